@@ -52,8 +52,8 @@ func AuthMiddleware(next http.Handler, jwtMgr *jwtutil.Manager) http.Handler {
 		authHeader := r.Header.Get("Authorization")
 		if token, found := strings.CutPrefix(authHeader, "Bearer "); found {
 			if jwtMgr != nil {
-				if _, err := jwtMgr.ValidateToken(token); err == nil {
-					next.ServeHTTP(w, r)
+				if t, err := jwtMgr.ValidateToken(token); err == nil {
+					next.ServeHTTP(w, r.WithContext(jwtutil.ContextWithToken(r.Context(), t)))
 					return
 				}
 			}
@@ -62,8 +62,8 @@ func AuthMiddleware(next http.Handler, jwtMgr *jwtutil.Manager) http.Handler {
 		// Check for token query parameter (for SSE endpoints)
 		tokenParam := r.URL.Query().Get("token")
 		if tokenParam != "" && jwtMgr != nil {
-			if _, err := jwtMgr.ValidateToken(tokenParam); err == nil {
-				next.ServeHTTP(w, r)
+			if t, err := jwtMgr.ValidateToken(tokenParam); err == nil {
+				next.ServeHTTP(w, r.WithContext(jwtutil.ContextWithToken(r.Context(), t)))
 				return
 			}
 		}
@@ -77,14 +77,30 @@ func AuthMiddleware(next http.Handler, jwtMgr *jwtutil.Manager) http.Handler {
 // checkCredentials validates the username and password against configuration.
 // Used by the /login endpoint.
 // Checks both main credentials and temporary funnel credentials if active.
-func checkCredentials(username, password string) bool {
+// The returned role is admin for the main credentials and viewer for the
+// temporary ones.
+func checkCredentials(username, password string) (role string, ok bool) {
 	// Check main credentials first
 	if username == c.Username && password == c.Password {
-		return true
+		return jwtutil.RoleAdmin, true
 	}
 	// Check temporary funnel credentials if active
 	if funnelCreds != nil && funnelCreds.Validate(username, password) {
-		return true
+		return jwtutil.RoleViewer, true
 	}
-	return false
+	return "", false
+}
+
+// requireRole only lets through requests authenticated with a token granting
+// role. It must be wrapped by AuthMiddleware, so requests are rejected when
+// authentication is disabled.
+func requireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := jwtutil.TokenFromContext(r.Context())
+		if !ok || token.Claims.Role != role {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
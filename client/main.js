@@ -11,6 +11,8 @@ if (DeviceModel === 'RemarkablePaperPro') {
 let flip = getBoolQueryParam('flip', defaultFlip);
 
 let rate = parseInt(getQueryParamOrDefault('rate', '200'), 10);
+// Replay the history from this time before going live (first connection only)
+let since = getQueryParam('since');
 
 // Use BGRA format flag from server (Paper Pro or RM2 firmware 3.24+)
 let useBGRA = UseBGRA;
@@ -121,6 +121,12 @@ async function initiateEventsListener() {
 		}
 	}
 
+	// Power state changes of the tablet (sleep, folio closed, wake up)
+	eventSource.addEventListener('power', (event) => {
+		const status = JSON.parse(event.data);
+		postMessage({ type: 'power', state: status.state, reason: status.reason });
+	});
+
 	eventSource.onerror = () => {
 		postMessage({
 			type: 'error',
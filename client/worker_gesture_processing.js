@@ -1,5 +1,3 @@
-// Constants for the maximum values from the WebSocket messages
-const SWIPE_DISTANCE = 200;
 let authToken = null;
 
 onmessage = (event) => {
@@ -9,6 +7,7 @@ onmessage = (event) => {
 		case 'init':
 			authToken = event.data.authToken || null;
 			fetchStream();
+			fetchCommands();
 			break;
 		case 'terminate':
 			console.log("terminating worker");
@@ -55,24 +54,65 @@ async function fetchStream() {
 }
 
 
+// fetchCommands listens to the commands sent by the server-side gesture
+// bindings (see RK_GESTURE_BINDINGS).
+async function fetchCommands() {
+	const fetchOptions = {};
+	if (authToken) {
+		fetchOptions.headers = {
+			'Authorization': `Bearer ${authToken}`
+		};
+	}
+	const response = await fetch('/commands', fetchOptions);
+
+	const reader = response.body.getReader();
+	const decoder = new TextDecoder('utf-8');
+	let buffer = '';
+
+	while (true) {
+		const { value, done } = await reader.read();
+		if (done) break;
+
+		buffer += decoder.decode(value, { stream: true });
+
+		while (buffer.includes('\n')) {
+			const index = buffer.indexOf('\n');
+			const jsonStr = buffer.slice(0, index);
+			buffer = buffer.slice(index + 1);
+
+			try {
+				const json = JSON.parse(jsonStr);
+				if (json.type === 'slide') {
+					postMessage({ type: 'gesture', value: json.value === 'next' ? 'right' : 'left' });
+				}
+			} catch (e) {
+				console.error('Error parsing JSON:', e);
+			}
+		}
+	}
+}
+
+// checkSwipeDirection maps the gestures recognized by the server to the
+// swipe names used by the presentation mode.
 function checkSwipeDirection(json) {
-	if (json.left > 400 && json.right < 100 && json.up < 100 && json.down < 100) {
-		return 'left';
-	} else if (json.right > 400 && json.left < 100 && json.up < 100 && json.down < 100) {
-		return 'right';
-	} else if (json.up > 400 && json.right < 100 && json.left < 100 && json.down < 100) {
-		return 'up';
-	} else if (json.down > 400 && json.right < 100 && json.up < 100 && json.left < 100) {
-		return 'down';
-	} else if (json.right > 600 && json.down > 600 && json.up < 50 && json.left < 50 ) {
-		return 'topright-to-bottomleft'
-	} else if (json.left > 600 && json.down > 600 && json.up < 50 && json.right < 50 ) {
-		return 'topleft-to-bottomright'
-	} else if (json.left > 600 && json.up > 600 && json.down < 50 && json.right < 50 ) {
-		return 'bottomleft-to-topright'
-	} else if (json.right > 600 && json.up > 600 && json.down < 50 && json.left < 50 ) {
-		return 'bottomright-to-topleft'
-	} else {
+	if (json.type !== 'swipe') {
 		return 'none';
 	}
+	switch (json.direction) {
+		case 'left':
+		case 'right':
+		case 'up':
+		case 'down':
+			return json.direction;
+		case 'down-right':
+			return 'topright-to-bottomleft';
+		case 'down-left':
+			return 'topleft-to-bottomright';
+		case 'up-left':
+			return 'bottomleft-to-topright';
+		case 'up-right':
+			return 'bottomright-to-topleft';
+		default:
+			return 'none';
+	}
 }
@@ -1,6 +1,7 @@
 let height;
 let width;
 let rate;
+let since;
 let authToken = null;
 
 // Delta decoding state
@@ -27,6 +28,7 @@ onmessage = (event) => {
 			height = event.data.height;
 			width = event.data.width;
 			rate = event.data.rate;
+			since = event.data.since || null;
 			authToken = event.data.authToken || null;
 			initiateStream();
 			break;
@@ -53,7 +55,11 @@ async function initiateStream() {
 			};
 		}
 
-		const response = await fetch('/stream?rate=' + rate, fetchOptions);
+		let url = '/stream?rate=' + rate;
+		if (since) {
+			url += '&since=' + encodeURIComponent(since);
+		}
+		const response = await fetch(url, fetchOptions);
 
 		// Handle rate limiting (429)
 		if (response.status === 429) {
@@ -121,8 +121,11 @@ function initStreamWorker() {
 		width: screenWidth,
 		height: screenHeight,
 		rate: rate,
+		since: since,
 		authToken: typeof getAuthToken === 'function' ? getAuthToken() : null,
 	});
+	// Reconnections go live directly
+	since = null;
 }
 
 // Initialize on load
@@ -224,6 +227,16 @@ eventWorker.onmessage = (event) => {
 			const Y = event.data.Y;
 			updateLaserPosition(X,Y);
 			break;
+		case 'power':
+			if (data.state === 'sleeping') {
+				messageDiv.style.display = '';
+				showStatusMessage('Device sleeping');
+				updateConnectionStatus(ConnectionState.PAUSED);
+			} else {
+				hideStatusMessage();
+				updateConnectionStatus(ConnectionState.CONNECTED);
+			}
+			break;
 		case 'error':
 			console.error('Error from event worker:', event.data.message);
 			eventWorkerConnected = false;
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/history"
+	"github.com/owulveryck/goMarkableStream/internal/journal"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+// grayPalette holds the 16 gray levels of the timelapse GIFs
+var grayPalette = func() color.Palette {
+	p := make(color.Palette, 16)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8(i * 17)}
+	}
+	return p
+}()
+
+// runExport renders the journal written with RK_JOURNAL_ENABLED as a
+// timelapse: an animated GIF, or a directory of PNG images.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", journal.DefaultConfig().Dir, "journal directory")
+	output := fs.String("o", "timelapse.gif", "output GIF file, or directory of PNG images with -format png")
+	format := fs.String("format", "gif", "output format: gif or png")
+	from := fs.String("from", "", "start time (RFC 3339, Unix milliseconds, or duration before now)")
+	to := fs.String("to", "", "end time (RFC 3339, Unix milliseconds, or duration before now)")
+	delay := fs.Duration("delay", 100*time.Millisecond, "delay between the frames of the GIF")
+	rotate := fs.Int("rotate", 0, "clockwise rotation in degrees")
+	scale := fs.Float64("scale", 0.5, "size factor of the frames, in (0, 1]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := stream.DefaultScreenshotOptions()
+	opts.Format = stream.FormatGray
+	opts.Rotate = ((*rotate % 360) + 360) % 360
+	opts.Scale = *scale
+	if opts.Rotate%90 != 0 || opts.Scale <= 0 || opts.Scale > 1 {
+		return errors.New("invalid rotation or scale")
+	}
+	var start, end time.Time
+	now := time.Now()
+	var err error
+	if *from != "" {
+		if start, err = history.ParseTime(*from, now); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if end, err = history.ParseTime(*to, now); err != nil {
+			return err
+		}
+	}
+
+	var out frameWriter
+	switch *format {
+	case "gif":
+		out = &gifWriter{name: *output, delay: max(int(*delay/(10*time.Millisecond)), 1)}
+	case "png":
+		if err := os.MkdirAll(*output, 0755); err != nil {
+			return err
+		}
+		out = &pngWriter{dir: *output}
+	default:
+		return fmt.Errorf("invalid format %q: must be gif or png", *format)
+	}
+
+	segments, err := journal.Segments(*dir)
+	if err != nil {
+		return err
+	}
+	frames := 0
+	for _, name := range segments {
+		seg, err := journal.OpenSegment(name)
+		if err != nil {
+			return err
+		}
+		g := seg.Geometry
+		for {
+			t, frame, err := seg.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				seg.Close()
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if (!start.IsZero() && t.Before(start)) || (!end.IsZero() && t.After(end)) {
+				continue
+			}
+			img, err := stream.RenderFrame(frame, g.Width, g.Height, g.BytesPerPixel, opts)
+			if err != nil {
+				seg.Close()
+				return err
+			}
+			if err := out.add(img.(*image.Gray)); err != nil {
+				seg.Close()
+				return err
+			}
+			frames++
+		}
+		seg.Close()
+	}
+	if frames == 0 {
+		return errors.New("no snapshot in the journal for this period")
+	}
+	if err := out.close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d frames from %d segments to %s\n", frames, len(segments), *output)
+	return nil
+}
+
+// frameWriter writes the frames of a timelapse
+type frameWriter interface {
+	add(img *image.Gray) error
+	close() error
+}
+
+// gifWriter writes an animated GIF with 16 gray levels. The frames are
+// written as they come, so that long journals fit in the memory of the
+// tablet: they must all have the size of the first one.
+type gifWriter struct {
+	name  string
+	delay int
+	f     *os.File
+	w     *bufio.Writer
+	rect  image.Rectangle
+}
+
+func (w *gifWriter) add(img *image.Gray) error {
+	if w.f == nil {
+		if err := w.start(img.Rect); err != nil {
+			return err
+		}
+	} else if img.Rect.Size() != w.rect.Size() {
+		return fmt.Errorf("frame of %v, want %v", img.Rect.Size(), w.rect.Size())
+	}
+	// Graphic control extension: the delay of the frame
+	w.w.Write([]byte{0x21, 0xf9, 0x04, 0x00})
+	binary.Write(w.w, binary.LittleEndian, uint16(w.delay))
+	w.w.Write([]byte{0x00, 0x00})
+	// Image descriptor, without local color table
+	w.w.WriteByte(0x2c)
+	binary.Write(w.w, binary.LittleEndian, [4]uint16{0, 0, uint16(w.rect.Dx()), uint16(w.rect.Dy())})
+	w.w.WriteByte(0x00)
+
+	// LZW-compressed indexes of the palette, in sub-blocks
+	w.w.WriteByte(gifCodeSize)
+	blocks := &gifBlockWriter{w: w.w}
+	lw := lzw.NewWriter(blocks, lzw.LSB, gifCodeSize)
+	row := make([]byte, w.rect.Dx())
+	for y := range w.rect.Dy() {
+		for x, v := range img.Pix[y*img.Stride : y*img.Stride+len(row)] {
+			row[x] = v >> 4
+		}
+		if _, err := lw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+	return blocks.close()
+}
+
+// gifCodeSize is the minimum LZW code size of the 16 gray levels
+const gifCodeSize = 4
+
+// start creates the file and writes the header, the gray palette and the
+// looping extension.
+func (w *gifWriter) start(rect image.Rectangle) error {
+	f, err := os.Create(w.name)
+	if err != nil {
+		return err
+	}
+	w.f, w.w, w.rect = f, bufio.NewWriter(f), rect
+	w.w.WriteString("GIF89a")
+	binary.Write(w.w, binary.LittleEndian, [2]uint16{uint16(rect.Dx()), uint16(rect.Dy())})
+	// Global color table of 16 colors, 8 bits per channel
+	w.w.Write([]byte{0xf3, 0x00, 0x00})
+	for _, c := range grayPalette {
+		y := c.(color.Gray).Y
+		w.w.Write([]byte{y, y, y})
+	}
+	// Loop forever
+	w.w.Write([]byte{0x21, 0xff, 0x0b})
+	w.w.WriteString("NETSCAPE2.0")
+	_, err = w.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	return err
+}
+
+func (w *gifWriter) close() error {
+	if w.f == nil {
+		return nil
+	}
+	w.w.WriteByte(0x3b)
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// gifBlockWriter splits the image data in sub-blocks of up to 255 bytes.
+type gifBlockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(b.buf[b.n:], p)
+		b.n += n
+		p = p[n:]
+		if b.n == len(b.buf) {
+			if err := b.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.w.WriteByte(byte(b.n))
+	_, err := b.w.Write(b.buf[:b.n])
+	b.n = 0
+	return err
+}
+
+// close writes the last sub-block and the block terminator.
+func (b *gifBlockWriter) close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	return b.w.WriteByte(0x00)
+}
+
+// pngWriter writes the frames as numbered PNG images.
+type pngWriter struct {
+	dir string
+	n   int
+}
+
+func (w *pngWriter) add(img *image.Gray) error {
+	w.n++
+	f, err := os.Create(filepath.Join(w.dir, fmt.Sprintf("frame-%05d.png", w.n)))
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (w *pngWriter) close() error {
+	return nil
+}
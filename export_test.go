@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGIFWriter(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "timelapse.gif")
+	w := &gifWriter{name: name, delay: 7}
+	for i := range 3 {
+		img := image.NewGray(image.Rect(0, 0, 300, 20))
+		for j := range img.Pix {
+			img.Pix[j] = byte(j*i) | 0x0f
+		}
+		if err := w.add(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.add(image.NewGray(image.Rect(0, 0, 10, 10))); err == nil {
+		t.Error("frame of another size accepted")
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || anim.Delay[2] != 7 || anim.LoopCount != 0 {
+		t.Fatalf("%d frames, delays %v, loop count %d", len(anim.Image), anim.Delay, anim.LoopCount)
+	}
+	for i, frame := range anim.Image {
+		for j, v := range frame.Pix {
+			if want := byte(j*i) >> 4; v != want {
+				t.Fatalf("frame %d: pixel %d = %d, want %d", i, j, v, want)
+			}
+		}
+	}
+}
@@ -14,13 +14,21 @@ import (
 	godebug "runtime/debug"
 	"strings"
 
+	"github.com/owulveryck/goMarkableStream/internal/actions"
+	"github.com/owulveryck/goMarkableStream/internal/capture"
 	"github.com/owulveryck/goMarkableStream/internal/delta"
 	internalDebug "github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/device"
 	"github.com/owulveryck/goMarkableStream/internal/eventhttphandler"
+	"github.com/owulveryck/goMarkableStream/internal/history"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
 	"github.com/owulveryck/goMarkableStream/internal/jwtutil"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/power"
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
 	"github.com/owulveryck/goMarkableStream/internal/remarkable"
 	"github.com/owulveryck/goMarkableStream/internal/stream"
+	"github.com/owulveryck/goMarkableStream/internal/strokes"
 	"github.com/owulveryck/goMarkableStream/internal/tlsutil"
 	"github.com/owulveryck/goMarkableStream/internal/trace"
 )
@@ -33,7 +41,7 @@ func (s stripFS) Open(name string) (http.File, error) {
 	return s.fs.Open("client" + name)
 }
 
-func setMuxer(eventPublisher *pubsub.PubSub, tm *TailscaleManager, restartCh chan<- bool, jwtMgr *jwtutil.Manager) *http.ServeMux {
+func setMuxer(eventPublisher *pubsub.PubSub, viewers *actions.Viewers, injector *inject.Injector, powerMonitor *power.Monitor, pageDetector *pagechange.Detector, frameHistory *history.Buffer, strokeRecorder *strokes.Recorder, tm *TailscaleManager, restartCh chan<- bool, jwtMgr *jwtutil.Manager) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Custom handler to serve index.html for root path
@@ -43,6 +51,21 @@ func setMuxer(eventPublisher *pubsub.PubSub, tm *TailscaleManager, restartCh cha
 	mux.HandleFunc("/login", handleLogin(jwtMgr))
 
 	streamHandler := stream.NewStreamHandler(file, pointerAddr, eventPublisher, c.DeltaThreshold)
+	streamHandler.SetPowerMonitor(powerMonitor)
+	streamHandler.SetDeltaWorkers(c.DeltaWorkers)
+	if pageDetector != nil {
+		streamHandler.SetChangeObserver(pageDetector)
+	}
+	// The rows of the legacy landscape layout do not follow the pen axis
+	if c.PartialReads && remarkable.Config.Height > remarkable.Config.Width {
+		streamHandler.SetPenAxis(inject.DefaultMapping().Pen.Y)
+	}
+	if frameHistory != nil {
+		streamHandler.SetHistory(frameHistory)
+		historyHandler := stream.NewHistoryHandler(frameHistory)
+		mux.Handle("/history", historyHandler)
+		mux.Handle("/history/frame", historyHandler)
+	}
 	mux.Handle("/stream", stream.ThrottlingMiddleware(streamHandler))
 
 	// Register idle callback to release memory when streaming ends
@@ -51,6 +74,9 @@ func setMuxer(eventPublisher *pubsub.PubSub, tm *TailscaleManager, restartCh cha
 		stream.ResetFrameBufferPool()
 		delta.ResetEncoderPool()
 		streamHandler.ReleaseMemory()
+		if frameHistory != nil {
+			frameHistory.ReleaseMemory()
+		}
 		// Force garbage collection and return memory to OS
 		runtime.GC()
 		godebug.FreeOSMemory()
@@ -58,13 +84,77 @@ func setMuxer(eventPublisher *pubsub.PubSub, tm *TailscaleManager, restartCh cha
 	})
 
 	wsHandler := eventhttphandler.NewEventHandler(eventPublisher)
+	wsHandler.SetPowerMonitor(powerMonitor)
+	if pageDetector != nil {
+		wsHandler.SetPageDetector(pageDetector)
+		mux.Handle("GET /pages/{page}", pageDetector)
+	}
 	mux.Handle("/events", wsHandler)
+	// Opt-in stream of the pen positions while drawing, for provisional ink
+	mux.Handle("/ink", eventhttphandler.NewInkHandler(eventPublisher, inject.DefaultMapping().Pen))
 	gestureHandler := eventhttphandler.NewGestureHandler(eventPublisher)
 	mux.Handle("/gestures", gestureHandler)
+	mux.Handle("/commands", eventhttphandler.NewCommandHandler(viewers))
+	// The keystrokes include the passwords typed, restricted to the device owner
+	if c.KeystrokeFeed {
+		mux.Handle("/keys", requireRole(jwtutil.RoleAdmin, eventhttphandler.NewKeyHandler(eventPublisher)))
+	}
+
+	// Remote control of the tablet, restricted to the device owner
+	if injector != nil {
+		limiter := inject.NewLimiter(c.InputRateLimit, max(int(c.InputRateLimit), 1))
+		inputHandler := eventhttphandler.NewInputHandler(injector, limiter, remarkable.Config.Width, remarkable.Config.Height)
+		mux.Handle("/input", requireRole(jwtutil.RoleAdmin, inputHandler))
+	}
 
 	screenshotHandler := stream.NewScreenshotHandler(file, pointerAddr)
 	mux.Handle("/screenshot", screenshotHandler)
 
+	// Capture sessions write files on the tablet, restricted to the device owner
+	captureManager := capture.NewManager(screenshotHandler, c.CaptureDir)
+	if pageDetector != nil {
+		captureManager.SetPageTurns(pageDetector.Topic())
+	}
+	mux.Handle("/capture/", requireRole(jwtutil.RoleAdmin, capture.NewHandler(captureManager)))
+
+	// The strokes hold the handwriting of all the sessions, restricted to the device owner
+	if strokeRecorder != nil {
+		strokesHandler := requireRole(jwtutil.RoleAdmin, strokes.NewHandler(strokeRecorder))
+		mux.Handle("/strokes", strokesHandler)
+		mux.Handle("/strokes/", strokesHandler)
+	}
+
+	// Delivery counters of the event bus subscribers
+	mux.Handle("/debug/pubsub", requireRole(jwtutil.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(eventPublisher.Stats()); err != nil {
+			log.Printf("failed to encode JSON response: %v", err)
+		}
+	})))
+
+	// Power state endpoint
+	mux.HandleFunc("/power", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(powerMonitor.Status()); err != nil {
+			log.Printf("failed to encode JSON response: %v", err)
+		}
+	})
+
+	// Device information endpoint. The network interfaces and the process
+	// are only disclosed to the device owner.
+	deviceInfo := device.NewCollector(device.DefaultConfig(), powerMonitor)
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		info := deviceInfo.Collect()
+		if token, ok := jwtutil.TokenFromContext(r.Context()); ok && token.Claims.Role != jwtutil.RoleAdmin {
+			info.Interfaces = nil
+			info.XochitlPID = 0
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			log.Printf("failed to encode JSON response: %v", err)
+		}
+	})
+
 	// Version endpoint
 	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
 		bi, ok := godebug.ReadBuildInfo()
@@ -231,7 +321,8 @@ func handleLogin(jwtMgr *jwtutil.Manager) http.HandlerFunc {
 		}
 
 		// Validate credentials
-		if !checkCredentials(req.Username, req.Password) {
+		role, ok := checkCredentials(req.Username, req.Password)
+		if !ok {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
@@ -239,7 +330,7 @@ func handleLogin(jwtMgr *jwtutil.Manager) http.HandlerFunc {
 		}
 
 		// Create JWT token
-		token, err := jwtMgr.CreateToken(req.Username)
+		token, err := jwtMgr.CreateTokenWithRole(req.Username, role)
 		if err != nil {
 			log.Printf("Failed to create JWT token: %v", err)
 			w.Header().Set("Content-Type", "application/json")
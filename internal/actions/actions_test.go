@@ -0,0 +1,244 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+func TestParseTrigger(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Trigger
+		wantErr bool
+	}{
+		{in: "tap", want: Trigger{Kind: gesture.KindTap}},
+		{in: "3-finger swipe left", want: Trigger{Kind: gesture.KindSwipe, Fingers: 3, Direction: gesture.DirectionLeft}},
+		{in: "2-finger Double-Tap", want: Trigger{Kind: gesture.KindDoubleTap, Fingers: 2}},
+		{in: "pinch in", want: Trigger{Kind: gesture.KindPinch, Direction: gesture.DirectionIn}},
+		{in: "edge-swipe down from top", want: Trigger{Kind: gesture.KindEdgeSwipe, Direction: gesture.DirectionDown, Zone: gesture.ZoneTop}},
+		{in: "long-press from top-right", want: Trigger{Kind: gesture.KindLongPress, Zone: gesture.ZoneTopRight}},
+		{in: "", wantErr: true},
+		{in: "x-finger tap", wantErr: true},
+		{in: "3-finger", wantErr: true},
+		{in: "wave", wantErr: true},
+		{in: "pinch left", wantErr: true},
+		{in: "tap left", wantErr: true},
+		{in: "swipe left from", wantErr: true},
+		{in: "swipe left from nowhere", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrigger(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTrigger(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseTrigger(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTriggerMatch(t *testing.T) {
+	g := gesture.Gesture{Kind: gesture.KindSwipe, Fingers: 3, Direction: gesture.DirectionLeft, StartZone: gesture.ZoneCenter}
+	tests := []struct {
+		trigger string
+		want    bool
+	}{
+		{"swipe", true},
+		{"3-finger swipe", true},
+		{"3-finger swipe left", true},
+		{"3-finger swipe left from center", true},
+		{"2-finger swipe left", false},
+		{"3-finger swipe right", false},
+		{"swipe left from left", false},
+		{"tap", false},
+	}
+	for _, tt := range tests {
+		trigger, err := ParseTrigger(tt.trigger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := trigger.Match(g); got != tt.want {
+			t.Errorf("%q.Match() = %v, want %v", tt.trigger, got, tt.want)
+		}
+	}
+}
+
+func TestParseBindings(t *testing.T) {
+	bindings, err := ParseBindings([]byte(`[
+		{"on": "3-finger swipe left", "action": "slide", "slide": "next"},
+		{"on": "long-press", "action": "screenshot"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bindings) != 2 {
+		t.Fatalf("got %d bindings, want 2", len(bindings))
+	}
+	if bindings[1].Dir != DefaultScreenshotDir {
+		t.Errorf("screenshot dir = %q, want default %q", bindings[1].Dir, DefaultScreenshotDir)
+	}
+
+	invalid := []string{
+		`not json`,
+		`[{"on": "swipe", "action": "webhook"}]`,
+		`[{"on": "swipe", "action": "command"}]`,
+		`[{"on": "swipe", "action": "slide", "slide": "sideways"}]`,
+		`[{"on": "swipe", "action": "dance"}]`,
+		`[{"on": "wave", "action": "pause"}]`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseBindings([]byte(data)); err == nil {
+			t.Errorf("ParseBindings(%s) succeeded, want error", data)
+		}
+	}
+}
+
+func TestLoadBindingsMissingFile(t *testing.T) {
+	if _, err := LoadBindings(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadBindings() on a missing file succeeded")
+	}
+}
+
+func TestRunWebhook(t *testing.T) {
+	received := make(chan gesture.Gesture, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var g gesture.Gesture
+		if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
+			t.Errorf("cannot decode webhook body: %v", err)
+		}
+		received <- g
+	}))
+	defer server.Close()
+
+	e := NewEngine(nil, Environment{})
+	b := Binding{Action: ActionWebhook, URL: server.URL}
+	g := gesture.Gesture{Kind: gesture.KindSwipe, Fingers: 3, Direction: gesture.DirectionLeft}
+	if err := e.Run(context.Background(), b, g); err != nil {
+		t.Fatal(err)
+	}
+	got := <-received
+	if got.Kind != g.Kind || got.Fingers != g.Fingers || got.Direction != g.Direction {
+		t.Errorf("webhook received %+v, want %+v", got, g)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := e.Run(context.Background(), Binding{Action: ActionWebhook, URL: failing.URL}, g); err == nil {
+		t.Error("webhook returning 500 did not fail")
+	}
+}
+
+func TestRunScreenshotAndPause(t *testing.T) {
+	paused := false
+	e := NewEngine(nil, Environment{
+		Screenshot: func(w io.Writer) error {
+			_, err := w.Write([]byte("png"))
+			return err
+		},
+		TogglePause: func() bool {
+			paused = !paused
+			return paused
+		},
+	})
+	dir := filepath.Join(t.TempDir(), "shots")
+	if err := e.Run(context.Background(), Binding{Action: ActionScreenshot, Dir: dir}, gesture.Gesture{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one screenshot in %s, got %v (%v)", dir, entries, err)
+	}
+
+	if err := e.Run(context.Background(), Binding{Action: ActionPause}, gesture.Gesture{}); err != nil {
+		t.Fatal(err)
+	}
+	if !paused {
+		t.Error("pause action did not toggle the pause")
+	}
+}
+
+func TestRunUnavailable(t *testing.T) {
+	e := NewEngine(nil, Environment{})
+	for _, b := range []Binding{
+		{Action: ActionPause},
+		{Action: ActionScreenshot, Dir: t.TempDir()},
+		{Action: ActionSlide, Slide: SlideNext},
+		{Action: "unknown"},
+	} {
+		if err := e.Run(context.Background(), b, gesture.Gesture{}); err == nil {
+			t.Errorf("Run(%s) without environment succeeded", b.Action)
+		}
+	}
+}
+
+// TestEngineSlideFromTouchEvents publishes a three finger swipe on the bus and
+// checks that the viewers receive the bound slide command.
+func TestEngineSlideFromTouchEvents(t *testing.T) {
+	bindings, err := ParseBindings([]byte(`[{"on": "3-finger swipe left", "action": "slide", "slide": "next"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewers := NewViewers()
+	commandC := viewers.Subscribe()
+	defer viewers.Unsubscribe(commandC)
+
+	e := NewEngine(bindings, Environment{Viewers: viewers})
+	e.config.MaxX, e.config.MaxY = 1403, 1871
+
+	ps := pubsub.NewPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.Start(ctx, ps)
+
+	publish := func(typ, code uint16, value int32) {
+		ps.Publish(events.InputEventFromSource{
+			Source: events.Touch,
+			InputEvent: events.InputEvent{
+				// The long-press detection compares the event time with the clock
+				Time: syscall.NsecToTimeval(time.Now().UnixNano()),
+				Type: typ, Code: code, Value: value,
+			},
+		})
+	}
+	for slot := int32(0); slot < 3; slot++ {
+		publish(events.EvAbs, gesture.AbsMtSlot, slot)
+		publish(events.EvAbs, gesture.AbsMtTrackingID, slot+1)
+		publish(events.EvAbs, gesture.AbsMtPositionX, 400+slot*200)
+		publish(events.EvAbs, gesture.AbsMtPositionY, 600)
+	}
+	publish(events.EvSyn, gesture.SynReport, 0)
+	for slot := int32(0); slot < 3; slot++ {
+		publish(events.EvAbs, gesture.AbsMtSlot, slot)
+		publish(events.EvAbs, gesture.AbsMtPositionY, 1200)
+	}
+	publish(events.EvSyn, gesture.SynReport, 0)
+	for slot := int32(0); slot < 3; slot++ {
+		publish(events.EvAbs, gesture.AbsMtSlot, slot)
+		publish(events.EvAbs, gesture.AbsMtTrackingID, -1)
+	}
+	publish(events.EvSyn, gesture.SynReport, 0)
+
+	select {
+	case cmd := <-commandC:
+		if cmd.Type != ActionSlide || cmd.Value != SlideNext {
+			t.Errorf("got command %+v, want slide next", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the slide command")
+	}
+}
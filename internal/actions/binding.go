@@ -0,0 +1,212 @@
+// Package actions binds touch gestures to server-side actions, so the tablet
+// can drive external tooling even when no browser is connected.
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+)
+
+// Action names
+const (
+	// ActionWebhook POSTs the gesture as JSON to URL
+	ActionWebhook = "webhook"
+	// ActionCommand runs Command on the tablet
+	ActionCommand = "command"
+	// ActionPause toggles the frame delivery of the streams
+	ActionPause = "pause"
+	// ActionScreenshot saves a PNG screenshot in Dir
+	ActionScreenshot = "screenshot"
+	// ActionSlide broadcasts a slide navigation command to the viewers
+	ActionSlide = "slide"
+)
+
+// Slide navigation commands
+const (
+	SlideNext     = "next"
+	SlidePrevious = "previous"
+)
+
+// DefaultScreenshotDir is where screenshots are saved when a binding has no Dir
+const DefaultScreenshotDir = "/home/root/screenshots"
+
+// Binding associates a gesture trigger to an action.
+//
+// Example of a bindings file:
+//
+//	[
+//	  {"on": "3-finger swipe left", "action": "slide", "slide": "next"},
+//	  {"on": "3-finger swipe right", "action": "slide", "slide": "previous"},
+//	  {"on": "2-finger double-tap", "action": "pause"},
+//	  {"on": "long-press from top-right", "action": "screenshot"},
+//	  {"on": "edge-swipe right from left", "action": "webhook", "url": "http://host/hook"},
+//	  {"on": "4-finger tap", "action": "command", "command": ["/home/root/bin/sync.sh"]}
+//	]
+type Binding struct {
+	On      string   `json:"on"`
+	Action  string   `json:"action"`
+	URL     string   `json:"url,omitempty"`
+	Command []string `json:"command,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	Slide   string   `json:"slide,omitempty"`
+
+	trigger Trigger
+}
+
+// Trigger describes the gestures matched by a binding. Zero values match
+// anything.
+type Trigger struct {
+	Kind      gesture.Kind
+	Fingers   int
+	Direction gesture.Direction
+	Zone      gesture.Zone
+}
+
+// ParseTrigger parses a trigger description of the form
+//
+//	[N-finger] kind [direction] [from zone]
+//
+// such as "3-finger swipe left", "double-tap", "pinch in" or
+// "edge-swipe down from top".
+func ParseTrigger(s string) (Trigger, error) {
+	var t Trigger
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return t, fmt.Errorf("empty trigger")
+	}
+	if n, found := strings.CutSuffix(fields[0], "-finger"); found {
+		fingers, err := strconv.Atoi(n)
+		if err != nil || fingers < 1 {
+			return t, fmt.Errorf("invalid finger count in %q", s)
+		}
+		t.Fingers = fingers
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return t, fmt.Errorf("missing gesture in %q", s)
+	}
+	switch k := gesture.Kind(fields[0]); k {
+	case gesture.KindTap, gesture.KindDoubleTap, gesture.KindLongPress,
+		gesture.KindSwipe, gesture.KindPinch, gesture.KindEdgeSwipe:
+		t.Kind = k
+	default:
+		return t, fmt.Errorf("unknown gesture %q in %q", fields[0], s)
+	}
+	fields = fields[1:]
+	if len(fields) > 0 && fields[0] != "from" {
+		t.Direction = gesture.Direction(fields[0])
+		if !validDirection(t.Kind, t.Direction) {
+			return t, fmt.Errorf("invalid direction %q for %s in %q", fields[0], t.Kind, s)
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		if fields[0] != "from" || len(fields) != 2 {
+			return t, fmt.Errorf("unexpected %q in %q", strings.Join(fields, " "), s)
+		}
+		t.Zone = gesture.Zone(fields[1])
+		if !validZone(t.Zone) {
+			return t, fmt.Errorf("unknown zone %q in %q", fields[1], s)
+		}
+	}
+	return t, nil
+}
+
+func validDirection(k gesture.Kind, d gesture.Direction) bool {
+	switch k {
+	case gesture.KindPinch:
+		return d == gesture.DirectionIn || d == gesture.DirectionOut
+	case gesture.KindSwipe, gesture.KindEdgeSwipe:
+		switch d {
+		case gesture.DirectionLeft, gesture.DirectionRight, gesture.DirectionUp, gesture.DirectionDown,
+			gesture.DirectionUpLeft, gesture.DirectionUpRight, gesture.DirectionDownLeft, gesture.DirectionDownRight:
+			return true
+		}
+	}
+	return false
+}
+
+func validZone(z gesture.Zone) bool {
+	switch z {
+	case gesture.ZoneCenter, gesture.ZoneLeft, gesture.ZoneRight, gesture.ZoneTop, gesture.ZoneBottom,
+		gesture.ZoneTopLeft, gesture.ZoneTopRight, gesture.ZoneBottomLeft, gesture.ZoneBottomRight:
+		return true
+	}
+	return false
+}
+
+// Match returns true if the gesture fulfills the trigger.
+func (t Trigger) Match(g gesture.Gesture) bool {
+	if t.Kind != g.Kind {
+		return false
+	}
+	if t.Fingers != 0 && t.Fingers != g.Fingers {
+		return false
+	}
+	if t.Direction != "" && t.Direction != g.Direction {
+		return false
+	}
+	if t.Zone != "" && t.Zone != g.StartZone {
+		return false
+	}
+	return true
+}
+
+// validate parses the trigger and checks the parameters of the action.
+func (b *Binding) validate() error {
+	t, err := ParseTrigger(b.On)
+	if err != nil {
+		return err
+	}
+	b.trigger = t
+	switch b.Action {
+	case ActionWebhook:
+		if b.URL == "" {
+			return fmt.Errorf("%q: webhook action requires an url", b.On)
+		}
+	case ActionCommand:
+		if len(b.Command) == 0 {
+			return fmt.Errorf("%q: command action requires a command", b.On)
+		}
+	case ActionPause:
+	case ActionScreenshot:
+		if b.Dir == "" {
+			b.Dir = DefaultScreenshotDir
+		}
+	case ActionSlide:
+		if b.Slide != SlideNext && b.Slide != SlidePrevious {
+			return fmt.Errorf("%q: slide must be %q or %q", b.On, SlideNext, SlidePrevious)
+		}
+	default:
+		return fmt.Errorf("%q: unknown action %q", b.On, b.Action)
+	}
+	return nil
+}
+
+// ParseBindings decodes and validates a JSON list of bindings.
+func ParseBindings(data []byte) ([]Binding, error) {
+	var bindings []Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("cannot decode bindings: %w", err)
+	}
+	for i := range bindings {
+		if err := bindings[i].validate(); err != nil {
+			return nil, fmt.Errorf("binding %d: %w", i, err)
+		}
+	}
+	return bindings, nil
+}
+
+// LoadBindings reads the bindings from a JSON file.
+func LoadBindings(path string) ([]Binding, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bindings: %w", err)
+	}
+	return ParseBindings(data)
+}
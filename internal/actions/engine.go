@@ -0,0 +1,207 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// actionTimeout bounds the duration of webhooks and commands
+const actionTimeout = 10 * time.Second
+
+// Environment holds what the actions operate on. Nil members disable the
+// corresponding actions.
+type Environment struct {
+	// Screenshot writes a PNG capture of the screen
+	Screenshot func(w io.Writer) error
+	// TogglePause flips the streaming pause and returns the new state
+	TogglePause func() bool
+	// Viewers receives the slide commands
+	Viewers *Viewers
+	// Client is used for the webhooks; http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Engine recognizes the gestures on the touch input and runs the bound actions.
+type Engine struct {
+	bindings []Binding
+	env      Environment
+	config   gesture.Config
+	now      func() time.Time
+}
+
+// NewEngine creates an engine for the bindings.
+func NewEngine(bindings []Binding, env Environment) *Engine {
+	if env.Client == nil {
+		env.Client = &http.Client{Timeout: actionTimeout}
+	}
+	return &Engine{
+		bindings: bindings,
+		env:      env,
+		config:   gesture.DefaultConfig(),
+		now:      time.Now,
+	}
+}
+
+// Start subscribes to the touch events and runs the engine until ctx is done.
+func (e *Engine) Start(ctx context.Context, ps *pubsub.PubSub) {
+	touchSource := events.Touch
+	// The engine must not delay the input reader: if it falls behind, the
+	// events are dropped and the tracker starts over on the SYN_DROPPED
+	// replacing them, rather than keeping a lost finger on the screen
+	eventC := ps.SubscribeWithOptions("actions", pubsub.Options{
+		Filter:     pubsub.EventFilter{Source: &touchSource},
+		BufferSize: 500,
+		Policy:     pubsub.DropOldest,
+		Resync:     true,
+	})
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		e.run(ctx, eventC)
+	}()
+}
+
+func (e *Engine) run(ctx context.Context, eventC <-chan events.InputEventFromSource) {
+	tracker := gesture.NewTracker()
+	recognizer := gesture.NewRecognizer(e.config)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			e.dispatch(ctx, recognizer.Tick(e.now()))
+		case event, ok := <-eventC:
+			if !ok {
+				return
+			}
+			if frame, ok := tracker.Process(event.InputEvent); ok {
+				e.dispatch(ctx, recognizer.Update(frame))
+			}
+		}
+	}
+}
+
+// dispatch runs the actions bound to the gestures. Actions run in their own
+// goroutine so a slow webhook does not delay the recognition.
+func (e *Engine) dispatch(ctx context.Context, gestures []gesture.Gesture) {
+	for _, g := range gestures {
+		for _, b := range e.bindings {
+			if !b.trigger.Match(g) {
+				continue
+			}
+			debug.Log("Actions: %s %s matched %q, running %s", g.Kind, g.Direction, b.On, b.Action)
+			go func(b Binding, g gesture.Gesture) {
+				if err := e.Run(ctx, b, g); err != nil {
+					log.Printf("action %s bound to %q failed: %v", b.Action, b.On, err)
+				}
+			}(b, g)
+		}
+	}
+}
+
+// Run executes the action of the binding for gesture g.
+func (e *Engine) Run(ctx context.Context, b Binding, g gesture.Gesture) error {
+	switch b.Action {
+	case ActionWebhook:
+		return e.webhook(ctx, b.URL, g)
+	case ActionCommand:
+		return e.command(ctx, b.Command, g)
+	case ActionPause:
+		if e.env.TogglePause == nil {
+			return fmt.Errorf("pause is not available")
+		}
+		log.Printf("streaming paused: %v", e.env.TogglePause())
+		return nil
+	case ActionScreenshot:
+		return e.screenshot(b.Dir)
+	case ActionSlide:
+		if e.env.Viewers == nil {
+			return fmt.Errorf("no viewers")
+		}
+		n := e.env.Viewers.Broadcast(Command{Type: ActionSlide, Value: b.Slide})
+		debug.Log("Actions: slide %s sent to %d viewers", b.Slide, n)
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", b.Action)
+}
+
+func (e *Engine) webhook(ctx context.Context, url string, g gesture.Gesture) error {
+	body, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.env.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// command runs the command with the gesture described in the environment
+// (GESTURE_TYPE, GESTURE_FINGERS, GESTURE_DIRECTION, GESTURE_ZONE).
+func (e *Engine) command(ctx context.Context, args []string, g gesture.Gesture) error {
+	ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"GESTURE_TYPE="+string(g.Kind),
+		"GESTURE_FINGERS="+strconv.Itoa(g.Fingers),
+		"GESTURE_DIRECTION="+string(g.Direction),
+		"GESTURE_ZONE="+string(g.StartZone),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (e *Engine) screenshot(dir string) error {
+	if e.env.Screenshot == nil {
+		return fmt.Errorf("screenshots are not available")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create screenshot directory: %w", err)
+	}
+	name := filepath.Join(dir, "remarkable_"+e.now().Format("20060102_150405.000")+".png")
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := e.env.Screenshot(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	log.Printf("screenshot saved to %s", name)
+	return f.Close()
+}
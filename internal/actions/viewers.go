@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"sync"
+
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+)
+
+// Command is a message sent to the connected viewers.
+type Command struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Viewers broadcasts commands to the connected browsers.
+type Viewers struct {
+	mu          sync.RWMutex
+	subscribers map[chan Command]struct{}
+}
+
+// NewViewers creates an empty broadcaster.
+func NewViewers() *Viewers {
+	return &Viewers{
+		subscribers: make(map[chan Command]struct{}),
+	}
+}
+
+// Subscribe registers a new viewer.
+func (v *Viewers) Subscribe() chan Command {
+	ch := make(chan Command, 16)
+	v.mu.Lock()
+	v.subscribers[ch] = struct{}{}
+	debug.Log("Viewers: new subscriber, total=%d", len(v.subscribers))
+	v.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes a viewer and closes its channel.
+func (v *Viewers) Unsubscribe(ch chan Command) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.subscribers[ch]; ok {
+		delete(v.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Broadcast sends cmd to every viewer. Slow viewers miss the command.
+// It returns the number of viewers reached.
+func (v *Viewers) Broadcast(cmd Command) int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	sent := 0
+	for ch := range v.subscribers {
+		select {
+		case ch <- cmd:
+			sent++
+		default:
+		}
+	}
+	return sent
+}
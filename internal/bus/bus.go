@@ -0,0 +1,200 @@
+// Package bus is a typed, topic-based publish/subscribe event bus.
+//
+// Each topic carries one type of value. The topic names are paths
+// separated by slashes, such as "input/pen". A subscription names a topic,
+// or a pattern ending with "*" matching all the topics of its type under
+// a prefix: "input/*" gets the events of all the input devices, including
+// the topics created after the subscription, and "*" all the topics of
+// its type.
+//
+// Publishing reads an immutable snapshot of the subscribers of the topic,
+// replaced on each subscription, without taking the lock of the bus. The
+// value is then delivered to each subscription according to its Policy,
+// under the lock of the subscription: a Block subscription holds it while
+// it waits for room.
+package bus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Bus holds the topics and the subscriptions.
+type Bus struct {
+	mu     sync.Mutex // Serializes the topic creations and the subscriptions
+	topics map[string]topicRef
+	// patterns are the wildcard subscriptions, attached to the topics
+	// created later
+	patterns []patternSub
+	// subscriptions are all the subscriptions, for Stats
+	subscriptions []statser
+}
+
+// topicRef is a *Topic[T] of any type
+type topicRef interface {
+	topicName() string
+}
+
+// patternSub is a *Subscription[T] of any type with its pattern
+type patternSub struct {
+	pattern string
+	sub     interface{ attachTo(t topicRef) bool }
+}
+
+type statser interface {
+	stats() Stats
+}
+
+// New creates an empty bus.
+func New() *Bus {
+	return &Bus{
+		topics: make(map[string]topicRef),
+	}
+}
+
+// Topic carries the values of type T published under a name.
+type Topic[T any] struct {
+	name string
+	bus  *Bus
+	// snapshot holds the subscriptions by decreasing priority
+	snapshot atomic.Pointer[[]*Subscription[T]]
+}
+
+// NewTopic returns the topic of the given name, creating it if needed. It
+// panics if the topic exists with another type.
+func NewTopic[T any](b *Bus, name string) *Topic[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ref, ok := b.topics[name]; ok {
+		t, ok := ref.(*Topic[T])
+		if !ok {
+			panic(fmt.Sprintf("bus: topic %q exists with type %T", name, ref))
+		}
+		return t
+	}
+	t := &Topic[T]{name: name, bus: b}
+	t.snapshot.Store(&[]*Subscription[T]{})
+	b.topics[name] = t
+	for _, p := range b.patterns {
+		if Match(p.pattern, name) {
+			p.sub.attachTo(t)
+		}
+	}
+	return t
+}
+
+// Name returns the name of the topic.
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+func (t *Topic[T]) topicName() string {
+	return t.name
+}
+
+// Subscribers returns the number of subscriptions of the topic.
+func (t *Topic[T]) Subscribers() int {
+	return len(*t.snapshot.Load())
+}
+
+// Publish sends a value to the subscribers of the topic.
+func (t *Topic[T]) Publish(v T) int {
+	subs := *t.snapshot.Load()
+	matched := 0
+	for _, sub := range subs {
+		if sub.opts.Filter != nil && !sub.opts.Filter(v) {
+			continue
+		}
+		sub.deliver(v)
+		matched++
+	}
+	return matched
+}
+
+// Subscribe subscribes to the topic.
+func (t *Topic[T]) Subscribe(name string, opts Options[T]) *Subscription[T] {
+	sub := newSubscription(t.bus, name, opts)
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	sub.attachTo(t)
+	t.bus.subscriptions = append(t.bus.subscriptions, sub)
+	return sub
+}
+
+// Subscribe subscribes to the topics of type T matching the pattern.
+func Subscribe[T any](b *Bus, pattern, name string, opts Options[T]) *Subscription[T] {
+	sub := newSubscription(b, name, opts)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for topic, ref := range b.topics {
+		if Match(pattern, topic) {
+			sub.attachTo(ref)
+		}
+	}
+	b.patterns = append(b.patterns, patternSub{pattern: pattern, sub: sub})
+	b.subscriptions = append(b.subscriptions, sub)
+	return sub
+}
+
+// Match reports whether a topic name matches a subscription pattern.
+func Match(pattern, topic string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(topic, prefix)
+	}
+	return pattern == topic
+}
+
+// attachTo adds the subscription to a topic of its type. It must be called
+// with the lock of the bus held.
+func (s *Subscription[T]) attachTo(ref topicRef) bool {
+	t, ok := ref.(*Topic[T])
+	if !ok {
+		return false
+	}
+	subs := append(slices.Clone(*t.snapshot.Load()), s)
+	slices.SortStableFunc(subs, func(a, b *Subscription[T]) int {
+		return b.opts.Priority - a.opts.Priority
+	})
+	t.snapshot.Store(&subs)
+	s.topics = append(s.topics, t)
+	return true
+}
+
+// detach removes the subscription from its topics and patterns. It must be
+// called with the lock of the bus held.
+func (s *Subscription[T]) detach() bool {
+	i := slices.IndexFunc(s.bus.subscriptions, func(sub statser) bool { return sub == statser(s) })
+	if i < 0 {
+		return false
+	}
+	s.bus.subscriptions = slices.Delete(s.bus.subscriptions, i, i+1)
+	s.bus.patterns = slices.DeleteFunc(s.bus.patterns, func(p patternSub) bool {
+		return p.sub == any(s)
+	})
+	for _, t := range s.topics {
+		subs := slices.DeleteFunc(slices.Clone(*t.snapshot.Load()), func(sub *Subscription[T]) bool {
+			return sub == s
+		})
+		t.snapshot.Store(&subs)
+	}
+	s.topics = nil
+	return true
+}
+
+// Stats returns the delivery counters of the subscriptions, by decreasing
+// priority.
+func (b *Bus) Stats() []Stats {
+	b.mu.Lock()
+	stats := make([]Stats, len(b.subscriptions))
+	for i, sub := range b.subscriptions {
+		stats[i] = sub.stats()
+	}
+	b.mu.Unlock()
+	slices.SortStableFunc(stats, func(a, b Stats) int {
+		return b.Priority - a.Priority
+	})
+	return stats
+}
@@ -0,0 +1,243 @@
+package bus
+
+import (
+	"testing"
+	"time"
+)
+
+type penMove struct {
+	X, Y int
+}
+
+// receive reads the values available on a subscription
+func receive[T any](sub *Subscription[T]) []T {
+	var values []T
+	for {
+		select {
+		case v, ok := <-sub.C:
+			if !ok {
+				return values
+			}
+			values = append(values, v)
+		case <-time.After(50 * time.Millisecond):
+			return values
+		}
+	}
+}
+
+// TestTypedTopics tests that the values are delivered to the subscribers
+// of their topic only
+func TestTypedTopics(t *testing.T) {
+	b := New()
+	pen := NewTopic[penMove](b, "input/pen")
+	status := NewTopic[string](b, "status")
+
+	penSub := pen.Subscribe("pen", Options[penMove]{})
+	statusSub := status.Subscribe("status", Options[string]{})
+
+	if n := pen.Publish(penMove{X: 1, Y: 2}); n != 1 {
+		t.Errorf("Expected 1 subscriber, got %d", n)
+	}
+	status.Publish("ready")
+
+	if got := receive(penSub); len(got) != 1 || got[0] != (penMove{X: 1, Y: 2}) {
+		t.Errorf("Unexpected pen values: %v", got)
+	}
+	if got := receive(statusSub); len(got) != 1 || got[0] != "ready" {
+		t.Errorf("Unexpected status values: %v", got)
+	}
+
+	if NewTopic[penMove](b, "input/pen") != pen {
+		t.Error("Expected NewTopic to return the existing topic")
+	}
+}
+
+// TestTopicTypeMismatch tests that a topic cannot be reused with another type
+func TestTopicTypeMismatch(t *testing.T) {
+	b := New()
+	NewTopic[penMove](b, "input/pen")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic")
+		}
+	}()
+	NewTopic[string](b, "input/pen")
+}
+
+// TestWildcard tests the pattern subscriptions, including the topics
+// created after the subscription and the topics of another type
+func TestWildcard(t *testing.T) {
+	b := New()
+	pen := NewTopic[penMove](b, "input/pen")
+	NewTopic[string](b, "input/name")
+	NewTopic[penMove](b, "output/pen")
+
+	sub := Subscribe(b, "input/*", "all", Options[penMove]{})
+	touch := NewTopic[penMove](b, "input/touch")
+
+	pen.Publish(penMove{X: 1})
+	touch.Publish(penMove{X: 2})
+	NewTopic[penMove](b, "output/pen").Publish(penMove{X: 3})
+	NewTopic[string](b, "input/name").Publish("ignored")
+
+	got := receive(sub)
+	if len(got) != 2 || got[0].X != 1 || got[1].X != 2 {
+		t.Errorf("Expected the values of input/pen and input/touch, got %v", got)
+	}
+
+	sub.Close()
+	if n := NewTopic[penMove](b, "input/keyboard").Publish(penMove{}); n != 0 {
+		t.Errorf("Expected no subscriber after Close, got %d", n)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"input/pen", "input/pen", true},
+		{"input/pen", "input/touch", false},
+		{"input/*", "input/pen", true},
+		{"input/*", "output/pen", false},
+		{"*", "input/pen", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// TestPolicies tests which values a full subscription keeps
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		policy    Policy
+		want      []int
+		delivered uint64
+		dropped   uint64
+	}{
+		{DropNewest, []int{0, 1}, 2, 3},
+		{DropOldest, []int{3, 4}, 5, 3},
+		{Block, []int{0, 1}, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			b := New()
+			topic := NewTopic[int](b, "counter")
+			sub := topic.Subscribe("slow", Options[int]{
+				BufferSize: 2,
+				Policy:     tt.policy,
+				Timeout:    time.Millisecond,
+			})
+			for i := range 5 {
+				topic.Publish(i)
+			}
+			if st := b.Stats()[0]; st.Dropped != tt.dropped || st.Delivered != tt.delivered {
+				t.Errorf("Unexpected stats: %+v", st)
+			}
+			got := receive(sub)
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestOverflow tests that the values dropped are replaced by the overflow
+// marker
+func TestOverflow(t *testing.T) {
+	b := New()
+	topic := NewTopic[int](b, "counter")
+	sub := topic.Subscribe("slow", Options[int]{
+		BufferSize: 3,
+		Policy:     DropOldest,
+		Overflow:   func() int { return -1 },
+	})
+	for i := range 5 {
+		topic.Publish(i)
+	}
+
+	// 0, 1, 2 fill the channel, 3 overflows, 4 fits
+	want := []int{-1, 3, 4}
+	got := receive(sub)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if st := b.Stats()[0]; st.Dropped != 3 || st.Delivered != 5 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+}
+
+// TestCoalesceLatestByKey tests that only the latest value of each key is
+// kept for a late subscriber
+func TestCoalesceLatestByKey(t *testing.T) {
+	b := New()
+	topic := NewTopic[penMove](b, "input/pen")
+	sub := topic.Subscribe("late", Options[penMove]{
+		BufferSize: 1,
+		Policy:     CoalesceLatest,
+		Key:        func(m penMove) uint64 { return uint64(m.Y) },
+	})
+
+	for x := range 10 {
+		topic.Publish(penMove{X: x, Y: x % 2})
+	}
+
+	latest := map[int]int{}
+	for _, m := range receive(sub) {
+		latest[m.Y] = m.X
+	}
+	if latest[0] != 8 || latest[1] != 9 {
+		t.Errorf("Expected the latest value of each key, got %v", latest)
+	}
+}
+
+// TestPriority tests that the subscriptions of higher priority are listed
+// and served first
+func TestPriority(t *testing.T) {
+	b := New()
+	topic := NewTopic[int](b, "counter")
+	topic.Subscribe("slow", Options[int]{BufferSize: 1, Policy: Block, Timeout: 20 * time.Millisecond, Priority: -1})
+	fast := topic.Subscribe("fast", Options[int]{Priority: 1})
+
+	start := time.Now()
+	topic.Publish(1)
+	topic.Publish(2) // Blocks on slow, after fast got it
+	select {
+	case <-fast.C:
+	default:
+		t.Fatal("Expected fast to get the value before slow blocks")
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("Expected the second publish to wait for slow")
+	}
+
+	stats := b.Stats()
+	if len(stats) != 2 || stats[0].Name != "fast" || stats[1].Name != "slow" {
+		t.Errorf("Unexpected stats order: %+v", stats)
+	}
+}
+
+// TestCloseTwice tests that closing a subscription twice doesn't panic
+func TestCloseTwice(t *testing.T) {
+	b := New()
+	topic := NewTopic[int](b, "counter")
+	sub := topic.Subscribe("test", Options[int]{})
+	if n := topic.Subscribers(); n != 1 {
+		t.Errorf("Expected 1 subscriber, got %d", n)
+	}
+	sub.Close()
+	sub.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected the channel to be closed")
+	}
+	if n := topic.Publish(1); n != 0 || topic.Subscribers() != 0 {
+		t.Errorf("Expected no subscriber, got %d", n)
+	}
+	if len(b.Stats()) != 0 {
+		t.Error("Expected no stats after Close")
+	}
+}
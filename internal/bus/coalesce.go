@@ -0,0 +1,121 @@
+package bus
+
+import "sync"
+
+// queued is a value waiting in a coalescer
+type queued[T any] struct {
+	v T
+	// version changes when the value is replaced
+	version uint64
+}
+
+// coalescer queues the values of a CoalesceLatest subscription and sends
+// them to its channel from its own goroutine. A queued value is replaced
+// by the next one of the same key, keeping its place in the queue.
+type coalescer[T any] struct {
+	sub *Subscription[T]
+
+	mu      sync.Mutex
+	keys    []uint64
+	latest  map[uint64]queued[T]
+	version uint64
+
+	wake   chan struct{}
+	done   chan struct{}
+	exited chan struct{}
+}
+
+func newCoalescer[T any](sub *Subscription[T]) *coalescer[T] {
+	q := &coalescer[T]{
+		sub:    sub,
+		latest: make(map[uint64]queued[T]),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// push queues a value, replacing the queued value of the same key.
+func (q *coalescer[T]) push(v T) {
+	var k uint64
+	if q.sub.opts.Key != nil {
+		k = q.sub.opts.Key(v)
+	}
+	q.mu.Lock()
+	if _, ok := q.latest[k]; ok {
+		q.sub.dropped.Add(1)
+	} else {
+		q.keys = append(q.keys, k)
+	}
+	q.version++
+	q.latest[k] = queued[T]{v: v, version: q.version}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// front returns the first value of the queue.
+func (q *coalescer[T]) front() (queued[T], uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.keys) == 0 {
+		return queued[T]{}, 0, false
+	}
+	k := q.keys[0]
+	return q.latest[k], k, true
+}
+
+// sent removes the value sent from the queue, unless it was replaced in
+// the meantime.
+func (q *coalescer[T]) sent(k uint64, version uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.keys) > 0 && q.keys[0] == k && q.latest[k].version == version {
+		q.keys = q.keys[1:]
+		delete(q.latest, k)
+	}
+}
+
+func (q *coalescer[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.keys)
+}
+
+// run sends the queued values until stop is called. The first value
+// stays in the queue while the channel is full, so that it can still be
+// replaced.
+func (q *coalescer[T]) run() {
+	defer close(q.exited)
+	for {
+		item, k, ok := q.front()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+		select {
+		case q.sub.C <- item.v:
+			q.sub.delivered.Add(1)
+			q.sent(k, item.version)
+		case <-q.wake:
+			// The queue changed: send the latest value
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// stop ends the goroutine of the queue. The channel of the subscription
+// can be closed once it returns.
+func (q *coalescer[T]) stop() {
+	close(q.done)
+	<-q.exited
+}
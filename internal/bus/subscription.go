@@ -0,0 +1,226 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBufferSize is the size of the channel of a subscription
+	DefaultBufferSize = 100
+	// DefaultTimeout is how long Publish waits for a Block subscription
+	DefaultTimeout = 100 * time.Millisecond
+)
+
+// Policy is what Publish does when the channel of a subscription is full.
+type Policy int
+
+const (
+	// DropNewest drops the value being published (default)
+	DropNewest Policy = iota
+	// DropOldest drops the oldest value of the channel to make room
+	DropOldest
+	// Block waits up to the timeout of the subscription for room in the
+	// channel, then drops the value. The publisher waits with it, delaying
+	// the next values for all the subscriptions: it only suits the local
+	// subscribers that never stall (see Options.Priority).
+	Block
+	// CoalesceLatest queues the values the subscriber is late on, keeping
+	// only the latest one of each key (see Options.Key). It suits the
+	// values describing a state, such as the position of the pen.
+	CoalesceLatest
+)
+
+// String returns the name of the policy
+func (p Policy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case CoalesceLatest:
+		return "coalesce-latest"
+	}
+	return "unknown"
+}
+
+// Options configure a subscription.
+type Options[T any] struct {
+	// Filter selects the values delivered, all of them if nil
+	Filter func(T) bool
+	// BufferSize is the size of the channel, DefaultBufferSize if 0
+	BufferSize int
+	// Policy applies when the channel is full
+	Policy Policy
+	// Timeout is the maximum wait of the Block policy, DefaultTimeout if 0
+	Timeout time.Duration
+	// Priority orders the deliveries of a value: the subscriptions of
+	// higher priority get it before the Block subscriptions of lower
+	// priority wait for room. The wait still delays the next values.
+	Priority int
+	// Key identifies the values replacing each other with CoalesceLatest;
+	// if nil, a value replaces any queued one
+	Key func(T) uint64
+	// Overflow, with DropOldest, marks the values dropped: when the channel
+	// is full, it is emptied and the value returned by Overflow is queued
+	// before the new one, as the kernel does with SYN_DROPPED
+	Overflow func() T
+}
+
+// Stats are the delivery counters of a subscription.
+type Stats struct {
+	Name      string `json:"name"`
+	Policy    string `json:"policy"`
+	Priority  int    `json:"priority"`
+	Buffer    int    `json:"buffer"`
+	Queued    int    `json:"queued"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// Subscription receives the values of one or more topics on C.
+type Subscription[T any] struct {
+	// C receives the values. It is closed by Close.
+	C chan T
+
+	name   string
+	opts   Options[T]
+	bus    *Bus
+	topics []*Topic[T]
+
+	// mu serializes the deliveries with the close of the channel
+	mu     sync.Mutex
+	closed bool
+	queue  *coalescer[T]
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func newSubscription[T any](b *Bus, name string, opts Options[T]) *Subscription[T] {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	s := &Subscription[T]{
+		C:    make(chan T, opts.BufferSize),
+		name: name,
+		opts: opts,
+		bus:  b,
+	}
+	if opts.Policy == CoalesceLatest {
+		s.queue = newCoalescer(s)
+	}
+	return s
+}
+
+// Close ends the subscription and closes C. It is safe to call it more
+// than once.
+func (s *Subscription[T]) Close() {
+	s.bus.mu.Lock()
+	ok := s.detach()
+	s.bus.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Wait for the delivery in progress, if any
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.queue != nil {
+		s.queue.stop()
+	}
+	close(s.C) // Close the channel to signal subscriber to exit.
+}
+
+// deliver sends the value according to the policy of the subscription
+func (s *Subscription[T]) deliver(v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.queue != nil {
+		// The queue sends the values in order
+		s.queue.push(v)
+		return
+	}
+	select {
+	case s.C <- v:
+		// Successfully sent
+		s.delivered.Add(1)
+		return
+	default:
+	}
+
+	// Channel full - subscriber is slow
+	switch s.opts.Policy {
+	case DropOldest:
+		if s.opts.Overflow != nil && cap(s.C) > 1 {
+			// Only the publisher sends on the channel, under s.mu: the
+			// room made stays free
+			for len(s.C) > 0 {
+				select {
+				case <-s.C:
+					s.dropped.Add(1)
+				default:
+				}
+			}
+			s.C <- s.opts.Overflow()
+			s.C <- v
+			s.delivered.Add(1)
+			return
+		}
+		for {
+			select {
+			case <-s.C:
+				s.dropped.Add(1)
+			default:
+			}
+			select {
+			case s.C <- v:
+				s.delivered.Add(1)
+				return
+			default:
+			}
+		}
+	case Block:
+		timer := time.NewTimer(s.opts.Timeout)
+		defer timer.Stop()
+		select {
+		case s.C <- v:
+			s.delivered.Add(1)
+		case <-timer.C:
+			s.dropped.Add(1)
+		}
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Stats returns the delivery counters of the subscription.
+func (s *Subscription[T]) Stats() Stats {
+	return s.stats()
+}
+
+func (s *Subscription[T]) stats() Stats {
+	st := Stats{
+		Name:      s.name,
+		Policy:    s.opts.Policy.String(),
+		Priority:  s.opts.Priority,
+		Buffer:    cap(s.C),
+		Queued:    len(s.C),
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+	if s.queue != nil {
+		st.Queued += s.queue.len()
+	}
+	return st
+}
@@ -0,0 +1,35 @@
+package capture
+
+import (
+	"context"
+	"log"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+// watch captures the final state of the previous page on each page turn,
+// until ctx is canceled.
+func (m *Manager) watch(ctx context.Context, s *session, sub *bus.Subscription[pagechange.Event]) {
+	defer close(s.done)
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			img, err := stream.RenderGray(ev.Previous, s.opts.Screenshot)
+			if err != nil {
+				log.Printf("capture: cannot render page: %v", err)
+				continue
+			}
+			if _, _, err := s.add(img, ev.Hash, ev.Time, true); err != nil {
+				log.Printf("capture: cannot save page: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package capture records the pages written on the tablet during a session
+// and assembles them into a PDF.
+//
+// A session saves each captured page as a PNG file in its own directory.
+// Finishing the session writes the pages into one PDF next to it and
+// removes the directory. If the PDF cannot be written, the session keeps
+// running so that it can be finished again.
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/pdf"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+var (
+	// ErrActive is returned when starting a session while another one runs
+	ErrActive = errors.New("a capture session is already running")
+	// ErrNoSession is returned when no session is running
+	ErrNoSession = errors.New("no capture session is running")
+	// ErrNoPages is returned when finishing a session without pages
+	ErrNoPages = errors.New("no page was captured")
+	// ErrNoDetection is returned when starting an automatic capture
+	// without page change detection
+	ErrNoDetection = errors.New("page change detection is disabled")
+)
+
+// Screen renders the screen of the tablet. The hash identifies the content
+// of the screen; it is implemented by stream.ScreenshotHandler.
+type Screen interface {
+	Snapshot(opts stream.ScreenshotOptions) (image.Image, uint64, error)
+}
+
+// Options configure a session.
+type Options struct {
+	// Screenshot are the rotation, crop, trim and scale of the pages. The
+	// pages are always gray.
+	Screenshot stream.ScreenshotOptions
+	// Auto captures the previous page when a page turn is detected
+	Auto bool
+}
+
+// Page is a page of a session.
+type Page struct {
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	Hash   string    `json:"hash"`
+	Auto   bool      `json:"auto,omitempty"`
+	file   string
+}
+
+// Status describes the running session.
+type Status struct {
+	ID      string    `json:"id"`
+	Started time.Time `json:"started"`
+	Auto    bool      `json:"auto"`
+	Pages   []Page    `json:"pages"`
+}
+
+// session is a running capture session
+type session struct {
+	id      string
+	started time.Time
+	dir     string
+	opts    Options
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	pages  []Page
+	hashes map[uint64]bool
+}
+
+// Manager runs one capture session at a time.
+type Manager struct {
+	screen Screen
+	pages  *bus.Topic[pagechange.Event]
+	dir    string
+	now    func() time.Time
+
+	mu      sync.Mutex
+	session *session
+}
+
+// NewManager creates a manager saving the sessions in dir.
+func NewManager(screen Screen, dir string) *Manager {
+	return &Manager{
+		screen: screen,
+		dir:    dir,
+		now:    time.Now,
+	}
+}
+
+// SetPageTurns enables the automatic capture on the page turns published on
+// the topic of a pagechange.Detector.
+func (m *Manager) SetPageTurns(t *bus.Topic[pagechange.Event]) {
+	m.pages = t
+}
+
+// Start begins a new session.
+func (m *Manager) Start(opts Options) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session != nil {
+		return Status{}, ErrActive
+	}
+	if opts.Auto && m.pages == nil {
+		return Status{}, ErrNoDetection
+	}
+	opts.Screenshot.Format = stream.FormatGray
+	if opts.Screenshot.Scale <= 0 {
+		opts.Screenshot.Scale = 1
+	}
+
+	now := m.now()
+	id, dir, err := m.newSessionDir(now)
+	if err != nil {
+		return Status{}, fmt.Errorf("cannot create capture directory: %w", err)
+	}
+	s := &session{
+		id:      id,
+		started: now,
+		dir:     dir,
+		opts:    opts,
+		hashes:  make(map[uint64]bool),
+	}
+	if opts.Auto {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stop = cancel
+		s.done = make(chan struct{})
+		go m.watch(ctx, s, m.pages.Subscribe("capture", bus.Options[pagechange.Event]{BufferSize: 8}))
+	}
+	m.session = s
+	log.Printf("capture session %s started", id)
+	return s.status(), nil
+}
+
+// newSessionDir creates the directory of a session started at now. The id
+// has a millisecond resolution, and gets a suffix if a session of the same
+// id exists.
+func (m *Manager) newSessionDir(now time.Time) (string, string, error) {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return "", "", err
+	}
+	base := fmt.Sprintf("%s_%03d", now.Format("20060102_150405"), now.Nanosecond()/int(time.Millisecond))
+	id := base
+	for n := 2; ; n++ {
+		dir := filepath.Join(m.dir, id)
+		if _, err := os.Stat(dir + ".pdf"); os.IsNotExist(err) {
+			err := os.Mkdir(dir, 0755)
+			if err == nil {
+				return id, dir, nil
+			}
+			if !os.IsExist(err) {
+				return "", "", err
+			}
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// Capture saves the current page. It returns false if the page was
+// already captured in the session.
+func (m *Manager) Capture() (Page, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return Page{}, false, ErrNoSession
+	}
+	img, hash, err := m.screen.Snapshot(m.session.opts.Screenshot)
+	if err != nil {
+		return Page{}, false, err
+	}
+	return m.session.add(img, hash, m.now(), false)
+}
+
+// Status returns the running session.
+func (m *Manager) Status() (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return Status{}, ErrNoSession
+	}
+	return m.session.status(), nil
+}
+
+// Finish ends the session and returns the path of its PDF. With auto
+// capture, the automatic capture stops and the current page is captured
+// first. If the PDF cannot be written, the session keeps running without
+// automatic capture, so that Finish can be retried.
+func (m *Manager) Finish() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.session
+	if s == nil {
+		return "", ErrNoSession
+	}
+	if s.stop != nil {
+		s.stop()
+		<-s.done
+		s.mu.Lock()
+		s.stop = nil
+		s.opts.Auto = false
+		s.mu.Unlock()
+		if img, hash, err := m.screen.Snapshot(s.opts.Screenshot); err == nil {
+			if _, _, err := s.add(img, hash, m.now(), true); err != nil {
+				log.Printf("capture: cannot save the last page: %v", err)
+			}
+		}
+	}
+	if len(s.pages) == 0 {
+		m.session = nil
+		os.RemoveAll(s.dir)
+		log.Printf("capture session %s finished without pages", s.id)
+		return "", ErrNoPages
+	}
+	name := s.dir + ".pdf"
+	if err := s.writePDF(name); err != nil {
+		os.Remove(name)
+		log.Printf("capture session %s: cannot write the PDF, the pages are kept in %s: %v", s.id, s.dir, err)
+		return "", err
+	}
+	m.session = nil
+	os.RemoveAll(s.dir)
+	log.Printf("capture session %s saved to %s (%d pages)", s.id, name, len(s.pages))
+	return name, nil
+}
+
+// add saves img as a new page unless the screen was already captured.
+func (s *session) add(img image.Image, hash uint64, now time.Time, auto bool) (Page, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes[hash] {
+		debug.Log("Capture: page %016x already captured", hash)
+		return Page{}, false, nil
+	}
+	page := Page{
+		Number: len(s.pages) + 1,
+		Time:   now,
+		Hash:   fmt.Sprintf("%016x", hash),
+		Auto:   auto,
+	}
+	page.file = filepath.Join(s.dir, fmt.Sprintf("page-%03d.png", page.Number))
+	if err := writePNG(page.file, img); err != nil {
+		return Page{}, false, err
+	}
+	s.hashes[hash] = true
+	s.pages = append(s.pages, page)
+	debug.Log("Capture: page %d saved", page.Number)
+	return page, true, nil
+}
+
+func (s *session) status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{
+		ID:      s.id,
+		Started: s.started,
+		Auto:    s.opts.Auto,
+		Pages:   append([]Page{}, s.pages...),
+	}
+}
+
+// writePDF assembles the pages, loading one at a time.
+func (s *session) writePDF(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	pw := pdf.NewWriter(f)
+	for _, page := range s.pages {
+		img, err := readPNG(page.file)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("page %d: %w", page.Number, err)
+		}
+		width, height := s.opts.Screenshot.PageSize(img.Bounds())
+		if err := pw.AddPage(img, width, height); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := pw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readPNG(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
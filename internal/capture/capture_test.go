@@ -0,0 +1,252 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+// fakeScreen shows a blank page with a black square, whatever the options.
+type fakeScreen struct {
+	mu   sync.Mutex
+	img  *image.Gray
+	hash uint64
+}
+
+func (s *fakeScreen) Snapshot(stream.ScreenshotOptions) (image.Image, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.img == nil {
+		return nil, 0, errors.New("no screen")
+	}
+	return s.img, s.hash, nil
+}
+
+// show draws a page with a square of ink at x and identifies it by hash.
+func (s *fakeScreen) show(x int, hash uint64) {
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := 5; y < 15; y++ {
+		for dx := range 10 {
+			img.SetGray(x+dx, y, color.Gray{})
+		}
+	}
+	s.mu.Lock()
+	s.img, s.hash = img, hash
+	s.mu.Unlock()
+}
+
+func TestManagerSession(t *testing.T) {
+	screen := &fakeScreen{}
+	dir := t.TempDir()
+	m := NewManager(screen, dir)
+
+	if _, _, err := m.Capture(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("Capture without session: err = %v, want ErrNoSession", err)
+	}
+	status, err := m.Start(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Start(Options{}); !errors.Is(err, ErrActive) {
+		t.Fatalf("second Start: err = %v, want ErrActive", err)
+	}
+
+	screen.show(0, 1)
+	if _, added, err := m.Capture(); err != nil || !added {
+		t.Fatalf("Capture = %v, %v", added, err)
+	}
+	if _, added, _ := m.Capture(); added {
+		t.Error("identical page captured twice")
+	}
+	screen.show(20, 2)
+	page, added, err := m.Capture()
+	if err != nil || !added || page.Number != 2 {
+		t.Fatalf("Capture = %+v, %v, %v", page, added, err)
+	}
+
+	name, err := m.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, status.ID+".pdf"); name != want {
+		t.Errorf("PDF saved to %s, want %s", name, want)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("/Type /Pages /Count 2")) {
+		t.Error("the PDF does not have 2 pages")
+	}
+	if _, err := os.Stat(filepath.Join(dir, status.ID)); !os.IsNotExist(err) {
+		t.Errorf("the pages were not removed: %v", err)
+	}
+	if _, err := m.Finish(); !errors.Is(err, ErrNoSession) {
+		t.Errorf("second Finish: err = %v, want ErrNoSession", err)
+	}
+}
+
+func TestManagerFinishWithoutPages(t *testing.T) {
+	m := NewManager(&fakeScreen{}, t.TempDir())
+	if _, err := m.Start(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Finish(); !errors.Is(err, ErrNoPages) {
+		t.Errorf("Finish: err = %v, want ErrNoPages", err)
+	}
+	if _, err := m.Start(Options{}); err != nil {
+		t.Errorf("Start after an empty session: %v", err)
+	}
+}
+
+func TestManagerFinishRetryOnError(t *testing.T) {
+	screen := &fakeScreen{}
+	dir := t.TempDir()
+	m := NewManager(screen, dir)
+	status, err := m.Start(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen.show(0, 1)
+	if _, _, err := m.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	// The PDF cannot be created over a non-empty directory
+	if err := os.MkdirAll(filepath.Join(dir, status.ID+".pdf", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Finish(); err == nil {
+		t.Fatal("Finish succeeded without writing the PDF")
+	}
+	if _, err := os.Stat(filepath.Join(dir, status.ID, "page-001.png")); err != nil {
+		t.Errorf("the pages were removed: %v", err)
+	}
+	if _, err := m.Status(); err != nil {
+		t.Fatalf("the session ended on error: %v", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, status.ID+".pdf")); err != nil {
+		t.Fatal(err)
+	}
+	name, err := m.Finish()
+	if err != nil {
+		t.Fatalf("Finish retry: %v", err)
+	}
+	if name != filepath.Join(dir, status.ID+".pdf") {
+		t.Errorf("PDF = %s", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, status.ID)); !os.IsNotExist(err) {
+		t.Errorf("the pages were kept after the retry: %v", err)
+	}
+}
+
+func TestManagerUniqueSessions(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(&fakeScreen{}, dir)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	ids := map[string]bool{}
+	for range 3 {
+		status, err := m.Start(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids[status.ID] {
+			t.Errorf("session id %s reused", status.ID)
+		}
+		ids[status.ID] = true
+		// Keep the directory, as a finished session keeps its PDF
+		m.mu.Lock()
+		m.session = nil
+		m.mu.Unlock()
+	}
+}
+
+func TestManagerAuto(t *testing.T) {
+	screen := &fakeScreen{}
+	m := NewManager(screen, t.TempDir())
+	if _, err := m.Start(Options{Auto: true}); !errors.Is(err, ErrNoDetection) {
+		t.Fatalf("Start without detection: err = %v, want ErrNoDetection", err)
+	}
+	pages := bus.NewTopic[pagechange.Event](bus.New(), pagechange.Topic)
+	m.SetPageTurns(pages)
+	if _, err := m.Start(Options{Auto: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	screen.show(0, 1)
+	first, _, _ := screen.Snapshot(stream.ScreenshotOptions{})
+	pages.Publish(pagechange.Event{Page: 1, Time: time.Now(), Previous: first.(*image.Gray), Hash: 1})
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if status, _ := m.Status(); len(status.Pages) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the previous page was not captured")
+		}
+	}
+
+	// The current page is captured when the session finishes
+	screen.show(25, 2)
+	name, err := m.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(name)
+	if !bytes.Contains(data, []byte("/Type /Pages /Count 2")) {
+		t.Error("the PDF does not have the previous page and the last one")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	screen := &fakeScreen{}
+	screen.show(0, 1)
+	h := NewHandler(NewManager(screen, t.TempDir()))
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/capture/start?scale=3"); rec.Code != http.StatusBadRequest {
+		t.Errorf("start with invalid options: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/capture/page"); rec.Code != http.StatusConflict {
+		t.Errorf("page without session: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/capture/start?trim=true"); rec.Code != http.StatusCreated {
+		t.Fatalf("start: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/capture/start"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET start: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/capture/page"); rec.Code != http.StatusCreated {
+		t.Errorf("page: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/capture/page"); rec.Code != http.StatusNoContent {
+		t.Errorf("same page: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/capture/status"); rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"number":1`)) {
+		t.Errorf("status: %d %s", rec.Code, rec.Body)
+	}
+	rec := do(http.MethodPost, "/capture/finish")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("finish: status = %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
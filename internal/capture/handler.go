@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+// NewHandler creates the handler of the capture API:
+//   - POST /capture/start starts a session. The query takes the rotate,
+//     portrait, flip, crop, trim and scale options of /screenshot, and
+//     auto=true to capture the pages on page changes.
+//   - POST /capture/page captures the current page.
+//   - POST /capture/finish ends the session and returns the PDF.
+//   - GET /capture/status returns the running session.
+func NewHandler(m *Manager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /capture/start", m.handleStart)
+	mux.HandleFunc("POST /capture/page", m.handlePage)
+	mux.HandleFunc("POST /capture/finish", m.handleFinish)
+	mux.HandleFunc("GET /capture/status", m.handleStatus)
+	return mux
+}
+
+func (m *Manager) handleStart(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	shot, err := stream.ParseScreenshotOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := Options{Screenshot: shot}
+	if s := query.Get("auto"); s != "" {
+		if opts.Auto, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, "invalid auto "+strconv.Quote(s), http.StatusBadRequest)
+			return
+		}
+	}
+	status, err := m.Start(opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (m *Manager) handlePage(w http.ResponseWriter, r *http.Request) {
+	page, added, err := m.Capture()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !added {
+		// The screen did not change since it was captured
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusCreated, page)
+}
+
+func (m *Manager) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := m.Status()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (m *Manager) handleFinish(w http.ResponseWriter, r *http.Request) {
+	name, err := m.Finish()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(name)+"\"")
+	w.Header().Set("Cache-Control", "no-cache")
+	info, err := f.Stat()
+	if err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	if _, err := f.WriteTo(w); err != nil {
+		log.Printf("failed to send capture: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrActive), errors.Is(err, ErrNoSession), errors.Is(err, ErrNoPages),
+		errors.Is(err, ErrNoDetection):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("capture failed: %v", err)
+		http.Error(w, "capture failed", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode JSON response: %v", err)
+	}
+}
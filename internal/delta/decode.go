@@ -0,0 +1,140 @@
+package delta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// HeaderSize is the size of the header of a frame: the type and the 24-bit
+// little-endian length of the payload.
+const HeaderSize = 4
+
+var (
+	// ErrNoPrevious is returned when applying a delta frame without a
+	// previous full frame
+	ErrNoPrevious = errors.New("delta frame without a previous frame")
+
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+)
+
+// IsKeyframe reports whether the frame can be decoded on its own.
+func IsKeyframe(frame []byte) bool {
+	return len(frame) > 0 && (frame[0] == FrameTypeFull || frame[0] == FrameTypeFullZstd)
+}
+
+// PayloadSize returns the size of the payload announced by the header.
+func PayloadSize(frame []byte) int {
+	if len(frame) < HeaderSize {
+		return 0
+	}
+	return int(frame[1]) | int(frame[2])<<8 | int(frame[3])<<16
+}
+
+// WriteFull writes data as a zstd-compressed full frame, like the encoder
+// does when most of the frame changed.
+func WriteFull(data []byte, w io.Writer) (int, error) {
+	var e Encoder
+	return e.writeFullFrame(data, w)
+}
+
+// Decoder rebuilds the frames from the frames of the wire protocol written
+// by Encoder.
+type Decoder struct {
+	frame    []byte
+	hasFrame bool
+}
+
+// NewDecoder creates a decoder of frames of size bytes.
+func NewDecoder(size int) *Decoder {
+	return &Decoder{frame: make([]byte, size)}
+}
+
+// Frame returns the current frame. It is updated in place by Apply.
+func (d *Decoder) Frame() []byte {
+	return d.frame
+}
+
+// HasFrame reports whether a full frame was applied.
+func (d *Decoder) HasFrame() bool {
+	return d.hasFrame
+}
+
+// Apply decodes one frame (header and payload) and applies it to the
+// current frame.
+func (d *Decoder) Apply(data []byte) error {
+	if len(data) < HeaderSize {
+		return io.ErrUnexpectedEOF
+	}
+	payload := data[HeaderSize:]
+	if n := PayloadSize(data); n <= len(payload) {
+		payload = payload[:n]
+	} else {
+		return io.ErrUnexpectedEOF
+	}
+
+	switch data[0] {
+	case FrameTypeFull:
+		if len(payload) != len(d.frame) {
+			return fmt.Errorf("full frame of %d bytes, want %d", len(payload), len(d.frame))
+		}
+		copy(d.frame, payload)
+	case FrameTypeFullZstd:
+		zstdDecoderOnce.Do(func() {
+			zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		})
+		out, err := zstdDecoder.DecodeAll(payload, d.frame[:0])
+		if err != nil {
+			return err
+		}
+		if len(out) != len(d.frame) {
+			return fmt.Errorf("full frame of %d bytes, want %d", len(out), len(d.frame))
+		}
+	case FrameTypeDelta:
+		if !d.hasFrame {
+			return ErrNoPrevious
+		}
+		return d.applyRuns(payload)
+	default:
+		return fmt.Errorf("unsupported frame type %#x", data[0])
+	}
+	d.hasFrame = true
+	return nil
+}
+
+// applyRuns copies the runs of a delta frame to the current frame.
+func (d *Decoder) applyRuns(payload []byte) error {
+	pos := 0
+	for i := 0; i < len(payload); {
+		var length, offset int
+		if payload[i]&0x80 == 0 {
+			if i+3 > len(payload) {
+				return io.ErrUnexpectedEOF
+			}
+			length = int(payload[i])
+			offset = int(binary.LittleEndian.Uint16(payload[i+1:]))
+			i += 3
+		} else {
+			if i+5 > len(payload) {
+				return io.ErrUnexpectedEOF
+			}
+			length = int(payload[i]&0x7F)<<8 | int(payload[i+1])
+			offset = int(payload[i+2]) | int(payload[i+3])<<8 | int(payload[i+4])<<16
+			i += 5
+		}
+		pos += offset
+		n := length * bytesPerPixel
+		if pos+n > len(d.frame) || i+n > len(payload) {
+			return fmt.Errorf("run out of bounds at offset %d", pos)
+		}
+		copy(d.frame[pos:], payload[i:i+n])
+		pos += n
+		i += n
+	}
+	return nil
+}
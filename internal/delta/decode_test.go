@@ -0,0 +1,70 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestDecoderRoundTrip(t *testing.T) {
+	const size = 64 * 64 * bytesPerPixel
+	rng := rand.New(rand.NewSource(1))
+	frame := make([]byte, size)
+	rng.Read(frame)
+
+	enc := NewEncoder(0.5)
+	dec := NewDecoder(size)
+	var buf bytes.Buffer
+	for i := range 20 {
+		// Change a few pixels, or most of the frame every 5 frames
+		changes := 10
+		if i%5 == 4 {
+			changes = size
+		}
+		for range changes {
+			frame[rng.Intn(size)] = byte(rng.Intn(256))
+		}
+		buf.Reset()
+		if err := enc.Encode(frame, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && !IsKeyframe(buf.Bytes()) {
+			t.Fatal("the first frame is not a keyframe")
+		}
+		if err := dec.Apply(buf.Bytes()); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(dec.Frame(), frame) {
+			t.Fatalf("frame %d differs after decoding", i)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	dec := NewDecoder(16)
+	if err := dec.Apply([]byte{FrameTypeDelta, 0, 0, 0}); !errors.Is(err, ErrNoPrevious) {
+		t.Errorf("delta without previous frame: %v", err)
+	}
+	if err := dec.Apply([]byte{FrameTypeDelta, 10, 0}); err == nil {
+		t.Error("truncated header accepted")
+	}
+	var buf bytes.Buffer
+	if _, err := WriteFull(make([]byte, 8), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Apply(buf.Bytes()); err == nil {
+		t.Error("full frame of the wrong size accepted")
+	}
+	buf.Reset()
+	if _, err := WriteFull(bytes.Repeat([]byte{7}, 16), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Apply(buf.Bytes()); err != nil || dec.Frame()[15] != 7 {
+		t.Errorf("full frame: %v", err)
+	}
+	// A run past the end of the frame
+	if err := dec.Apply([]byte{FrameTypeDelta, 7, 0, 0, 2, 16, 0, 1, 2, 3, 4}); err == nil {
+		t.Error("run out of bounds accepted")
+	}
+}
@@ -68,10 +68,14 @@ type Encoder struct {
 	headerBuf     [5]byte     // Max header size (long run: 5 bytes)
 	frameHeader   [4]byte     // Frame header buffer
 	runsBuf       []changeRun // Reusable runs slice
+	regionRuns    []changeRun // Reusable runs of the regions of a partial frame
 	compressedBuf []byte      // Reusable buffer for ZSTD compression output
 	maskBuf       []byte      // Reusable buffer for block comparison mask
 	writeBuf      []byte      // Reusable buffer for coalesced delta frame writes
 	prevChecksum  [16]byte    // XOR-fold checksum of previous frame (ARM32 idle detection)
+	changeRatio   float64     // Change ratio of the last frame encoded
+	workers       int         // Goroutines comparing a frame (see SetWorkers)
+	stripes       []stripe    // Per-worker comparison state
 }
 
 // NewEncoder creates a new delta encoder with the given threshold.
@@ -125,13 +129,89 @@ func (e *Encoder) EncodeWithSize(current []byte, w io.Writer) (n int, err error)
 			e.prevFrameHash = xxhash.Sum64(current)
 		}
 		e.hasPrev = true
+		e.invalidateStripes()
+		e.changeRatio = 1
 		debug.Log("Delta: first frame, sending full")
 		return e.writeFullFrame(current, w)
 	}
 
 	// Compare frames and copy current → prev in a single pass.
 	// This merges two memory scans into one, reducing bandwidth pressure.
-	runs := e.compareAndCopyFrames(current)
+	runs := e.compare(current)
+	return e.encodeRuns(runs, current, w)
+}
+
+// Region is the range of bytes [Start, End) of a frame.
+type Region struct {
+	Start, End int
+}
+
+// EncodeRegionWithSize encodes a frame of which only the bytes in
+// [start, end) may have changed since the previous frame, such as the rows
+// read around the pen. See EncodeRegionsWithSize.
+func (e *Encoder) EncodeRegionWithSize(current []byte, start, end int, w io.Writer) (int, error) {
+	return e.EncodeRegionsWithSize(current, []Region{{Start: start, End: end}}, w)
+}
+
+// EncodeRegionsWithSize encodes a frame of which only the bytes in the
+// regions, sorted and disjoint, may have changed since the previous frame.
+// Bytes outside the regions are ignored: they may be stale. A full frame is
+// sent from the previous frame updated with the regions. Without a previous
+// frame of the same size, current must be complete and is encoded as by
+// EncodeWithSize.
+func (e *Encoder) EncodeRegionsWithSize(current []byte, regions []Region, w io.Writer) (n int, err error) {
+	frameSize := len(current)
+	whole := len(regions) == 1 && regions[0].Start <= 0 && regions[0].End >= frameSize
+	if !e.hasPrev || len(e.prevFrame) != frameSize || whole {
+		return e.EncodeWithSize(current, w)
+	}
+
+	regionBytes := 0
+	span := trace.BeginSpan("delta_encode")
+	defer func() {
+		trace.EndSpan(span, map[string]any{
+			"bytes_written": n,
+			"frame_type":    "region",
+			"regions":       len(regions),
+			"region_bytes":  regionBytes,
+		})
+	}()
+
+	// The hash and checksum cover whole frames: skip the idle early exit, and
+	// let the next full comparison compute them again
+	prev := e.prevFrame
+	e.regionRuns = e.regionRuns[:0]
+	runEnd := 0 // end of the last run in bytes
+	for _, r := range regions {
+		// Keep the runs pixel-aligned, the bytes outside the region are stale
+		start := (max(r.Start, 0) + bytesPerPixel - 1) / bytesPerPixel * bytesPerPixel
+		end := min(r.End, frameSize) / bytesPerPixel * bytesPerPixel
+		if start >= end {
+			continue
+		}
+		regionBytes += end - start
+		e.prevFrame = prev[start:end]
+		e.lastChanged = true
+		runs := e.compareAndCopyFrames(current[start:end])
+		// The offsets of the region are relative to its start
+		if len(runs) > 0 {
+			runs[0].offset += start - runEnd
+		}
+		for _, run := range runs {
+			runEnd += run.offset + len(run.data)
+		}
+		e.regionRuns = append(e.regionRuns, runs...)
+	}
+	e.prevFrame = prev
+	e.lastChanged = true
+	e.invalidateStripes()
+	return e.encodeRuns(e.regionRuns, prev, w)
+}
+
+// encodeRuns writes the changes of a frame as a delta frame, or the full
+// frame if the changes are too large.
+func (e *Encoder) encodeRuns(runs []changeRun, full []byte, w io.Writer) (int, error) {
+	frameSize := len(full)
 
 	// Calculate total changed bytes
 	changedBytes := 0
@@ -141,12 +221,14 @@ func (e *Encoder) EncodeWithSize(current []byte, w io.Writer) (n int, err error)
 
 	// No changes - send empty delta frame (copy already skipped via hash early exit)
 	if changedBytes == 0 {
+		e.changeRatio = 0
 		debug.Log("Delta: no changes, sending empty delta")
 		return e.writeDeltaFrame(runs, 0, w)
 	}
 
 	// Calculate change ratio
 	changeRatio := float64(changedBytes) / float64(frameSize)
+	e.changeRatio = changeRatio
 
 	// Calculate delta payload size
 	deltaSize := e.calculateDeltaSize(runs)
@@ -155,7 +237,7 @@ func (e *Encoder) EncodeWithSize(current []byte, w io.Writer) (n int, err error)
 	// prevFrame was already updated during compareAndCopyFrames
 	if changeRatio > e.threshold || deltaSize >= frameSize {
 		debug.Log("Delta: changeRatio=%.2f%%, runs=%d, sending full", changeRatio*100, len(runs))
-		return e.writeFullFrame(current, w)
+		return e.writeFullFrame(full, w)
 	}
 
 	// Send delta frame - prevFrame already updated during compareAndCopyFrames
@@ -576,6 +658,18 @@ func (e *Encoder) writeDeltaFrame(runs []changeRun, payloadSize int, w io.Writer
 	return w.Write(buf[:pos])
 }
 
+// HasPrevious reports whether the encoder holds a previous frame, that is
+// whether the next frame may be partial (see EncodeRegionWithSize).
+func (e *Encoder) HasPrevious() bool {
+	return e.hasPrev
+}
+
+// ChangeRatio returns the ratio (0.0-1.0) of the bytes of the last frame
+// encoded that changed since the previous one, 1 for a first frame.
+func (e *Encoder) ChangeRatio() float64 {
+	return e.changeRatio
+}
+
 // Reset clears the encoder state, forcing the next frame to be a full frame.
 func (e *Encoder) Reset() {
 	e.hasPrev = false
@@ -592,4 +686,5 @@ func (e *Encoder) ReleaseMemory() {
 	e.compressedBuf = nil
 	e.maskBuf = nil
 	e.writeBuf = nil
+	e.stripes = nil
 }
@@ -3,6 +3,7 @@ package delta
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"runtime"
 	"testing"
 	"unsafe"
@@ -1592,3 +1593,145 @@ func BenchmarkChecksumChanged_Unchanged(b *testing.B) {
 		checksumChanged(unsafe.Pointer(&buf[0]), nblocks, unsafe.Pointer(&checksum[0]))
 	}
 }
+
+func TestEncodeRegion_MatchesFullEncode(t *testing.T) {
+	const frameSize = 64 * 1024
+	frame1 := make([]byte, frameSize)
+	for i := range frame1 {
+		frame1[i] = byte(i / 4096)
+	}
+	start, end := 20000, 20900
+	frame2 := append([]byte(nil), frame1...)
+	for i := start + 100; i < end-100; i++ {
+		frame2[i] = 0xFF
+	}
+	// Only the region of the partial frame is read, the rest is stale
+	partial := make([]byte, frameSize)
+	copy(partial[start:end], frame2[start:end])
+
+	enc := NewEncoder(DefaultThreshold)
+	var got bytes.Buffer
+	enc.Encode(frame1, io.Discard)
+	if _, err := enc.EncodeRegionWithSize(partial, start, end, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes()[0] != FrameTypeDelta {
+		t.Fatalf("expected a delta frame, got type %d", got.Bytes()[0])
+	}
+	decoded := applyDelta(t, frame1, got.Bytes())
+	if !bytes.Equal(decoded, frame2) {
+		t.Fatal("region delta does not produce the new frame")
+	}
+
+	// The previous frame was updated: the complete frame has no changes
+	got.Reset()
+	enc.Encode(frame2, &got)
+	if got.Len() != 4 || got.Bytes()[0] != FrameTypeDelta {
+		t.Errorf("expected an empty delta after the region update, got %d bytes", got.Len())
+	}
+}
+
+func TestEncodeRegions_Disjoint(t *testing.T) {
+	const frameSize = 64 * 1024
+	frame1 := make([]byte, frameSize)
+	for i := range frame1 {
+		frame1[i] = byte(i / 4096)
+	}
+	regions := []Region{{Start: 4000, End: 5000}, {Start: 40000, End: 41000}}
+	frame2 := append([]byte(nil), frame1...)
+	for _, r := range regions {
+		for i := r.Start + 100; i < r.End-100; i++ {
+			frame2[i] = 0xFF
+		}
+	}
+	// Only the regions of the partial frame are read, the gap is stale
+	partial := bytes.Repeat([]byte{0xAA}, frameSize)
+	for _, r := range regions {
+		copy(partial[r.Start:r.End], frame2[r.Start:r.End])
+	}
+
+	enc := NewEncoder(DefaultThreshold)
+	var got bytes.Buffer
+	enc.Encode(frame1, io.Discard)
+	if _, err := enc.EncodeRegionsWithSize(partial, regions, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes()[0] != FrameTypeDelta {
+		t.Fatalf("expected a delta frame, got type %d", got.Bytes()[0])
+	}
+	decoded := applyDelta(t, frame1, got.Bytes())
+	if !bytes.Equal(decoded, frame2) {
+		t.Fatal("regions delta does not produce the new frame")
+	}
+
+	got.Reset()
+	enc.Encode(frame2, &got)
+	if got.Len() != 4 || got.Bytes()[0] != FrameTypeDelta {
+		t.Errorf("expected an empty delta after the regions update, got %d bytes", got.Len())
+	}
+}
+
+func TestEncodeRegion_FullFrame(t *testing.T) {
+	const frameSize = 16 * 1024
+	frame1 := make([]byte, frameSize)
+	frame2 := bytes.Repeat([]byte{0xFF}, frameSize)
+	partial := make([]byte, frameSize)
+	start, end := 0, frameSize/2
+	copy(partial[start:end], frame2[start:end])
+
+	enc := NewEncoder(DefaultThreshold)
+	if enc.HasPrevious() {
+		t.Fatal("new encoder has a previous frame")
+	}
+	enc.Encode(frame1, io.Discard)
+	if !enc.HasPrevious() {
+		t.Fatal("encoder has no previous frame after a frame")
+	}
+	var buf bytes.Buffer
+	if _, err := enc.EncodeRegionWithSize(partial, start, end, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Bytes()[0] != FrameTypeFullZstd {
+		t.Fatalf("expected a full frame, got type %d", buf.Bytes()[0])
+	}
+	// The full frame is the previous frame updated with the region
+	dec, _ := zstd.NewReader(nil)
+	defer dec.Close()
+	decoded, err := dec.DecodeAll(buf.Bytes()[4:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte(nil), frame2[:end]...), frame1[end:]...)
+	if !bytes.Equal(decoded, want) {
+		t.Error("full frame does not match the previous frame updated with the region")
+	}
+}
+
+// applyDelta applies a delta frame to a copy of prev, as the client does.
+func applyDelta(t *testing.T, prev, frame []byte) []byte {
+	t.Helper()
+	out := append([]byte(nil), prev...)
+	payload := frame[4:]
+	pos := 0
+	for i := 0; i < len(payload); {
+		var length, offset int
+		if payload[i]&0x80 == 0 {
+			length = int(payload[i])
+			offset = int(binary.LittleEndian.Uint16(payload[i+1:]))
+			i += 3
+		} else {
+			length = int(payload[i]&0x7F)<<8 | int(payload[i+1])
+			offset = int(payload[i+2]) | int(payload[i+3])<<8 | int(payload[i+4])<<16
+			i += 5
+		}
+		pos += offset
+		n := length * bytesPerPixel
+		if pos+n > len(out) || i+n > len(payload) {
+			t.Fatalf("run out of bounds at offset %d", pos)
+		}
+		copy(out[pos:], payload[i:i+n])
+		pos += n
+		i += n
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package delta
+
+import (
+	"runtime"
+	"sync"
+)
+
+const (
+	// stripeAlign keeps the stripes aligned on the words of the block mask
+	stripeAlign = blockSize * 8
+	// minParallelSize is the frame size below which the comparison is not
+	// worth splitting across goroutines
+	minParallelSize = 256 * 1024
+)
+
+// stripe is a part of the frame compared by its own goroutine. Its encoder
+// holds the comparison state of the stripe: the previous pixels (a slice of
+// the previous frame), the runs, the mask and the idle hash or checksum.
+type stripe struct {
+	start, end int
+	enc        Encoder
+	runs       []changeRun
+}
+
+// SetWorkers sets the number of goroutines comparing a frame, each one on a
+// stripe of the frame. n <= 0 uses every core, 1 compares sequentially.
+func (e *Encoder) SetWorkers(n int) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	e.workers = n
+	e.stripes = nil
+	// The idle hash of the previous mode may be stale
+	e.lastChanged = true
+}
+
+// compare compares current with the previous frame and copies it, in
+// parallel stripes if the encoder has several workers.
+func (e *Encoder) compare(current []byte) []changeRun {
+	if e.workers <= 1 || len(current) < minParallelSize || len(e.prevFrame) != len(current) {
+		return e.compareAndCopyFrames(current)
+	}
+	return e.compareAndCopyParallel(current)
+}
+
+// compareAndCopyParallel runs compareAndCopyFrames on each stripe and merges
+// the runs in order, their offsets made relative to the previous stripes.
+// A run crossing two stripes is split in two runs.
+func (e *Encoder) compareAndCopyParallel(current []byte) []changeRun {
+	e.layoutStripes(len(current))
+
+	var wg sync.WaitGroup
+	for i := range e.stripes {
+		s := &e.stripes[i]
+		s.enc.prevFrame = e.prevFrame[s.start:s.end]
+		if i == len(e.stripes)-1 {
+			// The calling goroutine takes the last stripe
+			s.runs = s.enc.compareAndCopyFrames(current[s.start:s.end])
+			continue
+		}
+		wg.Go(func() {
+			s.runs = s.enc.compareAndCopyFrames(current[s.start:s.end])
+		})
+	}
+	wg.Wait()
+
+	e.runsBuf = e.runsBuf[:0]
+	lastEnd := 0
+	for i := range e.stripes {
+		s := &e.stripes[i]
+		if len(s.runs) == 0 {
+			continue
+		}
+		end := s.start
+		for j, run := range s.runs {
+			end += run.offset + len(run.data)
+			if j == 0 {
+				run.offset += s.start - lastEnd
+			}
+			e.runsBuf = append(e.runsBuf, run)
+		}
+		lastEnd = end
+	}
+	e.lastChanged = len(e.runsBuf) > 0
+	return e.runsBuf
+}
+
+// layoutStripes splits a frame of size bytes between the workers.
+func (e *Encoder) layoutStripes(size int) {
+	if len(e.stripes) > 0 && e.stripes[len(e.stripes)-1].end == size {
+		return
+	}
+	n := e.workers
+	stripeSize := (size/n + stripeAlign - 1) / stripeAlign * stripeAlign
+	e.stripes = e.stripes[:0]
+	for start := 0; start < size; start += stripeSize {
+		e.stripes = append(e.stripes, stripe{start: start, end: min(start+stripeSize, size)})
+	}
+	e.invalidateStripes()
+}
+
+// invalidateStripes makes the stripes compare their pixels on the next frame
+// instead of trusting their idle hash or checksum, after the previous frame
+// was replaced or partially updated.
+func (e *Encoder) invalidateStripes() {
+	for i := range e.stripes {
+		e.stripes[i].enc.lastChanged = true
+	}
+}
@@ -0,0 +1,125 @@
+package delta
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// frameSequence returns frames changing in scattered places, including
+// across the stripes, with unchanged frames in between.
+func frameSequence(size, n int) [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	frames := [][]byte{bytes.Repeat([]byte{0xff}, size)}
+	for i := 1; i < n; i++ {
+		frame := append([]byte(nil), frames[i-1]...)
+		if i%3 != 0 {
+			for range 20 {
+				start := rng.Intn(size - 4096)
+				length := rng.Intn(4096)
+				for j := start; j < start+length; j++ {
+					frame[j] = byte(rng.Intn(256))
+				}
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestParallelEncodeMatchesSequential(t *testing.T) {
+	const size = 1 << 20
+	frames := frameSequence(size, 12)
+	for _, workers := range []int{2, 3, 4, 7} {
+		t.Run(fmt.Sprintf("%d_workers", workers), func(t *testing.T) {
+			enc := NewEncoder(DefaultThreshold)
+			enc.SetWorkers(workers)
+			var client []byte
+			for i, frame := range frames {
+				if i == 7 {
+					// A reset must not leave stale stripe hashes
+					enc.Reset()
+				}
+				var buf bytes.Buffer
+				if err := enc.Encode(frame, &buf); err != nil {
+					t.Fatal(err)
+				}
+				if buf.Bytes()[0] == FrameTypeDelta {
+					client = applyDelta(t, client, buf.Bytes())
+				} else {
+					client = append(client[:0], frame...)
+				}
+				if !bytes.Equal(client, frame) {
+					t.Fatalf("frame %d: decoded frame differs", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelStripes(t *testing.T) {
+	enc := NewEncoder(DefaultThreshold)
+	enc.SetWorkers(3)
+	enc.layoutStripes(1<<20 + 100)
+	if len(enc.stripes) != 3 {
+		t.Fatalf("got %d stripes, want 3", len(enc.stripes))
+	}
+	end := 0
+	for _, s := range enc.stripes {
+		if s.start != end || s.start%stripeAlign != 0 {
+			t.Errorf("stripe [%d, %d) is not contiguous or aligned", s.start, s.end)
+		}
+		end = s.end
+	}
+	if end != 1<<20+100 {
+		t.Errorf("stripes end at %d", end)
+	}
+}
+
+func benchmarkParallelEncode(b *testing.B, workers int, change int) {
+	frameSize := 1872 * 1404 * 4
+	enc := NewEncoder(DefaultThreshold)
+	enc.SetWorkers(workers)
+	frames := [2][]byte{make([]byte, frameSize), make([]byte, frameSize)}
+	// Strokes spread over the page
+	for i := 0; i < change; i++ {
+		frames[1][(i*7919*4)%frameSize] = 0xFF
+	}
+	enc.Encode(frames[0], &bytes.Buffer{})
+
+	var buf bytes.Buffer
+	b.SetBytes(int64(frameSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		_ = enc.Encode(frames[(i+1)%2], &buf)
+	}
+}
+
+func BenchmarkParallelEncode(b *testing.B) {
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("changed_%d_workers", workers), func(b *testing.B) {
+			benchmarkParallelEncode(b, workers, 2000)
+		})
+	}
+}
+
+func BenchmarkParallelEncode_Unchanged(b *testing.B) {
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("%d_workers", workers), func(b *testing.B) {
+			frameSize := 1872 * 1404 * 4
+			enc := NewEncoder(DefaultThreshold)
+			enc.SetWorkers(workers)
+			frame := make([]byte, frameSize)
+			enc.Encode(frame, &bytes.Buffer{})
+			var buf bytes.Buffer
+			b.SetBytes(int64(frameSize))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				_ = enc.Encode(frame, &buf)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package device gathers information about the tablet, such as its model,
+// firmware, battery, storage and network interfaces.
+package device
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/power"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// Info describes the tablet.
+type Info struct {
+	Model       string      `json:"model"`
+	Firmware    string      `json:"firmware,omitempty"`
+	Framebuffer Framebuffer `json:"framebuffer"`
+	// Battery is nil when no battery is reported by the kernel
+	Battery *power.Battery `json:"battery,omitempty"`
+	// Storage is nil when the file system cannot be queried
+	Storage *Storage `json:"storage,omitempty"`
+	// Uptime is the time since the tablet booted, in seconds
+	Uptime float64 `json:"uptime,omitempty"`
+	// ServerUptime is the time since the server started, in seconds
+	ServerUptime float64     `json:"serverUptime"`
+	Interfaces   []Interface `json:"interfaces,omitempty"`
+	// XochitlPID is 0 when the framebuffer is not read from xochitl
+	XochitlPID int `json:"xochitlPid,omitempty"`
+}
+
+// Framebuffer describes the format of the framebuffer.
+type Framebuffer struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// BytesPerPixel is the size of a pixel in the framebuffer
+	BytesPerPixel int `json:"bytesPerPixel"`
+	// Confidence and Diagnosis are the result of the validation of the
+	// framebuffer address at startup, if any
+	Confidence string `json:"confidence,omitempty"`
+	Diagnosis  string `json:"diagnosis,omitempty"`
+}
+
+// Storage is the space of the file system holding the documents, in bytes.
+type Storage struct {
+	Path  string `json:"path"`
+	Free  uint64 `json:"free"`
+	Total uint64 `json:"total"`
+}
+
+// Interface is a network interface that is up, with its addresses.
+type Interface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	Addresses []string `json:"addresses"`
+}
+
+// Config configures the collection of the information.
+type Config struct {
+	// StoragePath is a path on the file system holding the documents
+	StoragePath string
+	// UptimePath is the file reporting the system uptime
+	UptimePath string
+}
+
+// DefaultConfig returns the configuration for the tablet.
+func DefaultConfig() Config {
+	return Config{
+		StoragePath: "/home/root",
+		UptimePath:  "/proc/uptime",
+	}
+}
+
+// Collector gathers the device information on demand.
+type Collector struct {
+	config  Config
+	power   *power.Monitor
+	started time.Time
+}
+
+// NewCollector creates a collector. The battery is read from the power
+// monitor, which may be nil.
+func NewCollector(config Config, monitor *power.Monitor) *Collector {
+	return &Collector{
+		config:  config,
+		power:   monitor,
+		started: time.Now(),
+	}
+}
+
+// Collect returns the current device information. Values that cannot be read
+// are left empty.
+func (c *Collector) Collect() Info {
+	info := Info{
+		Model: remarkable.Model.String(),
+		Framebuffer: Framebuffer{
+			Format:        remarkable.Config.PixelFormat(),
+			Width:         remarkable.Config.Width,
+			Height:        remarkable.Config.Height,
+			BytesPerPixel: remarkable.Config.BytesPerPixel,
+		},
+		ServerUptime: time.Since(c.started).Seconds(),
+		XochitlPID:   remarkable.XochitlPID(),
+	}
+	if v, ok := remarkable.FramebufferValidation(); ok {
+		info.Framebuffer.Confidence = v.Confidence.String()
+		info.Framebuffer.Diagnosis = v.Reason
+	}
+	if version, err := remarkable.FirmwareVersion(); err == nil {
+		info.Firmware = version
+	}
+	if c.power != nil {
+		info.Battery = c.power.Status().Battery
+	}
+	if free, total, err := diskSpace(c.config.StoragePath); err == nil {
+		info.Storage = &Storage{Path: c.config.StoragePath, Free: free, Total: total}
+	}
+	if uptime, err := readUptime(c.config.UptimePath); err == nil {
+		info.Uptime = uptime
+	}
+	info.Interfaces, _ = Interfaces()
+	return info
+}
+
+// Interfaces returns the network interfaces that are up, except the loopback,
+// with their non-loopback addresses.
+func Interfaces() ([]Interface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var result []Interface
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		i := Interface{Name: iface.Name, MAC: iface.HardwareAddr.String(), Addresses: []string{}}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+				i.Addresses = append(i.Addresses, ipnet.IP.String())
+			}
+		}
+		result = append(result, i)
+	}
+	return result, nil
+}
+
+// readUptime reads the system uptime in seconds from /proc/uptime.
+func readUptime(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
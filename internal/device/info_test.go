@@ -0,0 +1,61 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/power"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+func TestReadUptime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uptime")
+	if err := os.WriteFile(path, []byte("35163.48 131044.35\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uptime, err := readUptime(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime != 35163.48 {
+		t.Errorf("readUptime() = %v, want 35163.48", uptime)
+	}
+
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readUptime(path); err == nil {
+		t.Error("readUptime() on an empty file did not fail")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	uptimePath := filepath.Join(dir, "uptime")
+	if err := os.WriteFile(uptimePath, []byte("12.5 40.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector(Config{StoragePath: dir, UptimePath: uptimePath}, power.NewMonitor(power.DefaultConfig(), bus.New()))
+	info := collector.Collect()
+
+	if info.Model != remarkable.Model.String() {
+		t.Errorf("Model = %q, want %q", info.Model, remarkable.Model)
+	}
+	if info.Framebuffer.Width != remarkable.Config.Width || info.Framebuffer.Height != remarkable.Config.Height {
+		t.Errorf("Framebuffer = %+v, want %dx%d", info.Framebuffer, remarkable.Config.Width, remarkable.Config.Height)
+	}
+	if info.Framebuffer.Format == "" {
+		t.Error("Framebuffer format is empty")
+	}
+	if info.Uptime != 12.5 {
+		t.Errorf("Uptime = %v, want 12.5", info.Uptime)
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		if info.Storage == nil || info.Storage.Total == 0 || info.Storage.Free > info.Storage.Total {
+			t.Errorf("Storage = %+v, want the space of %s", info.Storage, dir)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package device
+
+import "errors"
+
+// diskSpace is not supported on this platform.
+func diskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,137 @@
+package eventhttphandler
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+const (
+	// EventBatchHeaderSize is the size of the header of a batch of events
+	// in the binary format: the sequence number of the first event (8
+	// bytes), the kernel timestamp of the report in Unix microseconds (8
+	// bytes), the number of events (2 bytes) and their source (2 bytes),
+	// little-endian.
+	EventBatchHeaderSize = 20
+	// EventRecordSize is the size of an event in the binary format: type
+	// (2 bytes), code (2 bytes) and value (4 bytes), little-endian.
+	EventRecordSize = 8
+
+	// maxBatchEvents is the number of events after which a batch is sent
+	// without waiting for the end of the report
+	maxBatchEvents = 32
+)
+
+// errShortBatch is returned when decoding a truncated batch
+var errShortBatch = errors.New("short event batch")
+
+// AppendEventBatch appends the binary encoding of the events of a report
+// to dst. The events are numbered from the sequence number of the first
+// one and share its source and timestamp.
+func AppendEventBatch(dst []byte, msgs []EventMessage) []byte {
+	if len(msgs) == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint64(dst, msgs[0].Seq)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(msgs[0].Time))
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(msgs)))
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(msgs[0].Source))
+	for _, msg := range msgs {
+		dst = binary.LittleEndian.AppendUint16(dst, msg.Type)
+		dst = binary.LittleEndian.AppendUint16(dst, msg.Code)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(msg.Value))
+	}
+	return dst
+}
+
+// DecodeEventBatch decodes the batch at the start of data and returns its
+// size.
+func DecodeEventBatch(data []byte) ([]EventMessage, int, error) {
+	if len(data) < EventBatchHeaderSize {
+		return nil, 0, errShortBatch
+	}
+	seq := binary.LittleEndian.Uint64(data)
+	t := int64(binary.LittleEndian.Uint64(data[8:]))
+	n := int(binary.LittleEndian.Uint16(data[16:]))
+	source := int(binary.LittleEndian.Uint16(data[18:]))
+	size := EventBatchHeaderSize + n*EventRecordSize
+	if len(data) < size {
+		return nil, 0, errShortBatch
+	}
+	msgs := make([]EventMessage, n)
+	for i := range msgs {
+		rec := data[EventBatchHeaderSize+i*EventRecordSize:]
+		msgs[i] = EventMessage{
+			InputEventFromSource: events.InputEventFromSource{
+				Source: source,
+				InputEvent: events.InputEvent{
+					Type:  binary.LittleEndian.Uint16(rec),
+					Code:  binary.LittleEndian.Uint16(rec[2:]),
+					Value: int32(binary.LittleEndian.Uint32(rec[4:])),
+				},
+			},
+			Seq:  seq + uint64(i),
+			Time: t,
+		}
+	}
+	return msgs, size, nil
+}
+
+// serveBinaryEvents streams the events in the binary format, one batch per
+// report of the digitizer. The power and page events are not sent.
+func serveBinaryEvents(w http.ResponseWriter, r *http.Request, eventC chan EventMessage, missed []EventMessage) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+
+	var batch []EventMessage
+	var out []byte
+	// add appends an event to the batch and returns true when the batch
+	// is to be sent
+	add := func(msg EventMessage) bool {
+		if msg.Type != events.EvSyn {
+			// The events of a batch are numbered consecutively
+			if n := len(batch); n > 0 && batch[n-1].Seq+1 != msg.Seq {
+				out = AppendEventBatch(out, batch)
+				batch = batch[:0]
+			}
+			batch = append(batch, msg)
+			// The replayed events carry the end of their report
+			return len(batch) == maxBatchEvents || msg.endOfReport
+		}
+		return len(batch) > 0
+	}
+	send := func() error {
+		out = AppendEventBatch(out, batch)
+		batch = batch[:0]
+		_, err := w.Write(out)
+		out = out[:0]
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	}
+
+	for _, msg := range missed {
+		if add(msg) {
+			out = AppendEventBatch(out, batch)
+			batch = batch[:0]
+		}
+	}
+	if send() != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-eventC:
+			if add(msg) && send() != nil {
+				return
+			}
+		}
+	}
+}
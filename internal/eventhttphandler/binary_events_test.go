@@ -0,0 +1,156 @@
+package eventhttphandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+func testReport() []EventMessage {
+	msg := func(seq uint64, code uint16, value int32) EventMessage {
+		return EventMessage{
+			InputEventFromSource: events.InputEventFromSource{
+				Source:     events.Pen,
+				InputEvent: events.InputEvent{Type: events.EvAbs, Code: code, Value: value},
+			},
+			Seq:  seq,
+			Time: 1760868131512034,
+		}
+	}
+	return []EventMessage{msg(41, 0, 8123), msg(42, 1, 15000), msg(43, 25, -3)}
+}
+
+// TestEventBatchRoundTrip checks that the binary format carries the same
+// events as the JSON one.
+func TestEventBatchRoundTrip(t *testing.T) {
+	report := testReport()
+	data := AppendEventBatch([]byte{0xaa}, report)[1:]
+	if len(data) != EventBatchHeaderSize+len(report)*EventRecordSize {
+		t.Fatalf("batch of %d bytes, want %d", len(data), EventBatchHeaderSize+len(report)*EventRecordSize)
+	}
+	got, n, err := DecodeEventBatch(append(data, 0))
+	if err != nil || n != len(data) {
+		t.Fatalf("decoded %d bytes: %v", n, err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("binary round trip = %+v, want %+v", got, report)
+	}
+
+	var fromJSON []EventMessage
+	for _, msg := range report {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m EventMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		fromJSON = append(fromJSON, m)
+	}
+	if !reflect.DeepEqual(got, fromJSON) {
+		t.Errorf("binary = %+v, JSON = %+v", got, fromJSON)
+	}
+
+	if _, _, err := DecodeEventBatch(data[:len(data)-1]); err == nil {
+		t.Error("truncated batch decoded")
+	}
+}
+
+func TestEventHandlerBinary(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	server := httptest.NewServer(NewEventHandler(ps))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "?format=xml"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid format: %v, %v", resp.StatusCode, err)
+	}
+	resp, err := http.Get(server.URL + "?format=binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	publish := func(typ, code uint16, value int32) {
+		ps.Publish(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: typ, Code: code, Value: value},
+		})
+	}
+	publish(events.EvAbs, 0, 10)
+	publish(events.EvAbs, 1, 20)
+	publish(events.EvSyn, 0, 0)
+	// Drawing is left out
+	publish(events.EvAbs, 24, 500)
+	publish(events.EvSyn, 0, 0)
+	publish(events.EvAbs, 24, 0)
+	publish(events.EvSyn, 0, 0)
+
+	var batches [][]EventMessage
+	buf := make([]byte, 0, 256)
+	for len(batches) < 2 {
+		chunk := make([]byte, 256)
+		n, err := resp.Body.Read(chunk)
+		if n == 0 && err != nil {
+			t.Fatalf("stream ended after %d batches: %v", len(batches), err)
+		}
+		buf = append(buf, chunk[:n]...)
+		for {
+			msgs, size, err := DecodeEventBatch(buf)
+			if err != nil {
+				break
+			}
+			batches = append(batches, msgs)
+			buf = buf[size:]
+		}
+	}
+	if len(batches[0]) != 2 || batches[0][0].Value != 10 || batches[0][1].Value != 20 || batches[0][1].Seq != batches[0][0].Seq+1 {
+		t.Errorf("first batch = %+v, want the first report", batches[0])
+	}
+	if len(batches[1]) != 1 || batches[1][0].Code != 24 || batches[1][0].Value != 0 {
+		t.Errorf("second batch = %+v, want the pen lifted", batches[1])
+	}
+	if len(buf) != 0 {
+		t.Errorf("%d bytes left", len(buf))
+	}
+}
+
+// TestBinaryEventsReplay checks that the replayed events are batched by
+// report.
+func TestBinaryEventsReplay(t *testing.T) {
+	missed := append(testReport(), testReport()...)
+	for i := range missed {
+		missed[i].Seq = uint64(i + 1)
+	}
+	missed[1].endOfReport = true
+	missed[len(missed)-1].endOfReport = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/events?format=binary", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	serveBinaryEvents(w, r, make(chan EventMessage), missed)
+
+	data := w.Body.Bytes()
+	var sizes []int
+	for len(data) > 0 {
+		msgs, n, err := DecodeEventBatch(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(msgs))
+		data = data[n:]
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 4}) {
+		t.Errorf("batches of %v events, want [2 4]", sizes)
+	}
+}
@@ -0,0 +1,53 @@
+package eventhttphandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/owulveryck/goMarkableStream/internal/actions"
+)
+
+// NewCommandHandler creates a handler streaming the commands broadcast to the viewers
+func NewCommandHandler(viewers *actions.Viewers) *CommandHandler {
+	return &CommandHandler{
+		viewers: viewers,
+	}
+}
+
+// CommandHandler is a http.Handler that streams the commands triggered by
+// server-side actions (such as slide navigation) as newline delimited JSON.
+type CommandHandler struct {
+	viewers *actions.Viewers
+}
+
+// ServeHTTP implements http.Handler
+func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	commandC := h.viewers.Subscribe()
+	defer h.viewers.Unsubscribe(commandC)
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		// Send the headers right away so the client knows it is connected
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case cmd, ok := <-commandC:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(cmd); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
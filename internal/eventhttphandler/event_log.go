@@ -0,0 +1,155 @@
+package eventhttphandler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+const (
+	// eventsTopic is the name of the topic of the numbered events on the bus
+	eventsTopic = "events/pen"
+	// replaySize is the number of events kept for the clients reconnecting
+	replaySize = 256
+	// retryDelay is the reconnection delay sent to the clients
+	retryDelay = time.Second
+)
+
+// EventMessage is an input event sent on /events.
+type EventMessage struct {
+	events.InputEventFromSource
+	// Seq is the sequence number of the event, also sent as the id of
+	// the server-sent event
+	Seq uint64
+	// Time is the kernel timestamp of the event in Unix microseconds, or
+	// 0 if unknown
+	Time int64
+	// endOfReport is set on the last kept event of a report, for the
+	// binary format to batch the replayed events by report
+	endOfReport bool
+}
+
+// eventLog numbers the hover events of the pen and keeps the last ones,
+// so that the clients reconnecting with Last-Event-ID get the events they
+// missed. The numbered events are published on the eventsTopic of the bus.
+// The EV_SYN events ending the reports are neither numbered nor kept: they
+// are only published, and mark the last kept event of the report.
+type eventLog struct {
+	input *pubsub.PubSub
+	topic *bus.Topic[EventMessage]
+	start sync.Once
+
+	// mu serializes the publications with the subscriptions, for the
+	// subscribers to get each event once, replayed or published
+	mu   sync.Mutex
+	seq  uint64
+	ring []EventMessage
+	next int
+}
+
+func newEventLog(ps *pubsub.PubSub) *eventLog {
+	return &eventLog{
+		input: ps,
+		topic: bus.NewTopic[EventMessage](ps.Bus(), eventsTopic),
+		// The ids keep increasing when the server restarts, so that the
+		// ids of the previous run are older than the buffer
+		seq:  uint64(time.Now().UnixMicro()),
+		ring: make([]EventMessage, 0, replaySize),
+	}
+}
+
+// run numbers the hover events until ctx is done.
+func (l *eventLog) run(ctx context.Context, eventC chan events.InputEventFromSource) {
+	defer l.input.Unsubscribe(eventC)
+
+	// Track current pressure to determine if pen is hovering or drawing
+	var currentPressure int32
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-eventC:
+			if event.Type != events.EvAbs && event.Type != events.EvSyn {
+				continue
+			}
+			// Update pressure tracking from ABS_PRESSURE events
+			if event.Type == events.EvAbs && event.Code == events.AbsPressure {
+				currentPressure = event.Value
+			}
+			// Only send events when pen is hovering (not touching)
+			// When pen is down (drawing), the frame stream provides visual feedback
+			// so individual coordinate events are redundant
+			if currentPressure <= events.PressureThreshold {
+				l.add(event)
+			}
+		}
+	}
+}
+
+// add numbers an event and sends it to the subscribers.
+func (l *eventLog) add(event events.InputEventFromSource) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if event.Type == events.EvSyn {
+		l.endReport(event)
+		return
+	}
+	l.seq++
+	msg := EventMessage{
+		InputEventFromSource: event,
+		Seq:                  l.seq,
+	}
+	if event.Time.Sec != 0 || event.Time.Usec != 0 {
+		msg.Time = int64(event.Time.Sec)*1e6 + int64(event.Time.Usec)
+	}
+	if len(l.ring) < cap(l.ring) {
+		l.ring = append(l.ring, msg)
+	} else {
+		l.ring[l.next] = msg
+		l.next = (l.next + 1) % len(l.ring)
+	}
+	l.topic.Publish(msg)
+}
+
+// endReport marks the last kept event as the end of a report and publishes
+// the EV_SYN event.
+func (l *eventLog) endReport(event events.InputEventFromSource) {
+	if n := len(l.ring); n > 0 {
+		l.ring[(l.next+n-1)%n].endOfReport = true
+	}
+	l.topic.Publish(EventMessage{InputEventFromSource: event})
+}
+
+// subscribe returns a subscription receiving the next events and, if resume
+// is set, the kept events numbered after lastID. A slow subscriber loses
+// the events it has no room for.
+func (l *eventLog) subscribe(lastID uint64, resume bool) (*bus.Subscription[EventMessage], []EventMessage) {
+	l.start.Do(func() {
+		// Subscribe only to Pen events, of type EvAbs and EvSyn
+		penSource := events.Pen
+		eventC := l.input.SubscribeWithFilter("eventLog", pubsub.EventFilter{
+			Source: &penSource,
+		})
+		// The log runs for the lifetime of the server to keep the events
+		// sent while the clients reconnect
+		go l.run(context.Background(), eventC)
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sub := l.topic.Subscribe("events", bus.Options[EventMessage]{})
+	if !resume {
+		return sub, nil
+	}
+	var missed []EventMessage
+	for i := range l.ring {
+		msg := l.ring[(l.next+i)%len(l.ring)]
+		if msg.Seq > lastID {
+			missed = append(missed, msg)
+		}
+	}
+	return sub, missed
+}
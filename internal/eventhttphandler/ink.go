@@ -0,0 +1,197 @@
+package eventhttphandler
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/strokes"
+)
+
+// Kinds of the ink records
+const (
+	// InkPoints is a batch of positions of the pen touching the screen
+	InkPoints byte = 1
+	// InkPenUp ends a stroke: the provisional ink of the stroke can be
+	// removed once the next frame arrives
+	InkPenUp byte = 2
+)
+
+// Tools of the ink records
+const (
+	// InkToolPen is the tip of the pen
+	InkToolPen byte = 0
+	// InkToolEraser is the eraser end of the pen
+	InkToolEraser byte = 1
+)
+
+const (
+	// InkHeaderSize is the size of the header of an ink record:
+	// kind (1 byte), tool (1 byte), number of points (2 bytes), stroke
+	// number (4 bytes) and time of the first point in Unix milliseconds
+	// (8 bytes), little-endian.
+	InkHeaderSize = 16
+	// InkPointSize is the size of a point: X, Y, pressure and time since
+	// the time of the record in milliseconds, as 2-byte little-endian
+	// values. X and Y are fractions of the width and height of the screen,
+	// from 0 to 65535, as displayed by the viewer.
+	InkPointSize = 8
+
+	// inkMaxPoints is the maximum number of points of a record
+	inkMaxPoints = 64
+)
+
+// errShortInk is returned when decoding a truncated ink record
+var errShortInk = errors.New("short ink record")
+
+// InkPoint is a position of the pen in an ink record.
+type InkPoint struct {
+	X, Y     uint16
+	Pressure uint16
+	// DT is the time since the time of the record, in milliseconds
+	DT uint16
+}
+
+// InkRecord is a record of the ink stream.
+type InkRecord struct {
+	Kind   byte
+	Tool   byte
+	Stroke uint32
+	Time   time.Time
+	Points []InkPoint
+}
+
+// AppendInkRecord appends the binary encoding of r to dst.
+func AppendInkRecord(dst []byte, r InkRecord) []byte {
+	dst = append(dst, r.Kind, r.Tool)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(r.Points)))
+	dst = binary.LittleEndian.AppendUint32(dst, r.Stroke)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(r.Time.UnixMilli()))
+	for _, p := range r.Points {
+		dst = binary.LittleEndian.AppendUint16(dst, p.X)
+		dst = binary.LittleEndian.AppendUint16(dst, p.Y)
+		dst = binary.LittleEndian.AppendUint16(dst, p.Pressure)
+		dst = binary.LittleEndian.AppendUint16(dst, p.DT)
+	}
+	return dst
+}
+
+// DecodeInkRecord decodes the record at the start of data and returns its
+// size.
+func DecodeInkRecord(data []byte) (InkRecord, int, error) {
+	if len(data) < InkHeaderSize {
+		return InkRecord{}, 0, errShortInk
+	}
+	n := int(binary.LittleEndian.Uint16(data[2:]))
+	size := InkHeaderSize + n*InkPointSize
+	if len(data) < size {
+		return InkRecord{}, 0, errShortInk
+	}
+	r := InkRecord{
+		Kind:   data[0],
+		Tool:   data[1],
+		Stroke: binary.LittleEndian.Uint32(data[4:]),
+		Time:   time.UnixMilli(int64(binary.LittleEndian.Uint64(data[8:]))),
+		Points: make([]InkPoint, n),
+	}
+	for i := range r.Points {
+		p := data[InkHeaderSize+i*InkPointSize:]
+		r.Points[i] = InkPoint{
+			X:        binary.LittleEndian.Uint16(p),
+			Y:        binary.LittleEndian.Uint16(p[2:]),
+			Pressure: binary.LittleEndian.Uint16(p[4:]),
+			DT:       binary.LittleEndian.Uint16(p[6:]),
+		}
+	}
+	return r, size, nil
+}
+
+// inkBuilder turns the strokes of the pen into ink records, as they are
+// drawn.
+type inkBuilder struct {
+	strokes *strokes.Builder
+
+	stroke uint32 // Number of the current stroke
+	sent   int    // Points of the current stroke in a batch
+	batch  InkRecord
+}
+
+// newInkBuilder creates a builder converting the pen positions to the
+// screen with the mapping of the pen.
+func newInkBuilder(mapping inject.DeviceMapping) *inkBuilder {
+	// Strokes on a 1x1 screen hold the fractions of the screen
+	return &inkBuilder{strokes: strokes.NewBuilder(mapping, 1, 1)}
+}
+
+// handleEvent processes a pen event and appends the finished records to
+// out: a full batch, or the end of a stroke.
+func (b *inkBuilder) handleEvent(ev events.InputEvent, out []byte) []byte {
+	if s, done := b.strokes.HandleEvent(ev); done {
+		out = b.add(&s, out)
+		out = b.flush(out)
+		b.sent = 0
+		return AppendInkRecord(out, InkRecord{Kind: InkPenUp, Tool: inkTool(s.Tool), Stroke: b.stroke, Time: ev.Timestamp()})
+	}
+	if s := b.strokes.Current(); s != nil {
+		out = b.add(s, out)
+	}
+	return out
+}
+
+// add batches the points of the stroke not sent yet, and appends the full
+// batches to out.
+func (b *inkBuilder) add(s *strokes.Stroke, out []byte) []byte {
+	if b.sent == 0 && len(s.Points) > 0 {
+		b.stroke++
+	}
+	for _, p := range s.Points[b.sent:] {
+		t := s.Start.Add(time.Duration(p.T) * time.Millisecond)
+		if len(b.batch.Points) == 0 {
+			b.batch.Time = t
+			b.batch.Tool = inkTool(s.Tool)
+		}
+		b.batch.Points = append(b.batch.Points, InkPoint{
+			X:        fraction(float64(p.X)),
+			Y:        fraction(float64(p.Y)),
+			Pressure: uint16(math.Round(float64(p.Pressure) * strokes.MaxPressure)),
+			DT:       uint16(min(max(t.Sub(b.batch.Time).Milliseconds(), 0), math.MaxUint16)),
+		})
+		if len(b.batch.Points) == inkMaxPoints {
+			out = b.flush(out)
+		}
+	}
+	b.sent = len(s.Points)
+	return out
+}
+
+// flush appends the pending points to out.
+func (b *inkBuilder) flush(out []byte) []byte {
+	if len(b.batch.Points) == 0 {
+		return out
+	}
+	b.batch.Kind, b.batch.Stroke = InkPoints, b.stroke
+	out = AppendInkRecord(out, b.batch)
+	b.batch.Points = b.batch.Points[:0]
+	return out
+}
+
+// pending reports whether points are waiting to be flushed.
+func (b *inkBuilder) pending() bool {
+	return len(b.batch.Points) > 0
+}
+
+// inkTool returns the tool of a stroke in the ink records.
+func inkTool(tool strokes.Tool) byte {
+	if tool == strokes.ToolEraser {
+		return InkToolEraser
+	}
+	return InkToolPen
+}
+
+// fraction converts a normalized coordinate to 16 bits.
+func fraction(f float64) uint16 {
+	return uint16(math.Round(f * math.MaxUint16))
+}
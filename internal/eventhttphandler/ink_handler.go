@@ -0,0 +1,88 @@
+package eventhttphandler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// inkFlushInterval is the maximum time the points of a stroke wait to be
+// sent in a batch
+const inkFlushInterval = 10 * time.Millisecond
+
+// InkHandler streams the positions of the pen while it touches the
+// screen. EventHandler leaves them out as the frames show the ink, but
+// only once the tablet has rendered it; with the ink stream the clients
+// can draw provisional ink right away and remove it when the frame
+// arrives.
+//
+// The response is a sequence of binary records (see AppendInkRecord).
+type InkHandler struct {
+	inputEventBus *pubsub.PubSub
+	mapping       inject.DeviceMapping
+}
+
+// NewInkHandler creates a handler converting the pen positions to the
+// screen with the mapping of the pen.
+func NewInkHandler(inputEvents *pubsub.PubSub, mapping inject.DeviceMapping) *InkHandler {
+	return &InkHandler{
+		inputEventBus: inputEvents,
+		mapping:       mapping,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *InkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The position, the pressure and the tool are reported by different
+	// event types
+	penSource := events.Pen
+	eventC := h.inputEventBus.SubscribeWithFilter("inkListener", pubsub.EventFilter{
+		Source: &penSource,
+	})
+	defer h.inputEventBus.Unsubscribe(eventC)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	b := newInkBuilder(h.mapping)
+	flush := time.NewTimer(inkFlushInterval)
+	flush.Stop()
+	defer flush.Stop()
+	var out []byte
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-eventC:
+			out = b.handleEvent(ev.InputEvent, out[:0])
+			if b.pending() {
+				// The first point of a batch starts the timer
+				if len(b.batch.Points) == 1 {
+					flush.Reset(inkFlushInterval)
+				}
+			} else {
+				flush.Stop()
+			}
+		case <-flush.C:
+			out = b.flush(out[:0])
+		}
+		if len(out) == 0 {
+			continue
+		}
+		if _, err := w.Write(out); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
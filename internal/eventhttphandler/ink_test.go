@@ -0,0 +1,153 @@
+package eventhttphandler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+var inkMapping = inject.DeviceMapping{
+	X: inject.Axis{Code: inject.AbsX, Max: 1000},
+	Y: inject.Axis{Code: inject.AbsY, Max: 1000},
+}
+
+var inkStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// penSample returns the events of a pen sample at ms milliseconds.
+func penSample(x, y, pressure int32, ms int) []events.InputEvent {
+	tv := syscall.NsecToTimeval(inkStart.Add(time.Duration(ms) * time.Millisecond).UnixNano())
+	return []events.InputEvent{
+		{Time: tv, Type: events.EvAbs, Code: inject.AbsX, Value: x},
+		{Time: tv, Type: events.EvAbs, Code: inject.AbsY, Value: y},
+		{Time: tv, Type: events.EvAbs, Code: inject.AbsPressure, Value: pressure},
+		{Time: tv, Type: events.EvSyn},
+	}
+}
+
+// decodeInk decodes a sequence of records.
+func decodeInk(t *testing.T, data []byte) []InkRecord {
+	t.Helper()
+	var records []InkRecord
+	for len(data) > 0 {
+		r, n, err := DecodeInkRecord(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+		data = data[n:]
+	}
+	return records
+}
+
+func TestInkRecordRoundTrip(t *testing.T) {
+	r := InkRecord{
+		Kind:   InkPoints,
+		Tool:   InkToolEraser,
+		Stroke: 70000,
+		Time:   inkStart,
+		Points: []InkPoint{{X: 1, Y: 65535, Pressure: 4095, DT: 0}, {X: 300, Y: 2, Pressure: 120, DT: 9}},
+	}
+	data := AppendInkRecord(nil, r)
+	if len(data) != InkHeaderSize+2*InkPointSize {
+		t.Fatalf("record of %d bytes, want %d", len(data), InkHeaderSize+2*InkPointSize)
+	}
+	got, n, err := DecodeInkRecord(append(data, 0xff))
+	if err != nil || n != len(data) {
+		t.Fatalf("decoded %d bytes: %v", n, err)
+	}
+	if !got.Time.Equal(r.Time) || !reflect.DeepEqual(got.Points, r.Points) || got.Stroke != r.Stroke || got.Tool != r.Tool {
+		t.Errorf("got %+v, want %+v", got, r)
+	}
+	if _, _, err := DecodeInkRecord(data[:len(data)-1]); err == nil {
+		t.Error("truncated record decoded")
+	}
+}
+
+func TestInkBuilder(t *testing.T) {
+	b := newInkBuilder(inkMapping)
+	var out []byte
+	feed := func(evs []events.InputEvent) {
+		for _, ev := range evs {
+			out = b.handleEvent(ev, out)
+		}
+	}
+	// Hovering is not sent
+	feed(penSample(100, 100, 0, 0))
+	if len(out) != 0 || b.pending() {
+		t.Fatalf("hover produced %d bytes", len(out))
+	}
+	feed(penSample(0, 500, 2000, 10))
+	feed(penSample(1000, 1000, 3000, 14))
+	if len(out) != 0 || !b.pending() {
+		t.Fatal("points sent before the batch is flushed")
+	}
+	feed(penSample(1000, 1000, 0, 20))
+	records := decodeInk(t, out)
+	if len(records) != 2 || records[0].Kind != InkPoints || records[1].Kind != InkPenUp {
+		t.Fatalf("records = %+v, want the points and the pen up", records)
+	}
+	want := []InkPoint{{X: 0, Y: 32768, Pressure: 2000, DT: 0}, {X: 65535, Y: 65535, Pressure: 3000, DT: 4}}
+	if !reflect.DeepEqual(records[0].Points, want) || records[0].Stroke != 1 || !records[0].Time.Equal(inkStart.Add(10*time.Millisecond)) {
+		t.Errorf("points = %+v, want %+v of stroke 1 at 10ms", records[0], want)
+	}
+
+	// A long stroke is sent in full batches
+	out = out[:0]
+	for i := range inkMaxPoints + 1 {
+		feed(penSample(int32(i), 0, 1000, 100+i))
+	}
+	records = decodeInk(t, out)
+	if len(records) != 1 || len(records[0].Points) != inkMaxPoints || records[0].Stroke != 2 {
+		t.Fatalf("records = %d, want a full batch of stroke 2", len(records))
+	}
+	if out = b.flush(out[:0]); len(decodeInk(t, out)[0].Points) != 1 {
+		t.Error("the last point is not flushed")
+	}
+}
+
+func TestInkHandler(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	server := httptest.NewServer(NewInkHandler(ps, inkMapping))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	publish := func(evs []events.InputEvent) {
+		for _, ev := range evs {
+			ps.Publish(events.InputEventFromSource{Source: events.Pen, InputEvent: ev})
+		}
+	}
+	publish(penSample(500, 500, 1000, 0))
+	// The point is sent by the timer
+	buf := make([]byte, InkHeaderSize+InkPointSize)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	if r := decodeInk(t, buf); r[0].Kind != InkPoints || r[0].Points[0].X != 32768 {
+		t.Errorf("record = %+v", r[0])
+	}
+	publish(penSample(500, 500, 0, 5))
+	buf = buf[:InkHeaderSize]
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	if r := decodeInk(t, buf); r[0].Kind != InkPenUp || r[0].Stroke != 1 {
+		t.Errorf("record = %+v, want the pen up", r[0])
+	}
+}
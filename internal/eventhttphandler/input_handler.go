@@ -0,0 +1,149 @@
+package eventhttphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+)
+
+const (
+	// maxInputPoints bounds the number of points of an injected stroke
+	maxInputPoints = 4096
+	// maxInputDuration bounds the duration of an injected swipe or stroke
+	maxInputDuration = 5 * time.Second
+	// maxInputBody bounds the size of an /input request
+	maxInputBody = 1 << 20
+)
+
+// NewInputHandler creates a handler injecting the requested gestures on the
+// tablet. width and height are the default size of the coordinate space, in
+// screen pixels.
+func NewInputHandler(injector *inject.Injector, limiter *inject.Limiter, width, height int) *InputHandler {
+	return &InputHandler{
+		injector: injector,
+		limiter:  limiter,
+		width:    float64(width),
+		height:   float64(height),
+	}
+}
+
+// InputHandler is a http.Handler accepting taps, swipes and pen strokes to
+// replay on the tablet.
+type InputHandler struct {
+	injector      *inject.Injector
+	limiter       *inject.Limiter
+	width, height float64
+}
+
+// inputRequest is the body of a POST /input request. Coordinates are in
+// pixels of a width x height screen (the framebuffer size by default).
+type inputRequest struct {
+	Type     string       `json:"type"`   // tap, swipe or stroke
+	Device   string       `json:"device"` // touch (default for tap and swipe) or pen (default for stroke)
+	X        float64      `json:"x"`
+	Y        float64      `json:"y"`
+	ToX      float64      `json:"toX"`
+	ToY      float64      `json:"toY"`
+	Points   [][2]float64 `json:"points"`
+	Duration int          `json:"duration"` // milliseconds
+	Width    float64      `json:"width"`
+	Height   float64      `json:"height"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *InputHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req inputRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInputBody)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if err := h.inject(r, req); err != nil {
+		var badRequest *inputError
+		if errors.As(err, &badRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Input injection failed: %v", err)
+		http.Error(w, "Input injection failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inputError reports an invalid request
+type inputError struct {
+	reason string
+}
+
+func (e *inputError) Error() string {
+	return e.reason
+}
+
+func (h *InputHandler) inject(r *http.Request, req inputRequest) error {
+	width, height := h.width, h.height
+	if req.Width > 0 && req.Height > 0 {
+		width, height = req.Width, req.Height
+	}
+	point := func(x, y float64) inject.Point {
+		return inject.Point{X: x / width, Y: y / height}
+	}
+	duration := time.Duration(req.Duration) * time.Millisecond
+	if duration < 0 || duration > maxInputDuration {
+		return &inputError{fmt.Sprintf("duration must be between 0 and %d ms", maxInputDuration.Milliseconds())}
+	}
+
+	defaultSource := events.Touch
+	if req.Type == "stroke" {
+		defaultSource = events.Pen
+	}
+	var source int
+	switch req.Device {
+	case "":
+		source = defaultSource
+	case "touch":
+		source = events.Touch
+	case "pen":
+		source = events.Pen
+	default:
+		return &inputError{fmt.Sprintf("unknown device %q", req.Device)}
+	}
+
+	ctx := r.Context()
+	switch req.Type {
+	case "tap":
+		return h.injector.Tap(ctx, source, point(req.X, req.Y))
+	case "swipe":
+		if duration == 0 {
+			duration = 300 * time.Millisecond
+		}
+		return h.injector.Swipe(ctx, source, point(req.X, req.Y), point(req.ToX, req.ToY), duration)
+	case "stroke":
+		if len(req.Points) == 0 || len(req.Points) > maxInputPoints {
+			return &inputError{fmt.Sprintf("a stroke needs between 1 and %d points", maxInputPoints)}
+		}
+		points := make([]inject.Point, len(req.Points))
+		for i, p := range req.Points {
+			points[i] = point(p[0], p[1])
+		}
+		if duration == 0 {
+			duration = min(time.Duration(len(points)-1)*h.injector.StepInterval, maxInputDuration)
+		}
+		return h.injector.Stroke(ctx, source, points, duration)
+	default:
+		return &inputError{fmt.Sprintf("unknown input type %q", req.Type)}
+	}
+}
@@ -0,0 +1,93 @@
+package eventhttphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+)
+
+func newTestInputHandler(rate float64) (*InputHandler, *inject.MemoryBackend) {
+	backend := inject.NewMemoryBackend()
+	mapping := inject.Mapping{
+		Pen: inject.DeviceMapping{
+			X: inject.Axis{Code: inject.AbsX, Max: 1000},
+			Y: inject.Axis{Code: inject.AbsY, Max: 1000},
+		},
+		Touch: inject.DefaultMapping().Touch,
+	}
+	injector := inject.NewInjector(backend, mapping)
+	injector.TapDuration = 0
+	injector.StepInterval = 0
+	return NewInputHandler(injector, inject.NewLimiter(rate, 1), 100, 200), backend
+}
+
+func TestInputHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"tap", http.MethodPost, `{"type":"tap","x":50,"y":100}`, http.StatusNoContent},
+		{"swipe", http.MethodPost, `{"type":"swipe","x":90,"y":100,"toX":10,"toY":100,"duration":20}`, http.StatusNoContent},
+		{"stroke", http.MethodPost, `{"type":"stroke","points":[[0,0],[50,100]]}`, http.StatusNoContent},
+		{"get", http.MethodGet, ``, http.StatusMethodNotAllowed},
+		{"malformed", http.MethodPost, `{`, http.StatusBadRequest},
+		{"unknown type", http.MethodPost, `{"type":"wave"}`, http.StatusBadRequest},
+		{"unknown device", http.MethodPost, `{"type":"tap","device":"mouse"}`, http.StatusBadRequest},
+		{"empty stroke", http.MethodPost, `{"type":"stroke"}`, http.StatusBadRequest},
+		{"too long", http.MethodPost, `{"type":"swipe","duration":60000}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestInputHandler(0)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/input", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestInputHandlerCoordinates(t *testing.T) {
+	h, backend := newTestInputHandler(0)
+	body := `{"type":"tap","device":"pen","x":50,"y":400,"width":100,"height":800}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/input", strings.NewReader(body)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	var x, y int32 = -1, -1
+	for _, ev := range backend.Events() {
+		if ev.Source != events.Pen {
+			t.Fatalf("event %+v not sent to the pen", ev)
+		}
+		if ev.Type == events.EvAbs && ev.Code == inject.AbsX {
+			x = ev.Value
+		}
+		if ev.Type == events.EvAbs && ev.Code == inject.AbsY {
+			y = ev.Value
+		}
+	}
+	if x != 500 || y != 500 {
+		t.Errorf("pen tapped at (%d, %d), want (500, 500)", x, y)
+	}
+}
+
+func TestInputHandlerRateLimit(t *testing.T) {
+	h, _ := newTestInputHandler(0.001)
+	codes := make([]int, 2)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/input", strings.NewReader(`{"type":"tap"}`)))
+		codes[i] = rec.Code
+	}
+	if codes[0] != http.StatusNoContent || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [204 429]", codes)
+	}
+}
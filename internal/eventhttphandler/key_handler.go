@@ -0,0 +1,110 @@
+package eventhttphandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// Keystroke is a key press sent by the keystroke feed.
+type Keystroke struct {
+	// Key is the label of the key, such as "A" or "Enter"
+	Key string `json:"key"`
+	// Combo is the key with the modifiers held, such as "Ctrl+Shift+Z"
+	Combo  string    `json:"combo"`
+	Code   uint16    `json:"code"`
+	Repeat bool      `json:"repeat,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// modifiers tracks the modifier keys held down
+type modifiers map[uint16]bool
+
+// prefix returns the modifiers held, in a stable order, as a combo prefix
+func (m modifiers) prefix() string {
+	var b strings.Builder
+	for _, mod := range []struct {
+		name        string
+		left, right uint16
+	}{
+		{"Ctrl", events.KeyLeftCtrl, events.KeyRightCtrl},
+		{"Alt", events.KeyLeftAlt, events.KeyRightAlt},
+		{"Shift", events.KeyLeftShift, events.KeyRightShift},
+		{"Meta", events.KeyLeftMeta, events.KeyRightMeta},
+	} {
+		if m[mod.left] || m[mod.right] {
+			b.WriteString(mod.name)
+			b.WriteByte('+')
+		}
+	}
+	return b.String()
+}
+
+// NewKeyHandler creates a handler streaming the keystrokes typed on the keyboard
+func NewKeyHandler(inputEvents *pubsub.PubSub) *KeyHandler {
+	return &KeyHandler{
+		inputEventBus: inputEvents,
+	}
+}
+
+// KeyHandler is a http.Handler that streams the keys pressed on the keyboard
+// as newline delimited JSON, for instance to display them during a
+// presentation. Modifier keys are only reported as part of a combo.
+type KeyHandler struct {
+	inputEventBus *pubsub.PubSub
+}
+
+// ServeHTTP implements http.Handler
+func (h *KeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keyboardSource := events.Keyboard
+	keyType := uint16(events.EvKey)
+	eventC := h.inputEventBus.SubscribeWithFilter("keyListener", pubsub.EventFilter{
+		Source: &keyboardSource,
+		Type:   &keyType,
+	})
+	defer h.inputEventBus.Unsubscribe(eventC)
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	held := make(modifiers)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-eventC:
+			if !ok {
+				return
+			}
+			if events.IsModifier(event.Code) {
+				held[event.Code] = event.Value != events.KeyReleased
+				continue
+			}
+			if event.Value == events.KeyReleased {
+				continue
+			}
+			key := events.KeyName(event.Code)
+			if err := enc.Encode(Keystroke{
+				Key:    key,
+				Combo:  held.prefix() + key,
+				Code:   event.Code,
+				Repeat: event.Value == events.KeyRepeated,
+				Time:   event.Timestamp(),
+			}); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
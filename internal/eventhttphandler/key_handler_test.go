@@ -0,0 +1,74 @@
+package eventhttphandler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+func TestKeyHandler(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	server := httptest.NewServer(NewKeyHandler(ps))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	key := func(source int, code uint16, value int32) {
+		ps.Publish(events.InputEventFromSource{
+			Source:     source,
+			InputEvent: events.InputEvent{Type: events.EvKey, Code: code, Value: value},
+		})
+	}
+	key(events.Keyboard, events.KeyLeftCtrl, events.KeyPressed)
+	key(events.Keyboard, events.KeyLeftShift, events.KeyPressed)
+	key(events.Keyboard, 44, events.KeyPressed) // Z
+	key(events.Keyboard, 44, events.KeyReleased)
+	key(events.Keyboard, events.KeyLeftShift, events.KeyReleased)
+	key(events.Keyboard, events.KeyLeftCtrl, events.KeyReleased)
+	key(events.Pen, 330, events.KeyPressed) // BTN_TOUCH is not a keystroke
+	key(events.Keyboard, 28, events.KeyPressed)
+	key(events.Keyboard, 28, events.KeyRepeated)
+
+	want := []Keystroke{
+		{Key: "Z", Combo: "Ctrl+Shift+Z", Code: 44},
+		{Key: "Enter", Combo: "Enter", Code: 28},
+		{Key: "Enter", Combo: "Enter", Code: 28, Repeat: true},
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for _, w := range want {
+		if !scanner.Scan() {
+			t.Fatalf("stream ended before %+v: %v", w, scanner.Err())
+		}
+		var got Keystroke
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		got.Time = time.Time{}
+		if got != w {
+			t.Errorf("got %+v, want %+v", got, w)
+		}
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	if got := events.KeyName(30); got != "A" {
+		t.Errorf("KeyName(30) = %q, want A", got)
+	}
+	if got := events.KeyName(999); got != "Key999" {
+		t.Errorf("KeyName(999) = %q, want Key999", got)
+	}
+}
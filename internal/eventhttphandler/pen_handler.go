@@ -4,42 +4,60 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"github.com/owulveryck/goMarkableStream/internal/bus"
 	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/power"
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
 )
 
-const (
-	// pressureThreshold defines the minimum pressure value to consider the pen as "touching"
-	// Values below this are considered "hovering" and should generate SSE events
-	// Values above this mean the pen is drawing, so frame stream handles visualization
-	pressureThreshold int32 = 100
-)
-
 // NewEventHandler creates an event habdler that subscribes from the inputEvents
 func NewEventHandler(inputEvents *pubsub.PubSub) *EventHandler {
 	return &EventHandler{
-		inputEventBus: inputEvents,
+		log: newEventLog(inputEvents),
 	}
 }
 
 // EventHandler is a http.Handler that servers the input events over http via wabsockets
 type EventHandler struct {
-	inputEventBus *pubsub.PubSub
+	log   *eventLog
+	power *power.Monitor
+	pages *pagechange.Detector
+}
+
+// SetPowerMonitor sends the power state changes to the clients as "power"
+// events, so they can tell the device is sleeping.
+func (h *EventHandler) SetPowerMonitor(m *power.Monitor) {
+	h.power = m
+}
+
+// SetPageDetector sends the page turns to the clients as "page-changed"
+// events.
+func (h *EventHandler) SetPageDetector(d *pagechange.Detector) {
+	h.pages = d
 }
 
 // ServeHTTP implements http.Handler
 func (h *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Subscribe only to Pen events of type EvAbs
-	penSource := events.Pen
-	absType := uint16(events.EvAbs)
-	eventC := h.inputEventBus.SubscribeWithFilter("eventListener", pubsub.EventFilter{
-		Source: &penSource,
-		Type:   &absType,
-	})
-	defer func() {
-		h.inputEventBus.Unsubscribe(eventC)
-	}()
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "binary" {
+		http.Error(w, "invalid format \""+format+"\": must be json or binary", http.StatusBadRequest)
+		return
+	}
+
+	// A reconnecting client gets the hover events it missed
+	lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub, missed := h.log.subscribe(lastID, err == nil)
+	defer sub.Close()
+	eventC := sub.C
+
+	if format == "binary" {
+		serveBinaryEvents(w, r, eventC, missed)
+		return
+	}
+
 	// Set necessary headers to indicate a stream
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -52,41 +70,106 @@ func (h *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
 
-	// Track current pressure to determine if pen is hovering or drawing
-	var currentPressure int32
+	if _, err := w.Write([]byte("retry: " + strconv.FormatInt(retryDelay.Milliseconds(), 10) + "\n\n")); err != nil {
+		return
+	}
+	for _, msg := range missed {
+		if writeEventMessage(w, &buf, encoder, msg) != nil {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	var powerC chan power.Status
+	if h.power != nil {
+		powerSub := h.power.Topic().Subscribe("events/power", bus.Options[power.Status]{BufferSize: 8})
+		defer powerSub.Close()
+		powerC = powerSub.C
+		// Tell new clients right away if the device is sleeping
+		if status := h.power.Status(); status.State == power.Sleeping {
+			if writePowerEvent(w, &buf, encoder, status) != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var pageC chan pagechange.Event
+	if h.pages != nil {
+		pageSub := h.pages.Topic().Subscribe("events/page", bus.Options[pagechange.Event]{BufferSize: 8})
+		defer pageSub.Close()
+		pageC = pageSub.C
+	}
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case event := <-eventC:
-			// Update pressure tracking from ABS_PRESSURE events (code 24)
-			if event.Code == 24 {
-				currentPressure = event.Value
+		case ev := <-pageC:
+			if writeNamedEvent(w, &buf, encoder, "page-changed", ev) != nil {
+				return
 			}
-
-			// Only send SSE events when pen is hovering (not touching)
-			// When pen is down (drawing), the frame stream provides visual feedback
-			// so individual coordinate events are redundant
-			if currentPressure <= pressureThreshold {
-				// Reset buffer and encode JSON
-				buf.Reset()
-				if err := encoder.Encode(event); err != nil {
-					http.Error(w, "cannot json encode the message "+err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// Remove trailing newline added by Encode
-				jsonBytes := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
-
-				// Send the event using direct writes (avoids fmt.Fprintf allocation)
-				w.Write([]byte("data: "))
-				w.Write(jsonBytes)
-				w.Write([]byte("\n\n"))
-				if flusher != nil {
-					flusher.Flush() // Ensure client receives the message immediately
-				}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case status := <-powerC:
+			if writePowerEvent(w, &buf, encoder, status) != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case msg := <-eventC:
+			if writeEventMessage(w, &buf, encoder, msg) != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush() // Ensure client receives the message immediately
 			}
-
 		}
 	}
 }
+
+// writeEventMessage sends an input event as a server-sent event with its
+// sequence number as id.
+func writeEventMessage(w http.ResponseWriter, buf *bytes.Buffer, encoder *json.Encoder, msg EventMessage) error {
+	// The EV_SYN events are not numbered: only the binary format uses
+	// them, to end its batches
+	if msg.Type == events.EvSyn {
+		return nil
+	}
+	// Reset buffer and encode JSON
+	buf.Reset()
+	if err := encoder.Encode(msg); err != nil {
+		return err
+	}
+	// Remove trailing newline added by Encode
+	jsonBytes := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	// Send the event using direct writes (avoids fmt.Fprintf allocation)
+	w.Write([]byte("id: " + strconv.FormatUint(msg.Seq, 10) + "\ndata: "))
+	w.Write(jsonBytes)
+	_, err := w.Write([]byte("\n\n"))
+	return err
+}
+
+// writePowerEvent sends the power status as a named "power" server-sent event.
+func writePowerEvent(w http.ResponseWriter, buf *bytes.Buffer, encoder *json.Encoder, status power.Status) error {
+	return writeNamedEvent(w, buf, encoder, "power", status)
+}
+
+// writeNamedEvent sends v as JSON in a server-sent event of the given name.
+func writeNamedEvent(w http.ResponseWriter, buf *bytes.Buffer, encoder *json.Encoder, name string, v any) error {
+	buf.Reset()
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	w.Write([]byte("event: " + name + "\ndata: "))
+	w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	_, err := w.Write([]byte("\n\n"))
+	return err
+}
@@ -1,10 +1,16 @@
 package eventhttphandler
 
 import (
+	"bufio"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/owulveryck/goMarkableStream/internal/events"
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
 )
 
@@ -73,3 +79,141 @@ func TestEventHandlerWithFlusher(t *testing.T) {
 
 	t.Log("Event handler works correctly with Flusher-capable ResponseWriter")
 }
+
+func TestEventLogReplay(t *testing.T) {
+	l := newEventLog(pubsub.NewPubSub())
+	first := l.seq + 1
+	for i := range replaySize + 10 {
+		l.add(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Time: syscall.Timeval{Sec: 2, Usec: 5}, Type: events.EvAbs, Value: int32(i)},
+		})
+	}
+	sub, missed := l.subscribe(0, true)
+	defer sub.Close()
+	if len(missed) != replaySize || missed[0].Seq != first+10 || missed[0].Value != 10 {
+		t.Fatalf("%d events replayed from %+v, want the last %d", len(missed), missed[0], replaySize)
+	}
+	for i := 1; i < len(missed); i++ {
+		if missed[i].Seq != missed[i-1].Seq+1 {
+			t.Fatalf("event %d numbered %d after %d", i, missed[i].Seq, missed[i-1].Seq)
+		}
+	}
+	if missed[0].Time != 2000005 {
+		t.Errorf("time = %d, want the kernel time in microseconds", missed[0].Time)
+	}
+	if _, missed := l.subscribe(missed[len(missed)-3].Seq, true); len(missed) != 2 {
+		t.Errorf("%d events replayed, want 2", len(missed))
+	}
+	if _, missed := l.subscribe(0, false); len(missed) != 0 {
+		t.Errorf("%d events replayed without Last-Event-ID", len(missed))
+	}
+}
+
+// TestEventLogReplaySyn checks that the EV_SYN events take no room in the
+// replay buffer and no sequence number.
+func TestEventLogReplaySyn(t *testing.T) {
+	l := newEventLog(pubsub.NewPubSub())
+	for i := range replaySize {
+		l.add(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: events.EvAbs, Value: int32(i)},
+		})
+		if i%2 == 1 {
+			l.add(events.InputEventFromSource{Source: events.Pen, InputEvent: events.InputEvent{Type: events.EvSyn}})
+		}
+	}
+	sub, missed := l.subscribe(0, true)
+	defer sub.Close()
+	if len(missed) != replaySize || missed[0].Value != 0 {
+		t.Fatalf("%d events replayed from %+v, want %d", len(missed), missed[0], replaySize)
+	}
+	for i, msg := range missed {
+		if msg.Type == events.EvSyn {
+			t.Fatalf("EV_SYN kept at %d", i)
+		}
+		if i > 0 && msg.Seq != missed[i-1].Seq+1 {
+			t.Fatalf("event %d numbered %d after %d", i, msg.Seq, missed[i-1].Seq)
+		}
+		if msg.endOfReport != (i%2 == 1) {
+			t.Errorf("event %d: end of report %v", i, msg.endOfReport)
+		}
+	}
+}
+
+// readEvents reads n server-sent events and returns their ids and data.
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) ([]string, []EventMessage) {
+	t.Helper()
+	var ids []string
+	var msgs []EventMessage
+	for len(msgs) < n && scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var msg EventMessage
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	if len(msgs) < n {
+		t.Fatalf("stream ended after %d events: %v", len(msgs), scanner.Err())
+	}
+	return ids, msgs
+}
+
+func TestEventHandlerResume(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	server := httptest.NewServer(NewEventHandler(ps))
+	defer server.Close()
+
+	connect := func(lastID string) (*http.Response, *bufio.Scanner) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		if !scanner.Scan() || scanner.Text() != "retry: 1000" {
+			t.Fatalf("first line %q, want the retry delay", scanner.Text())
+		}
+		return resp, scanner
+	}
+	abs := func(code uint16, value int32) {
+		ps.Publish(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: events.EvAbs, Code: code, Value: value},
+		})
+	}
+
+	resp, scanner := connect("")
+	abs(0, 1)
+	abs(0, 2)
+	// Drawing is left out
+	abs(24, 500)
+	abs(0, 100)
+	abs(24, 0)
+	abs(0, 3)
+	ids, msgs := readEvents(t, scanner, 4)
+	resp.Body.Close()
+	if msgs[0].Value != 1 || msgs[1].Value != 2 || msgs[2].Code != 24 || msgs[3].Value != 3 {
+		t.Fatalf("events = %+v, want the hover events", msgs)
+	}
+	if ids[1] != strconv.FormatUint(msgs[1].Seq, 10) || msgs[1].Seq != msgs[0].Seq+1 {
+		t.Errorf("ids = %v, sequence numbers %d, %d", ids, msgs[0].Seq, msgs[1].Seq)
+	}
+
+	// The events sent after the id are replayed
+	resp, scanner = connect(ids[1])
+	defer resp.Body.Close()
+	abs(0, 4)
+	_, msgs = readEvents(t, scanner, 3)
+	if msgs[0].Code != 24 || msgs[1].Value != 3 || msgs[2].Value != 4 {
+		t.Errorf("events after reconnecting = %+v", msgs)
+	}
+}
@@ -1,6 +1,9 @@
 package events
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 const (
 	// Input event types
@@ -36,11 +39,40 @@ const (
 	EvFfStatus = 23
 )
 
+const (
+	// Synchronization event codes
+
+	// SynReport commits the pending changes of an input device.
+	SynReport = 0
+	// SynDropped tells that the buffer of events overran and events were
+	// lost.
+	SynDropped = 3
+)
+
+// Pen event codes
+const (
+	// AbsPressure is the code of the EV_ABS events of the pressure of the
+	// pen tip.
+	AbsPressure = 24
+	// BtnToolPen and BtnToolRubber are the codes of the EV_KEY events
+	// reporting the tip or the eraser of the pen in range of the digitizer.
+	BtnToolPen    = 320
+	BtnToolRubber = 321
+
+	// PressureThreshold is the pen pressure above which the pen touches the
+	// screen. Below it, the pen is hovering.
+	PressureThreshold int32 = 100
+)
+
 const (
 	// Pen event
 	Pen int = 1
 	// Touch event
 	Touch int = 2
+	// Keyboard event (such as the Type Folio of the reMarkable Paper Pro)
+	Keyboard int = 3
+	// System event: folio cover switch (EV_SW) and power button
+	System int = 4
 )
 
 // InputEvent from the reMarkable
@@ -55,6 +87,15 @@ type InputEvent struct {
 	Value int32
 }
 
+// Timestamp returns the kernel time of the event, or the current time if
+// the event has none, such as the events created by the server.
+func (ev InputEvent) Timestamp() time.Time {
+	if ev.Time.Sec == 0 && ev.Time.Usec == 0 {
+		return time.Now()
+	}
+	return time.Unix(ev.Time.Unix())
+}
+
 // InputEventFromSource add the source origin
 type InputEventFromSource struct {
 	Source int
@@ -0,0 +1,61 @@
+package events
+
+import "strconv"
+
+// Key event values
+const (
+	// KeyReleased is the value of an EV_KEY event when the key is released
+	KeyReleased = 0
+	// KeyPressed is the value of an EV_KEY event when the key is pressed
+	KeyPressed = 1
+	// KeyRepeated is the value of an EV_KEY event sent by autorepeat
+	KeyRepeated = 2
+)
+
+// Modifier key codes
+const (
+	KeyLeftCtrl   = 29
+	KeyLeftShift  = 42
+	KeyRightShift = 54
+	KeyLeftAlt    = 56
+	KeyRightCtrl  = 97
+	KeyRightAlt   = 100
+	KeyLeftMeta   = 125
+	KeyRightMeta  = 126
+)
+
+// keyNames maps the Linux key codes to the label of the key on a US layout
+// see https://github.com/torvalds/linux/blob/master/include/uapi/linux/input-event-codes.h
+var keyNames = map[uint16]string{
+	1: "Esc", 2: "1", 3: "2", 4: "3", 5: "4", 6: "5", 7: "6", 8: "7", 9: "8", 10: "9", 11: "0",
+	12: "-", 13: "=", 14: "Backspace", 15: "Tab",
+	16: "Q", 17: "W", 18: "E", 19: "R", 20: "T", 21: "Y", 22: "U", 23: "I", 24: "O", 25: "P",
+	26: "[", 27: "]", 28: "Enter", 29: "Ctrl",
+	30: "A", 31: "S", 32: "D", 33: "F", 34: "G", 35: "H", 36: "J", 37: "K", 38: "L",
+	39: ";", 40: "'", 41: "`", 42: "Shift", 43: "\\",
+	44: "Z", 45: "X", 46: "C", 47: "V", 48: "B", 49: "N", 50: "M",
+	51: ",", 52: ".", 53: "/", 54: "Shift", 56: "Alt", 57: "Space", 58: "CapsLock",
+	59: "F1", 60: "F2", 61: "F3", 62: "F4", 63: "F5", 64: "F6", 65: "F7", 66: "F8", 67: "F9", 68: "F10",
+	87: "F11", 88: "F12",
+	97: "Ctrl", 100: "Alt", 102: "Home", 103: "Up", 104: "PageUp", 105: "Left", 106: "Right",
+	107: "End", 108: "Down", 109: "PageDown", 110: "Insert", 111: "Delete",
+	125: "Meta", 126: "Meta",
+}
+
+// KeyName returns the label of a key code, or its number if it is unknown.
+func KeyName(code uint16) string {
+	if name, ok := keyNames[code]; ok {
+		return name
+	}
+	return "Key" + strconv.Itoa(int(code))
+}
+
+// IsModifier reports whether the key code is a modifier (Ctrl, Shift, Alt or
+// Meta).
+func IsModifier(code uint16) bool {
+	switch code {
+	case KeyLeftCtrl, KeyRightCtrl, KeyLeftShift, KeyRightShift, KeyLeftAlt, KeyRightAlt, KeyLeftMeta, KeyRightMeta:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,445 @@
+package gesture
+
+import (
+	"math"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// Kind of a recognized gesture
+type Kind string
+
+const (
+	// KindTap is a short touch without movement
+	KindTap Kind = "tap"
+	// KindDoubleTap is a second tap shortly after a first one, at the same place
+	KindDoubleTap Kind = "double-tap"
+	// KindLongPress is a touch held without movement
+	KindLongPress Kind = "long-press"
+	// KindSwipe is a movement of one or more fingers in the same direction
+	KindSwipe Kind = "swipe"
+	// KindPinch is two fingers moving closer (in) or apart (out)
+	KindPinch Kind = "pinch"
+	// KindEdgeSwipe is a one finger swipe starting from an edge toward the center
+	KindEdgeSwipe Kind = "edge-swipe"
+)
+
+// Direction of a swipe, in screen space, or of a pinch ("in" or "out")
+type Direction string
+
+// Swipe directions, from the point of view of someone facing the screen, and
+// pinch directions.
+const (
+	DirectionLeft      Direction = "left"
+	DirectionRight     Direction = "right"
+	DirectionUp        Direction = "up"
+	DirectionDown      Direction = "down"
+	DirectionUpLeft    Direction = "up-left"
+	DirectionUpRight   Direction = "up-right"
+	DirectionDownLeft  Direction = "down-left"
+	DirectionDownRight Direction = "down-right"
+	DirectionIn        Direction = "in"
+	DirectionOut       Direction = "out"
+)
+
+// Zone is the area of the screen where a gesture started
+type Zone string
+
+// Start zones: the edges and corners are EdgeMargin wide.
+const (
+	ZoneCenter      Zone = "center"
+	ZoneLeft        Zone = "left"
+	ZoneRight       Zone = "right"
+	ZoneTop         Zone = "top"
+	ZoneBottom      Zone = "bottom"
+	ZoneTopLeft     Zone = "top-left"
+	ZoneTopRight    Zone = "top-right"
+	ZoneBottomLeft  Zone = "bottom-left"
+	ZoneBottomRight Zone = "bottom-right"
+)
+
+// Gesture is a recognized gesture. Coordinates and distances are expressed in
+// screen space (see Config), in digitizer units.
+type Gesture struct {
+	Kind      Kind      `json:"type"`
+	Fingers   int       `json:"fingers"`
+	Direction Direction `json:"direction,omitempty"`
+	// Velocity is the average speed in units per second (swipes and pinches)
+	Velocity float64 `json:"velocity,omitempty"`
+	// Distance travelled (swipes) in units
+	Distance float64 `json:"distance,omitempty"`
+	// Scale is the ratio between the final and initial finger spread (pinches)
+	Scale     float64       `json:"scale,omitempty"`
+	StartZone Zone          `json:"zone"`
+	X         int32         `json:"x"`
+	Y         int32         `json:"y"`
+	Duration  time.Duration `json:"duration"`
+	Time      time.Time     `json:"time"`
+}
+
+// Config holds the recognizer thresholds and the mapping from the digitizer
+// axes to the screen space.
+type Config struct {
+	// MaxX and MaxY are the maximum values of ABS_MT_POSITION_X and ABS_MT_POSITION_Y
+	MaxX, MaxY int32
+	// SwapXY uses the digitizer Y axis as the horizontal screen axis
+	SwapXY bool
+	// InvertX and InvertY flip the screen axes (applied after SwapXY)
+	InvertX, InvertY bool
+
+	TapMaxDuration    time.Duration
+	TapMaxMovement    float64
+	DoubleTapInterval time.Duration
+	LongPressDuration time.Duration
+	SwipeMinDistance  float64
+	// PinchMinScale is the minimal relative change of the finger spread
+	// for a two fingers gesture to be a pinch
+	PinchMinScale float64
+	// EdgeMargin is the width of the edge zones
+	EdgeMargin int32
+}
+
+// DefaultConfig returns the configuration for the current device. The axis
+// mapping matches the orientation historically used by the /gestures endpoint:
+// ABS_MT_POSITION_Y is the horizontal axis and ABS_MT_POSITION_X the vertical one.
+func DefaultConfig() Config {
+	return Config{
+		MaxX:              remarkable.TouchMaxXValue,
+		MaxY:              remarkable.TouchMaxYValue,
+		SwapXY:            true,
+		InvertX:           true,
+		TapMaxDuration:    250 * time.Millisecond,
+		TapMaxMovement:    40,
+		DoubleTapInterval: 350 * time.Millisecond,
+		LongPressDuration: 700 * time.Millisecond,
+		SwipeMinDistance:  400,
+		PinchMinScale:     0.25,
+		EdgeMargin:        100,
+	}
+}
+
+type point struct {
+	x, y float64
+}
+
+func (p point) dist(o point) float64 {
+	return math.Hypot(p.x-o.x, p.y-o.y)
+}
+
+// track is the history of one contact during a touch session
+type track struct {
+	start, last point
+}
+
+// Recognizer detects gestures from the successive frames of a Tracker.
+// A touch session starts when the first finger lands and ends when the last
+// finger is lifted; most gestures are emitted at the end of the session.
+type Recognizer struct {
+	cfg Config
+
+	active     bool
+	start      time.Time
+	last       time.Time
+	maxFingers int
+	tracks     map[int32]*track
+	order      []int32 // tracking IDs in landing order
+	moved      bool    // true once any contact left the tap slop
+	longFired  bool
+	pinchBase  float64 // spread of the first two fingers when the second landed
+	pinchIDs   [2]int32
+	hasPinch   bool
+	lastTap    time.Time
+	lastTapPos point
+	hasLastTap bool
+}
+
+// NewRecognizer creates a recognizer.
+func NewRecognizer(cfg Config) *Recognizer {
+	return &Recognizer{
+		cfg:    cfg,
+		tracks: make(map[int32]*track),
+	}
+}
+
+// toScreen maps digitizer coordinates to the screen space.
+func (r *Recognizer) toScreen(c Contact) point {
+	x, y := float64(c.X), float64(c.Y)
+	maxX, maxY := float64(r.cfg.MaxX), float64(r.cfg.MaxY)
+	if r.cfg.SwapXY {
+		x, y = y, x
+		maxX, maxY = maxY, maxX
+	}
+	if r.cfg.InvertX {
+		x = maxX - x
+	}
+	if r.cfg.InvertY {
+		y = maxY - y
+	}
+	return point{x, y}
+}
+
+// screenSize returns the width and height of the screen space.
+func (r *Recognizer) screenSize() (float64, float64) {
+	if r.cfg.SwapXY {
+		return float64(r.cfg.MaxY), float64(r.cfg.MaxX)
+	}
+	return float64(r.cfg.MaxX), float64(r.cfg.MaxY)
+}
+
+// Update processes a frame and returns the gestures completed by it.
+func (r *Recognizer) Update(f Frame) []Gesture {
+	var out []Gesture
+	if len(f.Contacts) == 0 {
+		if r.active {
+			r.last = f.Time
+			if g, ok := r.finish(); ok {
+				out = append(out, g)
+			}
+		}
+		return out
+	}
+
+	if !r.active {
+		r.begin(f.Time)
+	}
+	r.last = f.Time
+
+	for _, c := range f.Contacts {
+		p := r.toScreen(c)
+		t, ok := r.tracks[c.TrackingID]
+		if !ok {
+			t = &track{start: p}
+			r.tracks[c.TrackingID] = t
+			r.order = append(r.order, c.TrackingID)
+			if len(r.order) == 2 {
+				r.pinchIDs = [2]int32{r.order[0], r.order[1]}
+				r.pinchBase = r.tracks[r.order[0]].last.dist(p)
+				r.hasPinch = r.pinchBase > 0
+			}
+		}
+		t.last = p
+		if t.last.dist(t.start) > r.cfg.TapMaxMovement {
+			r.moved = true
+		}
+	}
+	r.maxFingers = max(r.maxFingers, len(f.Contacts))
+
+	if g, ok := r.checkLongPress(f.Time); ok {
+		out = append(out, g)
+	}
+	return out
+}
+
+// Tick must be called periodically: the panel does not report anything while
+// the fingers are still, so long-presses are detected on the clock.
+func (r *Recognizer) Tick(now time.Time) []Gesture {
+	if g, ok := r.checkLongPress(now); ok {
+		return []Gesture{g}
+	}
+	return nil
+}
+
+func (r *Recognizer) begin(at time.Time) {
+	r.active = true
+	r.start = at
+	r.maxFingers = 0
+	clear(r.tracks)
+	r.order = r.order[:0]
+	r.moved = false
+	r.longFired = false
+	r.hasPinch = false
+}
+
+func (r *Recognizer) checkLongPress(now time.Time) (Gesture, bool) {
+	if !r.active || r.longFired || r.moved {
+		return Gesture{}, false
+	}
+	if now.Sub(r.start) < r.cfg.LongPressDuration {
+		return Gesture{}, false
+	}
+	r.longFired = true
+	origin := r.origin()
+	return Gesture{
+		Kind:      KindLongPress,
+		Fingers:   r.maxFingers,
+		StartZone: r.zone(origin),
+		X:         int32(origin.x),
+		Y:         int32(origin.y),
+		Duration:  now.Sub(r.start),
+		Time:      now,
+	}, true
+}
+
+// origin is the centroid of the starting points of the session.
+func (r *Recognizer) origin() point {
+	var c point
+	for _, id := range r.order {
+		c.x += r.tracks[id].start.x
+		c.y += r.tracks[id].start.y
+	}
+	n := float64(len(r.order))
+	if n == 0 {
+		return c
+	}
+	return point{c.x / n, c.y / n}
+}
+
+// displacement is the mean displacement of all the contacts of the session.
+func (r *Recognizer) displacement() point {
+	var d point
+	for _, id := range r.order {
+		t := r.tracks[id]
+		d.x += t.last.x - t.start.x
+		d.y += t.last.y - t.start.y
+	}
+	n := float64(len(r.order))
+	if n == 0 {
+		return d
+	}
+	return point{d.x / n, d.y / n}
+}
+
+func (r *Recognizer) finish() (Gesture, bool) {
+	r.active = false
+	duration := r.last.Sub(r.start)
+	origin := r.origin()
+	g := Gesture{
+		Fingers:   r.maxFingers,
+		StartZone: r.zone(origin),
+		X:         int32(origin.x),
+		Y:         int32(origin.y),
+		Duration:  duration,
+		Time:      r.last,
+	}
+	seconds := duration.Seconds()
+
+	if r.longFired {
+		// Already reported while the fingers were down
+		return Gesture{}, false
+	}
+
+	if !r.moved {
+		if duration >= r.cfg.LongPressDuration {
+			// Released before a Tick noticed the press
+			g.Kind = KindLongPress
+			return g, true
+		}
+		if duration > r.cfg.TapMaxDuration {
+			return Gesture{}, false
+		}
+		if r.hasLastTap && r.last.Sub(r.lastTap) <= r.cfg.DoubleTapInterval &&
+			origin.dist(r.lastTapPos) <= 2*r.cfg.TapMaxMovement {
+			r.hasLastTap = false
+			g.Kind = KindDoubleTap
+			return g, true
+		}
+		r.hasLastTap = true
+		r.lastTap = r.last
+		r.lastTapPos = origin
+		g.Kind = KindTap
+		return g, true
+	}
+	r.hasLastTap = false
+
+	if r.maxFingers >= 2 && r.hasPinch {
+		a, aok := r.tracks[r.pinchIDs[0]]
+		b, bok := r.tracks[r.pinchIDs[1]]
+		if aok && bok {
+			scale := a.last.dist(b.last) / r.pinchBase
+			if math.Abs(scale-1) >= r.cfg.PinchMinScale {
+				g.Kind = KindPinch
+				g.Scale = scale
+				g.Direction = DirectionOut
+				if scale < 1 {
+					g.Direction = DirectionIn
+				}
+				if seconds > 0 {
+					g.Velocity = math.Abs(a.last.dist(b.last)-r.pinchBase) / seconds
+				}
+				return g, true
+			}
+		}
+	}
+
+	d := r.displacement()
+	distance := math.Hypot(d.x, d.y)
+	if distance < r.cfg.SwipeMinDistance {
+		return Gesture{}, false
+	}
+	g.Kind = KindSwipe
+	g.Direction = direction(d)
+	g.Distance = distance
+	if seconds > 0 {
+		g.Velocity = distance / seconds
+	}
+	if r.maxFingers == 1 && fromEdge(g.StartZone, g.Direction) {
+		g.Kind = KindEdgeSwipe
+	}
+	return g, true
+}
+
+// direction returns one of the eight directions closest to d.
+func direction(d point) Direction {
+	// tan(22.5°): below this ratio the movement is considered straight
+	const diagonalRatio = 0.4142
+	ax, ay := math.Abs(d.x), math.Abs(d.y)
+	horizontal := DirectionRight
+	if d.x < 0 {
+		horizontal = DirectionLeft
+	}
+	vertical := DirectionDown
+	if d.y < 0 {
+		vertical = DirectionUp
+	}
+	switch {
+	case ay <= ax*diagonalRatio:
+		return horizontal
+	case ax <= ay*diagonalRatio:
+		return vertical
+	default:
+		return Direction(string(vertical) + "-" + string(horizontal))
+	}
+}
+
+// fromEdge returns true when a swipe in direction d moves away from zone z.
+func fromEdge(z Zone, d Direction) bool {
+	switch z {
+	case ZoneLeft:
+		return d == DirectionRight
+	case ZoneRight:
+		return d == DirectionLeft
+	case ZoneTop:
+		return d == DirectionDown
+	case ZoneBottom:
+		return d == DirectionUp
+	}
+	return false
+}
+
+// zone classifies a point in screen space.
+func (r *Recognizer) zone(p point) Zone {
+	width, height := r.screenSize()
+	margin := float64(r.cfg.EdgeMargin)
+	left, right := p.x < margin, p.x > width-margin
+	top, bottom := p.y < margin, p.y > height-margin
+	switch {
+	case top && left:
+		return ZoneTopLeft
+	case top && right:
+		return ZoneTopRight
+	case bottom && left:
+		return ZoneBottomLeft
+	case bottom && right:
+		return ZoneBottomRight
+	case left:
+		return ZoneLeft
+	case right:
+		return ZoneRight
+	case top:
+		return ZoneTop
+	case bottom:
+		return ZoneBottom
+	}
+	return ZoneCenter
+}
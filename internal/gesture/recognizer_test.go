@@ -0,0 +1,201 @@
+package gesture
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+// testConfig uses the reMarkable 2 touch panel ranges regardless of the
+// architecture running the tests.
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.MaxX = 1403
+	cfg.MaxY = 1871
+	return cfg
+}
+
+// loadTrace reads a recorded event trace. Each line holds the kernel
+// timestamp in seconds, the event type, code and value.
+func loadTrace(t *testing.T, name string) []events.InputEvent {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name+".trace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var evs []events.InputEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			t.Fatalf("malformed line %q", line)
+		}
+		secs, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, _ := strconv.Atoi(fields[1])
+		code, _ := strconv.Atoi(fields[2])
+		value, _ := strconv.Atoi(fields[3])
+		evs = append(evs, events.InputEvent{
+			Time:  syscall.NsecToTimeval(int64(secs * float64(time.Second))),
+			Type:  uint16(typ),
+			Code:  uint16(code),
+			Value: int32(value),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return evs
+}
+
+func replay(evs []events.InputEvent, cfg Config) []Gesture {
+	tracker := NewTracker()
+	rec := NewRecognizer(cfg)
+	var out []Gesture
+	for _, ev := range evs {
+		if f, ok := tracker.Process(ev); ok {
+			out = append(out, rec.Update(f)...)
+		}
+	}
+	return out
+}
+
+func TestRecognizerTraces(t *testing.T) {
+	tests := []struct {
+		trace string
+		want  []Gesture
+	}{
+		{"tap", []Gesture{{Kind: KindTap, Fingers: 1, StartZone: ZoneCenter}}},
+		{"double_tap", []Gesture{
+			{Kind: KindTap, Fingers: 1, StartZone: ZoneCenter},
+			{Kind: KindDoubleTap, Fingers: 1, StartZone: ZoneCenter},
+		}},
+		{"long_press", []Gesture{{Kind: KindLongPress, Fingers: 1, StartZone: ZoneCenter}}},
+		{"swipe_left", []Gesture{{Kind: KindSwipe, Fingers: 1, Direction: DirectionLeft, StartZone: ZoneCenter}}},
+		{"two_finger_swipe_down", []Gesture{{Kind: KindSwipe, Fingers: 2, Direction: DirectionDown, StartZone: ZoneCenter}}},
+		{"three_finger_swipe_left", []Gesture{{Kind: KindSwipe, Fingers: 3, Direction: DirectionLeft, StartZone: ZoneCenter}}},
+		{"pinch_out", []Gesture{{Kind: KindPinch, Fingers: 2, Direction: DirectionOut, StartZone: ZoneCenter}}},
+		{"pinch_in", []Gesture{{Kind: KindPinch, Fingers: 2, Direction: DirectionIn, StartZone: ZoneCenter}}},
+		{"edge_swipe", []Gesture{{Kind: KindEdgeSwipe, Fingers: 1, Direction: DirectionRight, StartZone: ZoneLeft}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.trace, func(t *testing.T) {
+			got := replay(loadTrace(t, tt.trace), testConfig())
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d gestures (%+v), want %d", len(got), got, len(tt.want))
+			}
+			for i, g := range got {
+				w := tt.want[i]
+				if g.Kind != w.Kind || g.Fingers != w.Fingers || g.Direction != w.Direction || g.StartZone != w.StartZone {
+					t.Errorf("gesture %d = {%s %d %s %s}, want {%s %d %s %s}", i,
+						g.Kind, g.Fingers, g.Direction, g.StartZone,
+						w.Kind, w.Fingers, w.Direction, w.StartZone)
+				}
+			}
+		})
+	}
+}
+
+func TestRecognizerVelocity(t *testing.T) {
+	got := replay(loadTrace(t, "swipe_left"), testConfig())
+	if len(got) != 1 {
+		t.Fatalf("got %d gestures, want 1", len(got))
+	}
+	// 600 units in ~312ms
+	if got[0].Velocity < 1500 || got[0].Velocity > 2500 {
+		t.Errorf("velocity = %.0f, want ~1900 units/s", got[0].Velocity)
+	}
+	if got[0].Distance < 590 || got[0].Distance > 610 {
+		t.Errorf("distance = %.0f, want 600", got[0].Distance)
+	}
+}
+
+func TestRecognizerLongPressTick(t *testing.T) {
+	evs := loadTrace(t, "long_press")
+	tracker := NewTracker()
+	rec := NewRecognizer(testConfig())
+
+	// Only feed the landing of the finger, then let the clock run
+	f, ok := tracker.Process(evs[0])
+	for i := 1; !ok; i++ {
+		f, ok = tracker.Process(evs[i])
+	}
+	if g := rec.Update(f); len(g) != 0 {
+		t.Fatalf("unexpected gestures on landing: %+v", g)
+	}
+	if g := rec.Tick(f.Time.Add(300 * time.Millisecond)); len(g) != 0 {
+		t.Fatalf("long-press fired too early: %+v", g)
+	}
+	g := rec.Tick(f.Time.Add(time.Second))
+	if len(g) != 1 || g[0].Kind != KindLongPress {
+		t.Fatalf("Tick() = %+v, want one long-press", g)
+	}
+	if g := rec.Tick(f.Time.Add(2 * time.Second)); len(g) != 0 {
+		t.Fatalf("long-press fired twice: %+v", g)
+	}
+	// Releasing the finger must not report anything else
+	if g := rec.Update(Frame{Time: f.Time.Add(2 * time.Second)}); len(g) != 0 {
+		t.Fatalf("unexpected gestures on release: %+v", g)
+	}
+}
+
+func TestTrackerSlots(t *testing.T) {
+	tracker := NewTracker()
+	abs := func(code uint16, value int32) events.InputEvent {
+		return events.InputEvent{Type: events.EvAbs, Code: code, Value: value}
+	}
+	syn := events.InputEvent{Type: events.EvSyn, Code: SynReport}
+
+	for _, ev := range []events.InputEvent{
+		abs(AbsMtSlot, 0), abs(AbsMtTrackingID, 10), abs(AbsMtPositionX, 1), abs(AbsMtPositionY, 2),
+		abs(AbsMtSlot, 1), abs(AbsMtTrackingID, 11), abs(AbsMtPositionX, 3), abs(AbsMtPositionY, 4),
+	} {
+		if _, ok := tracker.Process(ev); ok {
+			t.Fatal("frame emitted before SYN_REPORT")
+		}
+	}
+	f, ok := tracker.Process(syn)
+	if !ok || len(f.Contacts) != 2 {
+		t.Fatalf("got %+v, want 2 contacts", f)
+	}
+	if c := f.Contacts[1]; c.TrackingID != 11 || c.X != 3 || c.Y != 4 {
+		t.Errorf("second contact = %+v", c)
+	}
+
+	// Only the updated axis changes; the other one keeps its value
+	tracker.Process(abs(AbsMtSlot, 0))
+	tracker.Process(abs(AbsMtPositionX, 5))
+	tracker.Process(abs(AbsMtSlot, 1))
+	tracker.Process(abs(AbsMtTrackingID, -1))
+	f, _ = tracker.Process(syn)
+	if len(f.Contacts) != 1 || f.Contacts[0].X != 5 || f.Contacts[0].Y != 2 {
+		t.Fatalf("got %+v, want slot 0 at (5,2)", f.Contacts)
+	}
+
+	// Events following a SYN_DROPPED are discarded up to the next report
+	tracker.Process(events.InputEvent{Type: events.EvSyn, Code: SynDropped})
+	tracker.Process(abs(AbsMtSlot, 0))
+	tracker.Process(abs(AbsMtTrackingID, 12))
+	if _, ok := tracker.Process(syn); ok {
+		t.Fatal("frame emitted right after SYN_DROPPED")
+	}
+	f, _ = tracker.Process(syn)
+	if len(f.Contacts) != 0 {
+		t.Fatalf("got %+v, want no contacts after SYN_DROPPED", f.Contacts)
+	}
+}
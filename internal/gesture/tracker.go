@@ -0,0 +1,166 @@
+// Package gesture turns raw multitouch input events into high level gestures.
+//
+// The touch panels of the reMarkable devices speak the Linux multitouch
+// protocol B: every contact is bound to a slot (ABS_MT_SLOT), a contact's
+// lifetime is delimited by ABS_MT_TRACKING_ID (-1 releases the slot), and
+// changes are committed atomically by a SYN_REPORT. The Tracker rebuilds the
+// set of active contacts from that stream, and the Recognizer turns the
+// successive contact frames into taps, long-presses, swipes and pinches.
+package gesture
+
+import (
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+const (
+	// Multitouch event codes
+	// see https://www.kernel.org/doc/Documentation/input/multi-touch-protocol.txt
+
+	// AbsMtSlot selects the slot the following ABS_MT events apply to.
+	AbsMtSlot uint16 = 47
+	// AbsMtTouchMajor is the length of the major axis of the contact.
+	AbsMtTouchMajor uint16 = 48
+	// AbsMtPositionX is the X coordinate of the contact.
+	AbsMtPositionX uint16 = 53
+	// AbsMtPositionY is the Y coordinate of the contact.
+	AbsMtPositionY uint16 = 54
+	// AbsMtTrackingID identifies the contact; -1 marks the slot as unused.
+	AbsMtTrackingID uint16 = 57
+	// AbsMtPressure is the pressure of the contact.
+	AbsMtPressure uint16 = 58
+
+	// SynReport commits the pending changes.
+	SynReport uint16 = events.SynReport
+	// SynDropped tells that the kernel buffer overran and events were lost.
+	SynDropped uint16 = events.SynDropped
+
+	// maxSlots is the number of slots tracked. The reMarkable panels report
+	// at most 10 contacts, extra slots are ignored.
+	maxSlots = 16
+)
+
+// Contact is a finger touching the panel, in raw digitizer units.
+type Contact struct {
+	Slot       int
+	TrackingID int32
+	X, Y       int32
+	Pressure   int32
+}
+
+// Frame is the set of active contacts at the time of a SYN_REPORT.
+type Frame struct {
+	Time     time.Time
+	Contacts []Contact
+}
+
+type slot struct {
+	trackingID int32
+	x, y       int32
+	pressure   int32
+}
+
+// Tracker reconstructs the active contacts from a multitouch protocol B
+// event stream.
+type Tracker struct {
+	slots   [maxSlots]slot
+	current int
+	// dropped is set after a SYN_DROPPED; events are discarded until the
+	// next SYN_REPORT.
+	dropped bool
+	// contacts is reused between frames to avoid allocations
+	contacts []Contact
+}
+
+// NewTracker returns a tracker with every slot released.
+func NewTracker() *Tracker {
+	t := &Tracker{
+		contacts: make([]Contact, 0, maxSlots),
+	}
+	t.Reset()
+	return t
+}
+
+// Reset releases every slot.
+func (t *Tracker) Reset() {
+	for i := range t.slots {
+		t.slots[i] = slot{trackingID: -1}
+	}
+	t.current = 0
+	t.dropped = false
+}
+
+// Process feeds an input event to the tracker. When the event is a
+// SYN_REPORT, it returns the active contacts and true. The returned frame is
+// only valid until the next call to Process.
+func (t *Tracker) Process(ev events.InputEvent) (Frame, bool) {
+	switch ev.Type {
+	case events.EvSyn:
+		switch ev.Code {
+		case SynDropped:
+			// The state is lost: the kernel does not resend it, and
+			// reading it back would take EVIOCGMTSLOTS and EVIOCGABS on
+			// the device. Start over from a clean state: the contacts
+			// still down are ignored until they are lifted and a new
+			// tracking id is reported for their slot.
+			t.Reset()
+			t.dropped = true
+			return Frame{}, false
+		case SynReport:
+			if t.dropped {
+				t.dropped = false
+				return Frame{}, false
+			}
+			return t.frame(ev.Timestamp()), true
+		}
+	case events.EvAbs:
+		if t.dropped {
+			return Frame{}, false
+		}
+		t.processAbs(ev)
+	}
+	return Frame{}, false
+}
+
+func (t *Tracker) processAbs(ev events.InputEvent) {
+	if ev.Code == AbsMtSlot {
+		t.current = int(ev.Value)
+		return
+	}
+	if t.current < 0 || t.current >= maxSlots {
+		return
+	}
+	s := &t.slots[t.current]
+	switch ev.Code {
+	case AbsMtTrackingID:
+		if ev.Value < 0 {
+			*s = slot{trackingID: -1}
+			return
+		}
+		s.trackingID = ev.Value
+	case AbsMtPositionX:
+		s.x = ev.Value
+	case AbsMtPositionY:
+		s.y = ev.Value
+	case AbsMtPressure:
+		s.pressure = ev.Value
+	}
+}
+
+func (t *Tracker) frame(at time.Time) Frame {
+	t.contacts = t.contacts[:0]
+	for i, s := range t.slots {
+		if s.trackingID < 0 {
+			continue
+		}
+		t.contacts = append(t.contacts, Contact{
+			Slot:       i,
+			TrackingID: s.trackingID,
+			X:          s.x,
+			Y:          s.y,
+			Pressure:   s.pressure,
+		})
+	}
+	return Frame{Time: at, Contacts: t.contacts}
+}
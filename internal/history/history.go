@@ -0,0 +1,288 @@
+// Package history keeps the recent frames of the screen in memory, so the
+// viewers can rewind. The frames are captured by a Recorder while the
+// tablet is used, whether a viewer is connected or not.
+//
+// The frames are kept as sent on the wire (see package delta): keyframes
+// followed by deltas. A keyframe is inserted at regular intervals, so the
+// oldest frames can be dropped while the others can still be decoded. The
+// memory used is bounded by the age and the total size of the frames: the
+// frames expire even when no frame is added anymore.
+package history
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+)
+
+var (
+	// ErrNotFound is returned when no frame was kept for the requested time
+	ErrNotFound = errors.New("no frame in history at this time")
+	// ErrNeedKeyframe is returned when adding a delta that cannot be
+	// decoded, after ReleaseMemory or a dropped frame
+	ErrNeedKeyframe = errors.New("the history needs a keyframe")
+)
+
+// Config configures a Buffer.
+type Config struct {
+	// MaxAge is how long the frames are kept
+	MaxAge time.Duration
+	// MaxBytes bounds the total size of the frames
+	MaxBytes int
+	// KeyframeInterval is the maximum time between two keyframes
+	KeyframeInterval time.Duration
+	// FrameSize is the size of a decoded frame
+	FrameSize int
+	// CaptureInterval is the period of the captures of the Recorder while
+	// the tablet is used
+	CaptureInterval time.Duration
+}
+
+// DefaultConfig returns the configuration used by the server.
+func DefaultConfig(frameSize int) Config {
+	return Config{
+		MaxAge:           10 * time.Minute,
+		MaxBytes:         32 << 20,
+		KeyframeInterval: 30 * time.Second,
+		FrameSize:        frameSize,
+		CaptureInterval:  time.Second,
+	}
+}
+
+// Entry is a frame of the history, as sent on the wire.
+type Entry struct {
+	Time time.Time
+	Data []byte
+}
+
+// Info describes a frame of the history.
+type Info struct {
+	Time     time.Time `json:"time"`
+	Size     int       `json:"size"`
+	Keyframe bool      `json:"keyframe,omitempty"`
+}
+
+// Buffer is a memory-bounded history of the frames.
+type Buffer struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries []Entry
+	size    int
+	// live is the last frame, rebuilt to create the keyframes. It is
+	// released with ReleaseMemory.
+	live    *delta.Decoder
+	lastKey time.Time
+	keyBuf  bytes.Buffer
+	// expiry drops the oldest frames when they expire
+	expiry *time.Timer
+}
+
+// NewBuffer creates an empty history.
+func NewBuffer(config Config) *Buffer {
+	return &Buffer{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Add appends a frame, as written by delta.Encoder. Frames without changes
+// are not kept. It returns ErrNeedKeyframe if the frame is a delta that
+// cannot be decoded.
+func (b *Buffer) Add(frame []byte) error {
+	if !delta.IsKeyframe(frame) && delta.PayloadSize(frame) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+
+	if b.live == nil {
+		b.live = delta.NewDecoder(b.config.FrameSize)
+	}
+	if err := b.live.Apply(frame); err != nil {
+		// The deltas following a released or dropped keyframe cannot be
+		// decoded until the next keyframe
+		debug.Log("History: frame dropped: %v", err)
+		return ErrNeedKeyframe
+	}
+
+	data := bytes.Clone(frame)
+	if !delta.IsKeyframe(frame) && now.Sub(b.lastKey) >= b.config.KeyframeInterval {
+		// Replace the delta with the frame it leads to
+		b.keyBuf.Reset()
+		if _, err := delta.WriteFull(b.live.Frame(), &b.keyBuf); err != nil {
+			log.Printf("History: cannot create a keyframe: %v", err)
+		} else {
+			data = bytes.Clone(b.keyBuf.Bytes())
+		}
+	}
+	if delta.IsKeyframe(data) {
+		b.lastKey = now
+	}
+	b.entries = append(b.entries, Entry{Time: now, Data: data})
+	b.size += len(data)
+	b.evict(now)
+	if b.expiry == nil {
+		b.expiry = time.AfterFunc(b.untilExpiry(now), b.expire)
+	}
+	return nil
+}
+
+// expire drops the expired frames, and waits for the expiry of the next
+// oldest one, if any.
+func (b *Buffer) expire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.evict(now)
+	if len(b.entries) == 0 {
+		// Let the frames be collected
+		b.entries = nil
+		b.expiry = nil
+		debug.Log("History: all frames expired")
+		return
+	}
+	if b.expiry != nil {
+		b.expiry.Reset(b.untilExpiry(now))
+	}
+}
+
+// untilExpiry returns the time before the oldest frame expires. b.mu must
+// be held.
+func (b *Buffer) untilExpiry(now time.Time) time.Duration {
+	if len(b.entries) == 0 {
+		return b.config.MaxAge
+	}
+	return max(b.entries[0].Time.Add(b.config.MaxAge).Sub(now), time.Second)
+}
+
+// evict drops the frames beyond the limits, then the deltas that cannot be
+// decoded anymore. b.mu must be held.
+func (b *Buffer) evict(now time.Time) {
+	drop := 0
+	size := b.size
+	for drop < len(b.entries) && (size > b.config.MaxBytes || now.Sub(b.entries[drop].Time) > b.config.MaxAge) {
+		size -= len(b.entries[drop].Data)
+		drop++
+	}
+	for drop < len(b.entries) && !delta.IsKeyframe(b.entries[drop].Data) {
+		size -= len(b.entries[drop].Data)
+		drop++
+	}
+	if drop == 0 {
+		return
+	}
+	clear(b.entries[:drop])
+	b.entries = b.entries[drop:]
+	b.size = size
+}
+
+// Infos lists the frames of the history.
+func (b *Buffer) Infos() []Info {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	infos := make([]Info, len(b.entries))
+	for i, e := range b.entries {
+		infos[i] = Info{Time: e.Time, Size: len(e.Data), Keyframe: delta.IsKeyframe(e.Data)}
+	}
+	return infos
+}
+
+// Size returns the total size of the frames.
+func (b *Buffer) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Since returns the frames to replay to show the screen from t on: the
+// last keyframe at or before t, and the frames following it.
+func (b *Buffer) Since(t time.Time) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := b.keyframeAt(t)
+	if start < 0 {
+		return nil
+	}
+	return append([]Entry(nil), b.entries[start:]...)
+}
+
+// FrameAt rebuilds the frame shown at time t. It returns the time of the
+// frame.
+func (b *Buffer) FrameAt(t time.Time) ([]byte, time.Time, error) {
+	b.mu.Lock()
+	start := b.keyframeAt(t)
+	if start < 0 || t.Before(b.entries[start].Time) {
+		b.mu.Unlock()
+		return nil, time.Time{}, ErrNotFound
+	}
+	end := start + 1
+	for end < len(b.entries) && !b.entries[end].Time.After(t) {
+		end++
+	}
+	entries := append([]Entry(nil), b.entries[start:end]...)
+	b.mu.Unlock()
+
+	dec := delta.NewDecoder(b.config.FrameSize)
+	for _, e := range entries {
+		if err := dec.Apply(e.Data); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	return dec.Frame(), entries[len(entries)-1].Time, nil
+}
+
+// keyframeAt returns the index of the last keyframe at or before t, or of
+// the first keyframe if t is older. b.mu must be held.
+func (b *Buffer) keyframeAt(t time.Time) int {
+	found := -1
+	for i, e := range b.entries {
+		if !delta.IsKeyframe(e.Data) {
+			continue
+		}
+		if found >= 0 && e.Time.After(t) {
+			break
+		}
+		found = i
+	}
+	return found
+}
+
+// ReleaseMemory drops the expired frames and the buffers used to create the
+// keyframes. The next frame added must be a keyframe.
+func (b *Buffer) ReleaseMemory() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.evict(b.now())
+	b.live = nil
+	b.keyBuf = bytes.Buffer{}
+	// Let the dropped entries be collected
+	b.entries = append([]Entry(nil), b.entries...)
+}
+
+// ParseTime reads a time of the history API: a RFC 3339 time, a Unix time
+// in milliseconds, or a duration before now such as 30s or 5m.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + strconv.Quote(s) + ": must be a RFC 3339 time, Unix milliseconds or a duration")
+	}
+	return t, nil
+}
@@ -0,0 +1,194 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+)
+
+const frameSize = 32 * 32 * 4
+
+// recorder encodes frames where pixel i is set to i and feeds the history.
+type recorder struct {
+	t     *testing.T
+	b     *Buffer
+	now   time.Time
+	enc   *delta.Encoder
+	frame []byte
+	buf   bytes.Buffer
+}
+
+func newRecorder(t *testing.T, config Config) *recorder {
+	r := &recorder{t: t, now: time.Unix(1000, 0), enc: delta.NewEncoder(0.5), frame: make([]byte, frameSize)}
+	r.b = NewBuffer(config)
+	r.b.now = func() time.Time { return r.now }
+	return r
+}
+
+// draw sets pixel i to v and records the frame after d.
+func (r *recorder) draw(d time.Duration, i int, v byte) {
+	r.now = r.now.Add(d)
+	copy(r.frame[i*4:i*4+4], []byte{v, v, v, 0xff})
+	r.buf.Reset()
+	if err := r.enc.Encode(r.frame, &r.buf); err != nil {
+		r.t.Fatal(err)
+	}
+	r.b.Add(r.buf.Bytes())
+}
+
+func testConfig() Config {
+	return Config{MaxAge: time.Minute, MaxBytes: 1 << 20, KeyframeInterval: 10 * time.Second, FrameSize: frameSize}
+}
+
+func TestBufferFrameAt(t *testing.T) {
+	r := newRecorder(t, testConfig())
+	start := r.now
+	for i := range 30 {
+		r.draw(time.Second, i, 0x10)
+	}
+
+	infos := r.b.Infos()
+	if len(infos) != 30 {
+		t.Fatalf("%d frames kept, want 30", len(infos))
+	}
+	keyframes := 0
+	for _, info := range infos {
+		if info.Keyframe {
+			keyframes++
+		}
+	}
+	// The first frame, then one every 10 seconds
+	if keyframes != 3 {
+		t.Errorf("%d keyframes, want 3", keyframes)
+	}
+
+	frame, at, err := r.b.FrameAt(start.Add(15500 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Equal(start.Add(15 * time.Second)) {
+		t.Errorf("frame at %v, want %v", at, start.Add(15*time.Second))
+	}
+	for i := range 30 {
+		want := byte(0)
+		if i < 15 {
+			want = 0x10
+		}
+		if frame[i*4] != want {
+			t.Fatalf("pixel %d = %#x, want %#x", i, frame[i*4], want)
+		}
+	}
+
+	if _, _, err := r.b.FrameAt(start); !errors.Is(err, ErrNotFound) {
+		t.Errorf("frame before the history: err = %v", err)
+	}
+
+	since := r.b.Since(start.Add(25 * time.Second))
+	if len(since) == 0 || !delta.IsKeyframe(since[0].Data) || since[0].Time.After(start.Add(25*time.Second)) {
+		t.Fatalf("Since does not start with the previous keyframe")
+	}
+	dec := delta.NewDecoder(frameSize)
+	for _, e := range since {
+		if err := dec.Apply(e.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(dec.Frame(), r.frame) {
+		t.Error("replaying Since does not lead to the last frame")
+	}
+}
+
+func TestBufferEviction(t *testing.T) {
+	r := newRecorder(t, testConfig())
+	for i := range 100 {
+		r.draw(time.Second, i, 0x20)
+	}
+	infos := r.b.Infos()
+	if !infos[0].Keyframe {
+		t.Error("the history does not start with a keyframe")
+	}
+	if age := r.now.Sub(infos[0].Time); age > time.Minute {
+		t.Errorf("oldest frame is %v old", age)
+	}
+
+	config := testConfig()
+	config.MaxBytes = 2000
+	r = newRecorder(t, config)
+	for i := range 100 {
+		r.draw(time.Second, i, 0x20)
+		if r.b.Size() > config.MaxBytes {
+			t.Fatalf("history of %d bytes", r.b.Size())
+		}
+	}
+}
+
+func TestBufferReleaseMemory(t *testing.T) {
+	r := newRecorder(t, testConfig())
+	r.draw(time.Second, 0, 1)
+	r.draw(time.Second, 1, 1)
+	r.b.ReleaseMemory()
+	if len(r.b.Infos()) != 2 {
+		t.Fatal("ReleaseMemory dropped recent frames")
+	}
+	// The following deltas cannot be rebuilt before the next keyframe
+	r.draw(time.Second, 2, 1)
+	if n := len(r.b.Infos()); n != 2 {
+		t.Errorf("%d frames after a delta without keyframe, want 2", n)
+	}
+	r.enc.Reset()
+	r.draw(time.Second, 3, 1)
+	if n := len(r.b.Infos()); n != 3 {
+		t.Errorf("%d frames after a keyframe, want 3", n)
+	}
+	r.now = r.now.Add(2 * time.Minute)
+	r.b.ReleaseMemory()
+	if n := len(r.b.Infos()); n != 0 {
+		t.Errorf("%d expired frames kept", n)
+	}
+}
+
+func TestBufferExpiry(t *testing.T) {
+	r := newRecorder(t, testConfig())
+	r.draw(time.Second, 0, 1)
+	r.draw(30*time.Second, 1, 1)
+	if r.b.expiry == nil {
+		t.Fatal("no expiry scheduled")
+	}
+
+	// The frames expire without new frames
+	r.now = r.now.Add(20 * time.Second)
+	r.b.expire()
+	if n := len(r.b.Infos()); n != 2 {
+		t.Fatalf("%d frames before their expiry, want 2", n)
+	}
+	r.now = r.now.Add(time.Minute)
+	r.b.expire()
+	if n := len(r.b.Infos()); n != 0 || r.b.Size() != 0 || r.b.expiry != nil {
+		t.Errorf("%d frames of %d bytes kept after their expiry", n, r.b.Size())
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"30s", now.Add(-30 * time.Second)},
+		{"-5m", now.Add(-5 * time.Minute)},
+		{"900000", time.UnixMilli(900000)},
+		{"1970-01-01T00:15:00Z", time.Unix(900, 0)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Error("invalid time accepted")
+	}
+}
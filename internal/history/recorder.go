@@ -0,0 +1,126 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+const (
+	// settleTime is how long the screen is still captured after the last
+	// input, for the changes to be rendered
+	settleTime = time.Second
+	// releaseAfter is the time without capture after which the memory of
+	// the encoder is released
+	releaseAfter = time.Minute
+)
+
+// Recorder captures the screen into a Buffer while the tablet is used,
+// without any viewer connected: the page cannot change without input.
+type Recorder struct {
+	buffer *Buffer
+	file   io.ReaderAt
+	offset int64
+	now    func() time.Time
+
+	enc   *delta.Encoder
+	frame []byte
+	buf   bytes.Buffer
+}
+
+// NewRecorder creates a recorder reading the frames of the size of the
+// buffer at offset in file, every CaptureInterval of the buffer while the
+// tablet is used.
+func NewRecorder(b *Buffer, file io.ReaderAt, offset int64) *Recorder {
+	return &Recorder{
+		buffer: b,
+		file:   file,
+		offset: offset,
+		now:    time.Now,
+		enc:    delta.NewEncoder(delta.DefaultThreshold),
+	}
+}
+
+// Start subscribes to the input events and captures the screen until ctx
+// is done.
+func (r *Recorder) Start(ctx context.Context, ps *pubsub.PubSub) {
+	eventC := ps.Subscribe("history")
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		r.run(ctx, eventC)
+	}()
+}
+
+func (r *Recorder) run(ctx context.Context, eventC <-chan events.InputEventFromSource) {
+	tick := time.NewTicker(r.buffer.config.CaptureInterval)
+	defer tick.Stop()
+	var lastInput, lastCapture time.Time
+	released := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-eventC:
+			if !ok {
+				return
+			}
+			switch ev.Source {
+			case events.Pen, events.Touch, events.Keyboard:
+				lastInput = r.now()
+			}
+		case <-tick.C:
+			now := r.now()
+			if now.Sub(lastInput) <= settleTime {
+				if err := r.Capture(); err != nil {
+					log.Printf("History: capture failed: %v", err)
+				}
+				lastCapture, released = now, false
+			} else if !released && now.Sub(lastCapture) >= releaseAfter {
+				r.ReleaseMemory()
+				released = true
+			}
+		}
+	}
+}
+
+// Capture reads the screen and adds it to the buffer. Captures without
+// changes are not kept.
+func (r *Recorder) Capture() error {
+	size := r.buffer.config.FrameSize
+	if len(r.frame) != size {
+		r.frame = make([]byte, size)
+	}
+	if _, err := r.file.ReadAt(r.frame, r.offset); err != nil {
+		return err
+	}
+	r.buf.Reset()
+	if err := r.enc.Encode(r.frame, &r.buf); err != nil {
+		return err
+	}
+	err := r.buffer.Add(r.buf.Bytes())
+	if !errors.Is(err, ErrNeedKeyframe) {
+		return err
+	}
+	// The buffer released its memory: start over from a keyframe
+	r.buf.Reset()
+	if _, err := delta.WriteFull(r.frame, &r.buf); err != nil {
+		return err
+	}
+	return r.buffer.Add(r.buf.Bytes())
+}
+
+// ReleaseMemory releases the buffers of the encoder and of the history
+// while the tablet is not used. The next capture is a keyframe.
+func (r *Recorder) ReleaseMemory() {
+	r.enc.ReleaseMemory()
+	r.frame = nil
+	r.buf = bytes.Buffer{}
+	r.buffer.ReleaseMemory()
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// screenFile is a file holding a framebuffer.
+type screenFile struct {
+	data []byte
+}
+
+func (f *screenFile) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+func TestRecorderCapture(t *testing.T) {
+	file := &screenFile{data: make([]byte, 16+frameSize)}
+	b := NewBuffer(testConfig())
+	r := NewRecorder(b, file, 16)
+
+	if err := r.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	file.data[16] = 1
+	if err := r.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	// Captures without changes are not kept
+	if err := r.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	infos := b.Infos()
+	if len(infos) != 2 || !infos[0].Keyframe || infos[1].Keyframe {
+		t.Fatalf("frames = %+v, want a keyframe and a delta", infos)
+	}
+
+	// The history released by the idle callback starts over from a keyframe
+	b.ReleaseMemory()
+	file.data[17] = 1
+	if err := r.Capture(); err != nil {
+		t.Fatal(err)
+	}
+	infos = b.Infos()
+	if len(infos) != 3 || !infos[2].Keyframe {
+		t.Fatalf("frames after ReleaseMemory = %+v, want a keyframe", infos)
+	}
+	frame, _, err := b.FrameAt(time.Now())
+	if err != nil || !bytes.Equal(frame, file.data[16:]) {
+		t.Errorf("last frame does not match the screen: %v", err)
+	}
+}
+
+// TestRecorderOnInput checks that the screen is recorded while the tablet
+// is used, without any viewer.
+func TestRecorderOnInput(t *testing.T) {
+	file := &screenFile{data: make([]byte, frameSize)}
+	config := testConfig()
+	config.CaptureInterval = 5 * time.Millisecond
+	b := NewBuffer(config)
+	ps := pubsub.NewPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	NewRecorder(b, file, 0).Start(ctx, ps)
+
+	time.Sleep(20 * time.Millisecond)
+	if n := len(b.Infos()); n != 0 {
+		t.Fatalf("%d frames recorded without input", n)
+	}
+	ps.Publish(events.InputEventFromSource{Source: events.Pen, InputEvent: events.InputEvent{Type: events.EvAbs}})
+	for deadline := time.Now().Add(2 * time.Second); len(b.Infos()) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the screen was not recorded after an input")
+		}
+	}
+}
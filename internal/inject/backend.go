@@ -0,0 +1,79 @@
+// Package inject sends synthetic taps, swipes and pen strokes to the tablet,
+// so a remote viewer can control it (for example to turn pages while
+// presenting).
+//
+// The gestures are expressed in screen coordinates and converted to the
+// digitizer axis ranges of the device model before being written to the
+// input devices through a Backend.
+package inject
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+// ErrUnknownDevice is returned by a backend asked to write to a device it
+// does not handle.
+var ErrUnknownDevice = errors.New("unknown input device")
+
+// Backend writes raw input events to the tablet input devices.
+type Backend interface {
+	// Inject writes the events, in order, to the device identified by its
+	// source (events.Pen or events.Touch).
+	Inject(source int, evs []events.InputEvent) error
+	// Close releases the devices.
+	Close() error
+}
+
+// MemoryBackend is an in-memory Backend keeping the injected events. It is
+// meant for tests and dry runs.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	events []events.InputEventFromSource
+	closed bool
+}
+
+// NewMemoryBackend creates an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+// Inject implements Backend.
+func (m *MemoryBackend) Inject(source int, evs []events.InputEvent) error {
+	if source != events.Pen && source != events.Touch {
+		return ErrUnknownDevice
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("backend closed")
+	}
+	for _, ev := range evs {
+		m.events = append(m.events, events.InputEventFromSource{Source: source, InputEvent: ev})
+	}
+	return nil
+}
+
+// Events returns a copy of the events injected so far.
+func (m *MemoryBackend) Events() []events.InputEventFromSource {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]events.InputEventFromSource(nil), m.events...)
+}
+
+// Reset forgets the injected events.
+func (m *MemoryBackend) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = nil
+}
+
+// Close implements Backend.
+func (m *MemoryBackend) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
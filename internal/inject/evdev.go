@@ -0,0 +1,27 @@
+//go:build !linux
+
+package inject
+
+import (
+	"errors"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+// EvdevBackend is only available on linux.
+type EvdevBackend struct{}
+
+// NewEvdevBackend always fails outside of linux.
+func NewEvdevBackend(penPath, touchPath string) (*EvdevBackend, error) {
+	return nil, errors.New("input injection is only supported on linux")
+}
+
+// Inject implements Backend.
+func (b *EvdevBackend) Inject(source int, evs []events.InputEvent) error {
+	return ErrUnknownDevice
+}
+
+// Close implements Backend.
+func (b *EvdevBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package inject
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+// EvdevBackend writes the events directly to the evdev nodes of the pen and
+// touch digitizers. The kernel delivers them to every reader of the device,
+// including xochitl, as if they came from the hardware.
+type EvdevBackend struct {
+	mu    sync.Mutex
+	pen   *os.File
+	touch *os.File
+}
+
+// NewEvdevBackend opens the pen and touch input devices for writing.
+func NewEvdevBackend(penPath, touchPath string) (*EvdevBackend, error) {
+	pen, err := os.OpenFile(penPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open pen device: %w", err)
+	}
+	touch, err := os.OpenFile(touchPath, os.O_WRONLY, 0)
+	if err != nil {
+		pen.Close()
+		return nil, fmt.Errorf("cannot open touch device: %w", err)
+	}
+	return &EvdevBackend{pen: pen, touch: touch}, nil
+}
+
+// Inject implements Backend.
+func (b *EvdevBackend) Inject(source int, evs []events.InputEvent) error {
+	var f *os.File
+	switch source {
+	case events.Pen:
+		f = b.pen
+	case events.Touch:
+		f = b.touch
+	default:
+		return ErrUnknownDevice
+	}
+	if len(evs) == 0 {
+		return nil
+	}
+	// events.InputEvent has the layout of the kernel struct input_event
+	size := int(unsafe.Sizeof(evs[0]))
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&evs[0])), size*len(evs))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := f.Write(buf)
+	return err
+}
+
+// Close implements Backend.
+func (b *EvdevBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.pen.Close()
+	if terr := b.touch.Close(); err == nil {
+		err = terr
+	}
+	return err
+}
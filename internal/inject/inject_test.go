@@ -0,0 +1,208 @@
+package inject
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+)
+
+func TestAxisValue(t *testing.T) {
+	a := Axis{Code: AbsX, Max: 1000}
+	tests := []struct {
+		f      float64
+		invert bool
+		want   int32
+	}{
+		{0, false, 0},
+		{0.5, false, 500},
+		{1, false, 1000},
+		{-0.2, false, 0},
+		{1.5, false, 1000},
+		{0.25, true, 750},
+		{0, true, 1000},
+	}
+	for _, tt := range tests {
+		a.Invert = tt.invert
+		if got := a.Value(tt.f); got != tt.want {
+			t.Errorf("Value(%v) with invert=%v = %d, want %d", tt.f, tt.invert, got, tt.want)
+		}
+	}
+}
+
+func TestAxisPosition(t *testing.T) {
+	for _, invert := range []bool{false, true} {
+		a := Axis{Code: AbsY, Max: 1000, Invert: invert}
+		for _, f := range []float64{0, 0.25, 0.5, 1} {
+			if got := a.Position(a.Value(f)); got != f {
+				t.Errorf("Position(Value(%v)) with invert=%v = %v", f, invert, got)
+			}
+		}
+	}
+	if got := (Axis{Max: 1000}).Position(2000); got != 1 {
+		t.Errorf("Position out of range = %v, want 1", got)
+	}
+}
+
+// recognize feeds the injected touch events to the gesture recognizer, which
+// uses the same axis conventions as the viewer.
+func recognize(evs []events.InputEventFromSource) []gesture.Gesture {
+	tracker := gesture.NewTracker()
+	rec := gesture.NewRecognizer(gesture.DefaultConfig())
+	var out []gesture.Gesture
+	for _, ev := range evs {
+		if ev.Source != events.Touch {
+			continue
+		}
+		if f, ok := tracker.Process(ev.InputEvent); ok {
+			out = append(out, rec.Update(f)...)
+		}
+	}
+	return out
+}
+
+func TestTapIsRecognized(t *testing.T) {
+	backend := NewMemoryBackend()
+	injector := NewInjector(backend, DefaultMapping())
+	if err := injector.Tap(context.Background(), events.Touch, Point{X: 0.25, Y: 0.75}); err != nil {
+		t.Fatal(err)
+	}
+	gestures := recognize(backend.Events())
+	if len(gestures) != 1 || gestures[0].Kind != gesture.KindTap {
+		t.Fatalf("recognized %+v, want a single tap", gestures)
+	}
+	// The recognizer reports screen positions in digitizer units
+	cfg := gesture.DefaultConfig()
+	width, height := float64(cfg.MaxY), float64(cfg.MaxX)
+	x, y := float64(gestures[0].X)/width, float64(gestures[0].Y)/height
+	if x < 0.24 || x > 0.26 || y < 0.74 || y > 0.76 {
+		t.Errorf("tap recognized at (%.3f, %.3f), want (0.25, 0.75)", x, y)
+	}
+}
+
+func TestSwipeIsRecognized(t *testing.T) {
+	backend := NewMemoryBackend()
+	injector := NewInjector(backend, DefaultMapping())
+	err := injector.Swipe(context.Background(), events.Touch, Point{X: 0.8, Y: 0.5}, Point{X: 0.2, Y: 0.5}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gestures := recognize(backend.Events())
+	if len(gestures) != 1 {
+		t.Fatalf("recognized %+v, want a single swipe", gestures)
+	}
+	if g := gestures[0]; g.Kind != gesture.KindSwipe || g.Direction != gesture.DirectionLeft || g.Fingers != 1 {
+		t.Errorf("recognized %+v, want a one finger swipe left", g)
+	}
+}
+
+func TestPenStroke(t *testing.T) {
+	backend := NewMemoryBackend()
+	mapping := Mapping{
+		Pen: DeviceMapping{
+			X: Axis{Code: AbsX, Max: 1000},
+			Y: Axis{Code: AbsY, Max: 2000, Invert: true},
+		},
+		PenPressure: 42,
+	}
+	injector := NewInjector(backend, mapping)
+	injector.StepInterval = time.Millisecond
+	points := []Point{{0, 0}, {0.5, 0.5}, {1, 1}}
+	if err := injector.Stroke(context.Background(), events.Pen, points, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	evs := backend.Events()
+	var xs, ys []int32
+	pressed := false
+	for _, ev := range evs {
+		if ev.Source != events.Pen {
+			t.Fatalf("event %+v not sent to the pen", ev)
+		}
+		switch {
+		case ev.Type == events.EvAbs && ev.Code == AbsX:
+			xs = append(xs, ev.Value)
+		case ev.Type == events.EvAbs && ev.Code == AbsY:
+			ys = append(ys, ev.Value)
+		case ev.Type == events.EvAbs && ev.Code == AbsPressure && ev.Value > 0:
+			if ev.Value != 42 {
+				t.Errorf("pressure = %d, want 42", ev.Value)
+			}
+		case ev.Type == events.EvKey && ev.Code == BtnTouch:
+			pressed = ev.Value == 1
+		}
+	}
+	wantX, wantY := []int32{0, 500, 1000}, []int32{2000, 1000, 0}
+	for i := range wantX {
+		if i >= len(xs) || i >= len(ys) || xs[i] != wantX[i] || ys[i] != wantY[i] {
+			t.Fatalf("positions x=%v y=%v, want x=%v y=%v", xs, ys, wantX, wantY)
+		}
+	}
+	if pressed {
+		t.Error("the pen was not lifted at the end of the stroke")
+	}
+	if last := evs[len(evs)-1]; last.Type != events.EvSyn {
+		t.Errorf("last event %+v is not a SYN_REPORT", last)
+	}
+}
+
+func TestCancelReleasesContact(t *testing.T) {
+	backend := NewMemoryBackend()
+	injector := NewInjector(backend, DefaultMapping())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := injector.Swipe(ctx, events.Touch, Point{X: 0.1, Y: 0.1}, Point{X: 0.9, Y: 0.9}, time.Second)
+	if err != context.Canceled {
+		t.Fatalf("Swipe() error = %v, want context.Canceled", err)
+	}
+	evs := backend.Events()
+	if len(evs) < 2 {
+		t.Fatalf("got %d events, want a press and a release", len(evs))
+	}
+	release := evs[len(evs)-2]
+	if release.Code != gesture.AbsMtTrackingID || release.Value != -1 {
+		t.Errorf("contact not released, last events %+v", evs[len(evs)-3:])
+	}
+}
+
+func TestUnknownDevice(t *testing.T) {
+	injector := NewInjector(NewMemoryBackend(), DefaultMapping())
+	if err := injector.Tap(context.Background(), 42, Point{}); err != ErrUnknownDevice {
+		t.Errorf("Tap() on an unknown device error = %v, want ErrUnknownDevice", err)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	if !l.Allow() || !l.Allow() {
+		t.Fatal("the burst was not allowed")
+	}
+	if l.Allow() {
+		t.Fatal("allowed more than the burst")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("token not refilled after 500ms at 2/s")
+	}
+	if l.Allow() {
+		t.Fatal("allowed more than the refill")
+	}
+	now = now.Add(time.Hour)
+	for range 2 {
+		if !l.Allow() {
+			t.Fatal("burst not restored")
+		}
+	}
+	if l.Allow() {
+		t.Fatal("tokens accumulated beyond the burst")
+	}
+
+	if unlimited := NewLimiter(0, 0); !unlimited.Allow() || !unlimited.Allow() {
+		t.Error("a zero rate should not limit")
+	}
+}
@@ -0,0 +1,193 @@
+package inject
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+)
+
+const (
+	// touchSlot is the multitouch slot used for synthetic contacts
+	touchSlot = 0
+	// touchPressure is the pressure reported for synthetic contacts
+	touchPressure = 100
+)
+
+// Injector turns taps, swipes and strokes into input events. Gestures are
+// serialized: a gesture starts once the previous one is released.
+type Injector struct {
+	backend Backend
+	mapping Mapping
+
+	// TapDuration is how long a tap stays down
+	TapDuration time.Duration
+	// StepInterval is the delay between two positions of a swipe or stroke
+	StepInterval time.Duration
+
+	mu         sync.Mutex
+	trackingID int32
+}
+
+// NewInjector creates an injector writing to backend.
+func NewInjector(backend Backend, mapping Mapping) *Injector {
+	return &Injector{
+		backend:      backend,
+		mapping:      mapping,
+		TapDuration:  50 * time.Millisecond,
+		StepInterval: 10 * time.Millisecond,
+	}
+}
+
+// Tap touches p with the touch screen (events.Touch) or the pen (events.Pen).
+func (i *Injector) Tap(ctx context.Context, source int, p Point) error {
+	return i.path(ctx, source, []Point{p}, i.TapDuration)
+}
+
+// Swipe moves from one point to another in d.
+func (i *Injector) Swipe(ctx context.Context, source int, from, to Point, d time.Duration) error {
+	steps := 1
+	if i.StepInterval > 0 {
+		steps = max(int(d/i.StepInterval), 1)
+	}
+	points := make([]Point, steps+1)
+	for s := range points {
+		f := float64(s) / float64(steps)
+		points[s] = Point{
+			X: from.X + (to.X-from.X)*f,
+			Y: from.Y + (to.Y-from.Y)*f,
+		}
+	}
+	return i.path(ctx, source, points, d)
+}
+
+// Stroke draws through the points in d. If d is zero, the points are
+// spaced by StepInterval.
+func (i *Injector) Stroke(ctx context.Context, source int, points []Point, d time.Duration) error {
+	if len(points) == 0 {
+		return errors.New("empty stroke")
+	}
+	if d == 0 {
+		d = time.Duration(len(points)-1) * i.StepInterval
+	}
+	return i.path(ctx, source, points, d)
+}
+
+// path presses at the first point, moves through the others evenly over d
+// and releases. The contact is released even if ctx is cancelled midway.
+func (i *Injector) path(ctx context.Context, source int, points []Point, d time.Duration) error {
+	var dev DeviceMapping
+	switch source {
+	case events.Pen:
+		dev = i.mapping.Pen
+	case events.Touch:
+		dev = i.mapping.Touch
+	default:
+		return ErrUnknownDevice
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.trackingID++
+
+	if err := i.backend.Inject(source, i.down(source, dev, points[0])); err != nil {
+		return err
+	}
+	err := i.move(ctx, source, dev, points, d)
+	if uerr := i.backend.Inject(source, i.up(source)); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func (i *Injector) move(ctx context.Context, source int, dev DeviceMapping, points []Point, d time.Duration) error {
+	interval := d
+	if len(points) > 1 {
+		interval = d / time.Duration(len(points)-1)
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if n >= len(points) {
+			return nil
+		}
+		p := points[n]
+		evs := []events.InputEvent{
+			absEvent(dev.X.Code, dev.X.Value(p.X)),
+			absEvent(dev.Y.Code, dev.Y.Value(p.Y)),
+			synReport(),
+		}
+		if err := i.backend.Inject(source, evs); err != nil {
+			return err
+		}
+		timer.Reset(interval)
+	}
+}
+
+func (i *Injector) down(source int, dev DeviceMapping, p Point) []events.InputEvent {
+	x := absEvent(dev.X.Code, dev.X.Value(p.X))
+	y := absEvent(dev.Y.Code, dev.Y.Value(p.Y))
+	if source == events.Pen {
+		return []events.InputEvent{
+			keyEvent(BtnToolPen, 1),
+			x, y,
+			absEvent(AbsDistance, 0),
+			absEvent(AbsPressure, i.mapping.PenPressure),
+			keyEvent(BtnTouch, 1),
+			synReport(),
+		}
+	}
+	return []events.InputEvent{
+		absEvent(gesture.AbsMtSlot, touchSlot),
+		absEvent(gesture.AbsMtTrackingID, i.trackingID),
+		x, y,
+		absEvent(gesture.AbsMtPressure, touchPressure),
+		synReport(),
+	}
+}
+
+func (i *Injector) up(source int) []events.InputEvent {
+	if source == events.Pen {
+		return []events.InputEvent{
+			absEvent(AbsPressure, 0),
+			keyEvent(BtnTouch, 0),
+			keyEvent(BtnToolPen, 0),
+			synReport(),
+		}
+	}
+	return []events.InputEvent{
+		absEvent(gesture.AbsMtSlot, touchSlot),
+		absEvent(gesture.AbsMtTrackingID, -1),
+		synReport(),
+	}
+}
+
+func absEvent(code uint16, value int32) events.InputEvent {
+	return newEvent(events.EvAbs, code, value)
+}
+
+func keyEvent(code uint16, value int32) events.InputEvent {
+	return newEvent(events.EvKey, code, value)
+}
+
+func synReport() events.InputEvent {
+	return newEvent(events.EvSyn, gesture.SynReport, 0)
+}
+
+func newEvent(typ, code uint16, value int32) events.InputEvent {
+	return events.InputEvent{
+		Time:  syscall.NsecToTimeval(time.Now().UnixNano()),
+		Type:  typ,
+		Code:  code,
+		Value: value,
+	}
+}
@@ -0,0 +1,109 @@
+package inject
+
+import (
+	"math"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/gesture"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// Event codes used to synthesize pen input
+// see https://www.kernel.org/doc/Documentation/input/event-codes.txt
+const (
+	// AbsX is the X coordinate of the pen.
+	AbsX uint16 = 0
+	// AbsY is the Y coordinate of the pen.
+	AbsY uint16 = 1
+	// AbsPressure is the pressure of the pen tip.
+	AbsPressure uint16 = events.AbsPressure
+	// AbsDistance is the hover distance of the pen.
+	AbsDistance uint16 = 25
+	// BtnToolPen reports the pen in range of the digitizer.
+	BtnToolPen uint16 = events.BtnToolPen
+	// BtnTouch reports the pen tip touching the screen.
+	BtnTouch uint16 = 330
+)
+
+// Point is a position on the screen, normalized to [0, 1] on both axes:
+// (0, 0) is the top-left corner and (1, 1) the bottom-right one, as seen in
+// the viewer.
+type Point struct {
+	X, Y float64
+}
+
+// Axis describes how a screen axis maps to a digitizer axis.
+type Axis struct {
+	// Code is the EV_ABS code of the digitizer axis
+	Code uint16
+	// Max is the maximum value reported by the digitizer on that axis
+	Max int32
+	// Invert maps the start of the screen axis to Max
+	Invert bool
+}
+
+// Value converts a normalized screen coordinate to a digitizer value.
+func (a Axis) Value(f float64) int32 {
+	f = math.Max(0, math.Min(1, f))
+	if a.Invert {
+		f = 1 - f
+	}
+	return int32(math.Round(f * float64(a.Max)))
+}
+
+// Position converts a digitizer value to a normalized screen coordinate,
+// the inverse of Value.
+func (a Axis) Position(v int32) float64 {
+	if a.Max <= 0 {
+		return 0
+	}
+	f := math.Max(0, math.Min(1, float64(v)/float64(a.Max)))
+	if a.Invert {
+		f = 1 - f
+	}
+	return f
+}
+
+// DeviceMapping maps the screen axes of a device.
+type DeviceMapping struct {
+	X, Y Axis
+}
+
+// Mapping holds the coordinate mappings of the pen and touch digitizers.
+type Mapping struct {
+	Pen   DeviceMapping
+	Touch DeviceMapping
+	// PenPressure is the pressure reported while a synthetic stroke is drawn
+	PenPressure int32
+}
+
+// DefaultMapping returns the mapping of the device model the binary is built
+// for. It is the inverse of the transformation applied by the viewer to
+// display the pen position, and of the one used by the gesture recognizer
+// for the touch screen.
+func DefaultMapping() Mapping {
+	m := Mapping{
+		PenPressure: 2000,
+	}
+	if remarkable.Model == remarkable.RemarkablePaperPro {
+		m.Pen = DeviceMapping{
+			X: Axis{Code: AbsX, Max: remarkable.MaxXValue},
+			Y: Axis{Code: AbsY, Max: remarkable.MaxYValue},
+		}
+	} else {
+		m.Pen = DeviceMapping{
+			X: Axis{Code: AbsX, Max: remarkable.MaxYValue},
+			Y: Axis{Code: AbsY, Max: remarkable.MaxXValue},
+		}
+	}
+	cfg := gesture.DefaultConfig()
+	touchX := Axis{Code: gesture.AbsMtPositionX, Max: cfg.MaxX}
+	touchY := Axis{Code: gesture.AbsMtPositionY, Max: cfg.MaxY}
+	if cfg.SwapXY {
+		touchX, touchY = touchY, touchX
+	}
+	touchX.Invert = cfg.InvertX
+	touchY.Invert = cfg.InvertY
+	m.Touch = DeviceMapping{X: touchX, Y: touchY}
+	return m
+}
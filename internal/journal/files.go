@@ -0,0 +1,54 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// segmentExt is the extension of the segment files
+const segmentExt = ".journal"
+
+// segmentName returns the path of a segment started at t.
+func segmentName(dir string, t time.Time) string {
+	return filepath.Join(dir, "journal-"+t.Format("2006-01-02-15-04-05.000")+segmentExt)
+}
+
+// Segments returns the paths of the segments of dir, oldest first.
+func Segments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentExt) {
+			continue
+		}
+		names = append(names, filepath.Join(dir, entry.Name()))
+	}
+	// The names hold the start time of the segments
+	sort.Strings(names)
+	return names, nil
+}
+
+// cleanupOldFiles removes the oldest segments beyond maxFiles (0 keeps all
+// the segments).
+func cleanupOldFiles(dir string, maxFiles int) error {
+	if maxFiles <= 0 {
+		return nil
+	}
+	names, err := Segments(dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(names)-maxFiles; i++ {
+		if err := os.Remove(names[i]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old journal segment %s: %w", names[i], err)
+		}
+	}
+	return nil
+}
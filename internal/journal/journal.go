@@ -0,0 +1,229 @@
+// Package journal writes a timelapse of the tablet to disk while the pen is
+// used, without any viewer connected.
+//
+// The screen is captured when the pen is lifted, and the snapshots are
+// delta-encoded (see package delta) into segment files rotated by size and
+// age. Only the last segments are kept. The segments are read back by
+// SegmentReader, for instance to export a timelapse.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+const (
+	// penLiftDelay leaves time for the stroke to be rendered before the
+	// snapshot
+	penLiftDelay = 500 * time.Millisecond
+	// releaseAfter is the time without snapshot after which the memory of
+	// the encoder is released
+	releaseAfter = time.Minute
+)
+
+// Config configures a Journal.
+type Config struct {
+	// Dir is the directory of the segments
+	Dir string
+	// MaxSegmentBytes is the size above which a new segment is started
+	MaxSegmentBytes int
+	// MaxSegmentAge is the age after which a new segment is started
+	MaxSegmentAge time.Duration
+	// MaxFiles is the number of segments kept
+	MaxFiles int
+}
+
+// DefaultConfig returns the configuration used by the server.
+func DefaultConfig() Config {
+	return Config{
+		Dir:             "/home/root/journal",
+		MaxSegmentBytes: 8 << 20,
+		MaxSegmentAge:   time.Hour,
+		MaxFiles:        24,
+	}
+}
+
+// Journal captures the screen on pen lifts and writes the snapshots to the
+// segments.
+type Journal struct {
+	config   Config
+	file     io.ReaderAt
+	offset   int64
+	geometry Geometry
+	now      func() time.Time
+
+	enc      *delta.Encoder
+	frame    []byte
+	buf      bytes.Buffer
+	seg      *os.File
+	segW     *bufio.Writer
+	segSize  int
+	segStart time.Time
+}
+
+// New creates a journal reading the frames of the given geometry at offset
+// in file.
+func New(config Config, file io.ReaderAt, offset int64, geometry Geometry) *Journal {
+	return &Journal{
+		config:   config,
+		file:     file,
+		offset:   offset,
+		geometry: geometry,
+		now:      time.Now,
+		enc:      delta.NewEncoder(delta.DefaultThreshold),
+	}
+}
+
+// Start subscribes to the pen events and writes the journal until ctx is
+// done.
+func (j *Journal) Start(ctx context.Context, ps *pubsub.PubSub) {
+	penSource := events.Pen
+	absType := uint16(events.EvAbs)
+	eventC := ps.SubscribeWithFilter("journal", pubsub.EventFilter{
+		Source: &penSource,
+		Type:   &absType,
+	})
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		defer func() {
+			if err := j.Close(); err != nil {
+				log.Printf("Journal: %v", err)
+			}
+		}()
+		j.run(ctx, eventC)
+	}()
+}
+
+func (j *Journal) run(ctx context.Context, eventC <-chan events.InputEventFromSource) {
+	lift := time.NewTimer(0)
+	<-lift.C
+	release := time.NewTimer(releaseAfter)
+	defer lift.Stop()
+	defer release.Stop()
+	penDown := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-eventC:
+			if !ok {
+				return
+			}
+			if ev.Code != events.AbsPressure {
+				continue
+			}
+			down := ev.Value > events.PressureThreshold
+			if penDown && !down {
+				lift.Reset(penLiftDelay)
+			} else if down {
+				lift.Stop()
+			}
+			penDown = down
+		case <-lift.C:
+			if err := j.Snapshot(); err != nil {
+				log.Printf("Journal: snapshot failed: %v", err)
+			}
+			release.Reset(releaseAfter)
+		case <-release.C:
+			j.ReleaseMemory()
+		}
+	}
+}
+
+// Snapshot captures the screen and appends it to the current segment.
+// Snapshots without changes are not written.
+func (j *Journal) Snapshot() error {
+	size := j.geometry.FrameSize()
+	if len(j.frame) != size {
+		j.frame = make([]byte, size)
+	}
+	if _, err := j.file.ReadAt(j.frame, j.offset); err != nil {
+		return err
+	}
+	now := j.now()
+	if err := j.rotate(now); err != nil {
+		return err
+	}
+
+	j.buf.Reset()
+	var ts [8]byte
+	binary.LittleEndian.PutUint64(ts[:], uint64(now.UnixNano()))
+	j.buf.Write(ts[:])
+	if err := j.enc.Encode(j.frame, &j.buf); err != nil {
+		return err
+	}
+	frame := j.buf.Bytes()[len(ts):]
+	if !delta.IsKeyframe(frame) && delta.PayloadSize(frame) == 0 {
+		return nil
+	}
+	if _, err := j.segW.Write(j.buf.Bytes()); err != nil {
+		return err
+	}
+	j.segSize += j.buf.Len()
+	debug.Log("Journal: snapshot of %d bytes", j.buf.Len())
+	return j.segW.Flush()
+}
+
+// rotate starts a new segment if there is none or if the current one is
+// full.
+func (j *Journal) rotate(now time.Time) error {
+	if j.seg != nil && j.segSize < j.config.MaxSegmentBytes && now.Sub(j.segStart) < j.config.MaxSegmentAge {
+		return nil
+	}
+	if err := j.closeSegment(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(j.config.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	f, err := os.Create(segmentName(j.config.Dir, now))
+	if err != nil {
+		return err
+	}
+	j.seg, j.segW, j.segStart = f, bufio.NewWriter(f), now
+	if err := writeHeader(j.segW, j.geometry); err != nil {
+		return err
+	}
+	j.segSize = headerSize
+	// The segment must start with a keyframe
+	j.enc.Reset()
+	debug.Log("Journal: new segment %s", f.Name())
+	return cleanupOldFiles(j.config.Dir, j.config.MaxFiles)
+}
+
+func (j *Journal) closeSegment() error {
+	if j.seg == nil {
+		return nil
+	}
+	err := j.segW.Flush()
+	if cerr := j.seg.Close(); err == nil {
+		err = cerr
+	}
+	j.seg, j.segW = nil, nil
+	return err
+}
+
+// ReleaseMemory releases the buffers of the encoder while the pen is not
+// used. The next snapshot is a keyframe.
+func (j *Journal) ReleaseMemory() {
+	j.enc.ReleaseMemory()
+	j.frame = nil
+	j.buf = bytes.Buffer{}
+}
+
+// Close closes the current segment.
+func (j *Journal) Close() error {
+	return j.closeSegment()
+}
@@ -0,0 +1,183 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+var testGeometry = Geometry{Width: 16, Height: 8, BytesPerPixel: 4}
+
+// newTestJournal returns a journal reading fb, with a clock advancing by a
+// second on each snapshot.
+func newTestJournal(t *testing.T, fb []byte, config Config) *Journal {
+	t.Helper()
+	config.Dir = t.TempDir()
+	j := New(config, bytes.NewReader(fb), 0, testGeometry)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	j.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// readSegment returns the times and frames of a segment.
+func readSegment(t *testing.T, name string) ([]time.Time, [][]byte) {
+	t.Helper()
+	seg, err := OpenSegment(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seg.Close()
+	if seg.Geometry != testGeometry {
+		t.Errorf("geometry = %+v, want %+v", seg.Geometry, testGeometry)
+	}
+	var times []time.Time
+	var frames [][]byte
+	for {
+		ts, frame, err := seg.Next()
+		if err == io.EOF {
+			return times, frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, ts)
+		frames = append(frames, bytes.Clone(frame))
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	fb := make([]byte, testGeometry.FrameSize())
+	j := newTestJournal(t, fb, DefaultConfig())
+
+	var want [][]byte
+	for i, change := range []int{0, 100, -1, 200} {
+		if change >= 0 {
+			fb[change] = byte(i + 1)
+			want = append(want, bytes.Clone(fb))
+		}
+		if err := j.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.ReleaseMemory()
+	fb[300] = 9
+	want = append(want, bytes.Clone(fb))
+	if err := j.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := Segments(j.config.Dir)
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("segments = %v, %v, want one segment", segments, err)
+	}
+	times, frames := readSegment(t, segments[0])
+	if len(frames) != len(want) {
+		t.Fatalf("%d snapshots, want %d (unchanged snapshots are skipped)", len(frames), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(frames[i], want[i]) {
+			t.Errorf("snapshot %d differs", i)
+		}
+		if i > 0 && !times[i].After(times[i-1]) {
+			t.Errorf("snapshot %d at %v, not after %v", i, times[i], times[i-1])
+		}
+	}
+}
+
+func TestTruncatedSegment(t *testing.T) {
+	fb := make([]byte, testGeometry.FrameSize())
+	j := newTestJournal(t, fb, DefaultConfig())
+	for i := range 2 {
+		fb[i*10] = 1
+		if err := j.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A crash in the middle of a record
+	if _, err := j.seg.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	segments, _ := Segments(j.config.Dir)
+	if _, frames := readSegment(t, segments[0]); len(frames) != 2 {
+		t.Errorf("%d snapshots, want 2", len(frames))
+	}
+}
+
+func TestRotationAndCleanup(t *testing.T) {
+	fb := make([]byte, testGeometry.FrameSize())
+	config := DefaultConfig()
+	config.MaxSegmentBytes = 1
+	config.MaxFiles = 3
+	j := newTestJournal(t, fb, config)
+	for i := range 5 {
+		fb[i] = 0xff
+		if err := j.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	segments, err := Segments(j.config.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 {
+		t.Fatalf("%d segments kept, want 3", len(segments))
+	}
+	// Each segment starts with a keyframe and holds the last frames
+	for i, name := range segments {
+		_, frames := readSegment(t, name)
+		if len(frames) != 1 {
+			t.Fatalf("segment %d: %d snapshots, want 1", i, len(frames))
+		}
+		if n := bytes.Count(frames[0][:8], []byte{0xff}); n != i+3 {
+			t.Errorf("segment %d: %d pixels changed, want %d", i, n, i+3)
+		}
+	}
+}
+
+func TestPenLift(t *testing.T) {
+	fb := make([]byte, testGeometry.FrameSize())
+	j := newTestJournal(t, fb, DefaultConfig())
+	eventC := make(chan events.InputEventFromSource)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.run(ctx, eventC)
+		close(done)
+	}()
+	pressure := func(v int32) {
+		eventC <- events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: events.EvAbs, Code: 24, Value: v},
+		}
+	}
+	pressure(1000)
+	fb[0] = 1
+	pressure(0)
+	// The snapshot waits for the stroke to be rendered
+	time.Sleep(penLiftDelay + 200*time.Millisecond)
+	cancel()
+	<-done
+	j.Close()
+
+	segments, err := Segments(j.config.Dir)
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("segments = %v, %v, want one segment", segments, err)
+	}
+	if _, frames := readSegment(t, segments[0]); len(frames) != 1 || frames[0][0] != 1 {
+		t.Errorf("got %d snapshots, want the frame after the stroke", len(frames))
+	}
+}
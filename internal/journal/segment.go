@@ -0,0 +1,123 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+)
+
+// Segment files start with a header describing the frames, followed by
+// records: the time of the snapshot (Unix nanoseconds, 8 bytes little
+// endian) and the frame as sent on the wire by delta.Encoder. The first
+// frame of a segment is a keyframe.
+const (
+	magic      = "GMSJ"
+	version    = 1
+	headerSize = 10
+)
+
+// Geometry describes the frames of a journal.
+type Geometry struct {
+	Width         int
+	Height        int
+	BytesPerPixel int
+}
+
+// FrameSize returns the size in bytes of a frame.
+func (g Geometry) FrameSize() int {
+	return g.Width * g.Height * g.BytesPerPixel
+}
+
+func writeHeader(w io.Writer, g Geometry) error {
+	var h [headerSize]byte
+	copy(h[:], magic)
+	h[4] = version
+	binary.LittleEndian.PutUint16(h[5:], uint16(g.Width))
+	binary.LittleEndian.PutUint16(h[7:], uint16(g.Height))
+	h[9] = byte(g.BytesPerPixel)
+	_, err := w.Write(h[:])
+	return err
+}
+
+func readHeader(r io.Reader) (Geometry, error) {
+	var h [headerSize]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return Geometry{}, err
+	}
+	if string(h[:4]) != magic {
+		return Geometry{}, errors.New("not a journal segment")
+	}
+	if h[4] != version {
+		return Geometry{}, fmt.Errorf("unsupported journal version %d", h[4])
+	}
+	return Geometry{
+		Width:         int(binary.LittleEndian.Uint16(h[5:])),
+		Height:        int(binary.LittleEndian.Uint16(h[7:])),
+		BytesPerPixel: int(h[9]),
+	}, nil
+}
+
+// SegmentReader decodes the snapshots of a segment.
+type SegmentReader struct {
+	Geometry Geometry
+	f        *os.File
+	r        *bufio.Reader
+	dec      *delta.Decoder
+	buf      []byte
+}
+
+// OpenSegment opens a segment file.
+func OpenSegment(name string) (*SegmentReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	g, err := readHeader(r)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &SegmentReader{
+		Geometry: g,
+		f:        f,
+		r:        r,
+		dec:      delta.NewDecoder(g.FrameSize()),
+	}, nil
+}
+
+// Next returns the next snapshot. The frame is overwritten by the next
+// call. It returns io.EOF at the end of the segment; a record truncated by
+// a crash is also reported as the end.
+func (s *SegmentReader) Next() (time.Time, []byte, error) {
+	var head [8 + delta.HeaderSize]byte
+	if _, err := io.ReadFull(s.r, head[:]); err != nil {
+		return time.Time{}, nil, io.EOF
+	}
+	t := time.Unix(0, int64(binary.LittleEndian.Uint64(head[:8])))
+	frame := head[8:]
+	n := delta.HeaderSize + delta.PayloadSize(frame)
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	s.buf = s.buf[:n]
+	copy(s.buf, frame)
+	if _, err := io.ReadFull(s.r, s.buf[delta.HeaderSize:]); err != nil {
+		return time.Time{}, nil, io.EOF
+	}
+	if err := s.dec.Apply(s.buf); err != nil {
+		return time.Time{}, nil, err
+	}
+	return t, s.dec.Frame(), nil
+}
+
+// Close closes the segment file.
+func (s *SegmentReader) Close() error {
+	return s.f.Close()
+}
@@ -1,6 +1,7 @@
 package jwtutil
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -18,12 +19,21 @@ const jwtHeaderBase64 = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9"
 
 // Claims represents the JWT payload claims.
 type Claims struct {
-	Subject   string `json:"sub"`           // Username
-	IssuedAt  int64  `json:"iat"`           // Issued at (Unix timestamp)
-	ExpiresAt int64  `json:"exp"`           // Expiration time (Unix timestamp)
-	TokenID   string `json:"jti,omitempty"` // Unique token ID
+	Subject   string `json:"sub"`            // Username
+	IssuedAt  int64  `json:"iat"`            // Issued at (Unix timestamp)
+	ExpiresAt int64  `json:"exp"`            // Expiration time (Unix timestamp)
+	TokenID   string `json:"jti,omitempty"`  // Unique token ID
+	Role      string `json:"role,omitempty"` // Role granted to the subject
 }
 
+const (
+	// RoleAdmin is granted to the device owner. Admins can control the tablet
+	// remotely.
+	RoleAdmin = "admin"
+	// RoleViewer can only watch the stream.
+	RoleViewer = "viewer"
+)
+
 // Token represents a validated JWT with its claims.
 type Token struct {
 	Raw    string
@@ -71,6 +81,11 @@ func generateTokenID() (string, error) {
 
 // CreateToken creates a new signed JWT token.
 func CreateToken(subject string, lifetime time.Duration, secret []byte) (string, error) {
+	return CreateTokenWithRole(subject, "", lifetime, secret)
+}
+
+// CreateTokenWithRole creates a new signed JWT token granting role to subject.
+func CreateTokenWithRole(subject, role string, lifetime time.Duration, secret []byte) (string, error) {
 	now := time.Now()
 
 	tokenID, err := generateTokenID()
@@ -83,6 +98,7 @@ func CreateToken(subject string, lifetime time.Duration, secret []byte) (string,
 		IssuedAt:  now.Unix(),
 		ExpiresAt: now.Add(lifetime).Unix(),
 		TokenID:   tokenID,
+		Role:      role,
 	}
 
 	return SignToken(claims, secret)
@@ -168,3 +184,16 @@ func IsValidationError(err error) bool {
 	var ve *ValidationError
 	return errors.As(err, &ve)
 }
+
+type tokenContextKey struct{}
+
+// ContextWithToken returns a copy of ctx carrying the validated token.
+func ContextWithToken(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// TokenFromContext returns the token stored by ContextWithToken, if any.
+func TokenFromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(*Token)
+	return token, ok && token != nil
+}
@@ -1,6 +1,7 @@
 package jwtutil
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -161,6 +162,34 @@ func TestCreateAndValidateToken(t *testing.T) {
 	}
 }
 
+func TestTokenRole(t *testing.T) {
+	secret, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	tokenString, err := CreateTokenWithRole("owner", RoleAdmin, time.Hour, secret)
+	if err != nil {
+		t.Fatalf("CreateTokenWithRole() error = %v", err)
+	}
+	token, err := ValidateToken(tokenString, secret)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if token.Claims.Role != RoleAdmin {
+		t.Errorf("Claims.Role = %q, want %q", token.Claims.Role, RoleAdmin)
+	}
+
+	ctx := ContextWithToken(context.Background(), token)
+	got, ok := TokenFromContext(ctx)
+	if !ok || got != token {
+		t.Errorf("TokenFromContext() = %v, %v, want the stored token", got, ok)
+	}
+	if _, ok := TokenFromContext(context.Background()); ok {
+		t.Error("TokenFromContext() found a token in an empty context")
+	}
+}
+
 func TestValidateTokenExpired(t *testing.T) {
 	secret, err := Generate()
 	if err != nil {
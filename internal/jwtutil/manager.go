@@ -74,6 +74,13 @@ func (m *Manager) CreateToken(subject string) (string, error) {
 	return CreateToken(subject, m.config.TokenLifetime, m.secret)
 }
 
+// CreateTokenWithRole creates a new JWT token granting role to subject.
+func (m *Manager) CreateTokenWithRole(subject, role string) (string, error) {
+	m.secretMu.RLock()
+	defer m.secretMu.RUnlock()
+	return CreateTokenWithRole(subject, role, m.config.TokenLifetime, m.secret)
+}
+
 // ValidateToken validates a JWT token and returns the parsed token.
 func (m *Manager) ValidateToken(tokenString string) (*Token, error) {
 	m.secretMu.RLock()
@@ -0,0 +1,301 @@
+// Package pagechange detects the page turns on the tablet and publishes them
+// on the bus.
+//
+// A page turn shows up as a large change of the framebuffer, like heavy
+// drawing does. The detector only compares the screen when no pen is
+// drawing, on gray images reduced by scale, and tells page turns apart with
+// the statistics of the change (see Stats.PageTurn).
+//
+// The detector only runs while it has subscribers, and not while the tablet
+// sleeps. While a stream runs, the screen is only compared after the delta
+// encoder of the stream saw it change (see stream.ChangeObserver).
+// Otherwise it is compared often while the tablet is used, and rarely
+// without input: the page cannot change without input.
+package pagechange
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pixconv"
+	"github.com/owulveryck/goMarkableStream/internal/power"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+const (
+	// Topic is the name of the topic of the page turns on the bus
+	Topic = "screen/page"
+
+	// maxSnapshots is the number of previous pages kept for /pages
+	maxSnapshots = 8
+)
+
+// Screen renders the screen of the tablet; it is implemented by
+// stream.ScreenshotHandler.
+type Screen interface {
+	Snapshot(opts stream.ScreenshotOptions) (image.Image, uint64, error)
+}
+
+// Config configures a Detector.
+type Config struct {
+	// Interval is the period of the comparisons while the tablet is used
+	Interval time.Duration
+	// IdleInterval is the period of the comparisons without input
+	IdleInterval time.Duration
+	// ActiveWindow is how long the tablet is considered in use after an
+	// input event
+	ActiveWindow time.Duration
+	// PenQuiet is how long the pen must be lifted before comparing
+	PenQuiet time.Duration
+	// Scale is the reduction factor of the compared images
+	Scale int
+
+	// ChangeRatio, Spread, InkRemoved, MaxInkAdded and MinInk are the
+	// thresholds of Stats.PageTurn
+	ChangeRatio float64
+	Spread      float64
+	InkRemoved  float64
+	MaxInkAdded float64
+	MinInk      int
+}
+
+// DefaultConfig returns the configuration used by the server.
+func DefaultConfig() Config {
+	return Config{
+		Interval:     500 * time.Millisecond,
+		IdleInterval: 10 * time.Second,
+		ActiveWindow: 5 * time.Second,
+		PenQuiet:     300 * time.Millisecond,
+		Scale:        4,
+		ChangeRatio:  0.30,
+		Spread:       0.5,
+		InkRemoved:   0.5,
+		MaxInkAdded:  0.9,
+		MinInk:       64,
+	}
+}
+
+// Event is a page turn.
+type Event struct {
+	Page int       `json:"page"`
+	Time time.Time `json:"time"`
+	Stats
+	// Snapshot is the path of the final state of the previous page
+	Snapshot string `json:"snapshot"`
+	// Previous is the final state of the previous page, in the orientation
+	// of the framebuffer
+	Previous *image.Gray `json:"-"`
+	// Hash identifies the framebuffer Previous was rendered from
+	Hash uint64 `json:"-"`
+}
+
+// snapshot is the PNG image of a previous page
+type snapshot struct {
+	page int
+	png  []byte
+}
+
+// Detector compares the screen and publishes the page turns on the bus.
+type Detector struct {
+	screen Screen
+	config Config
+	now    func() time.Time
+	power  *power.Monitor
+	topic  *bus.Topic[Event]
+
+	// Changes reported by the streams (see FrameEncoded)
+	streams atomic.Int32
+	changed atomic.Bool
+
+	mu        sync.Mutex
+	page      int
+	snapshots []snapshot
+
+	// Comparison state, only used by the detector goroutine
+	prev      *image.Gray
+	prevSmall []byte
+	prevHash  uint64
+	lastCheck time.Time
+	lastInput time.Time
+	lastPen   time.Time
+	penDown   bool
+}
+
+// NewDetector creates a detector reading the screen, publishing the page
+// turns on the Topic of b.
+func NewDetector(screen Screen, config Config, b *bus.Bus) *Detector {
+	return &Detector{
+		screen: screen,
+		config: config,
+		now:    time.Now,
+		topic:  bus.NewTopic[Event](b, Topic),
+	}
+}
+
+// SetPowerMonitor suspends the detection while the tablet sleeps.
+func (d *Detector) SetPowerMonitor(m *power.Monitor) {
+	d.power = m
+}
+
+// StreamStarted implements stream.ChangeObserver: the screen is compared
+// when the stream reports a change.
+func (d *Detector) StreamStarted() {
+	d.streams.Add(1)
+}
+
+// StreamStopped implements stream.ChangeObserver.
+func (d *Detector) StreamStopped() {
+	d.streams.Add(-1)
+}
+
+// FrameEncoded implements stream.ChangeObserver.
+func (d *Detector) FrameEncoded(changeRatio float64) {
+	if changeRatio > 0 {
+		d.changed.Store(true)
+	}
+}
+
+// Topic returns the topic of the page turns.
+func (d *Detector) Topic() *bus.Topic[Event] {
+	return d.topic
+}
+
+// Page returns the number of page turns detected so far.
+func (d *Detector) Page() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.page
+}
+
+// Start subscribes to the input events and detects the page turns until ctx
+// is done.
+func (d *Detector) Start(ctx context.Context, ps *pubsub.PubSub) {
+	eventC := ps.Subscribe("pagechange")
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		tick := time.NewTicker(d.config.Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-eventC:
+				d.HandleEvent(ev)
+			case <-tick.C:
+				d.check()
+			}
+		}
+	}()
+}
+
+// HandleEvent tracks the input activity and the pen.
+func (d *Detector) HandleEvent(ev events.InputEventFromSource) {
+	switch ev.Source {
+	case events.Pen, events.Touch, events.Keyboard:
+	default:
+		return
+	}
+	now := d.now()
+	d.lastInput = now
+	if ev.Source == events.Pen && ev.Type == events.EvAbs && ev.Code == events.AbsPressure {
+		d.penDown = ev.Value > events.PressureThreshold
+		d.lastPen = now
+	}
+}
+
+// check compares the screen with its previous state. It returns the page
+// turn, if any.
+func (d *Detector) check() (Event, bool) {
+	if d.topic.Subscribers() == 0 {
+		// Nobody is notified: release the previous screen
+		d.prev, d.prevSmall = nil, nil
+		return Event{}, false
+	}
+	if d.power != nil && d.power.Status().State == power.Sleeping {
+		return Event{}, false
+	}
+
+	now := d.now()
+	streaming := d.streams.Load() > 0
+	active := now.Sub(d.lastInput) < d.config.ActiveWindow
+	if !streaming && !active && now.Sub(d.lastCheck) < d.config.IdleInterval {
+		return Event{}, false
+	}
+	// The screen is compared before and after the strokes, not during
+	if d.penDown || now.Sub(d.lastPen) < d.config.PenQuiet {
+		return Event{}, false
+	}
+	// The stream reads the framebuffer already: compare the screen only
+	// if its encoder saw a change
+	if changed := d.changed.Swap(false); streaming && !changed && d.prev != nil {
+		return Event{}, false
+	}
+	d.lastCheck = now
+
+	opts := stream.DefaultScreenshotOptions()
+	opts.Format = stream.FormatGray
+	img, hash, err := d.screen.Snapshot(opts)
+	if err != nil {
+		debug.Log("PageChange: cannot read the screen: %v", err)
+		return Event{}, false
+	}
+	if d.prev != nil && hash == d.prevHash {
+		return Event{}, false
+	}
+	cur, ok := img.(*image.Gray)
+	if !ok {
+		return Event{}, false
+	}
+	b := cur.Bounds()
+	scale := max(d.config.Scale, 1)
+	small := make([]byte, (b.Dx()/scale)*(b.Dy()/scale))
+	width, height := pixconv.Downscale(small, cur.Pix, b.Dx(), b.Dy(), 1, scale)
+
+	prev, prevSmall, prevHash := d.prev, d.prevSmall, d.prevHash
+	d.prev, d.prevSmall, d.prevHash = cur, small, hash
+	if prev == nil || len(prevSmall) != len(small) {
+		return Event{}, false
+	}
+	stats := Compare(prevSmall, small, width, height)
+	debug.Log("PageChange: change %.1f%%, ink removed %.1f%%, ink added %.1f%%, spread %.1f%%",
+		stats.ChangeRatio*100, stats.InkRemoved*100, stats.InkAdded*100, stats.Spread*100)
+	if !stats.PageTurn(d.config) {
+		return Event{}, false
+	}
+	return d.publish(Event{Time: now, Stats: stats, Previous: prev, Hash: prevHash}), true
+}
+
+// publish numbers the page turn, keeps the snapshot of the previous page
+// and publishes the page turn.
+func (d *Detector) publish(ev Event) Event {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, ev.Previous); err != nil {
+		log.Printf("PageChange: cannot encode the snapshot: %v", err)
+	}
+
+	d.mu.Lock()
+	d.page++
+	ev.Page = d.page
+	ev.Snapshot = SnapshotPath(ev.Page - 1)
+	if buf.Len() > 0 {
+		d.snapshots = append(d.snapshots, snapshot{page: ev.Page - 1, png: buf.Bytes()})
+		if len(d.snapshots) > maxSnapshots {
+			d.snapshots = d.snapshots[1:]
+		}
+	}
+	d.mu.Unlock()
+	log.Printf("PageChange: page %d (change %.0f%%, ink removed %.0f%%)", ev.Page, ev.ChangeRatio*100, ev.InkRemoved*100)
+	d.topic.Publish(ev)
+	return ev
+}
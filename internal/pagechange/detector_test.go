@@ -0,0 +1,226 @@
+package pagechange
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+)
+
+// page returns a 64x64 blank page with ink on the rows [y0, y1) of the
+// columns [x0, x1).
+func page(x0, x1, y0, y1 int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			img.Pix[y*64+x] = 0
+		}
+	}
+	return img
+}
+
+func TestPageTurn(t *testing.T) {
+	blank := page(0, 0, 0, 0)
+	full := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range full.Pix {
+		full.Pix[i] = 0x80 + byte(i%64)
+	}
+	cfg := DefaultConfig()
+	tests := []struct {
+		name      string
+		prev, cur *image.Gray
+		want      bool
+	}{
+		{"drawing", page(0, 16, 0, 16), page(0, 32, 0, 32), false},
+		{"heavy drawing", blank, page(0, 64, 0, 40), false},
+		{"small erasure", page(0, 16, 0, 16), page(0, 16, 0, 12), false},
+		{"new blank page", page(0, 16, 0, 16), blank, true},
+		{"other page", page(0, 16, 0, 16), page(40, 56, 40, 56), true},
+		{"blank to template", blank, full, true},
+		{"nothing", page(0, 16, 0, 16), page(0, 16, 0, 16), false},
+	}
+	for _, tt := range tests {
+		stats := Compare(tt.prev.Pix, tt.cur.Pix, 64, 64)
+		if got := stats.PageTurn(cfg); got != tt.want {
+			t.Errorf("%s: PageTurn = %v, want %v (%+v)", tt.name, got, tt.want, stats)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	stats := Compare(page(0, 32, 0, 32).Pix, page(0, 32, 0, 16).Pix, 64, 64)
+	if stats.ChangeRatio != 0.125 || stats.InkRemoved != 0.5 || stats.InkAdded != 0 || stats.Spread != 0.125 {
+		t.Errorf("Compare = %+v", stats)
+	}
+}
+
+// fakeScreen returns the image it shows, whatever the options.
+type fakeScreen struct {
+	mu    sync.Mutex
+	img   *image.Gray
+	hash  uint64
+	reads int
+}
+
+func (s *fakeScreen) Snapshot(stream.ScreenshotOptions) (image.Image, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	return s.img, s.hash, nil
+}
+
+func (s *fakeScreen) show(img *image.Gray) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.img = img
+	s.hash++
+}
+
+func TestDetectorCheck(t *testing.T) {
+	screen := &fakeScreen{}
+	screen.show(page(0, 32, 0, 32))
+	d := NewDetector(screen, DefaultConfig(), bus.New())
+	now := time.Unix(1000, 0)
+	d.now = func() time.Time { return now }
+	input := func(source int, code uint16, value int32) {
+		d.HandleEvent(events.InputEventFromSource{Source: source, InputEvent: events.InputEvent{Type: events.EvAbs, Code: code, Value: value}})
+	}
+	sub := d.Topic().Subscribe("test", bus.Options[Event]{BufferSize: 8})
+	defer sub.Close()
+	pageC := sub.C
+
+	if _, ok := d.check(); ok {
+		t.Fatal("page turn on the first check")
+	}
+
+	// The screen is not compared while the pen is drawing
+	input(events.Pen, 24, 2000)
+	screen.show(page(0, 0, 0, 0))
+	now = now.Add(time.Second)
+	if _, ok := d.check(); ok {
+		t.Fatal("page turn detected while drawing")
+	}
+	input(events.Pen, 24, 0)
+	now = now.Add(100 * time.Millisecond)
+	if _, ok := d.check(); ok {
+		t.Fatal("page turn detected right after the pen was lifted")
+	}
+	now = now.Add(time.Second)
+	ev, ok := d.check()
+	if !ok || ev.Page != 1 || ev.Snapshot != "/pages/0" || ev.Previous.Pix[0] != 0 {
+		t.Fatalf("check = %+v, %v", ev.Stats, ok)
+	}
+	select {
+	case got := <-pageC:
+		if got.Page != 1 {
+			t.Errorf("notified page %d", got.Page)
+		}
+	default:
+		t.Error("the subscriber was not notified")
+	}
+
+	// Without input, the screen is compared every IdleInterval
+	screen.show(page(0, 32, 0, 32))
+	now = now.Add(DefaultConfig().ActiveWindow)
+	if _, ok := d.check(); ok {
+		t.Error("idle screen compared before IdleInterval")
+	}
+	now = now.Add(DefaultConfig().IdleInterval)
+	if _, ok := d.check(); ok {
+		t.Error("page turn from a blank page")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/pages/0", nil)
+	req.SetPathValue("page", "0")
+	d.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("snapshot: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec = httptest.NewRecorder()
+	req.SetPathValue("page", "5")
+	d.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown snapshot: status %d", rec.Code)
+	}
+}
+
+func TestDetectorPublishesOnBus(t *testing.T) {
+	screen := &fakeScreen{}
+	screen.show(page(0, 32, 0, 32))
+	cfg := DefaultConfig()
+	cfg.Interval = 5 * time.Millisecond
+	cfg.IdleInterval = 5 * time.Millisecond
+	ps := pubsub.NewPubSub()
+	d := NewDetector(screen, cfg, ps.Bus())
+	sub := bus.Subscribe(ps.Bus(), Topic, "test", bus.Options[Event]{BufferSize: 8})
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, ps)
+
+	time.Sleep(20 * time.Millisecond)
+	screen.show(page(0, 0, 0, 0))
+	select {
+	case ev := <-sub.C:
+		if ev.Page != 1 || ev.Snapshot != "/pages/0" {
+			t.Errorf("published %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no page turn published")
+	}
+}
+
+func TestDetectorOnlyRunsWhenNeeded(t *testing.T) {
+	screen := &fakeScreen{}
+	screen.show(page(0, 32, 0, 32))
+	d := NewDetector(screen, DefaultConfig(), bus.New())
+	now := time.Unix(1000, 0)
+	d.now = func() time.Time { return now }
+
+	// Without subscribers, the screen is not read
+	d.check()
+	if screen.reads != 0 || d.prev != nil {
+		t.Fatalf("screen read %d times without subscribers", screen.reads)
+	}
+
+	sub := d.Topic().Subscribe("test", bus.Options[Event]{BufferSize: 8})
+	d.check()
+	if screen.reads != 1 {
+		t.Fatalf("screen read %d times, want 1", screen.reads)
+	}
+
+	// While a stream runs, the screen is only read after a change
+	d.StreamStarted()
+	now = now.Add(DefaultConfig().IdleInterval)
+	d.FrameEncoded(0)
+	d.check()
+	if screen.reads != 1 {
+		t.Errorf("screen read without change while streaming")
+	}
+	screen.show(page(0, 0, 0, 0))
+	d.FrameEncoded(0.2)
+	if _, ok := d.check(); !ok || screen.reads != 2 {
+		t.Errorf("page turn not detected after a change (%d reads)", screen.reads)
+	}
+	d.StreamStopped()
+
+	// The previous screen is released with the last subscriber
+	sub.Close()
+	d.check()
+	if d.prev != nil || d.prevSmall != nil {
+		t.Error("previous screen kept without subscribers")
+	}
+}
@@ -0,0 +1,43 @@
+package pagechange
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// SnapshotPath returns the path of the final state of a page on the
+// handler of the detector.
+func SnapshotPath(page int) string {
+	return "/pages/" + strconv.Itoa(page)
+}
+
+// Snapshot returns the PNG image of the final state of a previous page.
+// Only the last pages are kept.
+func (d *Detector) Snapshot(page int) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.snapshots {
+		if s.page == page {
+			return s.png, true
+		}
+	}
+	return nil, false
+}
+
+// ServeHTTP serves the snapshots of the previous pages at /pages/{page}.
+func (d *Detector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil {
+		http.Error(w, "invalid page", http.StatusBadRequest)
+		return
+	}
+	data, ok := d.Snapshot(page)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
@@ -0,0 +1,90 @@
+package pagechange
+
+const (
+	// inkLevel is the gray level under which a pixel is written
+	inkLevel = 128
+	// diffLevel is the difference of gray level for a pixel to be changed
+	diffLevel = 32
+	// gridSize is the number of cells per side of the spread grid
+	gridSize = 8
+)
+
+// Stats compares two states of the screen, reduced to gray images of the
+// same size.
+type Stats struct {
+	// ChangeRatio is the part of the pixels that changed
+	ChangeRatio float64 `json:"changeRatio"`
+	// InkRemoved is the part of the written pixels of the previous state
+	// that are blank now
+	InkRemoved float64 `json:"inkRemoved"`
+	// InkAdded is the part of the changed pixels that were blank and are
+	// written now
+	InkAdded float64 `json:"inkAdded"`
+	// Spread is the part of the cells of a grid over the screen holding
+	// changes
+	Spread float64 `json:"spread"`
+	// PreviousInk is the number of written pixels of the previous state
+	PreviousInk int `json:"-"`
+}
+
+// Compare computes the statistics of the change from prev to cur, two gray
+// images of width x height pixels.
+func Compare(prev, cur []byte, width, height int) Stats {
+	var (
+		changed, ink, removed, added int
+		cells                        [gridSize * gridSize]bool
+	)
+	for y := range height {
+		row := y * width
+		cellRow := y * gridSize / height * gridSize
+		for x := range width {
+			p, c := prev[row+x], cur[row+x]
+			if p < inkLevel {
+				ink++
+				if c >= inkLevel {
+					removed++
+				}
+			}
+			if diff := int(p) - int(c); diff > -diffLevel && diff < diffLevel {
+				continue
+			}
+			changed++
+			if p >= inkLevel && c < inkLevel {
+				added++
+			}
+			cells[cellRow+x*gridSize/width] = true
+		}
+	}
+
+	s := Stats{PreviousInk: ink}
+	if n := width * height; n > 0 {
+		s.ChangeRatio = float64(changed) / float64(n)
+	}
+	if ink > 0 {
+		s.InkRemoved = float64(removed) / float64(ink)
+	}
+	if changed > 0 {
+		s.InkAdded = float64(added) / float64(changed)
+	}
+	spread := 0
+	for _, c := range cells {
+		if c {
+			spread++
+		}
+	}
+	s.Spread = float64(spread) / float64(len(cells))
+	return s
+}
+
+// PageTurn tells a page turn apart from drawing and erasing: turning the
+// page removes most of the ink, or changes a large part of the screen in
+// both directions, whereas drawing only adds ink.
+func (s Stats) PageTurn(cfg Config) bool {
+	if s.PreviousInk >= cfg.MinInk && s.InkRemoved >= cfg.InkRemoved {
+		return true
+	}
+	if s.InkAdded >= cfg.MaxInkAdded {
+		return false
+	}
+	return s.ChangeRatio >= cfg.ChangeRatio || s.Spread >= cfg.Spread
+}
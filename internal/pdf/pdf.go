@@ -0,0 +1,191 @@
+// Package pdf writes PDF documents made of full-page images, such as
+// screenshots of the tablet.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Reserved object numbers, the others are allocated as the pages are added
+const (
+	catalogObject = 1
+	pagesObject   = 2
+	firstObject   = 3
+)
+
+// PointsPerInch is the unit of the page sizes.
+const PointsPerInch = 72
+
+// Writer writes a PDF document page by page, so that the images need not
+// be kept in memory.
+type Writer struct {
+	w       *bufio.Writer
+	counter *countingWriter
+	offsets map[int]int64
+	next    int
+	pages   []int
+	closed  bool
+	err     error
+}
+
+// NewWriter writes the header of a document to w.
+func NewWriter(w io.Writer) *Writer {
+	counter := &countingWriter{w: w}
+	pw := &Writer{
+		w:       bufio.NewWriter(counter),
+		counter: counter,
+		offsets: map[int]int64{},
+		next:    firstObject,
+	}
+	// The binary comment marks the file as binary for transfer tools
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+// AddPage adds a page of width x height points showing img stretched over
+// the whole page. Gray images are stored in gray, the others in RGB.
+func (pw *Writer) AddPage(img image.Image, width, height float64) error {
+	if pw.closed {
+		return errors.New("pdf: writer is closed")
+	}
+	data, colorSpace := pixels(img)
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	bounds := img.Bounds()
+	imageObject := pw.begin()
+	pw.printf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n",
+		bounds.Dx(), bounds.Dy(), colorSpace, compressed.Len())
+	pw.write(compressed.Bytes())
+	pw.printf("\nendstream\nendobj\n")
+
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q\n", number(width), number(height))
+	contentObject := pw.begin()
+	pw.printf("<< /Length %d >>\nstream\n%sendstream\nendobj\n", len(content), content)
+
+	pageObject := pw.begin()
+	pw.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		pagesObject, number(width), number(height), imageObject, contentObject)
+	pw.pages = append(pw.pages, pageObject)
+	return pw.err
+}
+
+// Pages returns the number of pages added.
+func (pw *Writer) Pages() int {
+	return len(pw.pages)
+}
+
+// Close writes the page tree, the cross-reference table and the trailer.
+// It does not close the underlying writer.
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return pw.err
+	}
+	pw.closed = true
+
+	pw.beginObject(pagesObject)
+	pw.printf("<< /Type /Pages /Count %d /Kids [", len(pw.pages))
+	for _, p := range pw.pages {
+		pw.printf(" %d 0 R", p)
+	}
+	pw.printf(" ] >>\nendobj\n")
+	pw.beginObject(catalogObject)
+	pw.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pagesObject)
+
+	pw.flush()
+	xref := pw.counter.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", pw.next)
+	for i := 1; i < pw.next; i++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[i])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", pw.next, catalogObject, xref)
+	pw.flush()
+	return pw.err
+}
+
+// begin starts a new object and returns its number.
+func (pw *Writer) begin() int {
+	n := pw.next
+	pw.next++
+	pw.beginObject(n)
+	return n
+}
+
+func (pw *Writer) beginObject(n int) {
+	pw.flush()
+	pw.offsets[n] = pw.counter.n
+	pw.printf("%d 0 obj\n", n)
+}
+
+func (pw *Writer) printf(format string, args ...any) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+func (pw *Writer) write(p []byte) {
+	if pw.err == nil {
+		_, pw.err = pw.w.Write(p)
+	}
+}
+
+func (pw *Writer) flush() {
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+}
+
+// pixels returns the samples of img and their color space, without alpha.
+func pixels(img image.Image) ([]byte, string) {
+	b := img.Bounds()
+	if gray, ok := img.(*image.Gray); ok {
+		data := make([]byte, 0, b.Dx()*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := gray.PixOffset(b.Min.X, y)
+			data = append(data, gray.Pix[i:i+b.Dx()]...)
+		}
+		return data, "DeviceGray"
+	}
+	data := make([]byte, 0, b.Dx()*b.Dy()*3)
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+			for x := 0; x < b.Dx(); x++ {
+				data = append(data, row[x*4], row[x*4+1], row[x*4+2])
+			}
+		}
+		return data, "DeviceRGB"
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			data = append(data, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+	}
+	return data, "DeviceRGB"
+}
+
+// number formats a length in points.
+func number(f float64) string {
+	return fmt.Sprintf("%.2f", f)
+}
+
+// countingWriter counts the bytes written, for the cross-reference table.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 4, 2))
+	gray.SetGray(1, 1, color.Gray{Y: 0x80})
+	rgba := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	rgba.Set(2, 0, color.RGBA{R: 0xff, A: 0xff})
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.AddPage(gray, 100, 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddPage(rgba, 72, 72); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Pages() != 2 {
+		t.Errorf("got %d pages, want 2", w.Pages())
+	}
+	doc := buf.String()
+
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatal("missing header or trailer")
+	}
+	for _, want := range []string{"/Count 2", "/ColorSpace /DeviceGray", "/ColorSpace /DeviceRGB", "/MediaBox [0 0 100.00 50.00]"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document does not contain %q", want)
+		}
+	}
+
+	// Every entry of the cross-reference table points to its object
+	start := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	xref, _ := strconv.Atoi(start[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point to the table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(doc[off:], want) {
+			t.Errorf("entry %d points to %q", i+1, doc[off:off+10])
+		}
+	}
+
+	// The samples of the gray image are stored in its stream
+	m := regexp.MustCompile(`(?s)/DeviceGray .*?/Length (\d+) >>\nstream\n`).FindStringSubmatchIndex(doc)
+	length, _ := strconv.Atoi(doc[m[2]:m[3]])
+	zr, err := zlib.NewReader(strings.NewReader(doc[m[1] : m[1]+length]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(zr)
+	if !bytes.Equal(data, gray.Pix) {
+		t.Errorf("gray samples %v, want %v", data, gray.Pix)
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w := NewWriter(io.Discard)
+	w.Close()
+	if err := w.AddPage(image.NewGray(image.Rect(0, 0, 1, 1)), 1, 1); err == nil {
+		t.Error("adding a page after Close should fail")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build arm && !nosimd
+
+package pixconv
+
+import "unsafe"
+
+// bgraToRGBA converts blocks of 16 BGRA pixels to opaque RGBA.
+// Implemented in convert_arm.s using NEON interleaved loads and stores.
+//
+//go:noescape
+func bgraToRGBA(dst, src unsafe.Pointer, blocks int)
+
+// bgraToGray8 converts blocks of 16 BGRA pixels to 8-bit luma.
+// Implemented in convert_arm.s using NEON widening multiply-accumulate.
+//
+//go:noescape
+func bgraToGray8(dst, src unsafe.Pointer, blocks int)
+
+// gray16ToGray8 keeps the high byte of blocks of 16 gray16 pixels.
+// Implemented in convert_arm.s using NEON deinterleaving loads.
+//
+//go:noescape
+func gray16ToGray8(dst, src unsafe.Pointer, blocks int)
@@ -0,0 +1,102 @@
+//go:build arm && !nosimd
+
+#include "textflag.h"
+
+// Uses NEON vector instructions encoded as WORD directives because Go's ARM32
+// assembler does not support NEON mnemonics. Each block of 16 pixels is
+// processed as two halves of 8 pixels (one D register per channel).
+//
+// ARM register allocation:
+//   R0 = dst pointer (post-incremented by the stores)
+//   R1 = src pointer (post-incremented by the loads)
+//   R2 = iteration counter (decrements to 0)
+//
+// ABI0 stack layout (32-bit, all args on stack):
+//   dst:     0(FP)   4 bytes
+//   src:     4(FP)   4 bytes
+//   blocks:  8(FP)   4 bytes
+//   Total args: 12 bytes
+
+// func bgraToRGBA(dst, src unsafe.Pointer, blocks int)
+//
+// VLD4 deinterleaves 8 pixels into d0 = B, d1 = G, d2 = R, d3 = A, B and R
+// are swapped, alpha is made opaque and VST4 interleaves the pixels back.
+TEXT ·bgraToRGBA(SB), NOSPLIT|NOFRAME, $0-12
+	MOVW	dst+0(FP), R0
+	MOVW	src+4(FP), R1
+	MOVW	blocks+8(FP), R2
+
+	CMP	$0, R2
+	BEQ	done
+	ADD	R2, R2		// two halves per block
+
+loop:
+	WORD	$0xF421000D	// VLD4.8 {d0,d1,d2,d3}, [R1]!
+	WORD	$0xF3B20002	// VSWP d0, d2
+	WORD	$0xF3873E1F	// VMOV.I8 d3, #255
+	WORD	$0xF400000D	// VST4.8 {d0,d1,d2,d3}, [R0]!
+
+	SUB.S	$1, R2
+	BNE	loop
+
+done:
+	RET
+
+// func bgraToGray8(dst, src unsafe.Pointer, blocks int)
+//
+// Computes (77*R + 150*G + 29*B) >> 8 for 8 pixels per iteration with
+// widening multiply-accumulates into q2 (16-bit lanes), narrowed to bytes.
+//
+// NEON register allocation:
+//   d0-d3   : B, G, R, A of 8 pixels
+//   q2      : weighted sums
+//   d6      : luma
+//   d28-d30 : weights of R, G and B
+TEXT ·bgraToGray8(SB), NOSPLIT|NOFRAME, $0-12
+	MOVW	dst+0(FP), R0
+	MOVW	src+4(FP), R1
+	MOVW	blocks+8(FP), R2
+
+	CMP	$0, R2
+	BEQ	gray_done
+	ADD	R2, R2		// two halves per block
+
+	WORD	$0xF2C4CE1D	// VMOV.I8 d28, #77
+	WORD	$0xF3C1DE16	// VMOV.I8 d29, #150
+	WORD	$0xF2C1EE1D	// VMOV.I8 d30, #29
+
+gray_loop:
+	WORD	$0xF421000D	// VLD4.8 {d0,d1,d2,d3}, [R1]!
+	WORD	$0xF3824C2C	// VMULL.U8 q2, d2, d28
+	WORD	$0xF381482D	// VMLAL.U8 q2, d1, d29
+	WORD	$0xF380482E	// VMLAL.U8 q2, d0, d30
+	WORD	$0xF2886814	// VSHRN.I16 d6, q2, #8
+	WORD	$0xF400670D	// VST1.8 {d6}, [R0]!
+
+	SUB.S	$1, R2
+	BNE	gray_loop
+
+gray_done:
+	RET
+
+// func gray16ToGray8(dst, src unsafe.Pointer, blocks int)
+//
+// VLD2 deinterleaves 16 little-endian pixels into q0 = low bytes and
+// q1 = high bytes, and the high bytes are stored.
+TEXT ·gray16ToGray8(SB), NOSPLIT|NOFRAME, $0-12
+	MOVW	dst+0(FP), R0
+	MOVW	src+4(FP), R1
+	MOVW	blocks+8(FP), R2
+
+	CMP	$0, R2
+	BEQ	g16_done
+
+g16_loop:
+	WORD	$0xF421030D	// VLD2.8 {d0,d1,d2,d3}, [R1]!
+	WORD	$0xF4002A0D	// VST1.8 {d2,d3}, [R0]!
+
+	SUB.S	$1, R2
+	BNE	g16_loop
+
+g16_done:
+	RET
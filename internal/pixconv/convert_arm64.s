@@ -0,0 +1,105 @@
+#include "textflag.h"
+
+// ABI0 stack layout (all three functions):
+//   dst:     0(FP)   8 bytes
+//   src:     8(FP)   8 bytes
+//   blocks: 16(FP)   8 bytes
+//   Total args: 24 bytes
+
+// func bgraToRGBA(dst, src unsafe.Pointer, blocks int)
+//
+// VLD4 deinterleaves 16 pixels into one register per channel (B, G, R, A),
+// the channels are reordered into consecutive registers and VST4 interleaves
+// them back as R, G, B, 0xff.
+TEXT ·bgraToRGBA(SB), NOSPLIT|NOFRAME, $0-24
+	MOVD	dst+0(FP), R0
+	MOVD	src+8(FP), R1
+	MOVD	blocks+16(FP), R2
+
+	CBZ	R2, done
+
+	// Opaque alpha
+	VMOVI	$255, V7.B16
+
+loop:
+	// V0 = B, V1 = G, V2 = R, V3 = A (ignored)
+	VLD4.P	64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+
+	// V4 = R, V5 = G, V6 = B
+	VORR	V2.B16, V2.B16, V4.B16
+	VORR	V1.B16, V1.B16, V5.B16
+	VORR	V0.B16, V0.B16, V6.B16
+
+	VST4.P	[V4.B16, V5.B16, V6.B16, V7.B16], 64(R0)
+
+	SUB	$1, R2, R2
+	CBNZ	R2, loop
+
+done:
+	RET
+
+// func bgraToGray8(dst, src unsafe.Pointer, blocks int)
+//
+// Computes (77*R + 150*G + 29*B) >> 8 for 16 pixels per iteration. The
+// weighted sum fits in 16 bits (255 * 256 = 65280): the low and high 8
+// pixels are accumulated with widening multiplies into 16-bit lanes, then
+// narrowed back to bytes.
+TEXT ·bgraToGray8(SB), NOSPLIT|NOFRAME, $0-24
+	MOVD	dst+0(FP), R0
+	MOVD	src+8(FP), R1
+	MOVD	blocks+16(FP), R2
+
+	CBZ	R2, gray_done
+
+	// Weights of the channels
+	VMOVI	$77, V20.B16
+	VMOVI	$150, V21.B16
+	VMOVI	$29, V22.B16
+
+gray_loop:
+	// V0 = B, V1 = G, V2 = R, V3 = A (ignored)
+	VLD4.P	64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+
+	// Low 8 pixels
+	VUMULL	V2.B8, V20.B8, V4.H8
+	VUMLAL	V1.B8, V21.B8, V4.H8
+	VUMLAL	V0.B8, V22.B8, V4.H8
+
+	// High 8 pixels
+	VUMULL2	V2.B16, V20.B16, V5.H8
+	VUMLAL2	V1.B16, V21.B16, V5.H8
+	VUMLAL2	V0.B16, V22.B16, V5.H8
+
+	// Keep the high byte of each sum
+	VSHRN	$8, V4.H8, V6.B8
+	VSHRN2	$8, V5.H8, V6.B16
+
+	VST1.P	[V6.B16], 16(R0)
+
+	SUB	$1, R2, R2
+	CBNZ	R2, gray_loop
+
+gray_done:
+	RET
+
+// func gray16ToGray8(dst, src unsafe.Pointer, blocks int)
+//
+// VLD2 deinterleaves the low and high bytes of 16 little-endian pixels, and
+// the high bytes are stored.
+TEXT ·gray16ToGray8(SB), NOSPLIT|NOFRAME, $0-24
+	MOVD	dst+0(FP), R0
+	MOVD	src+8(FP), R1
+	MOVD	blocks+16(FP), R2
+
+	CBZ	R2, g16_done
+
+g16_loop:
+	// V0 = low bytes, V1 = high bytes
+	VLD2.P	32(R1), [V0.B16, V1.B16]
+	VST1.P	[V1.B16], 16(R0)
+
+	SUB	$1, R2, R2
+	CBNZ	R2, g16_loop
+
+g16_done:
+	RET
@@ -0,0 +1,20 @@
+//go:build !arm64 && (!arm || nosimd)
+
+package pixconv
+
+import "unsafe"
+
+func bgraToRGBA(dst, src unsafe.Pointer, blocks int) {
+	n := blocks * blockPixels * 4
+	bgraToRGBAGeneric(unsafe.Slice((*byte)(dst), n), unsafe.Slice((*byte)(src), n))
+}
+
+func bgraToGray8(dst, src unsafe.Pointer, blocks int) {
+	n := blocks * blockPixels
+	bgraToGray8Generic(unsafe.Slice((*byte)(dst), n), unsafe.Slice((*byte)(src), n*4))
+}
+
+func gray16ToGray8(dst, src unsafe.Pointer, blocks int) {
+	n := blocks * blockPixels
+	gray16ToGray8Generic(unsafe.Slice((*byte)(dst), n), unsafe.Slice((*byte)(src), n*2))
+}
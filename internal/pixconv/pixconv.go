@@ -0,0 +1,130 @@
+// Package pixconv converts framebuffer pixels for screenshots and exports.
+// The conversions process the bulk of the pixels with NEON SIMD on arm and
+// arm64, by groups of blockPixels, and the rest with the generic code.
+// Downscale is generic Go code on every architecture.
+package pixconv
+
+import "unsafe"
+
+// blockPixels is the number of pixels processed per iteration of the SIMD kernels
+const blockPixels = 16
+
+// BGRAToRGBA converts the BGRA pixels of src to opaque RGBA pixels in dst.
+// dst must be at least as long as src, and may be src.
+func BGRAToRGBA(dst, src []byte) {
+	n := len(src) / 4
+	if n == 0 {
+		return
+	}
+	_ = dst[n*4-1]
+	blocks := n / blockPixels
+	if blocks > 0 {
+		bgraToRGBA(unsafe.Pointer(&dst[0]), unsafe.Pointer(&src[0]), blocks)
+	}
+	done := blocks * blockPixels * 4
+	bgraToRGBAGeneric(dst[done:], src[done:n*4])
+}
+
+// BGRAToGray8 converts the BGRA pixels of src to 8-bit luma in dst, with
+// the BT.601 weights. dst must hold len(src)/4 pixels.
+func BGRAToGray8(dst, src []byte) {
+	n := len(src) / 4
+	if n == 0 {
+		return
+	}
+	_ = dst[n-1]
+	blocks := n / blockPixels
+	if blocks > 0 {
+		bgraToGray8(unsafe.Pointer(&dst[0]), unsafe.Pointer(&src[0]), blocks)
+	}
+	done := blocks * blockPixels
+	bgraToGray8Generic(dst[done:], src[done*4:n*4])
+}
+
+// Gray16ToGray8 converts the 16-bit little-endian gray pixels of src to 8
+// bits in dst, keeping the most significant byte. dst must hold len(src)/2
+// pixels.
+func Gray16ToGray8(dst, src []byte) {
+	n := len(src) / 2
+	if n == 0 {
+		return
+	}
+	_ = dst[n-1]
+	blocks := n / blockPixels
+	if blocks > 0 {
+		gray16ToGray8(unsafe.Pointer(&dst[0]), unsafe.Pointer(&src[0]), blocks)
+	}
+	done := blocks * blockPixels
+	gray16ToGray8Generic(dst[done:], src[done*2:n*2])
+}
+
+// Downscale reduces an image of width x height pixels of bpp bytes by
+// factor in both directions, averaging each factor x factor box of pixels
+// channel by channel. The partial boxes of the right and bottom edges are
+// dropped. It returns the size of the result written to dst, which must
+// hold (width/factor) * (height/factor) pixels.
+//
+// Downscale is deliberately generic: the factor and the pixel size vary
+// between the callers, and the sums of the boxes of 17x17 pixels and more
+// overflow the 16-bit lanes of a NEON kernel. It runs on images that are
+// already converted, so it is not on the hot path of the conversions.
+func Downscale(dst, src []byte, width, height, bpp, factor int) (w, h int) {
+	if factor <= 1 {
+		copy(dst, src[:width*height*bpp])
+		return width, height
+	}
+	w, h = width/factor, height/factor
+	stride := width * bpp
+	area := uint32(factor * factor)
+	sums := make([]uint32, w*bpp)
+	for y := range h {
+		clear(sums)
+		for dy := range factor {
+			row := src[(y*factor+dy)*stride:]
+			for x := range w {
+				px := row[x*factor*bpp:]
+				for dx := range factor {
+					for c := range bpp {
+						sums[x*bpp+c] += uint32(px[dx*bpp+c])
+					}
+				}
+			}
+		}
+		out := dst[y*w*bpp : (y+1)*w*bpp]
+		for i, s := range sums {
+			// Rounded to the nearest
+			out[i] = byte((s + area/2) / area)
+		}
+	}
+	return w, h
+}
+
+func bgraToRGBAGeneric(dst, src []byte) {
+	// Read the pixel first, dst may be src
+	for i := 0; i+3 < len(src); i += 4 {
+		b, g, r := src[i], src[i+1], src[i+2]
+		dst[i+0] = r    // R <- B
+		dst[i+1] = g    // G <- G
+		dst[i+2] = b    // B <- R
+		dst[i+3] = 0xff // A (fully opaque)
+	}
+}
+
+// Luma weights, in 1/256 (77 + 150 + 29 = 256)
+const (
+	weightR = 77
+	weightG = 150
+	weightB = 29
+)
+
+func bgraToGray8Generic(dst, src []byte) {
+	for i := 0; i+3 < len(src); i += 4 {
+		dst[i/4] = byte((weightB*uint16(src[i]) + weightG*uint16(src[i+1]) + weightR*uint16(src[i+2])) >> 8)
+	}
+}
+
+func gray16ToGray8Generic(dst, src []byte) {
+	for i := 0; i+1 < len(src); i += 2 {
+		dst[i/2] = src[i+1]
+	}
+}
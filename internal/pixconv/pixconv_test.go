@@ -0,0 +1,181 @@
+package pixconv
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomPixels(n int) []byte {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(buf)
+	return buf
+}
+
+// sizes covers empty inputs, partial blocks, exact blocks and tails
+var sizes = []int{0, 1, 15, 16, 17, 31, 32, 100, 1404}
+
+func TestBGRAToRGBA(t *testing.T) {
+	for _, n := range sizes {
+		src := randomPixels(n * 4)
+		got, want := make([]byte, n*4), make([]byte, n*4)
+		BGRAToRGBA(got, src)
+		bgraToRGBAGeneric(want, src)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d pixels: SIMD and generic conversions differ", n)
+		}
+	}
+	got := make([]byte, 4)
+	BGRAToRGBA(got, []byte{1, 2, 3, 4})
+	if !bytes.Equal(got, []byte{3, 2, 1, 0xff}) {
+		t.Errorf("got %v, want [3 2 1 255]", got)
+	}
+}
+
+func TestBGRAToRGBAInPlace(t *testing.T) {
+	src := randomPixels(100 * 4)
+	want := make([]byte, len(src))
+	bgraToRGBAGeneric(want, src)
+	BGRAToRGBA(src, src)
+	if !bytes.Equal(src, want) {
+		t.Error("in-place conversion differs")
+	}
+}
+
+func TestBGRAToGray8(t *testing.T) {
+	for _, n := range sizes {
+		src := randomPixels(n * 4)
+		got, want := make([]byte, n), make([]byte, n)
+		BGRAToGray8(got, src)
+		bgraToGray8Generic(want, src)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d pixels: SIMD and generic conversions differ", n)
+		}
+	}
+	got := make([]byte, 3)
+	BGRAToGray8(got, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0xff, 0, 0, 0xff, 0xff})
+	if !bytes.Equal(got, []byte{0xff, 0, 76}) {
+		t.Errorf("got %v, want [255 0 76] for white, black and red", got)
+	}
+}
+
+func TestGray16ToGray8(t *testing.T) {
+	for _, n := range sizes {
+		src := randomPixels(n * 2)
+		got, want := make([]byte, n), make([]byte, n)
+		Gray16ToGray8(got, src)
+		gray16ToGray8Generic(want, src)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d pixels: SIMD and generic conversions differ", n)
+		}
+	}
+	got := make([]byte, 2)
+	Gray16ToGray8(got, []byte{0x34, 0x12, 0xff, 0xab})
+	if !bytes.Equal(got, []byte{0x12, 0xab}) {
+		t.Errorf("got %x, want 12ab", got)
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	// 5x3 gray image, the last column and row are dropped with factor 2
+	src := []byte{
+		0, 2, 10, 20, 99,
+		4, 6, 30, 41, 99,
+		99, 99, 99, 99, 99,
+	}
+	dst := make([]byte, 2)
+	w, h := Downscale(dst, src, 5, 3, 1, 2)
+	if w != 2 || h != 1 || !bytes.Equal(dst, []byte{3, 25}) {
+		t.Errorf("got %dx%d %v, want 2x1 [3 25]", w, h, dst)
+	}
+
+	// Channels are averaged separately
+	rgba := []byte{
+		0, 10, 100, 255, 4, 10, 100, 255,
+		0, 20, 200, 255, 4, 20, 200, 255,
+	}
+	dst = make([]byte, 4)
+	Downscale(dst, rgba, 2, 2, 4, 2)
+	if !bytes.Equal(dst, []byte{2, 15, 150, 255}) {
+		t.Errorf("got %v, want [2 15 150 255]", dst)
+	}
+
+	dst = make([]byte, len(src))
+	if w, h := Downscale(dst, src, 5, 3, 1, 1); w != 5 || h != 3 || !bytes.Equal(dst, src) {
+		t.Error("factor 1 should copy the image")
+	}
+}
+
+func FuzzBGRAToRGBA(f *testing.F) {
+	f.Add(randomPixels(64))
+	f.Add(randomPixels(71))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		n := len(src) / 4 * 4
+		got, want := make([]byte, n), make([]byte, n)
+		BGRAToRGBA(got, src)
+		bgraToRGBAGeneric(want, src[:n])
+		if !bytes.Equal(got, want) {
+			t.Errorf("SIMD and generic conversions differ for %x", src)
+		}
+	})
+}
+
+func FuzzBGRAToGray8(f *testing.F) {
+	f.Add(randomPixels(64))
+	f.Add(randomPixels(71))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		got, want := make([]byte, len(src)/4), make([]byte, len(src)/4)
+		BGRAToGray8(got, src)
+		bgraToGray8Generic(want, src[:len(src)/4*4])
+		if !bytes.Equal(got, want) {
+			t.Errorf("SIMD and generic conversions differ for %x", src)
+		}
+	})
+}
+
+func FuzzGray16ToGray8(f *testing.F) {
+	f.Add(randomPixels(32))
+	f.Add(randomPixels(37))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		got, want := make([]byte, len(src)/2), make([]byte, len(src)/2)
+		Gray16ToGray8(got, src)
+		gray16ToGray8Generic(want, src[:len(src)/2*2])
+		if !bytes.Equal(got, want) {
+			t.Errorf("SIMD and generic conversions differ for %x", src)
+		}
+	})
+}
+
+const benchPixels = 1404 * 1872
+
+func BenchmarkBGRAToRGBA(b *testing.B) {
+	src, dst := randomPixels(benchPixels*4), make([]byte, benchPixels*4)
+	b.SetBytes(int64(len(src)))
+	for b.Loop() {
+		BGRAToRGBA(dst, src)
+	}
+}
+
+func BenchmarkBGRAToRGBA_Generic(b *testing.B) {
+	src, dst := randomPixels(benchPixels*4), make([]byte, benchPixels*4)
+	b.SetBytes(int64(len(src)))
+	for b.Loop() {
+		bgraToRGBAGeneric(dst, src)
+	}
+}
+
+func BenchmarkBGRAToGray8(b *testing.B) {
+	src, dst := randomPixels(benchPixels*4), make([]byte, benchPixels)
+	b.SetBytes(int64(len(src)))
+	for b.Loop() {
+		BGRAToGray8(dst, src)
+	}
+}
+
+func BenchmarkBGRAToGray8_Generic(b *testing.B) {
+	src, dst := randomPixels(benchPixels*4), make([]byte, benchPixels)
+	b.SetBytes(int64(len(src)))
+	for b.Loop() {
+		bgraToGray8Generic(dst, src)
+	}
+}
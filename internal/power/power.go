@@ -0,0 +1,233 @@
+// Package power tracks whether the tablet is awake or sleeping, so streaming
+// can be suspended while the screen cannot change and refreshed on wake.
+//
+// The state is derived from the folio cover switch and the power button
+// published on the bus, from the suspend statistics of the kernel in
+// /sys/power, and from the gap between the wall clock and the monotonic
+// clock (which stops while the system is suspended). The battery state is
+// read from /sys/class/power_supply.
+package power
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// State is the power state of the tablet.
+type State string
+
+const (
+	// Awake means the screen is on
+	Awake State = "awake"
+	// Sleeping means the tablet is asleep or the folio is closed
+	Sleeping State = "sleeping"
+)
+
+// Reasons of a state change
+const (
+	ReasonLid         = "lid"
+	ReasonPowerButton = "power-button"
+	ReasonResume      = "resume"
+	ReasonInput       = "input"
+)
+
+// Topic is the name of the topic of the status changes on the bus
+const Topic = "power/status"
+
+// Event codes of the power related events
+const (
+	// SwLid is the EV_SW code of the folio cover sensor (1 when closed)
+	SwLid uint16 = 0
+	// KeyPower is the EV_KEY code of the power button
+	KeyPower uint16 = 116
+)
+
+// Status describes the power state of the tablet.
+type Status struct {
+	State  State     `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	// Battery is nil when no battery is reported by the kernel
+	Battery *Battery `json:"battery,omitempty"`
+}
+
+// Config configures a Monitor.
+type Config struct {
+	// PowerSupplyDir is the sysfs directory listing the power supplies
+	PowerSupplyDir string
+	// SuspendStatsPath is the counter of successful suspends
+	SuspendStatsPath string
+	// PollInterval is how often the suspend counter and the clocks are checked
+	PollInterval time.Duration
+	// BatteryInterval is how often the battery is read
+	BatteryInterval time.Duration
+}
+
+// DefaultConfig returns the configuration for the reMarkable sysfs layout.
+func DefaultConfig() Config {
+	return Config{
+		PowerSupplyDir:   "/sys/class/power_supply",
+		SuspendStatsPath: "/sys/power/suspend_stats/success",
+		PollInterval:     time.Second,
+		BatteryInterval:  30 * time.Second,
+	}
+}
+
+// Monitor tracks the power state and publishes its changes on the bus.
+// An Awake notification is also sent after each resume from suspend, even if
+// the tablet was not seen going to sleep, since the screen may have changed.
+type Monitor struct {
+	config Config
+	now    func() time.Time
+	topic  *bus.Topic[Status]
+
+	mu     sync.Mutex
+	status Status
+
+	// Polling state, only used by the monitor goroutine
+	lastTick     time.Time
+	suspendCount int
+	hasSuspends  bool
+}
+
+// NewMonitor creates a monitor, initially awake, publishing the status
+// changes on the Topic of b.
+func NewMonitor(config Config, b *bus.Bus) *Monitor {
+	m := &Monitor{
+		config: config,
+		now:    time.Now,
+		topic:  bus.NewTopic[Status](b, Topic),
+	}
+	m.status = Status{State: Awake, Since: m.now()}
+	return m
+}
+
+// Status returns the current power status.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Topic returns the topic of the status changes.
+func (m *Monitor) Topic() *bus.Topic[Status] {
+	return m.topic
+}
+
+// Start subscribes to the bus and monitors the power state until ctx is done.
+func (m *Monitor) Start(ctx context.Context, ps *pubsub.PubSub) {
+	eventC := ps.Subscribe("power")
+	m.suspendCount, m.hasSuspends = readSuspendCount(m.config.SuspendStatsPath)
+	m.lastTick = m.now()
+	m.updateBattery()
+
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		poll := time.NewTicker(m.config.PollInterval)
+		defer poll.Stop()
+		battery := time.NewTicker(m.config.BatteryInterval)
+		defer battery.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-eventC:
+				m.HandleEvent(ev)
+			case <-poll.C:
+				m.poll()
+			case <-battery.C:
+				m.updateBattery()
+			}
+		}
+	}()
+}
+
+// HandleEvent updates the state from an input event.
+func (m *Monitor) HandleEvent(ev events.InputEventFromSource) {
+	switch {
+	case ev.Source == events.System && ev.Type == events.EvSw && ev.Code == SwLid:
+		if ev.Value == 1 {
+			m.set(Sleeping, ReasonLid, false)
+		} else {
+			m.set(Awake, ReasonLid, false)
+		}
+	case ev.Source == events.System && ev.Type == events.EvKey && ev.Code == KeyPower && ev.Value == events.KeyPressed,
+		ev.Type == events.EvPwr:
+		if m.Status().State == Awake {
+			m.set(Sleeping, ReasonPowerButton, false)
+		} else {
+			m.set(Awake, ReasonPowerButton, false)
+		}
+	case ev.Source == events.Pen || ev.Source == events.Touch || ev.Source == events.Keyboard:
+		// Input while sleeping means a wake was missed
+		if m.Status().State == Sleeping {
+			m.set(Awake, ReasonInput, false)
+		}
+	}
+}
+
+// poll detects the resumes from suspend.
+func (m *Monitor) poll() {
+	now := m.now()
+	// time.Sub uses the monotonic clock, which stops during suspend, while
+	// the wall clock keeps running
+	wall := now.Round(0).Sub(m.lastTick.Round(0))
+	mono := now.Sub(m.lastTick)
+	m.lastTick = now
+	resumed := wall-mono > 2*m.config.PollInterval
+
+	if count, ok := readSuspendCount(m.config.SuspendStatsPath); ok {
+		if m.hasSuspends && count > m.suspendCount {
+			resumed = true
+		}
+		m.suspendCount, m.hasSuspends = count, true
+	}
+	if resumed {
+		m.set(Awake, ReasonResume, true)
+	}
+}
+
+func (m *Monitor) updateBattery() {
+	battery, ok := readBattery(m.config.PowerSupplyDir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := (m.status.Battery == nil) == ok
+	if ok && m.status.Battery != nil {
+		changed = *m.status.Battery != battery
+	}
+	if !changed {
+		return
+	}
+	if ok {
+		m.status.Battery = &battery
+	} else {
+		m.status.Battery = nil
+	}
+	m.notify()
+}
+
+// set changes the state. Unchanged states are only notified if force is set.
+func (m *Monitor) set(state State, reason string, force bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status.State == state && !force {
+		return
+	}
+	log.Printf("Power: %s (%s)", state, reason)
+	m.status.State = state
+	m.status.Reason = reason
+	m.status.Since = m.now()
+	m.notify()
+}
+
+// notify publishes the status. m.mu must be held, for the changes to be
+// published in order.
+func (m *Monitor) notify() {
+	m.topic.Publish(m.status)
+}
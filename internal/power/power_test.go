@@ -0,0 +1,158 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/bus"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+func testConfig(t *testing.T) Config {
+	dir := t.TempDir()
+	return Config{
+		PowerSupplyDir:   filepath.Join(dir, "power_supply"),
+		SuspendStatsPath: filepath.Join(dir, "success"),
+		PollInterval:     time.Second,
+		BatteryInterval:  time.Minute,
+	}
+}
+
+func systemEvent(typ, code uint16, value int32) events.InputEventFromSource {
+	return events.InputEventFromSource{
+		Source:     events.System,
+		InputEvent: events.InputEvent{Type: typ, Code: code, Value: value},
+	}
+}
+
+// next returns the next notification, failing if there is none.
+func next(t *testing.T, ch chan Status) Status {
+	t.Helper()
+	select {
+	case s := <-ch:
+		return s
+	default:
+		t.Fatal("no status notified")
+		return Status{}
+	}
+}
+
+// subscribe returns a channel receiving the status changes of m.
+func subscribe(t *testing.T, m *Monitor) chan Status {
+	sub := m.Topic().Subscribe("test", bus.Options[Status]{BufferSize: 8})
+	t.Cleanup(sub.Close)
+	return sub.C
+}
+
+func TestLid(t *testing.T) {
+	m := NewMonitor(testConfig(t), bus.New())
+	ch := subscribe(t, m)
+
+	m.HandleEvent(systemEvent(events.EvSw, SwLid, 1))
+	if s := next(t, ch); s.State != Sleeping || s.Reason != ReasonLid {
+		t.Errorf("closing the folio notified %+v, want sleeping (lid)", s)
+	}
+	// Repeated states are not notified
+	m.HandleEvent(systemEvent(events.EvSw, SwLid, 1))
+	if len(ch) != 0 {
+		t.Errorf("unchanged state notified: %+v", <-ch)
+	}
+	m.HandleEvent(systemEvent(events.EvSw, SwLid, 0))
+	if s := next(t, ch); s.State != Awake {
+		t.Errorf("opening the folio notified %+v, want awake", s)
+	}
+}
+
+func TestPowerButton(t *testing.T) {
+	m := NewMonitor(testConfig(t), bus.New())
+	ch := subscribe(t, m)
+
+	m.HandleEvent(systemEvent(events.EvKey, KeyPower, events.KeyPressed))
+	if s := next(t, ch); s.State != Sleeping || s.Reason != ReasonPowerButton {
+		t.Errorf("power button notified %+v, want sleeping", s)
+	}
+	// Releasing the button does not change the state
+	m.HandleEvent(systemEvent(events.EvKey, KeyPower, events.KeyReleased))
+	if m.Status().State != Sleeping {
+		t.Error("releasing the power button woke the device")
+	}
+	m.HandleEvent(systemEvent(events.EvKey, KeyPower, events.KeyPressed))
+	if s := next(t, ch); s.State != Awake {
+		t.Errorf("second press notified %+v, want awake", s)
+	}
+}
+
+func TestInputWakes(t *testing.T) {
+	m := NewMonitor(testConfig(t), bus.New())
+	m.HandleEvent(systemEvent(events.EvSw, SwLid, 1))
+	m.HandleEvent(events.InputEventFromSource{Source: events.Pen, InputEvent: events.InputEvent{Type: events.EvAbs}})
+	if s := m.Status(); s.State != Awake || s.Reason != ReasonInput {
+		t.Errorf("status after pen input = %+v, want awake (input)", s)
+	}
+}
+
+func TestResumeFromSuspend(t *testing.T) {
+	cfg := testConfig(t)
+	if err := os.WriteFile(cfg.SuspendStatsPath, []byte("3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitor(cfg, bus.New())
+	m.suspendCount, m.hasSuspends = readSuspendCount(cfg.SuspendStatsPath)
+	m.lastTick = m.now()
+	ch := subscribe(t, m)
+
+	m.poll()
+	if len(ch) != 0 {
+		t.Fatalf("notified without suspend: %+v", <-ch)
+	}
+	if err := os.WriteFile(cfg.SuspendStatsPath, []byte("4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.poll()
+	// A resume is notified even though the device was not seen sleeping,
+	// so the clients refresh the screen
+	if s := next(t, ch); s.State != Awake || s.Reason != ReasonResume {
+		t.Errorf("resume notified %+v, want awake (resume)", s)
+	}
+}
+
+func TestBattery(t *testing.T) {
+	cfg := testConfig(t)
+	bat := filepath.Join(cfg.PowerSupplyDir, "max77818_battery")
+	charger := filepath.Join(cfg.PowerSupplyDir, "max77818-charger")
+	for dir, attrs := range map[string]map[string]string{
+		charger: {"type": "USB", "online": "1"},
+		bat:     {"type": "Battery", "capacity": "87", "status": "Charging"},
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range attrs {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	m := NewMonitor(cfg, bus.New())
+	ch := subscribe(t, m)
+	m.updateBattery()
+	s := next(t, ch)
+	if s.Battery == nil || *s.Battery != (Battery{Capacity: 87, Status: "Charging"}) {
+		t.Fatalf("battery = %+v, want 87%% charging", s.Battery)
+	}
+	m.updateBattery()
+	if len(ch) != 0 {
+		t.Errorf("unchanged battery notified: %+v", <-ch)
+	}
+
+	if err := os.WriteFile(filepath.Join(bat, "capacity"), []byte("86\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.updateBattery()
+	if s := next(t, ch); s.Battery == nil || s.Battery.Capacity != 86 {
+		t.Errorf("battery = %+v, want 86%%", s.Battery)
+	}
+}
@@ -0,0 +1,63 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Battery is the state of the battery.
+type Battery struct {
+	// Capacity is the charge level in percent
+	Capacity int `json:"capacity"`
+	// Status is the charging status reported by the kernel, such as
+	// "Charging", "Discharging" or "Full"
+	Status string `json:"status"`
+}
+
+// readBattery reads the first battery listed in the power supply directory.
+func readBattery(dir string) (Battery, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Battery{}, false
+	}
+	for _, entry := range entries {
+		supply := filepath.Join(dir, entry.Name())
+		if readAttribute(supply, "type") != "Battery" {
+			continue
+		}
+		capacity, err := strconv.Atoi(readAttribute(supply, "capacity"))
+		if err != nil {
+			continue
+		}
+		return Battery{
+			Capacity: capacity,
+			Status:   readAttribute(supply, "status"),
+		}, true
+	}
+	return Battery{}, false
+}
+
+// readSuspendCount reads the number of successful suspends.
+func readSuspendCount(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return count, true
+}
+
+// readAttribute returns the trimmed content of a sysfs attribute, or an empty
+// string if it cannot be read.
+func readAttribute(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
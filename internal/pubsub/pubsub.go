@@ -2,85 +2,130 @@ package pubsub
 
 import (
 	"sync"
+	"time"
 
+	"github.com/owulveryck/goMarkableStream/internal/bus"
 	"github.com/owulveryck/goMarkableStream/internal/debug"
 	"github.com/owulveryck/goMarkableStream/internal/events"
 	"github.com/owulveryck/goMarkableStream/internal/trace"
 )
 
+const (
+	// DefaultBufferSize is the size of the channel of a subscriber
+	DefaultBufferSize = bus.DefaultBufferSize
+	// DefaultTimeout is how long Publish waits for a Block subscriber
+	DefaultTimeout = bus.DefaultTimeout
+
+	// InputTopics is the pattern of the topics of the input events, one
+	// per source: "input/pen", "input/touch", "input/keyboard" and
+	// "input/system"
+	InputTopics = "input/*"
+)
+
+// Policy is what Publish does when the channel of a subscriber is full
+// (see bus.Policy).
+type Policy = bus.Policy
+
+// Delivery policies
+const (
+	DropNewest     = bus.DropNewest
+	DropOldest     = bus.DropOldest
+	Block          = bus.Block
+	CoalesceLatest = bus.CoalesceLatest
+)
+
+// SubscriberStats are the delivery counters of a subscriber.
+type SubscriberStats = bus.Stats
+
 // EventFilter allows subscribers to filter events by source and type
 type EventFilter struct {
 	Source *int    // nil = all sources
 	Type   *uint16 // nil = all types
 }
 
-type subscriber struct {
-	ch     chan events.InputEventFromSource
-	filter EventFilter
+// Options configure a subscription.
+type Options struct {
+	Filter EventFilter
+	// BufferSize is the size of the channel, DefaultBufferSize if 0
+	BufferSize int
+	// Policy applies when the channel is full
+	Policy Policy
+	// Timeout is the maximum wait of the Block policy, DefaultTimeout if 0
+	Timeout time.Duration
+	// Priority orders the deliveries of an event: the subscribers of
+	// higher priority get it before the Block subscribers of lower priority
+	// wait for room. The wait still delays the next events.
+	Priority int
+	// Resync, with DropOldest, replaces the events dropped by a
+	// SYN_DROPPED event, as the kernel does when its buffer overruns: the
+	// subscriber must rebuild its state from the next SYN_REPORT
+	Resync bool
 }
 
-// PubSub is a structure to hold publisher and subscribers to events
+// PubSub is a structure to hold publisher and subscribers to events. The
+// events are published on the bus, on the topic of their source; the
+// events of unknown sources go to the "input/unknown" topic.
 type PubSub struct {
-	subscribers map[chan events.InputEventFromSource]subscriber
-	mu          sync.RWMutex // Use RWMutex for better read concurrency
-	slicePool   sync.Pool    // Pool for subscriber slice allocations
+	bus     *bus.Bus
+	topics  [events.System + 1]*bus.Topic[events.InputEventFromSource]
+	unknown *bus.Topic[events.InputEventFromSource]
+
+	mu            sync.Mutex
+	subscriptions map[chan events.InputEventFromSource]*bus.Subscription[events.InputEventFromSource]
 }
 
-// NewPubSub creates a new pubsub
+// NewPubSub creates a new pubsub, publishing the input events on a new bus
 func NewPubSub() *PubSub {
-	return &PubSub{
-		subscribers: make(map[chan events.InputEventFromSource]subscriber),
-		slicePool: sync.Pool{
-			New: func() any {
-				// Pre-allocate slice with small capacity
-				// Will grow as needed
-				s := make([]chan events.InputEventFromSource, 0, 8)
-				return &s
-			},
-		},
+	b := bus.New()
+	ps := &PubSub{
+		bus:           b,
+		subscriptions: make(map[chan events.InputEventFromSource]*bus.Subscription[events.InputEventFromSource]),
+	}
+	for source := events.Pen; source < len(ps.topics); source++ {
+		ps.topics[source] = bus.NewTopic[events.InputEventFromSource](b, TopicName(source))
 	}
+	ps.unknown = bus.NewTopic[events.InputEventFromSource](b, TopicName(-1))
+	return ps
 }
 
-// Publish an event to all subscribers
-func (ps *PubSub) Publish(event events.InputEventFromSource) {
-	span := trace.BeginSpan("pubsub_publish")
+// TopicName returns the name of the topic of the events of a source.
+func TopicName(source int) string {
+	switch source {
+	case events.Pen:
+		return "input/pen"
+	case events.Touch:
+		return "input/touch"
+	case events.Keyboard:
+		return "input/keyboard"
+	case events.System:
+		return "input/system"
+	}
+	return "input/unknown"
+}
 
-	// Get slice from pool
-	subscribersPtr := ps.slicePool.Get().(*[]chan events.InputEventFromSource)
-	subscribers := (*subscribersPtr)[:0] // Reset to zero length, keep capacity
+// Bus returns the bus of the pubsub.
+func (ps *PubSub) Bus() *bus.Bus {
+	return ps.bus
+}
 
-	// Copy subscriber list under read lock, applying filters
-	ps.mu.RLock()
-	for ch, sub := range ps.subscribers {
-		// Apply filter - cache filter values to avoid pointer dereferences
-		if sub.filter.Source != nil && *sub.filter.Source != event.Source {
-			continue // Skip this subscriber
-		}
-		if sub.filter.Type != nil && *sub.filter.Type != event.Type {
-			continue // Skip this subscriber
-		}
-		subscribers = append(subscribers, ch)
-	}
-	ps.mu.RUnlock()
-
-	// Send to matching subscribers without holding lock
-	for _, ch := range subscribers {
-		select {
-		case ch <- event:
-			// Successfully sent
-		default:
-			// Channel full - subscriber is slow, drop event
-		}
+// topic returns the topic of a source, without taking the lock of the bus.
+func (ps *PubSub) topic(source int) *bus.Topic[events.InputEventFromSource] {
+	if source > 0 && source < len(ps.topics) {
+		return ps.topics[source]
 	}
+	return ps.unknown
+}
+
+// Publish an event to all subscribers
+func (ps *PubSub) Publish(event events.InputEventFromSource) {
+	span := trace.BeginSpan("pubsub_publish")
 
-	// Return slice to pool
-	*subscribersPtr = subscribers
-	ps.slicePool.Put(subscribersPtr)
+	matched := ps.topic(event.Source).Publish(event)
 
 	trace.EndSpan(span, map[string]any{
 		"event_type":   event.Type,
 		"event_source": event.Source,
-		"subscribers":  len(subscribers),
+		"subscribers":  matched,
 	})
 }
 
@@ -91,27 +136,94 @@ func (ps *PubSub) Subscribe(name string) chan events.InputEventFromSource {
 
 // SubscribeWithFilter subscribes to events with optional filtering by source and type
 func (ps *PubSub) SubscribeWithFilter(name string, filter EventFilter) chan events.InputEventFromSource {
-	eventChan := make(chan events.InputEventFromSource, 100)
+	return ps.SubscribeWithOptions(name, Options{Filter: filter})
+}
 
-	ps.mu.Lock() // Full write lock for subscription
-	ps.subscribers[eventChan] = subscriber{
-		ch:     eventChan,
-		filter: filter,
+// SubscribeWithOptions subscribes to events with a delivery policy.
+func (ps *PubSub) SubscribeWithOptions(name string, opts Options) chan events.InputEventFromSource {
+	busOpts := bus.Options[events.InputEventFromSource]{
+		BufferSize: opts.BufferSize,
+		Policy:     opts.Policy,
+		Timeout:    opts.Timeout,
+		Priority:   opts.Priority,
+		Key:        coalesceKey,
+	}
+	if opts.Resync {
+		var source int
+		if opts.Filter.Source != nil {
+			source = *opts.Filter.Source
+		}
+		busOpts.Overflow = func() events.InputEventFromSource {
+			return events.InputEventFromSource{
+				Source:     source,
+				InputEvent: events.InputEvent{Type: events.EvSyn, Code: events.SynDropped},
+			}
+		}
+	}
+	// The unknown sources share a topic: their events are filtered by source
+	checkSource := opts.Filter.Source != nil && ps.topic(*opts.Filter.Source) == ps.unknown
+	checkType := opts.Filter.Type != nil
+	if checkSource || checkType {
+		var source int
+		var eventType uint16
+		if checkSource {
+			source = *opts.Filter.Source
+		}
+		if checkType {
+			eventType = *opts.Filter.Type
+		}
+		busOpts.Filter = func(event events.InputEventFromSource) bool {
+			return (!checkSource || event.Source == source) && (!checkType || event.Type == eventType)
+		}
+	}
+	var sub *bus.Subscription[events.InputEventFromSource]
+	if opts.Filter.Source != nil {
+		sub = ps.topic(*opts.Filter.Source).Subscribe(name, busOpts)
+	} else {
+		sub = bus.Subscribe(ps.bus, InputTopics, name, busOpts)
 	}
-	debug.Log("PubSub: new subscriber '%s', total=%d", name, len(ps.subscribers))
+
+	ps.mu.Lock()
+	ps.subscriptions[sub.C] = sub
+	debug.Log("PubSub: new subscriber '%s' (%s), total=%d", name, opts.Policy, len(ps.subscriptions))
 	ps.mu.Unlock()
 
-	return eventChan
+	return sub.C
+}
+
+// coalesceKey identifies the events replacing each other with
+// CoalesceLatest: the events of the same source, type and code.
+func coalesceKey(event events.InputEventFromSource) uint64 {
+	return uint64(event.Source)<<32 | uint64(event.Type)<<16 | uint64(event.Code)
 }
 
 // Unsubscribe from the events
 func (ps *PubSub) Unsubscribe(ch chan events.InputEventFromSource) {
 	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	sub, ok := ps.subscriptions[ch]
+	delete(ps.subscriptions, ch)
+	remaining := len(ps.subscriptions)
+	ps.mu.Unlock()
+	if !ok {
+		return
+	}
+	sub.Close() // Closes the channel to signal subscriber to exit.
+	debug.Log("PubSub: unsubscribed, remaining=%d", remaining)
+}
 
-	if _, ok := ps.subscribers[ch]; ok {
-		delete(ps.subscribers, ch)
-		close(ch) // Close the channel to signal subscriber to exit.
-		debug.Log("PubSub: unsubscribed, remaining=%d", len(ps.subscribers))
+// SubscriberStats returns the delivery counters of the subscriber of ch.
+func (ps *PubSub) SubscriberStats(ch chan events.InputEventFromSource) (SubscriberStats, bool) {
+	ps.mu.Lock()
+	sub, ok := ps.subscriptions[ch]
+	ps.mu.Unlock()
+	if !ok {
+		return SubscriberStats{}, false
 	}
+	return sub.Stats(), true
+}
+
+// Stats returns the delivery counters of the subscribers of the bus, by
+// decreasing priority.
+func (ps *PubSub) Stats() []SubscriberStats {
+	return ps.bus.Stats()
 }
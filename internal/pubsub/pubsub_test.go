@@ -324,3 +324,224 @@ func TestEventFiltering(t *testing.T) {
 	ps.Unsubscribe(chAbs)
 	ps.Unsubscribe(chPenAbs)
 }
+
+// publishCodes publishes pen events with the given codes.
+func publishCodes(ps *PubSub, codes ...uint16) {
+	for _, code := range codes {
+		ps.Publish(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: events.EvAbs, Code: code, Value: int32(code)},
+		})
+	}
+}
+
+// receiveCodes reads the codes of the events queued in ch.
+func receiveCodes(t *testing.T, ch chan events.InputEventFromSource, n int) []uint16 {
+	t.Helper()
+	var codes []uint16
+	for range n {
+		select {
+		case ev := <-ch:
+			codes = append(codes, ev.Code)
+		case <-time.After(200 * time.Millisecond):
+			t.Fatalf("timeout after %v", codes)
+		}
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %+v after %v", ev, codes)
+	default:
+	}
+	return codes
+}
+
+// statsOf returns the counters of the subscriber named name.
+func statsOf(t *testing.T, ps *PubSub, name string) SubscriberStats {
+	t.Helper()
+	for _, s := range ps.Stats() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no subscriber %q", name)
+	return SubscriberStats{}
+}
+
+func TestDeliveryPolicies(t *testing.T) {
+	tests := []struct {
+		policy  Policy
+		buffer  int
+		publish []uint16
+		want    []uint16
+		dropped uint64
+	}{
+		{DropNewest, 2, []uint16{1, 2, 3, 4}, []uint16{1, 2}, 2},
+		{DropOldest, 2, []uint16{1, 2, 3, 4}, []uint16{3, 4}, 2},
+		// The first events fill the channel, the next ones are queued
+		{CoalesceLatest, 2, []uint16{1, 2, 3, 4, 3, 4, 3}, []uint16{1, 2, 3, 4}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			ps := NewPubSub()
+			ch := ps.SubscribeWithOptions("sub", Options{BufferSize: tt.buffer, Policy: tt.policy})
+			for _, code := range tt.publish {
+				publishCodes(ps, code)
+				// Let the queue fill the channel
+				time.Sleep(time.Millisecond)
+			}
+			stats := statsOf(t, ps, "sub")
+			got := receiveCodes(t, ch, len(tt.want))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("received %v, want %v", got, tt.want)
+				}
+			}
+			if stats.Dropped != tt.dropped || stats.Policy != tt.policy.String() {
+				t.Errorf("stats = %+v, want %d dropped", stats, tt.dropped)
+			}
+			ps.Unsubscribe(ch)
+		})
+	}
+}
+
+func TestDropOldestResync(t *testing.T) {
+	ps := NewPubSub()
+	penSource := events.Pen
+	ch := ps.SubscribeWithOptions("gestures", Options{
+		Filter:     EventFilter{Source: &penSource},
+		BufferSize: 3,
+		Policy:     DropOldest,
+		Resync:     true,
+	})
+	defer ps.Unsubscribe(ch)
+
+	publishCodes(ps, 10, 11, 12, 13)
+	first := <-ch
+	if first.Type != events.EvSyn || first.Code != events.SynDropped || first.Source != events.Pen {
+		t.Fatalf("first event = %+v, want SYN_DROPPED", first)
+	}
+	if got := receiveCodes(t, ch, 1); got[0] != 13 {
+		t.Errorf("received %v after SYN_DROPPED, want [13]", got)
+	}
+}
+
+func TestCoalesceLatestKeepsLatestValue(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithOptions("hover", Options{BufferSize: 1, Policy: CoalesceLatest})
+	defer ps.Unsubscribe(ch)
+	publish := func(code uint16, value int32) {
+		ps.Publish(events.InputEventFromSource{
+			Source:     events.Pen,
+			InputEvent: events.InputEvent{Type: events.EvAbs, Code: code, Value: value},
+		})
+		time.Sleep(time.Millisecond)
+	}
+	publish(0, 1)
+	publish(0, 2)
+	publish(1, 10)
+	publish(0, 3)
+	want := []events.InputEvent{{Type: events.EvAbs, Code: 0, Value: 1}, {Type: events.EvAbs, Code: 0, Value: 3}, {Type: events.EvAbs, Code: 1, Value: 10}}
+	for _, w := range want {
+		select {
+		case ev := <-ch:
+			if ev.InputEvent != w {
+				t.Errorf("received %+v, want %+v", ev.InputEvent, w)
+			}
+		case <-time.After(200 * time.Millisecond):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestBlockWithTimeout(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.SubscribeWithOptions("recorder", Options{BufferSize: 1, Policy: Block, Timeout: 50 * time.Millisecond})
+	publishCodes(ps, 1)
+
+	// The event waits for the reader
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	publishCodes(ps, 2)
+	if got := receiveCodes(t, ch, 1); got[0] != 2 {
+		t.Errorf("received %v, want [2]", got)
+	}
+
+	// Without reader, the event is dropped after the timeout
+	publishCodes(ps, 3)
+	start := time.Now()
+	publishCodes(ps, 4)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Publish returned after %v, want the 50ms timeout", elapsed)
+	}
+	if got := receiveCodes(t, ch, 1); got[0] != 3 {
+		t.Errorf("received %v, want [3]", got)
+	}
+	if stats := statsOf(t, ps, "recorder"); stats.Dropped != 1 || stats.Delivered != 3 {
+		t.Errorf("stats = %+v, want 3 delivered and 1 dropped", stats)
+	}
+
+	// Unsubscribing during a blocked delivery does not panic
+	publishCodes(ps, 5)
+	done := make(chan struct{})
+	go func() {
+		publishCodes(ps, 6)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ps.Unsubscribe(ch)
+	<-done
+}
+
+func TestPriority(t *testing.T) {
+	ps := NewPubSub()
+	// A slow lossless subscriber delivered last
+	blocked := ps.SubscribeWithOptions("slow", Options{BufferSize: 1, Policy: Block, Timeout: time.Second, Priority: -1})
+	defer ps.Unsubscribe(blocked)
+	fast := ps.Subscribe("fast")
+	defer ps.Unsubscribe(fast)
+	if stats := ps.Stats(); stats[0].Name != "fast" || stats[1].Name != "slow" {
+		t.Errorf("stats = %+v, want the subscribers by decreasing priority", stats)
+	}
+
+	publishCodes(ps, 1)
+	<-fast
+	go publishCodes(ps, 2)
+	select {
+	case <-fast:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the blocked subscriber delays the subscribers of higher priority")
+	}
+	<-blocked
+}
+
+func TestUnknownSource(t *testing.T) {
+	ps := NewPubSub()
+	ch := ps.Subscribe("all")
+	defer ps.Unsubscribe(ch)
+
+	ps.Publish(events.InputEventFromSource{Source: 42, InputEvent: events.InputEvent{Code: 7}})
+	select {
+	case ev := <-ch:
+		if ev.Source != 42 || ev.Code != 7 {
+			t.Errorf("received %+v", ev)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("the event of an unknown source was not delivered")
+	}
+	// The subscribers of an unknown source only get its events
+	source := 99
+	sourceC := ps.SubscribeWithFilter("source 99", EventFilter{Source: &source})
+	defer ps.Unsubscribe(sourceC)
+	ps.Publish(events.InputEventFromSource{Source: 0, InputEvent: events.InputEvent{Code: 1}})
+	ps.Publish(events.InputEventFromSource{Source: 99, InputEvent: events.InputEvent{Code: 2}})
+	select {
+	case ev := <-sourceC:
+		if ev.Source != 99 || ev.Code != 2 {
+			t.Errorf("source 99 received %+v", ev)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("the event of source 99 was not delivered")
+	}
+}
@@ -0,0 +1,131 @@
+// Package recording captures the input events published on the bus to a file
+// and replays them, so the stream and gesture logic can be exercised without
+// a physical tablet.
+//
+// Recordings are JSON Lines files, one event per line:
+//
+//	{"time":1700000000123456,"source":1,"type":3,"code":0,"value":5062}
+//
+// where time is the kernel timestamp of the event in microseconds.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+)
+
+// Record is the serialized form of an input event.
+type Record struct {
+	Time   int64  `json:"time"` // microseconds since the epoch
+	Source int    `json:"source"`
+	Type   uint16 `json:"type"`
+	Code   uint16 `json:"code"`
+	Value  int32  `json:"value"`
+}
+
+// NewRecord converts an event, keeping its timestamp.
+func NewRecord(ev events.InputEventFromSource) Record {
+	sec, nsec := ev.Time.Unix()
+	return Record{
+		Time:   sec*1e6 + nsec/1e3,
+		Source: ev.Source,
+		Type:   ev.Type,
+		Code:   ev.Code,
+		Value:  ev.Value,
+	}
+}
+
+// Timestamp returns the time of the record.
+func (r Record) Timestamp() time.Time {
+	return time.UnixMicro(r.Time)
+}
+
+// Event converts the record back to an input event.
+func (r Record) Event() events.InputEventFromSource {
+	return events.InputEventFromSource{
+		Source: r.Source,
+		InputEvent: events.InputEvent{
+			Time:  syscall.NsecToTimeval(r.Time * 1e3),
+			Type:  r.Type,
+			Code:  r.Code,
+			Value: r.Value,
+		},
+	}
+}
+
+// Encoder writes records.
+type Encoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewEncoder returns an encoder writing to w. Flush must be called to write
+// the buffered records.
+func NewEncoder(w io.Writer) *Encoder {
+	bw := bufio.NewWriter(w)
+	return &Encoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// Encode writes an event.
+func (e *Encoder) Encode(ev events.InputEventFromSource) error {
+	return e.enc.Encode(NewRecord(ev))
+}
+
+// Flush writes the buffered records to the underlying writer.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// Decoder reads records.
+type Decoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewDecoder returns a decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{scanner: bufio.NewScanner(r)}
+}
+
+// Decode reads the next record. It returns io.EOF at the end of the recording.
+func (d *Decoder) Decode() (Record, error) {
+	for d.scanner.Scan() {
+		d.line++
+		line := d.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", d.line, err)
+		}
+		return r, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// ReadAll reads all the records.
+func ReadAll(r io.Reader) ([]Record, error) {
+	d := NewDecoder(r)
+	var records []Record
+	for {
+		rec, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
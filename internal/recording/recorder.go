@@ -0,0 +1,170 @@
+package recording
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+const (
+	// flushInterval bounds how long records stay in memory before being written
+	flushInterval = time.Second
+	// bufferSize is the number of events queued while the file is written,
+	// about a minute of drawing
+	bufferSize = 16384
+)
+
+// Recorder writes every event published on the bus. When the writes fall
+// behind, the oldest events queued are dropped (see Dropped).
+type Recorder struct {
+	enc    *Encoder
+	closer io.Closer
+	done   chan struct{}
+
+	mu      sync.Mutex
+	count   int
+	dropped uint64
+	err     error
+}
+
+// NewRecorder creates a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{
+		enc:  NewEncoder(w),
+		done: make(chan struct{}),
+	}
+	if c, ok := w.(io.Closer); ok {
+		r.closer = c
+	}
+	return r
+}
+
+// CreateRecorder creates (or truncates) the file at path and returns a
+// recorder writing to it.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Start subscribes to the bus and records until ctx is done. The records are
+// flushed and the underlying writer is closed when the recording ends.
+func (r *Recorder) Start(ctx context.Context, ps *pubsub.PubSub) {
+	// The recording must not delay the other subscribers: a slow write,
+	// such as a flush to the eMMC, is absorbed by a large buffer, and the
+	// oldest events are dropped if it overflows
+	eventC := ps.SubscribeWithOptions("recorder", pubsub.Options{
+		BufferSize: bufferSize,
+		Policy:     pubsub.DropOldest,
+		Priority:   -1,
+	})
+	go func() {
+		defer close(r.done)
+		defer ps.Unsubscribe(eventC)
+		r.run(ctx, eventC)
+		if stats, ok := ps.SubscriberStats(eventC); ok {
+			r.mu.Lock()
+			r.dropped = stats.Dropped
+			r.mu.Unlock()
+		}
+		r.finish()
+	}()
+}
+
+// Done is closed once the recording is flushed and closed.
+func (r *Recorder) Done() <-chan struct{} {
+	return r.done
+}
+
+// Count returns the number of events recorded so far.
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Dropped returns the number of events dropped because the writes fell
+// behind. It is known once the recording is done; while it runs, the count
+// is reported by the delivery counters of the bus.
+func (r *Recorder) Dropped() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Err returns the first write error, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) run(ctx context.Context, eventC <-chan events.InputEventFromSource) {
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Record what is already queued before stopping
+			for {
+				select {
+				case ev := <-eventC:
+					r.write(ev)
+				default:
+					return
+				}
+			}
+		case <-flush.C:
+			if err := r.enc.Flush(); err != nil {
+				r.setErr(err)
+			}
+		case ev, ok := <-eventC:
+			if !ok {
+				return
+			}
+			r.write(ev)
+		}
+	}
+}
+
+func (r *Recorder) write(ev events.InputEventFromSource) {
+	if err := r.enc.Encode(ev); err != nil {
+		r.setErr(err)
+		return
+	}
+	r.mu.Lock()
+	r.count++
+	r.mu.Unlock()
+}
+
+func (r *Recorder) finish() {
+	if err := r.enc.Flush(); err != nil {
+		r.setErr(err)
+	}
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil {
+			r.setErr(err)
+		}
+	}
+	log.Printf("Input recording stopped: %d events recorded", r.Count())
+	if dropped := r.Dropped(); dropped > 0 {
+		log.Printf("Input recording: %d events dropped, the writes were too slow", dropped)
+	}
+}
+
+func (r *Recorder) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+		log.Printf("Input recording error: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+func penEvent(at time.Time, code uint16, value int32) events.InputEventFromSource {
+	return events.InputEventFromSource{
+		Source: events.Pen,
+		InputEvent: events.InputEvent{
+			Time:  syscall.NsecToTimeval(at.UnixNano()),
+			Type:  events.EvAbs,
+			Code:  code,
+			Value: value,
+		},
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	ev := penEvent(at, 24, 1234)
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(ev); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"time":1704164645123456`) {
+		t.Errorf("timestamp not recorded in %s", buf.String())
+	}
+
+	records, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	got := records[0].Event()
+	if got != ev {
+		t.Errorf("round trip = %+v, want %+v", got, ev)
+	}
+	if !records[0].Timestamp().Equal(at) {
+		t.Errorf("Timestamp() = %v, want %v", records[0].Timestamp(), at)
+	}
+}
+
+func TestReadAllMalformed(t *testing.T) {
+	_, err := ReadAll(strings.NewReader("{\"time\":1}\n\nnot json\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("ReadAll() error = %v, want an error on line 3", err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	rec, err := CreateRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rec.Start(ctx, ps)
+
+	at := time.Now()
+	for i := range 10 {
+		ps.Publish(penEvent(at.Add(time.Duration(i)*time.Millisecond), 0, int32(i)))
+	}
+	// Wait for the events to be consumed before stopping
+	deadline := time.Now().Add(time.Second)
+	for rec.Count() < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-rec.Done()
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 {
+		t.Fatalf("got %d records, want 10", len(records))
+	}
+	for i, r := range records {
+		if r.Value != int32(i) {
+			t.Errorf("record %d has value %d", i, r.Value)
+		}
+	}
+}
+
+// stalledWriter blocks the writes until release is closed.
+type stalledWriter struct {
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+// TestRecorderSlowWrites checks that a stalled recording drops its oldest
+// events rather than delaying the publishers.
+func TestRecorderSlowWrites(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	w := &stalledWriter{release: make(chan struct{})}
+	rec := NewRecorder(w)
+	ctx, cancel := context.WithCancel(context.Background())
+	rec.Start(ctx, ps)
+
+	const total = 2 * bufferSize
+	start := time.Now()
+	for i := range total {
+		ps.Publish(penEvent(start, 0, int32(i)))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("publishing took %v with a stalled recording", elapsed)
+	}
+	close(w.release)
+	cancel()
+	<-rec.Done()
+	if rec.Dropped() == 0 || rec.Count()+int(rec.Dropped()) != total {
+		t.Errorf("%d events recorded and %d dropped, want %d in all", rec.Count(), rec.Dropped(), total)
+	}
+}
+
+// collect subscribes to ps and returns the events received until done is closed.
+func collect(ps *pubsub.PubSub, done <-chan struct{}) <-chan []events.InputEventFromSource {
+	ch := ps.Subscribe("test")
+	out := make(chan []events.InputEventFromSource, 1)
+	go func() {
+		var got []events.InputEventFromSource
+		for {
+			select {
+			case ev := <-ch:
+				got = append(got, ev)
+			case <-done:
+				// Drain what is left
+				for {
+					select {
+					case ev := <-ch:
+						got = append(got, ev)
+					default:
+						out <- got
+						return
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func TestReplayScannerTiming(t *testing.T) {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var records []Record
+	for i := range 5 {
+		records = append(records, NewRecord(penEvent(origin.Add(time.Duration(i)*40*time.Millisecond), 0, int32(i))))
+	}
+
+	ps := pubsub.NewPubSub()
+	scanner := NewReplayScanner(records, 2, false)
+	got := collect(ps, scanner.Done())
+	start := time.Now()
+	scanner.StartAndPublish(context.Background(), ps)
+	evs := <-got
+	elapsed := time.Since(start)
+
+	if len(evs) != 5 {
+		t.Fatalf("got %d events, want 5", len(evs))
+	}
+	// 160ms recorded, replayed at 2x
+	if elapsed < 75*time.Millisecond {
+		t.Errorf("replay took %v, want at least 80ms", elapsed)
+	}
+	for i, ev := range evs {
+		if ev.Value != int32(i) {
+			t.Errorf("event %d has value %d", i, ev.Value)
+		}
+	}
+	first := time.Unix(evs[0].Time.Unix())
+	last := time.Unix(evs[4].Time.Unix())
+	if d := last.Sub(first); d < 79*time.Millisecond || d > 81*time.Millisecond {
+		t.Errorf("rebased timestamps span %v, want 80ms", d)
+	}
+	if first.Before(start.Add(-time.Millisecond)) {
+		t.Errorf("first event stamped %v, before the replay start %v", first, start)
+	}
+}
+
+func TestReplayScannerNoDelay(t *testing.T) {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		NewRecord(penEvent(origin, 0, 1)),
+		NewRecord(penEvent(origin.Add(time.Hour), 0, 2)),
+	}
+	ps := pubsub.NewPubSub()
+	scanner := NewReplayScanner(records, 0, false)
+	got := collect(ps, scanner.Done())
+	scanner.StartAndPublish(context.Background(), ps)
+
+	select {
+	case evs := <-got:
+		if len(evs) != 2 {
+			t.Fatalf("got %d events, want 2", len(evs))
+		}
+		d := time.Unix(evs[1].Time.Unix()).Sub(time.Unix(evs[0].Time.Unix()))
+		if d != time.Hour {
+			t.Errorf("timestamps spaced by %v, want the original 1h", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replay without delay did not complete")
+	}
+}
+
+func TestReplayScannerCancel(t *testing.T) {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		NewRecord(penEvent(origin, 0, 1)),
+		NewRecord(penEvent(origin.Add(time.Hour), 0, 2)),
+	}
+	ps := pubsub.NewPubSub()
+	scanner := NewReplayScanner(records, 1, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	scanner.StartAndPublish(ctx, ps)
+	cancel()
+	select {
+	case <-scanner.Done():
+	case <-time.After(time.Second):
+		t.Fatal("replay did not stop on cancellation")
+	}
+}
+
+func TestReplayScannerEmptyLoop(t *testing.T) {
+	scanner := NewReplayScanner(nil, 1, true)
+	scanner.StartAndPublish(context.Background(), pubsub.NewPubSub())
+	select {
+	case <-scanner.Done():
+	case <-time.After(time.Second):
+		t.Fatal("looping on an empty recording did not stop")
+	}
+}
+
+func TestOpenReplayScanner(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.jsonl")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenReplayScanner(empty, 1, false); err == nil {
+		t.Error("OpenReplayScanner() accepted an empty recording")
+	}
+	if _, err := OpenReplayScanner(filepath.Join(dir, "missing.jsonl"), 1, false); err == nil {
+		t.Error("OpenReplayScanner() accepted a missing file")
+	}
+	valid := filepath.Join(dir, "valid.jsonl")
+	if err := os.WriteFile(valid, []byte(`{"time":1,"source":1,"type":3,"code":0,"value":1}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenReplayScanner(valid, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.records) != 1 {
+		t.Errorf("loaded %d records, want 1", len(s.records))
+	}
+}
@@ -0,0 +1,122 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// ReplayScanner publishes a recording on the bus in place of the input
+// devices. It can be used wherever a remarkable.EventScanner is expected.
+//
+// The events are rebased on the time the replay starts: an event recorded d
+// after the first one is published, and timestamped, d/Speed after the start.
+type ReplayScanner struct {
+	records []Record
+	// Speed is the replay speed factor: 1 replays at the original pace, 2
+	// twice as fast. 0 publishes the events without waiting; the timestamps
+	// then keep the original spacing.
+	Speed float64
+	// Loop restarts the replay once the end of the recording is reached.
+	Loop bool
+
+	done chan struct{}
+}
+
+// NewReplayScanner creates a scanner replaying records.
+func NewReplayScanner(records []Record, speed float64, loop bool) *ReplayScanner {
+	return &ReplayScanner{
+		records: records,
+		Speed:   speed,
+		Loop:    loop,
+		done:    make(chan struct{}),
+	}
+}
+
+// OpenReplayScanner loads the recording at path.
+func OpenReplayScanner(path string, speed float64, loop bool) (*ReplayScanner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recording %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("recording %s is empty", path)
+	}
+	return NewReplayScanner(records, speed, loop), nil
+}
+
+// Done is closed when the replay is over (never when looping, unless the
+// context is cancelled).
+func (s *ReplayScanner) Done() <-chan struct{} {
+	return s.done
+}
+
+// StartAndPublish replays the recording on the bus until the end of the
+// recording or the cancellation of ctx.
+func (s *ReplayScanner) StartAndPublish(ctx context.Context, ps *pubsub.PubSub) {
+	go func() {
+		defer close(s.done)
+		for {
+			if !s.replay(ctx, ps) || !s.Loop {
+				return
+			}
+		}
+	}()
+}
+
+// replay publishes the records once. It returns false if ctx was cancelled,
+// or if there is nothing to replay, so that an empty recording does not
+// loop forever.
+func (s *ReplayScanner) replay(ctx context.Context, ps *pubsub.PubSub) bool {
+	if len(s.records) == 0 {
+		return false
+	}
+	start := time.Now()
+	origin := s.records[0].Timestamp()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for _, rec := range s.records {
+		offset := rec.Timestamp().Sub(origin)
+		at := start.Add(offset)
+		if s.Speed > 0 {
+			at = start.Add(time.Duration(float64(offset) / s.Speed))
+			if wait := time.Until(at); wait > 0 {
+				if timer == nil {
+					timer = time.NewTimer(wait)
+				} else {
+					timer.Reset(wait)
+				}
+				select {
+				case <-ctx.Done():
+					return false
+				case <-timer.C:
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+		}
+		ev := rec.Event()
+		ev.Time = syscall.NsecToTimeval(at.UnixNano())
+		ps.Publish(ev)
+	}
+	log.Printf("Input replay: %d events published", len(s.records))
+	return true
+}
@@ -38,3 +38,15 @@ func init() {
 		TextureFlipped: Model == RemarkablePaperPro,
 	}
 }
+
+// PixelFormat returns the name of the pixel format of the framebuffer.
+func (c FramebufferConfig) PixelFormat() string {
+	switch {
+	case c.BytesPerPixel == BytesPerPixelGray16:
+		return "gray16le"
+	case c.UseBGRA:
+		return "bgra32"
+	default:
+		return "rgba32"
+	}
+}
@@ -19,8 +19,19 @@ const (
 	// MaxYValue represents the maximum Y coordinate value from /dev/input/event1 (ABS_Y)
 	MaxYValue = 20966
 
+	// TouchMaxXValue represents the maximum value of ABS_MT_POSITION_X from /dev/input/event2
+	TouchMaxXValue = 1403
+	// TouchMaxYValue represents the maximum value of ABS_MT_POSITION_Y from /dev/input/event2
+	TouchMaxYValue = 1871
+
 	// PenInputDevice ...
 	PenInputDevice = "/dev/input/event1"
 	// TouchInputDevice ...
 	TouchInputDevice = "/dev/input/event2"
+
+	// DisplayDevice is the device mapped by the process drawing on the screen
+	DisplayDevice = "/dev/fb0"
+
+	// ScreenDPI is the resolution of the screen in dots per inch
+	ScreenDPI = 226
 )
@@ -16,6 +16,16 @@ const (
 	MaxXValue = 11180
 	MaxYValue = 15340
 
+	// These values are from Max values of /dev/input/event3 (ABS_MT_POSITION_X and ABS_MT_POSITION_Y)
+	TouchMaxXValue = 2064
+	TouchMaxYValue = 2832
+
 	PenInputDevice   = "/dev/input/event2"
 	TouchInputDevice = "/dev/input/event3"
+
+	// DisplayDevice is the device mapped by the process drawing on the screen
+	DisplayDevice = "/dev/dri/card0"
+
+	// ScreenDPI is the resolution of the screen in dots per inch
+	ScreenDPI = 229
 )
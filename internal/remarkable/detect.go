@@ -3,11 +3,7 @@
 package remarkable
 
 import (
-	"bufio"
 	"log"
-	"os"
-	"strconv"
-	"strings"
 )
 
 // FramebufferFormat represents the type of framebuffer format in use
@@ -21,9 +17,6 @@ const (
 )
 
 const (
-	// Firmware version file location (os-release contains IMG_VERSION)
-	firmwareVersionPath = "/etc/os-release"
-
 	// New format constants (firmware 3.24+)
 	newFormatWidth         = 1404
 	newFormatHeight        = 1872
@@ -49,43 +42,6 @@ func DetectFirmwareFormat() FramebufferFormat {
 	return FormatLegacy
 }
 
-// parseFirmwareVersion reads and parses the firmware version from /etc/os-release.
-// It looks for IMG_VERSION="3.24.0.149" and extracts the major.minor version.
-func parseFirmwareVersion(path string) (major, minor int, err error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return 0, 0, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if value, found := strings.CutPrefix(line, "IMG_VERSION="); found {
-			// Remove surrounding quotes if present
-			value = strings.Trim(value, "\"")
-			parts := strings.Split(value, ".")
-			if len(parts) >= 2 {
-				major, err = strconv.Atoi(parts[0])
-				if err != nil {
-					return 0, 0, err
-				}
-				minor, err = strconv.Atoi(parts[1])
-				if err != nil {
-					return 0, 0, err
-				}
-				return major, minor, nil
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return 0, 0, err
-	}
-
-	return 0, 0, os.ErrNotExist
-}
-
 // initConfigForFirmware updates the runtime Config based on detected firmware format.
 // This should be called during initialization on RM2 devices.
 func initConfigForFirmware() {
@@ -94,7 +50,16 @@ func initConfigForFirmware() {
 	switch format {
 	case FormatNew:
 		log.Println("Using new framebuffer format (firmware 3.24+)")
-		Config = FramebufferConfig{
+	case FormatLegacy:
+		log.Println("Using legacy framebuffer format (pre-3.24)")
+	}
+	Config = configForFormat(format)
+}
+
+// configForFormat returns the framebuffer configuration of a format.
+func configForFormat(format FramebufferFormat) FramebufferConfig {
+	if format == FormatNew {
+		return FramebufferConfig{
 			Width:          newFormatWidth,
 			Height:         newFormatHeight,
 			BytesPerPixel:  BytesPerPixelBGRA,
@@ -103,16 +68,14 @@ func initConfigForFirmware() {
 			UseBGRA:        true,
 			TextureFlipped: true,
 		}
-	case FormatLegacy:
-		log.Println("Using legacy framebuffer format (pre-3.24)")
-		Config = FramebufferConfig{
-			Width:          ScreenWidth,
-			Height:         ScreenHeight,
-			BytesPerPixel:  BytesPerPixelGray16,
-			SizeBytes:      ScreenWidth * ScreenHeight * BytesPerPixelGray16,
-			PointerOffset:  0,
-			UseBGRA:        false,
-			TextureFlipped: false,
-		}
+	}
+	return FramebufferConfig{
+		Width:          ScreenWidth,
+		Height:         ScreenHeight,
+		BytesPerPixel:  BytesPerPixelGray16,
+		SizeBytes:      ScreenWidth * ScreenHeight * BytesPerPixelGray16,
+		PointerOffset:  0,
+		UseBGRA:        false,
+		TextureFlipped: false,
 	}
 }
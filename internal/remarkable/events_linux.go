@@ -13,6 +13,9 @@ import (
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
 )
 
+// keyboardRescanInterval is the delay between two lookups of the keyboard
+const keyboardRescanInterval = 5 * time.Second
+
 // EventScanner ...
 type EventScanner struct {
 	pen, touch *os.File
@@ -112,6 +115,63 @@ func (e *EventScanner) StartAndPublish(ctx context.Context, pubsub *pubsub.PubSu
 			})
 		}
 	}()
+	// The keyboard is optional and can be attached at any time
+	go e.scanKeyboard(ctx, pubsub)
+	// The folio cover sensor and the power button feed the power monitor
+	for _, path := range FindSystemDevices() {
+		go readDevice(ctx, pubsub, path, events.System)
+	}
+}
+
+// scanKeyboard publishes the events of the keyboard. The keyboard can be
+// attached and detached at any time, so it is looked up again while it is
+// missing and after a read failure.
+func (e *EventScanner) scanKeyboard(ctx context.Context, ps *pubsub.PubSub) {
+	for {
+		if path, ok := FindKeyboardDevice(); ok {
+			readDevice(ctx, ps, path, events.Keyboard)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(keyboardRescanInterval):
+		}
+	}
+}
+
+// readDevice publishes the events of the optional input device at path until
+// ctx is done or the device is detached.
+func readDevice(ctx context.Context, ps *pubsub.PubSub, path string, source int) {
+	device, err := os.OpenFile(path, os.O_RDONLY, 0o644)
+	if err != nil {
+		log.Printf("failed to open input device %s: %v", path, err)
+		return
+	}
+	defer device.Close()
+	log.Printf("Reading input device %s", path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		device.SetReadDeadline(time.Now().Add(1 * time.Second))
+		ev, err := readEvent(device)
+		if err != nil {
+			if os.IsTimeout(err) {
+				continue
+			}
+			log.Printf("Input device %s disconnected: %v", path, err)
+			return
+		}
+
+		ps.Publish(events.InputEventFromSource{
+			Source:     source,
+			InputEvent: ev,
+		})
+	}
 }
 
 func readEvent(inputDevice *os.File) (events.InputEvent, error) {
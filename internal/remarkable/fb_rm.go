@@ -3,16 +3,36 @@
 package remarkable
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"log"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/owulveryck/goMarkableStream/internal/trace"
 )
 
+// followInterval is the minimum delay between two searches of a new display process
+const followInterval = 2 * time.Second
+
 // FramebufferReader wraps an os.File to provide framebuffer reading with proper cleanup.
+// Offsets are relative to the framebuffer. When following the display, the
+// process is searched again if it exits, for instance when another
+// application takes over the screen.
 type FramebufferReader struct {
+	mu     sync.RWMutex
 	file   *os.File
+	mem    io.ReaderAt // file, or a VMReader falling back to it
+	base   int64
+	pid    string
 	closed bool
+
+	// find returns the process to follow, nil if the process is not followed
+	find       func() (string, error)
+	lastFollow time.Time
 }
 
 // ReadAt implements io.ReaderAt interface.
@@ -25,11 +45,84 @@ func (r *FramebufferReader) ReadAt(p []byte, off int64) (n int, err error) {
 		})
 	}()
 
-	return r.file.ReadAt(p, off)
+	r.mu.RLock()
+	n, err = r.mem.ReadAt(p, r.base+off)
+	r.mu.RUnlock()
+	if err != nil && r.follow() {
+		r.mu.RLock()
+		n, err = r.mem.ReadAt(p, r.base+off)
+		r.mu.RUnlock()
+	}
+	return n, err
+}
+
+// ReadSegments implements SegmentReader, reading the segments in a single
+// system call when process_vm_readv is allowed.
+func (r *FramebufferReader) ReadSegments(segs []Segment) (n int, err error) {
+	span := trace.BeginSpan("frame_capture")
+	defer func() {
+		trace.EndSpan(span, map[string]any{
+			"bytes_read": n,
+			"segments":   len(segs),
+			"error":      err != nil,
+		})
+	}()
+
+	read := func() (int, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		abs := make([]Segment, len(segs))
+		for i, s := range segs {
+			abs[i] = Segment{Buf: s.Buf, Off: r.base + s.Off}
+		}
+		return ReadSegments(r.mem, abs)
+	}
+	n, err = read()
+	if err != nil && r.follow() {
+		n, err = read()
+	}
+	return n, err
+}
+
+// follow switches to the process now owning the display, and reports
+// whether it did.
+func (r *FramebufferReader) follow() bool {
+	if r.find == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || time.Since(r.lastFollow) < followInterval {
+		return false
+	}
+	r.lastFollow = time.Now()
+
+	pid, err := r.find()
+	if err != nil || pid == r.pid {
+		return false
+	}
+	file, framebuffer, err := openProcessFramebuffer(pid)
+	if err != nil {
+		log.Printf("Cannot follow the display to process %s: %v", pid, err)
+		return false
+	}
+	// The buffers of the stream are sized for the current layout
+	if framebuffer.Config.SizeBytes != Config.SizeBytes {
+		log.Printf("Cannot follow the display to process %s: different framebuffer layout", pid)
+		file.Close()
+		return false
+	}
+	log.Printf("Following the display to process %s", pid)
+	r.file.Close()
+	r.file, r.mem, r.base, r.pid = file, processMemory(pid, file), framebuffer.Address, pid
+	setStreamedPID(pid)
+	return true
 }
 
 // Close closes the underlying file handle. Safe to call multiple times.
 func (r *FramebufferReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if r.closed {
 		return nil
 	}
@@ -39,18 +132,82 @@ func (r *FramebufferReader) Close() error {
 
 // GetFileAndPointer returns the memory file handle and pointer address for the reMarkable framebuffer
 func GetFileAndPointer() (io.ReaderAt, int64, error) {
-	pid, err := findXochitlPID()
+	source := FramebufferSource
+	if source == SourceAuto {
+		source = SourceDisplay
+		if _, err := os.Stat(RM2FBPath); err == nil {
+			source = SourceRM2FB
+		}
+	}
+
+	if source == SourceRM2FB {
+		reader, config, err := OpenRM2FB(RM2FBPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot open the rm2fb framebuffer: %w", err)
+		}
+		log.Printf("Reading the rm2fb framebuffer from %s", RM2FBPath)
+		Config = config
+		return reader, 0, nil
+	}
+
+	finder := ProcessFinder{Root: "/proc", Names: ProcessNames}
+	find := finder.Find
+	if source == SourceDisplay {
+		find = func() (string, error) {
+			return finder.FindMapping(DisplayDevice)
+		}
+	}
+	// The display process may still be starting when the service starts
+	pid, err := waitForProcess(context.Background(), ProcessWait, find)
 	if err != nil {
 		return nil, 0, err
 	}
-	file, err := os.OpenFile("/proc/"+pid+"/mem", os.O_RDONLY, os.ModeDevice)
+	file, framebuffer, err := openProcessFramebuffer(pid)
 	if err != nil {
 		return nil, 0, err
 	}
-	pointerAddr, err := getFramePointer(pid)
+	// A fallback may have a different layout
+	Config = framebuffer.Config
+	setStreamedPID(pid)
+	// Follow the display process if it restarts or, when following the
+	// display, if another application takes over the screen
+	return &FramebufferReader{file: file, mem: processMemory(pid, file), base: framebuffer.Address, pid: pid, find: find}, 0, nil
+}
+
+// processMemory returns the reader of the memory of a process, using
+// process_vm_readv if enabled and falling back to its /proc/<pid>/mem file.
+func processMemory(pid string, file *os.File) io.ReaderAt {
+	n, err := strconv.Atoi(pid)
+	if !UseProcessVMReadv || err != nil {
+		return file
+	}
+	return NewVMReader(n, file)
+}
+
+// openProcessFramebuffer opens the memory of a process and locates its framebuffer.
+func openProcessFramebuffer(pid string) (*os.File, Candidate, error) {
+	file, err := os.OpenFile("/proc/"+pid+"/mem", os.O_RDONLY, os.ModeDevice)
+	if err != nil {
+		return nil, Candidate{}, err
+	}
+	candidates, err := framePointerCandidates(pid)
 	if err != nil {
 		file.Close() // Close file on error
-		return nil, 0, err
+		return nil, Candidate{}, err
+	}
+	framebuffer, validation, err := selectFramebuffer(file, candidates, FramebufferCheck)
+	if err != nil {
+		file.Close()
+		return nil, Candidate{}, err
+	}
+	if validation != nil {
+		lastValidation.Store(validation)
+	}
+	return file, framebuffer, nil
+}
+
+func setStreamedPID(pid string) {
+	if n, err := strconv.Atoi(pid); err == nil {
+		streamedPID.Store(int64(n))
 	}
-	return &FramebufferReader{file: file}, pointerAddr, nil
 }
@@ -13,6 +13,7 @@ func TestFramebufferReaderImplementsInterfaces(t *testing.T) {
 	// This test will compile only if FramebufferReader implements the interfaces
 	var _ io.ReaderAt = (*FramebufferReader)(nil)
 	var _ io.Closer = (*FramebufferReader)(nil)
+	var _ SegmentReader = (*FramebufferReader)(nil)
 }
 
 // TestGetFileAndPointerReturnsCloser verifies that GetFileAndPointer returns
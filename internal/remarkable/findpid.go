@@ -1,45 +1,202 @@
 package remarkable
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var ErrXochitlNotFound = errors.New("xochitl process not found - is the reMarkable software running?")
+var (
+	// ErrXochitlNotFound is matched by the ProcessNotFoundError looking for xochitl
+	ErrXochitlNotFound = errors.New("xochitl process not found - is the reMarkable software running?")
+	// ErrProcessNotFound is matched by every ProcessNotFoundError
+	ErrProcessNotFound = errors.New("display process not found")
+	// ErrProcUnavailable is returned when the processes cannot be listed
+	ErrProcUnavailable = errors.New("cannot list the processes")
+)
 
-func findXochitlPID() (string, error) {
-	base := "/proc"
-	entries, err := os.ReadDir(base)
+// ProcessNotFoundError is returned when no process has one of the names looked for.
+type ProcessNotFoundError struct {
+	Names []string
+}
+
+func (e *ProcessNotFoundError) Error() string {
+	if len(e.Names) == 1 && e.Names[0] == "xochitl" {
+		return ErrXochitlNotFound.Error()
+	}
+	return fmt.Sprintf("no process named %s found - is the display application running?", strings.Join(e.Names, ", "))
+}
+
+// Is matches ErrProcessNotFound, and ErrXochitlNotFound if xochitl was looked for.
+func (e *ProcessNotFoundError) Is(target error) bool {
+	return target == ErrProcessNotFound || (target == ErrXochitlNotFound && slices.Contains(e.Names, "xochitl"))
+}
+
+// ProcessNames are the names of the processes holding the framebuffer, in
+// order of preference. A name is compared with the executable of the process
+// (its full path if the name contains a slash, its base name otherwise) and
+// with its command name.
+var ProcessNames = []string{"xochitl"}
+
+// ProcessWait is how long GetFileAndPointer waits for the process to start.
+var ProcessWait = 30 * time.Second
+
+// streamedPID is the PID of the process whose framebuffer is streamed
+var streamedPID atomic.Int64
+
+// XochitlPID returns the PID of the process whose framebuffer is streamed
+// (xochitl unless configured otherwise), or 0 if the framebuffer is not read
+// from a process (off the tablet or with rm2fb).
+func XochitlPID() int {
+	return int(streamedPID.Load())
+}
+
+// commLength is the maximum length of the command name of a process
+const commLength = 15
+
+// ProcessFinder finds a process by name in a procfs tree.
+type ProcessFinder struct {
+	// Root is the mount point of procfs
+	Root string
+	// Names are the process names, in order of preference
+	Names []string
+}
+
+// Find returns the PID of the process matching the first name possible. If
+// several processes match the same name, the most recent one is returned.
+// Processes exiting while the tree is walked are ignored.
+func (f ProcessFinder) Find() (string, error) {
+	entries, err := os.ReadDir(f.Root)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("%w: %w", ErrProcUnavailable, err)
 	}
 
+	best, bestRank, bestPID := "", len(f.Names), -1
 	for _, entry := range entries {
-		pid := entry.Name()
-		if !entry.IsDir() {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
 			continue
 		}
-		entries, err := os.ReadDir(filepath.Join(base, entry.Name()))
-		if err != nil {
-			log.Fatal(err)
+		rank := f.rank(filepath.Join(f.Root, entry.Name()))
+		if rank < bestRank || (rank == bestRank && rank < len(f.Names) && pid > bestPID) {
+			best, bestRank, bestPID = entry.Name(), rank, pid
 		}
-		for _, entry := range entries {
-			info, err := entry.Info()
-			if err != nil {
-				log.Fatal(err)
-			}
-			if info.Mode()&os.ModeSymlink != 0 {
-				orig, err := os.Readlink(filepath.Join(base, pid, entry.Name()))
-				if err != nil {
-					continue
-				}
-				if orig == "/usr/bin/xochitl" {
-					return pid, nil
-				}
+	}
+	if best == "" {
+		return "", &ProcessNotFoundError{Names: f.Names}
+	}
+	return best, nil
+}
+
+// rank returns the index of the first name matching the process, or
+// len(f.Names) if none matches.
+func (f ProcessFinder) rank(dir string) int {
+	// Kernel threads have no executable, and the link is unreadable for
+	// exited processes or without permission
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	// The executable was replaced, for instance by an update
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	var comm string
+	if data, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		comm = strings.TrimSpace(string(data))
+	}
+
+	for i, name := range f.Names {
+		if strings.Contains(name, "/") {
+			if exe == name {
+				return i
 			}
+			continue
+		}
+		if exe != "" && filepath.Base(exe) == name {
+			return i
+		}
+		// The command name is truncated by the kernel
+		if comm != "" && comm == name[:min(len(name), commLength)] {
+			return i
+		}
+	}
+	return len(f.Names)
+}
+
+// FindMapping returns the PID of the process mapping device in its memory,
+// such as the display. Processes matching one of the names are preferred, in
+// order, then the most recent one.
+func (f ProcessFinder) FindMapping(device string) (string, error) {
+	entries, err := os.ReadDir(f.Root)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrProcUnavailable, err)
+	}
+
+	best, bestRank, bestPID := "", len(f.Names)+1, -1
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(f.Root, entry.Name())
+		if !mapsDevice(filepath.Join(dir, "maps"), device) {
+			continue
+		}
+		rank := f.rank(dir)
+		if rank < bestRank || (rank == bestRank && pid > bestPID) {
+			best, bestRank, bestPID = entry.Name(), rank, pid
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("%w: no process maps %s", ErrProcessNotFound, device)
+	}
+	return best, nil
+}
+
+// mapsDevice reports whether a maps file lists a mapping of device.
+func mapsDevice(path, device string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for line := range strings.Lines(string(data)) {
+		if fields := strings.Fields(line); len(fields) >= 6 && fields[5] == device {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait calls Find until the process is found, with an exponential backoff,
+// for at most timeout or until ctx is done. The last error is returned.
+func (f ProcessFinder) Wait(ctx context.Context, timeout time.Duration) (string, error) {
+	return waitForProcess(ctx, timeout, f.Find)
+}
+
+// waitForProcess calls find until it stops returning ErrProcessNotFound.
+func waitForProcess(ctx context.Context, timeout time.Duration, find func() (string, error)) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	delay := 100 * time.Millisecond
+	for {
+		pid, err := find()
+		if err == nil || !errors.Is(err, ErrProcessNotFound) {
+			return pid, err
+		}
+		log.Printf("%v, retrying in %v", err, delay)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(delay):
 		}
+		delay = min(2*delay, 5*time.Second)
 	}
-	return "", ErrXochitlNotFound
+}
+
+func findXochitlPID() (string, error) {
+	return ProcessFinder{Root: "/proc", Names: ProcessNames}.Find()
 }
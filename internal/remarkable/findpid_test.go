@@ -1,7 +1,12 @@
 package remarkable
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // TestFindXochitlPIDReturnsError tests that findXochitlPID returns an error
@@ -54,3 +59,153 @@ func TestFindXochitlPIDErrorMessage(t *testing.T) {
 	// Process found
 	t.Logf("xochitl process found: %s", pid)
 }
+
+// fakeProc builds a procfs tree. Each process is given by its executable
+// (empty for kernel threads) and its command name.
+func fakeProc(t *testing.T, processes map[string][2]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for pid, p := range processes {
+		dir := filepath.Join(root, pid)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if p[0] != "" {
+			if err := os.Symlink(p[0], filepath.Join(dir, "exe")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(p[1]+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Entries that are not processes
+	if err := os.Symlink("1", filepath.Join(root, "self")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "uptime"), []byte("1.0 1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestProcessFinder(t *testing.T) {
+	root := fakeProc(t, map[string][2]string{
+		"1":   {"/sbin/init", "systemd"},
+		"2":   {"", "kthreadd"},
+		"210": {"/usr/bin/xochitl (deleted)", "xochitl"},
+		"340": {"/home/root/.local/bin/koreader/luajit", "reader.lua"},
+		"350": {"/opt/bin/launcher", "launcher"},
+		"360": {"", "a-very-long-app"},
+	})
+
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"xochitl"}, "210"},
+		{[]string{"/usr/bin/xochitl"}, "210"},
+		{[]string{"reader.lua", "xochitl"}, "340"},
+		{[]string{"luajit"}, "340"},
+		// Command names are truncated to 15 characters
+		{[]string{"a-very-long-application"}, "360"},
+		{[]string{"missing", "launcher"}, "350"},
+	}
+	for _, tt := range tests {
+		pid, err := ProcessFinder{Root: root, Names: tt.names}.Find()
+		if err != nil || pid != tt.want {
+			t.Errorf("Find(%v) = %q, %v, want %q", tt.names, pid, err, tt.want)
+		}
+	}
+}
+
+func TestProcessFinderMostRecent(t *testing.T) {
+	root := fakeProc(t, map[string][2]string{
+		"900":  {"/usr/bin/xochitl", "xochitl"},
+		"1200": {"/usr/bin/xochitl", "xochitl"},
+		"80":   {"/usr/bin/xochitl", "xochitl"},
+	})
+	pid, err := ProcessFinder{Root: root, Names: []string{"xochitl"}}.Find()
+	if err != nil || pid != "1200" {
+		t.Errorf("Find() = %q, %v, want the most recent process 1200", pid, err)
+	}
+}
+
+func TestProcessFinderErrors(t *testing.T) {
+	root := fakeProc(t, map[string][2]string{
+		"1": {"/sbin/init", "systemd"},
+	})
+	_, err := ProcessFinder{Root: root, Names: []string{"xochitl"}}.Find()
+	var notFound *ProcessNotFoundError
+	if !errors.As(err, &notFound) || !errors.Is(err, ErrXochitlNotFound) || !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("got error %v, want a ProcessNotFoundError for xochitl", err)
+	}
+	_, err = ProcessFinder{Root: root, Names: []string{"koreader"}}.Find()
+	if errors.Is(err, ErrXochitlNotFound) || !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("got error %v, want a ProcessNotFoundError for koreader only", err)
+	}
+	_, err = ProcessFinder{Root: filepath.Join(root, "missing"), Names: []string{"xochitl"}}.Find()
+	if !errors.Is(err, ErrProcUnavailable) {
+		t.Errorf("got error %v, want ErrProcUnavailable", err)
+	}
+}
+
+func TestProcessFinderWait(t *testing.T) {
+	root := fakeProc(t, nil)
+	finder := ProcessFinder{Root: root, Names: []string{"xochitl"}}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		dir := filepath.Join(root, "42")
+		_ = os.Mkdir(dir, 0755)
+		_ = os.WriteFile(filepath.Join(dir, "comm"), []byte("xochitl\n"), 0644)
+	}()
+	pid, err := finder.Wait(context.Background(), 5*time.Second)
+	if err != nil || pid != "42" {
+		t.Errorf("Wait() = %q, %v, want 42", pid, err)
+	}
+
+	finder.Names = []string{"missing"}
+	start := time.Now()
+	if _, err := finder.Wait(context.Background(), 250*time.Millisecond); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("got error %v, want ErrProcessNotFound", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Wait() returned after %v, want about 250ms", elapsed)
+	}
+}
+
+func TestProcessFinderMapping(t *testing.T) {
+	root := fakeProc(t, map[string][2]string{
+		"210": {"/usr/bin/xochitl", "xochitl"},
+		"340": {"/home/root/koreader/luajit", "reader.lua"},
+		"350": {"/opt/bin/launcher", "launcher"},
+	})
+	maps := func(pid, device string) {
+		content := "00010000-00a2c000 r-xp 00000000 b3:02 1234       /usr/bin/app\n"
+		if device != "" {
+			content += "73ee2000-74d25000 rw-s 00000000 00:06 195        " + device + "\n"
+		}
+		content += "74d25000-75b68000 rw-p 00000000 00:00 0 \n"
+		if err := os.WriteFile(filepath.Join(root, pid, "maps"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	maps("210", "")
+	maps("340", "/dev/fb0")
+	maps("350", "")
+
+	// xochitl is in the background, KOReader owns the display
+	pid, err := ProcessFinder{Root: root, Names: []string{"xochitl"}}.FindMapping("/dev/fb0")
+	if err != nil || pid != "340" {
+		t.Errorf("FindMapping() = %q, %v, want 340", pid, err)
+	}
+	// Both map the display, the named process is preferred
+	maps("210", "/dev/fb0")
+	pid, err = ProcessFinder{Root: root, Names: []string{"xochitl"}}.FindMapping("/dev/fb0")
+	if err != nil || pid != "210" {
+		t.Errorf("FindMapping() = %q, %v, want 210", pid, err)
+	}
+	if _, err := (ProcessFinder{Root: root}).FindMapping("/dev/dri/card0"); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("got error %v, want ErrProcessNotFound", err)
+	}
+}
@@ -0,0 +1,63 @@
+package remarkable
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Firmware version file location (os-release contains IMG_VERSION)
+const firmwareVersionPath = "/etc/os-release"
+
+// FirmwareVersion returns the full firmware version of the tablet, such as
+// "3.24.0.149", as found in IMG_VERSION in /etc/os-release.
+func FirmwareVersion() (string, error) {
+	return readImageVersion(firmwareVersionPath)
+}
+
+// readImageVersion returns the unquoted value of IMG_VERSION in an os-release file.
+func readImageVersion(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, found := strings.CutPrefix(line, "IMG_VERSION="); found {
+			// Remove surrounding quotes if present
+			return strings.Trim(value, "\""), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", os.ErrNotExist
+}
+
+// parseFirmwareVersion reads and parses the firmware version from /etc/os-release.
+// It looks for IMG_VERSION="3.24.0.149" and extracts the major.minor version.
+func parseFirmwareVersion(path string) (major, minor int, err error) {
+	value, err := readImageVersion(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) < 2 {
+		return 0, 0, os.ErrNotExist
+	}
+	major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,62 @@
+package remarkable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFirmwareVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		version      string
+		major, minor int
+		wantErr      bool
+	}{
+		{
+			name:    "quoted",
+			content: "ID=codex\nIMG_VERSION=\"3.24.0.149\"\nVERSION_ID=4.0\n",
+			version: "3.24.0.149",
+			major:   3,
+			minor:   24,
+		},
+		{
+			name:    "unquoted",
+			content: "IMG_VERSION=2.15.1.1189\n",
+			version: "2.15.1.1189",
+			major:   2,
+			minor:   15,
+		},
+		{
+			name:    "missing",
+			content: "ID=codex\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			content: "IMG_VERSION=\"three\"\n",
+			version: "three",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "os-release")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			version, _ := readImageVersion(path)
+			if version != tt.version {
+				t.Errorf("readImageVersion() = %q, want %q", version, tt.version)
+			}
+			major, minor, err := parseFirmwareVersion(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFirmwareVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if major != tt.major || minor != tt.minor {
+				t.Errorf("parseFirmwareVersion() = %d.%d, want %d.%d", major, minor, tt.major, tt.minor)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package remarkable
+
+import (
+	"bufio"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// inputDevicesPath lists the input devices known to the kernel
+	inputDevicesPath = "/proc/bus/input/devices"
+
+	// Positions of the event types in the EV capability bitmask
+	evKeyBit = 1
+	evSwBit  = 5
+	evRepBit = 20
+)
+
+// inputDevice is an entry of /proc/bus/input/devices.
+type inputDevice struct {
+	Name     string
+	Handlers []string
+	EV       *big.Int
+}
+
+// parseInputDevices parses the content of /proc/bus/input/devices. Entries are
+// separated by blank lines, for example:
+//
+//	I: Bus=0005 Vendor=2d1f Product=0001 Version=0001
+//	N: Name="Type Folio"
+//	H: Handlers=sysrq kbd event4
+//	B: EV=120013
+func parseInputDevices(r io.Reader) ([]inputDevice, error) {
+	var devices []inputDevice
+	var current *inputDevice
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			current = nil
+			continue
+		}
+		if current == nil {
+			devices = append(devices, inputDevice{EV: new(big.Int)})
+			current = &devices[len(devices)-1]
+		}
+		if name, ok := strings.CutPrefix(line, "N: Name="); ok {
+			current.Name = strings.Trim(name, `"`)
+		} else if handlers, ok := strings.CutPrefix(line, "H: Handlers="); ok {
+			current.Handlers = strings.Fields(handlers)
+		} else if ev, ok := strings.CutPrefix(line, "B: EV="); ok {
+			current.EV.SetString(ev, 16)
+		}
+	}
+	return devices, scanner.Err()
+}
+
+// eventNode returns the /dev/input node of the device, if any.
+func (d inputDevice) eventNode() (string, bool) {
+	for _, h := range d.Handlers {
+		if strings.HasPrefix(h, "event") {
+			return filepath.Join("/dev/input", h), true
+		}
+	}
+	return "", false
+}
+
+// isKeyboard reports whether the device is a keyboard: it reports keys with
+// autorepeat. This rules out the power button, which only reports keys.
+func (d inputDevice) isKeyboard() bool {
+	return slices.Contains(d.Handlers, "kbd") && d.EV.Bit(evKeyBit) == 1 && d.EV.Bit(evRepBit) == 1
+}
+
+// isSystem reports whether the device reports power related events: switches
+// (such as the folio cover sensor) or keys without autorepeat (the power
+// button).
+func (d inputDevice) isSystem() bool {
+	if d.EV.Bit(evSwBit) == 1 {
+		return true
+	}
+	return slices.Contains(d.Handlers, "kbd") && d.EV.Bit(evKeyBit) == 1 && !d.isKeyboard()
+}
+
+// findKeyboard returns the event node of the first keyboard listed in r.
+func findKeyboard(r io.Reader) (string, bool) {
+	devices, err := parseInputDevices(r)
+	if err != nil {
+		return "", false
+	}
+	for _, d := range devices {
+		if !d.isKeyboard() {
+			continue
+		}
+		if node, ok := d.eventNode(); ok {
+			return node, true
+		}
+	}
+	return "", false
+}
+
+// FindKeyboardDevice returns the input device of the attached keyboard (such
+// as the Type Folio of the reMarkable Paper Pro).
+func FindKeyboardDevice() (string, bool) {
+	f, err := os.Open(inputDevicesPath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	return findKeyboard(f)
+}
+
+// findSystemDevices returns the event nodes of the devices listed in r that
+// report power related events.
+func findSystemDevices(r io.Reader) []string {
+	devices, err := parseInputDevices(r)
+	if err != nil {
+		return nil
+	}
+	var nodes []string
+	for _, d := range devices {
+		if !d.isSystem() {
+			continue
+		}
+		if node, ok := d.eventNode(); ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// FindSystemDevices returns the input devices reporting the folio cover
+// state and the power button.
+func FindSystemDevices() []string {
+	f, err := os.Open(inputDevicesPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return findSystemDevices(f)
+}
@@ -0,0 +1,92 @@
+package remarkable
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const inputDevicesFixture = `I: Bus=0019 Vendor=0001 Product=0001 Version=0100
+N: Name="gpio-keys"
+P: Phys=gpio-keys/input0
+H: Handlers=kbd event0
+B: PROP=0
+B: EV=3
+B: KEY=100000 0 0 0
+
+I: Bus=0018 Vendor=2d1f Product=0095 Version=0001
+N: Name="Elan marker input"
+H: Handlers=event2
+B: PROP=0
+B: EV=b
+B: KEY=1c03 0 0 0 0 0 0 0 0 0 0
+B: ABS=1000d000003
+
+I: Bus=0019 Vendor=0000 Product=0000 Version=0000
+N: Name="hall-sensor"
+H: Handlers=event3
+B: PROP=0
+B: EV=21
+B: SW=1
+
+I: Bus=0005 Vendor=2d1f Product=0b01 Version=0001
+N: Name="Type Folio"
+H: Handlers=sysrq kbd leds event4
+B: PROP=0
+B: EV=120013
+B: KEY=1000000000007 ff9f207ac14057ff febeffdfffefffff fffffffffffffffe
+B: MSC=10
+B: LED=1f
+`
+
+func TestParseInputDevices(t *testing.T) {
+	devices, err := parseInputDevices(strings.NewReader(inputDevicesFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 4 {
+		t.Fatalf("parsed %d devices, want 4", len(devices))
+	}
+	want := []struct {
+		name     string
+		keyboard bool
+		system   bool
+	}{
+		{"gpio-keys", false, true},
+		{"Elan marker input", false, false},
+		{"hall-sensor", false, true},
+		{"Type Folio", true, false},
+	}
+	for i, w := range want {
+		if devices[i].Name != w.name {
+			t.Errorf("device %d name = %q, want %q", i, devices[i].Name, w.name)
+		}
+		if got := devices[i].isKeyboard(); got != w.keyboard {
+			t.Errorf("%s isKeyboard() = %v, want %v", w.name, got, w.keyboard)
+		}
+		if got := devices[i].isSystem(); got != w.system {
+			t.Errorf("%s isSystem() = %v, want %v", w.name, got, w.system)
+		}
+	}
+}
+
+func TestFindKeyboard(t *testing.T) {
+	path, ok := findKeyboard(strings.NewReader(inputDevicesFixture))
+	if !ok || path != "/dev/input/event4" {
+		t.Errorf("findKeyboard() = %q, %v, want /dev/input/event4", path, ok)
+	}
+
+	// Without the Type Folio attached, only the power button is listed
+	detached := inputDevicesFixture[:strings.Index(inputDevicesFixture, "I: Bus=0005")]
+	if path, ok := findKeyboard(strings.NewReader(detached)); ok {
+		t.Errorf("findKeyboard() found %q without keyboard", path)
+	}
+}
+
+func TestFindSystemDevices(t *testing.T) {
+	got := findSystemDevices(strings.NewReader(inputDevicesFixture))
+	want := []string{"/dev/input/event0", "/dev/input/event3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("findSystemDevices() = %v, want %v", got, want)
+	}
+}
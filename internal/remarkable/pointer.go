@@ -15,15 +15,35 @@ func init() {
 	initConfigForFirmware()
 }
 
-// getFramePointer locates the framebuffer in memory for RM2.
+// framePointerCandidates locates the framebuffer in memory for RM2.
 //
 // RM2 uses the classic Linux framebuffer device (/dev/fb0). This function
-// scans /proc/[pid]/maps to find the memory mapping for /dev/fb0, then
+// scans /proc/[pid]/maps to find the memory mapping following /dev/fb0, then
 // applies the configured PointerOffset to locate the actual pixel data.
 //
 // For firmware 3.24+, the offset is 2629632 bytes; for legacy firmware it's 0.
 // This differs from RMPP's approach which uses the modern GPU/DRM stack.
-func getFramePointer(pid string) (int64, error) {
+//
+// The address of the detected format comes first, followed by the address
+// and layout of the other format in case the firmware detection was wrong.
+func framePointerCandidates(pid string) ([]Candidate, error) {
+	base, err := fbMappingAddress(pid)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []Candidate{{Address: base + Config.PointerOffset + 8, Config: Config}}
+	for _, format := range []FramebufferFormat{FormatNew, FormatLegacy} {
+		cfg := configForFormat(format)
+		if cfg != Config {
+			candidates = append(candidates, Candidate{Address: base + cfg.PointerOffset + 8, Config: cfg})
+		}
+	}
+	return candidates, nil
+}
+
+// fbMappingAddress returns the start address of the memory mapping following
+// /dev/fb0 in the maps of the process.
+func fbMappingAddress(pid string) (int64, error) {
 	file, err := os.OpenFile("/proc/"+pid+"/maps", os.O_RDONLY, os.ModeDevice)
 	if err != nil {
 		return 0, fmt.Errorf("cannot open maps file: %w", err)
@@ -32,16 +52,17 @@ func getFramePointer(pid string) (int64, error) {
 	scanner := bufio.NewScanner(file)
 	scanner.Split(bufio.ScanWords)
 	scanAddr := false
-	var addr int64
 	for scanner.Scan() {
 		if scanAddr {
 			hex := strings.Split(scanner.Text(), "-")[0]
-			addr, err = strconv.ParseInt("0x"+hex, 0, 64)
-			break
+			return strconv.ParseInt("0x"+hex, 0, 64)
 		}
 		if scanner.Text() == `/dev/fb0` {
 			scanAddr = true
 		}
 	}
-	return addr + Config.PointerOffset + 8, err
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading maps file: %w", err)
+	}
+	return 0, fmt.Errorf("no mapping found after /dev/fb0")
 }
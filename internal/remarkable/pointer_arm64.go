@@ -5,12 +5,13 @@ package remarkable
 import (
 	"bufio"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
 	"strings"
 )
 
-// getFramePointer locates the framebuffer in memory for RMPP.
+// framePointerCandidates locates the framebuffer in memory for RMPP.
 //
 // RMPP uses a modern GPU/DRM display stack (/dev/dri/card0) rather than
 // the classic framebuffer device. This requires a more complex algorithm:
@@ -21,20 +22,28 @@ import (
 // This differs from RM2's simpler /dev/fb0 approach due to the GPU architecture.
 // Both devices now use BGRA format, but the underlying hardware architecture
 // necessitates different pointer detection methods.
-func getFramePointer(pid string) (int64, error) {
+//
+// The calculated address comes first, followed by the start of the mapping
+// as a fallback if the headers cannot be followed.
+func framePointerCandidates(pid string) ([]Candidate, error) {
 	// Find the memory range for the framebuffer
 	startAddress, err := getMemoryRange(pid)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get memory range: %w", err)
+		return nil, fmt.Errorf("failed to get memory range: %w", err)
 	}
 
 	// Calculate the correct starting address
 	framePointer, err := calculateFramePointer(pid, startAddress)
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate frame pointer: %w", err)
+		log.Printf("Failed to calculate frame pointer: %v", err)
+		return []Candidate{{Address: startAddress, Config: Config}}, nil
 	}
 
-	return framePointer, nil
+	candidates := []Candidate{{Address: framePointer, Config: Config}}
+	if framePointer != startAddress {
+		candidates = append(candidates, Candidate{Address: startAddress, Config: Config})
+	}
+	return candidates, nil
 }
 
 // getMemoryRange retrieves the end address of the last /dev/dri/card0 entry from /proc/[pid]/maps
@@ -87,6 +96,12 @@ func getMemoryRange(pid string) (int64, error) {
 	return end, nil
 }
 
+// Bounds of the walk through the memory headers preceding the framebuffer
+const (
+	maxHeaderWalk       = 64
+	maxHeaderWalkOffset = 64 << 20
+)
+
 // calculateFramePointer finds the frame pointer using the end address and memory file
 func calculateFramePointer(pid string, startAddress int64) (int64, error) {
 	memFilePath := fmt.Sprintf("/proc/%s/mem", pid)
@@ -103,7 +118,12 @@ func calculateFramePointer(pid string, startAddress int64) (int64, error) {
 	// The memory header contains a length field (4 bytes) which we use to determine
 	// how much memory to skip. We dynamically calculate the offset until the
 	// buffer size (width x height x 4 bytes per pixel) is reached.
-	for length < ScreenSizeBytes {
+	for i := 0; length < ScreenSizeBytes; i++ {
+		// A header not longer than itself would loop forever, and the
+		// framebuffer follows a handful of small allocations
+		if (i > 0 && length <= 2) || i >= maxHeaderWalk || offset > maxHeaderWalkOffset {
+			return 0, fmt.Errorf("implausible memory header (length %d at offset %d)", length, offset)
+		}
 		offset += int64(length - 2)
 
 		// Seek to the start address plus offset and read the header
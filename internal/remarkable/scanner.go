@@ -0,0 +1,16 @@
+package remarkable
+
+import (
+	"context"
+
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+)
+
+// InputSource publishes input events on the bus until the context is done.
+// It is implemented by the EventScanner reading the input devices, and by
+// alternative sources such as recording replays.
+type InputSource interface {
+	StartAndPublish(ctx context.Context, ps *pubsub.PubSub)
+}
+
+var _ InputSource = (*EventScanner)(nil)
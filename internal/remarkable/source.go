@@ -0,0 +1,132 @@
+package remarkable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Source is the strategy used to find the framebuffer.
+type Source string
+
+const (
+	// SourceAuto uses the rm2fb shared memory if it exists, and follows the
+	// process owning the display otherwise
+	SourceAuto Source = "auto"
+	// SourceProcess reads the memory of the process named in ProcessNames
+	SourceProcess Source = "process"
+	// SourceDisplay reads the memory of whichever process maps the display
+	// device, preferring the ones named in ProcessNames
+	SourceDisplay Source = "display"
+	// SourceRM2FB reads the shared memory of the rm2fb display server
+	SourceRM2FB Source = "rm2fb"
+)
+
+// FramebufferSource is the strategy used by GetFileAndPointer.
+var FramebufferSource = SourceProcess
+
+// RM2FBPath is the shared memory segment of the rm2fb display server.
+var RM2FBPath = "/dev/shm/swtfb.01"
+
+// Layout of the rm2fb shared framebuffer (RGB565)
+const (
+	rm2fbWidth         = 1404
+	rm2fbHeight        = 1872
+	rm2fbBytesPerPixel = 2
+)
+
+// rm2fbConfig is the layout of the rm2fb framebuffer once converted to BGRA.
+var rm2fbConfig = FramebufferConfig{
+	Width:         rm2fbWidth,
+	Height:        rm2fbHeight,
+	BytesPerPixel: BytesPerPixelBGRA,
+	SizeBytes:     rm2fbWidth * rm2fbHeight * BytesPerPixelBGRA,
+	UseBGRA:       true,
+}
+
+// RM2FBReader reads the RGB565 framebuffer shared by rm2fb as BGRA pixels,
+// the format expected by the stream. Offsets are in the converted frame.
+type RM2FBReader struct {
+	file io.ReaderAt
+	pool sync.Pool
+}
+
+// OpenRM2FB opens the shared memory segment of rm2fb and returns a reader of
+// the framebuffer at address 0 with its layout.
+func OpenRM2FB(path string) (*RM2FBReader, FramebufferConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, FramebufferConfig{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, FramebufferConfig{}, err
+	}
+	if info.Size() < rm2fbWidth*rm2fbHeight*rm2fbBytesPerPixel {
+		f.Close()
+		return nil, FramebufferConfig{}, fmt.Errorf("%s is too small for a framebuffer (%d bytes)", path, info.Size())
+	}
+	return newRM2FBReader(f), rm2fbConfig, nil
+}
+
+func newRM2FBReader(r io.ReaderAt) *RM2FBReader {
+	return &RM2FBReader{file: r}
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RM2FBReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read the RGB565 pixels covering the requested range
+	first := off / BytesPerPixelBGRA
+	last := (off + int64(len(p)) + BytesPerPixelBGRA - 1) / BytesPerPixelBGRA
+	size := int(last-first) * rm2fbBytesPerPixel
+	bufPtr, _ := r.pool.Get().(*[]byte)
+	if bufPtr == nil || cap(*bufPtr) < size {
+		buf := make([]byte, size)
+		bufPtr = &buf
+	}
+	defer r.pool.Put(bufPtr)
+	src := (*bufPtr)[:size]
+	n, err := r.file.ReadAt(src, first*rm2fbBytesPerPixel)
+	src = src[:n-n%rm2fbBytesPerPixel]
+
+	skip := int(off % BytesPerPixelBGRA)
+	written := 0
+	var pixel [BytesPerPixelBGRA]byte
+	for i := 0; i < len(src) && written < len(p); i += rm2fbBytesPerPixel {
+		v := uint16(src[i]) | uint16(src[i+1])<<8
+		r5, g6, b5 := byte(v>>11), byte(v>>5)&0x3f, byte(v)&0x1f
+		pixel = [4]byte{b5<<3 | b5>>2, g6<<2 | g6>>4, r5<<3 | r5>>2, 0xff}
+		if skip == 0 && written+BytesPerPixelBGRA <= len(p) {
+			// Whole pixel, the common case
+			*(*[4]byte)(p[written:]) = pixel
+			written += BytesPerPixelBGRA
+			continue
+		}
+		written += copy(p[written:], pixel[skip:])
+		skip = 0
+	}
+	if written < len(p) {
+		if err == nil {
+			err = io.EOF
+		}
+		return written, err
+	}
+	return written, nil
+}
+
+// Close closes the shared memory segment.
+func (r *RM2FBReader) Close() error {
+	if c, ok := r.file.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package remarkable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rgb565 encodes the pixels in the rm2fb format.
+func rgb565(pixels ...uint16) []byte {
+	buf := make([]byte, 2*len(pixels))
+	for i, p := range pixels {
+		binary.LittleEndian.PutUint16(buf[2*i:], p)
+	}
+	return buf
+}
+
+func TestRM2FBReader(t *testing.T) {
+	// White, black, pure red, pure green, pure blue
+	r := newRM2FBReader(bytes.NewReader(rgb565(0xffff, 0x0000, 0xf800, 0x07e0, 0x001f)))
+	want := []byte{
+		0xff, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0xff,
+		0x00, 0x00, 0xff, 0xff,
+		0x00, 0xff, 0x00, 0xff,
+		0xff, 0x00, 0x00, 0xff,
+	}
+
+	got := make([]byte, len(want))
+	if n, err := r.ReadAt(got, 0); err != nil || n != len(want) {
+		t.Fatalf("ReadAt() = %d, %v", n, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ReadAt() = % x, want % x", got, want)
+	}
+
+	// Unaligned reads
+	for _, tt := range []struct{ off, size int }{{2, 5}, {7, 9}, {16, 4}, {1, 1}} {
+		got := make([]byte, tt.size)
+		if n, err := r.ReadAt(got, int64(tt.off)); err != nil || n != tt.size {
+			t.Fatalf("ReadAt(%d, %d) = %d, %v", tt.size, tt.off, n, err)
+		}
+		if !bytes.Equal(got, want[tt.off:tt.off+tt.size]) {
+			t.Errorf("ReadAt(%d, %d) = % x, want % x", tt.size, tt.off, got, want[tt.off:tt.off+tt.size])
+		}
+	}
+
+	// Reads past the end
+	got = make([]byte, 8)
+	n, err := r.ReadAt(got, int64(len(want)-4))
+	if n != 4 || err != io.EOF {
+		t.Errorf("ReadAt() past the end = %d, %v, want 4, EOF", n, err)
+	}
+}
+
+func TestOpenRM2FB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swtfb.01")
+	if err := os.WriteFile(path, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenRM2FB(path); err == nil {
+		t.Error("OpenRM2FB() accepted a segment too small")
+	}
+
+	if err := os.Truncate(path, rm2fbWidth*rm2fbHeight*rm2fbBytesPerPixel); err != nil {
+		t.Fatal(err)
+	}
+	r, config, err := OpenRM2FB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if config.Width != rm2fbWidth || config.Height != rm2fbHeight || config.BytesPerPixel != BytesPerPixelBGRA {
+		t.Errorf("config = %+v", config)
+	}
+	frame := make([]byte, config.SizeBytes)
+	if n, err := r.ReadAt(frame, 0); err != nil || n != config.SizeBytes {
+		t.Errorf("ReadAt() = %d, %v, want a whole frame", n, err)
+	}
+	// A black frame
+	if v := ValidateFramebuffer(r, Candidate{Config: config}); v.Confidence != ConfidenceLow || !v.Blank {
+		t.Errorf("validation = %v", v)
+	}
+}
@@ -0,0 +1,307 @@
+package remarkable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sync/atomic"
+)
+
+// ErrFramebufferNotFound is returned when no candidate address looks like a framebuffer
+var ErrFramebufferNotFound = errors.New("no plausible framebuffer found")
+
+// Confidence is how likely a memory region holds the framebuffer.
+type Confidence int
+
+const (
+	// ConfidenceNone means the region is not a framebuffer (unreadable, random or zeroed memory)
+	ConfidenceNone Confidence = iota
+	// ConfidenceLow means the region cannot be told apart from other memory, for instance a blank page
+	ConfidenceLow
+	// ConfidenceMedium means the region looks like an image
+	ConfidenceMedium
+	// ConfidenceHigh means the region looks like an image with the expected pixel layout
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	default:
+		return "none"
+	}
+}
+
+// Candidate is a possible location and layout of the framebuffer.
+type Candidate struct {
+	Address int64
+	Config  FramebufferConfig
+}
+
+// Validation is the result of the validation of a candidate.
+type Validation struct {
+	Candidate  Candidate
+	Confidence Confidence
+	// Entropy of the sampled bytes, in bits per byte
+	Entropy float64
+	// Coherence is the ratio of pixels equal to the pixel below them
+	Coherence float64
+	// Blank is set when every sampled pixel has the same value
+	Blank bool
+	// Header is set when the region is preceded by an allocation header of
+	// the size of the framebuffer
+	Header bool
+	// Reason explains the confidence
+	Reason string
+}
+
+func (v Validation) String() string {
+	return fmt.Sprintf("address 0x%x (%dx%d, %s): confidence %s, %s",
+		v.Candidate.Address, v.Candidate.Config.Width, v.Candidate.Config.Height, v.Candidate.Config.PixelFormat(),
+		v.Confidence, v.Reason)
+}
+
+// PointerCheck is how the framebuffer address is validated.
+type PointerCheck string
+
+const (
+	// PointerCheckOff uses the computed address without validation
+	PointerCheckOff PointerCheck = "off"
+	// PointerCheckWarn falls back to an alternative address if the computed
+	// one is implausible, and keeps the computed one if none is plausible
+	PointerCheckWarn PointerCheck = "warn"
+	// PointerCheckStrict fails if no address is plausible
+	PointerCheckStrict PointerCheck = "strict"
+)
+
+// FramebufferCheck is the validation applied by GetFileAndPointer.
+var FramebufferCheck = PointerCheckWarn
+
+// lastValidation is the result of the validation of the framebuffer in use
+var lastValidation atomic.Pointer[Validation]
+
+// FramebufferValidation returns the result of the validation of the
+// framebuffer in use, if it was validated.
+func FramebufferValidation() (Validation, bool) {
+	v := lastValidation.Load()
+	if v == nil {
+		return Validation{}, false
+	}
+	return *v, true
+}
+
+// Thresholds of the validation
+const (
+	// validationRows is the number of pairs of adjacent rows sampled
+	validationRows = 24
+	// maxImageEntropy is the entropy above which the region looks random
+	maxImageEntropy = 7.0
+	// minCoherence is the coherence below which the region is not an image
+	minCoherence = 0.5
+	// goodCoherence is the coherence of a typical page
+	goodCoherence = 0.9
+	// maxHeaderSlack is how much larger than the framebuffer an allocation may be
+	maxHeaderSlack = 1 << 20
+)
+
+// ValidateFramebuffer samples the memory region of a candidate to estimate
+// whether it holds the framebuffer. A page is mostly made of runs of
+// identical pixels, so adjacent rows are largely equal and the entropy is
+// low, while heap memory or a wrong stride looks random. On 32 bits formats,
+// one byte of each pixel (the alpha channel) is expected to be constant.
+func ValidateFramebuffer(r io.ReaderAt, c Candidate) Validation {
+	v := Validation{Candidate: c}
+	cfg := c.Config
+	stride := cfg.Width * cfg.BytesPerPixel
+	if stride <= 0 || cfg.Height < 2 || cfg.SizeBytes < stride*cfg.Height {
+		v.Reason = "invalid framebuffer configuration"
+		return v
+	}
+
+	// The whole region must be readable
+	last := make([]byte, 1)
+	if _, err := r.ReadAt(last, c.Address+int64(cfg.SizeBytes)-1); err != nil {
+		v.Reason = fmt.Sprintf("region not readable: %v", err)
+		return v
+	}
+
+	var histogram [256]int
+	var pixels, equal int
+	// lanes tracks the bytes of the pixels that never change
+	lanes := make([]bool, cfg.BytesPerPixel)
+	for i := range lanes {
+		lanes[i] = true
+	}
+	var first []byte
+	rows := make([]byte, 2*stride)
+	for i := range validationRows {
+		y := i * (cfg.Height - 2) / (validationRows - 1)
+		if _, err := r.ReadAt(rows, c.Address+int64(y*stride)); err != nil {
+			v.Reason = fmt.Sprintf("region not readable: %v", err)
+			return v
+		}
+		if first == nil {
+			first = append([]byte(nil), rows[:cfg.BytesPerPixel]...)
+		}
+		for _, b := range rows {
+			histogram[b]++
+		}
+		upper, lower := rows[:stride], rows[stride:]
+		for x := 0; x < stride; x += cfg.BytesPerPixel {
+			pixels++
+			same := true
+			for lane := range cfg.BytesPerPixel {
+				if upper[x+lane] != lower[x+lane] {
+					same = false
+				}
+				if upper[x+lane] != first[lane] || lower[x+lane] != first[lane] {
+					lanes[lane] = false
+				}
+			}
+			if same {
+				equal++
+			}
+		}
+	}
+
+	v.Entropy = entropy(histogram[:])
+	v.Coherence = float64(equal) / float64(pixels)
+	v.Header = hasAllocationHeader(r, c.Address, cfg.SizeBytes)
+
+	// Every sampled pixel is the same
+	blank, zeroed := true, true
+	for lane, constant := range lanes {
+		blank = blank && constant
+		zeroed = zeroed && first[lane] == 0
+	}
+	if blank {
+		v.Blank = true
+		switch {
+		case zeroed:
+			v.Reason = "region is zeroed"
+		case v.Header:
+			v.Confidence = ConfidenceMedium
+			v.Reason = "blank page with a matching allocation header"
+		default:
+			v.Confidence = ConfidenceLow
+			v.Reason = "blank page, cannot be confirmed"
+		}
+		return v
+	}
+
+	if v.Entropy > maxImageEntropy || v.Coherence < minCoherence {
+		v.Reason = fmt.Sprintf("looks like random data (entropy %.2f, coherence %.2f)", v.Entropy, v.Coherence)
+		return v
+	}
+
+	// On 32 bits formats, the alpha channel is constant
+	layout := cfg.BytesPerPixel != BytesPerPixelBGRA
+	for _, constant := range lanes {
+		layout = layout || constant
+	}
+	switch {
+	case v.Coherence >= goodCoherence && layout:
+		v.Confidence = ConfidenceHigh
+		v.Reason = fmt.Sprintf("image with the expected layout (coherence %.2f)", v.Coherence)
+	case v.Coherence >= goodCoherence || v.Header:
+		v.Confidence = ConfidenceMedium
+		v.Reason = fmt.Sprintf("image with an unexpected layout (coherence %.2f)", v.Coherence)
+	default:
+		v.Confidence = ConfidenceLow
+		v.Reason = fmt.Sprintf("weakly structured data (coherence %.2f)", v.Coherence)
+	}
+	return v
+}
+
+// FindFramebuffer validates the candidates in order of preference. The first
+// candidate is kept unless it is implausible, since a blank page cannot be
+// told apart from other memory; the most likely of the others is returned
+// otherwise. ErrFramebufferNotFound is returned with the best result if no
+// candidate is plausible.
+func FindFramebuffer(r io.ReaderAt, candidates []Candidate) (Validation, error) {
+	var best Validation
+	for i, c := range candidates {
+		v := ValidateFramebuffer(r, c)
+		if i == 0 || v.Confidence > best.Confidence {
+			best = v
+		}
+		if best.Confidence == ConfidenceHigh || (i == 0 && best.Confidence != ConfidenceNone) {
+			break
+		}
+	}
+	if best.Confidence == ConfidenceNone {
+		return best, fmt.Errorf("%w: %s", ErrFramebufferNotFound, best)
+	}
+	return best, nil
+}
+
+// hasAllocationHeader reports whether the region is preceded by a malloc
+// chunk header holding its size (at -4 on 32 bits, -8 on 64 bits systems).
+func hasAllocationHeader(r io.ReaderAt, addr int64, size int) bool {
+	if addr < 8 {
+		return false
+	}
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, addr-8); err != nil {
+		return false
+	}
+	for _, word := range []uint32{binary.LittleEndian.Uint32(header[:4]), binary.LittleEndian.Uint32(header[4:])} {
+		// The low bits of the size are flags
+		chunk := int(word &^ 7)
+		if chunk >= size && chunk <= size+maxHeaderSlack {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of a histogram, in bits per symbol.
+func entropy(histogram []int) float64 {
+	var total int
+	for _, n := range histogram {
+		total += n
+	}
+	var e float64
+	for _, n := range histogram {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(total)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// selectFramebuffer chooses among the candidates according to the check. The
+// first candidate is the computed one, the others are the fallbacks.
+func selectFramebuffer(r io.ReaderAt, candidates []Candidate, check PointerCheck) (Candidate, *Validation, error) {
+	if len(candidates) == 0 {
+		return Candidate{}, nil, ErrFramebufferNotFound
+	}
+	if check == PointerCheckOff {
+		return candidates[0], nil, nil
+	}
+	v, err := FindFramebuffer(r, candidates)
+	if err != nil {
+		if check == PointerCheckStrict {
+			return Candidate{}, &v, err
+		}
+		log.Printf("Warning: %v, using the computed address anyway", err)
+		v = ValidateFramebuffer(r, candidates[0])
+		return candidates[0], &v, nil
+	}
+	if v.Candidate != candidates[0] {
+		log.Printf("Computed framebuffer address is implausible, falling back to %s", v)
+	} else {
+		log.Printf("Framebuffer %s", v)
+	}
+	return v.Candidate, &v, nil
+}
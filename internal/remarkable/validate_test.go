@@ -0,0 +1,190 @@
+package remarkable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testConfig = FramebufferConfig{
+	Width:         64,
+	Height:        48,
+	BytesPerPixel: BytesPerPixelBGRA,
+	SizeBytes:     64 * 48 * BytesPerPixelBGRA,
+	UseBGRA:       true,
+}
+
+// page returns a white BGRA page with a few strokes.
+func page(cfg FramebufferConfig) []byte {
+	buf := bytes.Repeat([]byte{0xff}, cfg.SizeBytes)
+	set := func(x, y int, gray byte) {
+		i := (y*cfg.Width + x) * cfg.BytesPerPixel
+		buf[i], buf[i+1], buf[i+2] = gray, gray, gray
+	}
+	for x := 5; x < 40; x++ {
+		set(x, 10, 0)
+		set(x, 11, 0)
+	}
+	for y := 15; y < 45; y++ {
+		set(30, y, 0x80)
+		set(31+y/8, y, 0)
+	}
+	return buf
+}
+
+func randomBytes(n int) []byte {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(buf)
+	return buf
+}
+
+func TestValidateFramebuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		memory []byte
+		want   Confidence
+		blank  bool
+	}{
+		{"page", page(testConfig), ConfidenceHigh, false},
+		{"random", randomBytes(testConfig.SizeBytes), ConfidenceNone, false},
+		{"blank", bytes.Repeat([]byte{0xff}, testConfig.SizeBytes), ConfidenceLow, true},
+		{"zeroed", make([]byte, testConfig.SizeBytes), ConfidenceNone, true},
+		{"truncated", page(testConfig)[:testConfig.SizeBytes-1], ConfidenceNone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := ValidateFramebuffer(bytes.NewReader(tt.memory), Candidate{Config: testConfig})
+			if v.Confidence != tt.want || v.Blank != tt.blank {
+				t.Errorf("got confidence %v (blank %v), want %v (blank %v): %s", v.Confidence, v.Blank, tt.want, tt.blank, v.Reason)
+			}
+		})
+	}
+}
+
+func TestAllocationHeader(t *testing.T) {
+	memory := make([]byte, 16)
+	// malloc chunk size with the "previous in use" flag
+	binary.LittleEndian.PutUint32(memory[8:], uint32(testConfig.SizeBytes+16)|1)
+	memory = append(memory, bytes.Repeat([]byte{0xff}, testConfig.SizeBytes)...)
+
+	v := ValidateFramebuffer(bytes.NewReader(memory), Candidate{Address: 16, Config: testConfig})
+	if !v.Header || v.Confidence != ConfidenceMedium {
+		t.Errorf("blank page with a header: header %v, confidence %v, want medium", v.Header, v.Confidence)
+	}
+	v = ValidateFramebuffer(bytes.NewReader(memory), Candidate{Address: 24, Config: testConfig})
+	if v.Header {
+		t.Error("header found at the wrong address")
+	}
+}
+
+func TestFindFramebuffer(t *testing.T) {
+	const offset = 1 << 16
+	memory := append(randomBytes(offset), page(testConfig)...)
+	computed := Candidate{Address: 0, Config: testConfig}
+	fallback := Candidate{Address: offset, Config: testConfig}
+
+	v, err := FindFramebuffer(bytes.NewReader(memory), []Candidate{computed, fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Candidate != fallback {
+		t.Errorf("found 0x%x, want the fallback 0x%x", v.Candidate.Address, fallback.Address)
+	}
+
+	_, err = FindFramebuffer(bytes.NewReader(memory), []Candidate{computed})
+	if !errors.Is(err, ErrFramebufferNotFound) {
+		t.Errorf("got error %v, want ErrFramebufferNotFound", err)
+	}
+
+	// A plausible computed address is kept, even if a fallback looks better
+	blank := append(bytes.Repeat([]byte{0xff}, offset), page(testConfig)...)
+	v, err = FindFramebuffer(bytes.NewReader(blank), []Candidate{computed, fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Candidate != computed {
+		t.Errorf("found 0x%x, want the computed address", v.Candidate.Address)
+	}
+}
+
+func TestSelectFramebuffer(t *testing.T) {
+	r := bytes.NewReader(randomBytes(testConfig.SizeBytes))
+	candidates := []Candidate{{Address: 0, Config: testConfig}}
+
+	c, v, err := selectFramebuffer(r, candidates, PointerCheckOff)
+	if err != nil || v != nil || c != candidates[0] {
+		t.Errorf("off: got %v, %v, %v", c, v, err)
+	}
+	c, v, err = selectFramebuffer(r, candidates, PointerCheckWarn)
+	if err != nil || v == nil || v.Confidence != ConfidenceNone || c != candidates[0] {
+		t.Errorf("warn: got %v, %v, %v, want the computed address", c, v, err)
+	}
+	if _, _, err = selectFramebuffer(r, candidates, PointerCheckStrict); !errors.Is(err, ErrFramebufferNotFound) {
+		t.Errorf("strict: got error %v, want ErrFramebufferNotFound", err)
+	}
+}
+
+// openDump opens a memory dump of the testdata directory, skipping the test
+// if it is missing or was not fetched from Git LFS.
+func openDump(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("..", "..", "testdata", name))
+	if err != nil {
+		t.Skipf("testdata not available: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	prefix := make([]byte, 64)
+	n, _ := f.ReadAt(prefix, 0)
+	if bytes.HasPrefix(prefix[:n], []byte("version https://git-lfs")) {
+		t.Skipf("%s is a Git LFS pointer, run git lfs pull", name)
+	}
+	return f
+}
+
+var (
+	// legacyConfig is the RM2 layout before firmware 3.24
+	legacyConfig = FramebufferConfig{
+		Width:         1872,
+		Height:        1404,
+		BytesPerPixel: BytesPerPixelGray16,
+		SizeBytes:     1872 * 1404 * BytesPerPixelGray16,
+	}
+	// bgraConfig is the RM2 layout since firmware 3.24
+	bgraConfig = FramebufferConfig{
+		Width:         1404,
+		Height:        1872,
+		BytesPerPixel: BytesPerPixelBGRA,
+		SizeBytes:     1404 * 1872 * BytesPerPixelBGRA,
+		UseBGRA:       true,
+	}
+)
+
+func TestValidateDumps(t *testing.T) {
+	t.Run("full_memory_region", func(t *testing.T) {
+		f := openDump(t, "full_memory_region.raw")
+		// The dump starts with the framebuffer
+		v, err := FindFramebuffer(f, []Candidate{{Config: legacyConfig}, {Config: bgraConfig}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(v)
+	})
+	t.Run("colorful", func(t *testing.T) {
+		f := openDump(t, "colorful.raw")
+		// The dump starts with the /dev/fb0 mapping of firmware 3.24
+		candidates := []Candidate{
+			{Address: 2629632 + 8, Config: bgraConfig},
+			{Address: 8, Config: bgraConfig},
+			{Address: 8, Config: legacyConfig},
+		}
+		v, err := FindFramebuffer(f, candidates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(v)
+	})
+}
@@ -0,0 +1,38 @@
+package remarkable
+
+import "io"
+
+// UseProcessVMReadv reads the memory of the display process with
+// process_vm_readv rather than /proc/<pid>/mem, when the system allows it.
+var UseProcessVMReadv = true
+
+// Segment is a range of the framebuffer to read into Buf.
+type Segment struct {
+	Buf []byte
+	Off int64
+}
+
+// SegmentReader reads several segments of the framebuffer at once, for
+// instance scattered rows.
+type SegmentReader interface {
+	// ReadSegments fills the buffers of the segments and returns the
+	// number of bytes read. An error is returned if a buffer is not filled.
+	ReadSegments(segs []Segment) (int, error)
+}
+
+// ReadSegments reads the segments from r, in a single call if r is a
+// SegmentReader.
+func ReadSegments(r io.ReaderAt, segs []Segment) (int, error) {
+	if sr, ok := r.(SegmentReader); ok {
+		return sr.ReadSegments(segs)
+	}
+	var total int
+	for _, s := range segs {
+		n, err := r.ReadAt(s.Buf, s.Off)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package remarkable
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIovecs is the maximum number of segments of a process_vm_readv call (IOV_MAX)
+const maxIovecs = 1024
+
+// processVMReadv is replaced in tests
+var processVMReadv = unix.ProcessVMReadv
+
+// VMReader reads the memory of a process with process_vm_readv, which copies
+// the pages directly instead of going through /proc/<pid>/mem, and reads
+// scattered segments in a single system call. If the call is denied (by
+// seccomp, the ptrace scope or an old kernel), the fallback reader is used
+// from then on.
+type VMReader struct {
+	pid      int
+	fallback io.ReaderAt
+	denied   atomic.Bool
+}
+
+// NewVMReader returns a reader of the memory of the process pid, offsets
+// being addresses in the process. fallback, usually /proc/<pid>/mem, may be
+// nil.
+func NewVMReader(pid int, fallback io.ReaderAt) *VMReader {
+	return &VMReader{pid: pid, fallback: fallback}
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *VMReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadSegments([]Segment{{Buf: p, Off: off}})
+}
+
+// ReadSegments implements SegmentReader.
+func (r *VMReader) ReadSegments(segs []Segment) (int, error) {
+	if !r.denied.Load() {
+		n, err := r.readv(segs)
+		if !errors.Is(err, unix.EPERM) && !errors.Is(err, unix.EACCES) && !errors.Is(err, unix.ENOSYS) {
+			return n, err
+		}
+		if r.fallback == nil {
+			return n, err
+		}
+		if !r.denied.Swap(true) {
+			log.Printf("process_vm_readv is not allowed (%v), reading /proc/%d/mem instead", err, r.pid)
+		}
+	}
+	return ReadSegments(r.fallback, segs)
+}
+
+// readv reads the segments with as few system calls as possible.
+func (r *VMReader) readv(segs []Segment) (int, error) {
+	local := make([]unix.Iovec, 0, min(len(segs), maxIovecs))
+	remote := make([]unix.RemoteIovec, 0, cap(local))
+	var total int
+	for len(segs) > 0 {
+		batch := segs[:min(len(segs), maxIovecs)]
+		segs = segs[len(batch):]
+
+		local, remote = local[:0], remote[:0]
+		want := 0
+		for _, s := range batch {
+			if len(s.Buf) == 0 {
+				continue
+			}
+			iov := unix.Iovec{Base: &s.Buf[0]}
+			iov.SetLen(len(s.Buf))
+			local = append(local, iov)
+			remote = append(remote, unix.RemoteIovec{Base: uintptr(s.Off), Len: len(s.Buf)})
+			want += len(s.Buf)
+		}
+		if want == 0 {
+			continue
+		}
+		n, err := processVMReadv(r.pid, local, remote, 0)
+		total += max(n, 0)
+		if err != nil {
+			return total, err
+		}
+		// The copy stops at the first unmapped page
+		if n < want {
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package remarkable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// selfMemory returns a buffer of the test process and its address.
+func selfMemory(size int) ([]byte, int64) {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i * 7)
+	}
+	return buf, int64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+func TestVMReaderSegments(t *testing.T) {
+	src, addr := selfMemory(64 << 10)
+	r := NewVMReader(os.Getpid(), nil)
+
+	p := make([]byte, 4096)
+	if _, err := r.ReadAt(p, addr+100); err != nil {
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOSYS) {
+			t.Skipf("process_vm_readv not allowed: %v", err)
+		}
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, src[100:4196]) {
+		t.Error("ReadAt returned the wrong bytes")
+	}
+
+	// More segments than a single call accepts
+	segs := make([]Segment, maxIovecs+10)
+	for i := range segs {
+		segs[i] = Segment{Buf: make([]byte, 16), Off: addr + int64(i*32)}
+	}
+	n, err := r.ReadSegments(segs)
+	if err != nil || n != 16*len(segs) {
+		t.Fatalf("ReadSegments = %d, %v, want %d bytes", n, err, 16*len(segs))
+	}
+	for i, s := range segs {
+		if !bytes.Equal(s.Buf, src[i*32:i*32+16]) {
+			t.Fatalf("segment %d holds the wrong bytes", i)
+		}
+	}
+	runtime.KeepAlive(src)
+}
+
+func TestVMReaderFallback(t *testing.T) {
+	calls := 0
+	saved := processVMReadv
+	processVMReadv = func(int, []unix.Iovec, []unix.RemoteIovec, uint) (int, error) {
+		calls++
+		return -1, unix.EPERM
+	}
+	defer func() { processVMReadv = saved }()
+
+	data := []byte("0123456789abcdef")
+	r := NewVMReader(1, bytes.NewReader(data))
+	for range 2 {
+		segs := []Segment{{Buf: make([]byte, 4), Off: 2}, {Buf: make([]byte, 3), Off: 10}}
+		n, err := r.ReadSegments(segs)
+		if err != nil || n != 7 || string(segs[0].Buf) != "2345" || string(segs[1].Buf) != "abc" {
+			t.Fatalf("fallback read = %d, %v, %q %q", n, err, segs[0].Buf, segs[1].Buf)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("process_vm_readv called %d times, want 1 before falling back", calls)
+	}
+
+	// Without fallback the error is returned
+	r = NewVMReader(1, nil)
+	if _, err := r.ReadAt(make([]byte, 4), 0); !errors.Is(err, unix.EPERM) {
+		t.Errorf("got %v, want EPERM", err)
+	}
+}
+
+func TestReadSegmentsShortRead(t *testing.T) {
+	r := bytes.NewReader([]byte("0123"))
+	_, err := ReadSegments(r, []Segment{{Buf: make([]byte, 2), Off: 0}, {Buf: make([]byte, 4), Off: 2}})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
@@ -3,8 +3,27 @@ package stream
 import (
 	"context"
 	"io"
+	"slices"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+const (
+	// FullReadInterval is the maximum delay between two reads of the whole
+	// framebuffer while only damaged rows are read, to catch the changes
+	// away from the pen.
+	FullReadInterval = time.Second
+	// damageLifetime is how long a damage hint restricts the reads: without
+	// new hints, the whole framebuffer is read again
+	damageLifetime = 300 * time.Millisecond
+	// maxDamageRegions is the number of separate damaged regions read in one
+	// cycle: beyond, the closest regions are merged
+	maxDamageRegions = 8
 )
 
 // AsyncFrameReader reads the framebuffer continuously in a background goroutine,
@@ -17,6 +36,10 @@ import (
 //
 // This allows the Cortex-A9's second core to read the next frame while
 // the first core encodes the current one.
+//
+// With damage hints (see Damage), only the hinted rows are read, in a
+// single remarkable.ReadSegments call, and the frames are partial:
+// LatestRegion returns the regions that were read.
 type AsyncFrameReader struct {
 	file        io.ReaderAt
 	pointerAddr int64
@@ -27,6 +50,19 @@ type AsyncFrameReader struct {
 	reading []byte // owned by handler during encode
 	hasNew  bool
 
+	// The regions of the buffers that were read, rotating with them
+	writingRegions []delta.Region
+	readyRegions   []delta.Region
+	readingRegions []delta.Region
+	segs           []remarkable.Segment // owned by background goroutine
+
+	// Damage hints, in rows, since the last full read
+	rowSize   int
+	hints     []delta.Region
+	hintTime  time.Time
+	forceFull bool
+	lastFull  time.Time
+
 	paused int32         // atomic: 1 = paused, 0 = active
 	wake   chan struct{} // signal to resume from paused state
 }
@@ -60,6 +96,88 @@ func (r *AsyncFrameReader) Resume() {
 	}
 }
 
+// SetRowSize sets the size of a framebuffer row in bytes, enabling the
+// damage hints.
+func (r *AsyncFrameReader) SetRowSize(n int) {
+	r.mu.Lock()
+	r.rowSize = n
+	r.mu.Unlock()
+}
+
+// Damage hints that only the rows in [start, end) changed, for instance
+// around the pen. The hints accumulate until the next full read, and only
+// the hinted rows are read as long as hints keep coming. The whole
+// framebuffer is still read every FullReadInterval.
+func (r *AsyncFrameReader) Damage(start, end int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rowSize <= 0 {
+		return
+	}
+	start, end = max(start, 0), min(end, len(r.writing)/r.rowSize)
+	if start >= end {
+		return
+	}
+	r.hints = addRegion(r.hints, delta.Region{Start: start, End: end})
+	r.hintTime = time.Now()
+}
+
+// RequestFull makes the next read cover the whole framebuffer, for instance
+// when the change cannot be located or a full frame must be sent.
+func (r *AsyncFrameReader) RequestFull() {
+	r.mu.Lock()
+	r.forceFull = true
+	r.mu.Unlock()
+}
+
+// region returns the regions of bytes to read in the next cycle, sorted
+// and disjoint. They are stored in writingRegions.
+func (r *AsyncFrameReader) region(now time.Time) []delta.Region {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	regions := r.writingRegions[:0]
+	if len(r.hints) > 0 && !r.forceFull && now.Sub(r.hintTime) < damageLifetime && now.Sub(r.lastFull) < FullReadInterval {
+		for _, h := range r.hints {
+			regions = append(regions, delta.Region{Start: h.Start * r.rowSize, End: h.End * r.rowSize})
+		}
+		// The unconsumed frame is replaced: keep what it read
+		if r.hasNew {
+			for _, reg := range r.readyRegions {
+				regions = addRegion(regions, reg)
+			}
+		}
+	} else {
+		r.hints, r.forceFull, r.lastFull = r.hints[:0], false, now
+		regions = append(regions, delta.Region{End: len(r.writing)})
+	}
+	r.writingRegions = regions
+	return regions
+}
+
+// addRegion adds reg to the sorted and disjoint regions, merging the
+// overlapping or adjacent ones. Beyond maxDamageRegions, the two closest
+// regions are merged, reading the rows between them.
+func addRegion(regions []delta.Region, reg delta.Region) []delta.Region {
+	i := sort.Search(len(regions), func(i int) bool { return regions[i].End >= reg.Start })
+	j := i
+	for j < len(regions) && regions[j].Start <= reg.End {
+		reg.Start, reg.End = min(reg.Start, regions[j].Start), max(reg.End, regions[j].End)
+		j++
+	}
+	regions = slices.Replace(regions, i, j, reg)
+	if len(regions) > maxDamageRegions {
+		closest := 0
+		for k := 1; k < len(regions)-1; k++ {
+			if regions[k+1].Start-regions[k].End < regions[closest+1].Start-regions[closest].End {
+				closest = k
+			}
+		}
+		regions[closest].End = regions[closest+1].End
+		regions = slices.Delete(regions, closest+1, closest+2)
+	}
+	return regions
+}
+
 // Run reads frames continuously until ctx is cancelled.
 // Should be called in a goroutine: go reader.Run(ctx)
 func (r *AsyncFrameReader) Run(ctx context.Context) {
@@ -80,12 +198,21 @@ func (r *AsyncFrameReader) Run(ctx context.Context) {
 			continue
 		}
 
-		// ReadAt into writing buffer — no lock held, we own this buffer.
-		r.file.ReadAt(r.writing, r.pointerAddr)
+		// Read into writing buffer — no lock held, we own this buffer.
+		// The damaged regions are read together.
+		r.segs = r.segs[:0]
+		for _, reg := range r.region(time.Now()) {
+			r.segs = append(r.segs, remarkable.Segment{
+				Buf: r.writing[reg.Start:reg.End],
+				Off: r.pointerAddr + int64(reg.Start),
+			})
+		}
+		remarkable.ReadSegments(r.file, r.segs)
 
 		// Swap writing and ready under lock (O(1) pointer swap).
 		r.mu.Lock()
 		r.writing, r.ready = r.ready, r.writing
+		r.writingRegions, r.readyRegions = r.readyRegions, r.writingRegions
 		r.hasNew = true
 		r.mu.Unlock()
 	}
@@ -93,14 +220,24 @@ func (r *AsyncFrameReader) Run(ctx context.Context) {
 
 // Latest returns the latest complete frame, or nil if no new frame
 // is available since the last call. The returned slice is stable
-// until the next call to Latest.
+// until the next call to Latest. With damage hints, use LatestRegion.
 func (r *AsyncFrameReader) Latest() []byte {
+	frame, _ := r.LatestRegion()
+	return frame
+}
+
+// LatestRegion returns the latest frame and the regions of bytes that were
+// read, sorted and disjoint, or nil if no new frame is available since the
+// last call. The rest of the frame is stale. The returned slices are stable
+// until the next call.
+func (r *AsyncFrameReader) LatestRegion() (frame []byte, regions []delta.Region) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if !r.hasNew {
-		return nil
+		return nil, nil
 	}
 	r.hasNew = false
 	r.reading, r.ready = r.ready, r.reading
-	return r.reading
+	r.readingRegions, r.readyRegions = r.readyRegions, r.readingRegions
+	return r.reading, r.readingRegions
 }
@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+)
+
+// regionsOf returns the regions between the bounds, in units of size bytes.
+func regionsOf(size int, bounds ...int) []delta.Region {
+	var regions []delta.Region
+	for i := 0; i < len(bounds); i += 2 {
+		regions = append(regions, delta.Region{Start: bounds[i] * size, End: bounds[i+1] * size})
+	}
+	return regions
+}
+
+func TestAsyncFrameReaderRegion(t *testing.T) {
+	const rowSize, rows = 16, 100
+	r := NewAsyncFrameReader(bytes.NewReader(nil), 0, rowSize*rows)
+	now := time.Now()
+	whole := []delta.Region{{End: rowSize * rows}}
+	rowRegions := func(bounds ...int) []delta.Region { return regionsOf(rowSize, bounds...) }
+
+	// Without hints, the whole framebuffer is read
+	if got := r.region(now); !slices.Equal(got, whole) {
+		t.Fatalf("no hint: got %v, want the whole frame", got)
+	}
+
+	// Hints are ignored until the row size is known
+	r.Damage(10, 20)
+	if got := r.region(now); !slices.Equal(got, whole) {
+		t.Fatalf("no row size: got %v, want the whole frame", got)
+	}
+
+	r.SetRowSize(rowSize)
+	r.Damage(10, 20)
+	r.Damage(-5, 5)
+	if got, want := r.region(now), rowRegions(0, 5, 10, 20); !slices.Equal(got, want) {
+		t.Errorf("separate hints: got %v, want %v", got, want)
+	}
+	r.Damage(5, 12)
+	if got, want := r.region(now), rowRegions(0, 20); !slices.Equal(got, want) {
+		t.Errorf("merged hints: got %v, want %v", got, want)
+	}
+
+	// An unconsumed frame is replaced: its regions are kept
+	r.hasNew, r.readyRegions = true, rowRegions(50, 60)
+	if got, want := r.region(now), rowRegions(0, 20, 50, 60); !slices.Equal(got, want) {
+		t.Errorf("unconsumed frame: got %v, want %v", got, want)
+	}
+	r.hasNew = false
+
+	// The hints expire without new ones
+	if got := r.region(time.Now().Add(damageLifetime)); !slices.Equal(got, whole) {
+		t.Errorf("expired hint: got %v, want the whole frame", got)
+	}
+
+	// The whole framebuffer is read periodically
+	r.Damage(10, 20)
+	if got := r.region(now.Add(FullReadInterval)); !slices.Equal(got, whole) {
+		t.Errorf("full read interval: got %v, want the whole frame", got)
+	}
+
+	r.Damage(10, 20)
+	r.RequestFull()
+	if got := r.region(time.Now()); !slices.Equal(got, whole) {
+		t.Errorf("requested full read: got %v, want the whole frame", got)
+	}
+}
+
+func TestAddRegion(t *testing.T) {
+	var regions []delta.Region
+	for i := range maxDamageRegions {
+		regions = addRegion(regions, delta.Region{Start: i * 10, End: i*10 + 2})
+	}
+	if len(regions) != maxDamageRegions {
+		t.Fatalf("got %d regions, want %d", len(regions), maxDamageRegions)
+	}
+	// The closest regions are merged beyond the limit
+	regions = addRegion(regions, delta.Region{Start: 73, End: 75})
+	want := regionsOf(1, 0, 2, 10, 12, 20, 22, 30, 32, 40, 42, 50, 52, 60, 62, 70, 75)
+	if !slices.Equal(regions, want) {
+		t.Errorf("got %v, want %v", regions, want)
+	}
+	// A region spanning several others replaces them
+	regions = addRegion(regions, delta.Region{Start: 11, End: 40})
+	want = regionsOf(1, 0, 2, 10, 42, 50, 52, 60, 62, 70, 75)
+	if !slices.Equal(regions, want) {
+		t.Errorf("got %v, want %v", regions, want)
+	}
+}
+
+func TestAsyncFrameReaderPartialRead(t *testing.T) {
+	const rowSize, rows = 16, 8
+	data := make([]byte, rowSize*rows)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	r := NewAsyncFrameReader(bytes.NewReader(data), 0, len(data))
+	r.SetRowSize(rowSize)
+	r.region(time.Now()) // full read done
+	r.Damage(2, 4)
+	r.Damage(6, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+	r.Resume()
+
+	deadline := time.After(time.Second)
+	for {
+		frame, regions := r.LatestRegion()
+		if frame != nil {
+			want := regionsOf(rowSize, 2, 4, 6, 7)
+			if !slices.Equal(regions, want) {
+				t.Fatalf("got regions %v, want %v", regions, want)
+			}
+			for _, reg := range regions {
+				if !bytes.Equal(frame[reg.Start:reg.End], data[reg.Start:reg.End]) {
+					t.Errorf("region %v does not hold the framebuffer rows", reg)
+				}
+			}
+			if frame[5*rowSize] != 0 {
+				t.Error("the rows between the regions were read")
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("no frame read")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
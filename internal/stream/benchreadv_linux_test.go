@@ -0,0 +1,114 @@
+//go:build linux
+
+package stream
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// Layout of the RM2 framebuffer since firmware 3.24 (BGRA)
+const (
+	benchRowSize = 1404 * 4
+	benchRows    = 1872
+)
+
+// benchMemory returns a framebuffer-sized buffer of the benchmark process and
+// its address, read back through the process memory like xochitl's.
+func benchMemory() ([]byte, int64) {
+	buf := make([]byte, benchRowSize*benchRows)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	return buf, int64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// damagedRows returns segments of 64 rows every 256 rows, the scattered
+// reads of partial updates.
+func damagedRows(addr int64) []remarkable.Segment {
+	var segs []remarkable.Segment
+	for y := 0; y+64 <= benchRows; y += 256 {
+		segs = append(segs, remarkable.Segment{
+			Buf: make([]byte, 64*benchRowSize),
+			Off: addr + int64(y*benchRowSize),
+		})
+	}
+	return segs
+}
+
+func openSelfMem(b *testing.B) *os.File {
+	f, err := os.Open("/proc/self/mem")
+	if err != nil {
+		b.Skipf("cannot open /proc/self/mem: %v", err)
+	}
+	b.Cleanup(func() { f.Close() })
+	return f
+}
+
+func BenchmarkFrameRead_ProcMem(b *testing.B) {
+	src, addr := benchMemory()
+	f := openSelfMem(b)
+	dst := make([]byte, len(src))
+	b.SetBytes(int64(len(dst)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.ReadAt(dst, addr); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.KeepAlive(src)
+}
+
+func BenchmarkFrameRead_ProcessVMReadv(b *testing.B) {
+	src, addr := benchMemory()
+	r := remarkable.NewVMReader(os.Getpid(), nil)
+	dst := make([]byte, len(src))
+	if _, err := r.ReadAt(dst, addr); err != nil {
+		b.Skipf("process_vm_readv not allowed: %v", err)
+	}
+	b.SetBytes(int64(len(dst)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ReadAt(dst, addr); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.KeepAlive(src)
+}
+
+func BenchmarkRowsRead_ProcMem(b *testing.B) {
+	src, addr := benchMemory()
+	f := openSelfMem(b)
+	segs := damagedRows(addr)
+	b.SetBytes(int64(len(segs) * 64 * benchRowSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// One system call per segment
+		if _, err := remarkable.ReadSegments(f, segs); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.KeepAlive(src)
+}
+
+func BenchmarkRowsRead_ProcessVMReadv(b *testing.B) {
+	src, addr := benchMemory()
+	r := remarkable.NewVMReader(os.Getpid(), nil)
+	segs := damagedRows(addr)
+	if _, err := r.ReadSegments(segs); err != nil {
+		b.Skipf("process_vm_readv not allowed: %v", err)
+	}
+	b.SetBytes(int64(len(segs) * 64 * benchRowSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// A single system call for all the segments
+		if _, err := r.ReadSegments(segs); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.KeepAlive(src)
+}
@@ -9,9 +9,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/owulveryck/goMarkableStream/internal/bus"
 	"github.com/owulveryck/goMarkableStream/internal/debug"
 	"github.com/owulveryck/goMarkableStream/internal/delta"
 	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/history"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/power"
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
 	"github.com/owulveryck/goMarkableStream/internal/remarkable"
 	"github.com/owulveryck/goMarkableStream/internal/trace"
@@ -19,12 +23,15 @@ import (
 
 var (
 	defaultRate time.Duration = 200
-	// pressureThreshold defines the minimum pressure value to consider the pen as "touching"
-	// Values below this are considered "hovering" and should not trigger frame streaming
-	pressureThreshold int32 = 100
 	// penLiftCooldown is the grace period after pen lift during which we continue
 	// streaming to flush buffered frames and catch late xochitl renders.
 	penLiftCooldown = 300 * time.Millisecond
+	// damageMargin is the number of rows read on each side of the pen, to
+	// cover the width of the strokes and the pen moving during a tick
+	damageMargin = 96
+	// maxReplayGap bounds the pause between two frames replayed from the
+	// history, so the time without changes is skipped
+	maxReplayGap = 500 * time.Millisecond
 )
 
 var rawFrameBuffer = sync.Pool{
@@ -62,6 +69,51 @@ type StreamHandler struct {
 	inputEventsBus *pubsub.PubSub
 	deltaEncoder   *delta.Encoder
 	flusher        http.Flusher // Cached flusher interface per connection
+	power          *power.Monitor
+	penAxis        *inject.Axis
+	history        *history.Buffer
+	changes        ChangeObserver
+}
+
+// ChangeObserver is notified of the changes of the screen seen by the
+// stream, such as a page change detector.
+type ChangeObserver interface {
+	// StreamStarted and StreamStopped delimit a stream: while a stream
+	// runs, each frame encoded is reported to FrameEncoded
+	StreamStarted()
+	StreamStopped()
+	// FrameEncoded receives the change ratio of a frame (see
+	// delta.Encoder.ChangeRatio)
+	FrameEncoded(changeRatio float64)
+}
+
+// SetDeltaWorkers sets the number of goroutines comparing the frames (see
+// delta.Encoder.SetWorkers).
+func (h *StreamHandler) SetDeltaWorkers(n int) {
+	h.deltaEncoder.SetWorkers(n)
+}
+
+// SetPenAxis enables partial reads: while drawing, only the rows around the
+// pen are read. axis is the pen digitizer axis along the framebuffer rows.
+func (h *StreamHandler) SetPenAxis(axis inject.Axis) {
+	h.penAxis = &axis
+}
+
+// SetHistory lets the clients replay the history with the since parameter.
+// The history is recorded by a history.Recorder.
+func (h *StreamHandler) SetHistory(b *history.Buffer) {
+	h.history = b
+}
+
+// SetChangeObserver reports the changes of the frames streamed to o.
+func (h *StreamHandler) SetChangeObserver(o ChangeObserver) {
+	h.changes = o
+}
+
+// SetPowerMonitor suspends the capture while the tablet sleeps and sends a
+// full frame when it wakes up.
+func (h *StreamHandler) SetPowerMonitor(m *power.Monitor) {
+	h.power = m
 }
 
 // ReleaseMemory releases large buffers held by the stream handler's delta encoder.
@@ -100,6 +152,15 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	debug.Log("Stream: rate=%dms", rate)
+	var replay []history.Entry
+	if since := query.Get("since"); since != "" && h.history != nil {
+		t, err := history.ParseTime(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		replay = h.history.Since(t)
+	}
 
 	// Set CORS headers for the preflight request
 	if r.Method == http.MethodOptions {
@@ -118,7 +179,20 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Type: &absType,
 	})
 	defer h.inputEventsBus.Unsubscribe(eventC)
-	debug.Log("Stream: subscribed to EvAbs events")
+	// Typing on the keyboard changes the screen too
+	keyboardSource := events.Keyboard
+	keyType := uint16(events.EvKey)
+	keyC := h.inputEventsBus.SubscribeWithFilter("stream-keyboard", pubsub.EventFilter{
+		Source: &keyboardSource,
+		Type:   &keyType,
+	})
+	defer h.inputEventsBus.Unsubscribe(keyC)
+	debug.Log("Stream: subscribed to EvAbs and keyboard events")
+
+	if h.changes != nil {
+		h.changes.StreamStarted()
+		defer h.changes.StreamStopped()
+	}
 
 	ticker := time.NewTicker(rate * time.Millisecond)
 	defer ticker.Stop()
@@ -129,6 +203,9 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	asyncCtx, asyncCancel := context.WithCancel(r.Context())
 	defer asyncCancel()
 	asyncReader := NewAsyncFrameReader(h.file, h.pointerAddr, remarkable.Config.SizeBytes)
+	if h.penAxis != nil {
+		asyncReader.SetRowSize(remarkable.Config.Width * remarkable.Config.BytesPerPixel)
+	}
 	go asyncReader.Run(asyncCtx)
 
 	writing := true
@@ -145,14 +222,47 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cooldownTimer.Stop()
 	cooldownActive := false
 
+	// wake resumes writing on input activity
+	wake := func() {
+		if !writing {
+			asyncReader.Resume()
+		}
+		writing = true
+		stopWriting.Reset(2000 * time.Millisecond)
+		// Cancel any pending pen-lift cooldown
+		if cooldownActive {
+			cooldownTimer.Stop()
+			cooldownActive = false
+		}
+	}
+
+	var powerC chan power.Status
+	if h.power != nil {
+		sub := h.power.Topic().Subscribe("stream", bus.Options[power.Status]{BufferSize: 8})
+		defer sub.Close()
+		powerC = sub.C
+	}
+
 	// Track current pressure value to distinguish hover from touch
 	var currentPressure int32
 
+	// Rows drawn on by the pen during the tick, for partial reads
+	penRow, damageStart, damageEnd := -1, 0, 0
+	damaged := false
+
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Connection", "close")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Transfer-Encoding", "chunked")
 
+	if len(replay) > 0 {
+		if !h.replay(r.Context(), w, replay) {
+			return
+		}
+		// Go live with a full frame, the encoder has no previous frame yet
+		asyncReader.RequestFull()
+	}
+
 	for {
 		select {
 		case <-r.Context().Done():
@@ -163,6 +273,9 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if event.Code == 24 {
 				currentPressure = event.Value
 			}
+			if h.penAxis != nil && event.Source == events.Pen && event.Code == h.penAxis.Code {
+				penRow = int(h.penAxis.Position(event.Value) * float64(remarkable.Config.Height-1))
+			}
 
 			// Only trigger frame streaming when:
 			// 1. Touch events (finger touch, always active)
@@ -170,23 +283,26 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			shouldWrite := false
 			if event.Source == events.Touch {
 				shouldWrite = true
-			} else if event.Source == events.Pen && currentPressure > pressureThreshold {
+			} else if event.Source == events.Pen && currentPressure > events.PressureThreshold {
 				shouldWrite = true
 			}
 
 			if shouldWrite {
+				if event.Source == events.Touch {
+					// The change cannot be located (scrolling, page turn...)
+					asyncReader.RequestFull()
+				} else if penRow >= 0 {
+					if !damaged {
+						damageStart, damageEnd = penRow, penRow+1
+					}
+					damageStart, damageEnd = min(damageStart, penRow), max(damageEnd, penRow+1)
+					damaged = true
+				}
 				if !writing {
 					debug.Log("Stream: writing resumed (source=%v, pressure=%d)", event.Source, currentPressure)
-					asyncReader.Resume()
-				}
-				writing = true
-				stopWriting.Reset(2000 * time.Millisecond)
-				// Cancel any pending pen-lift cooldown
-				if cooldownActive {
-					cooldownTimer.Stop()
-					cooldownActive = false
 				}
-			} else if writing && event.Source == events.Pen && currentPressure <= pressureThreshold {
+				wake()
+			} else if writing && event.Source == events.Pen && currentPressure <= events.PressureThreshold {
 				// Pen lifted or hovering - start cooldown instead of stopping immediately.
 				// This grace period flushes buffered frames and catches late xochitl renders.
 				if !cooldownActive {
@@ -195,6 +311,24 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					cooldownActive = true
 				}
 			}
+		case <-keyC:
+			asyncReader.RequestFull()
+			if !writing {
+				debug.Log("Stream: writing resumed (keyboard)")
+			}
+			wake()
+		case status := <-powerC:
+			if status.State == power.Sleeping {
+				debug.Log("Stream: writing paused (device sleeping)")
+				writing = false
+				cooldownActive = false
+				asyncReader.Pause()
+			} else {
+				// The screen may have changed while sleeping
+				debug.Log("Stream: device awake, sending a full frame")
+				h.deltaEncoder.Reset()
+				wake()
+			}
 		case <-stopWriting.C:
 			if writing {
 				debug.Log("Stream: writing paused (no input for 2s)")
@@ -210,7 +344,11 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 			cooldownActive = false
 		case <-ticker.C:
-			if writing {
+			if damaged {
+				asyncReader.Damage(damageStart-damageMargin, damageEnd+damageMargin)
+				damaged = false
+			}
+			if writing && !IsPaused() {
 				if frameSize := h.fetchAndSendDeltaAsync(w, asyncReader); frameSize > 0 {
 					ticker.Reset(adaptRate(frameSize, rate*time.Millisecond))
 				} else {
@@ -221,6 +359,28 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// replay sends the frames of the history with their original timing, up
+// to maxReplayGap between frames. It returns false if the client is gone.
+func (h *StreamHandler) replay(ctx context.Context, w io.Writer, entries []history.Entry) bool {
+	debug.Log("Stream: replaying %d frames since %v", len(entries), entries[0].Time)
+	for i, e := range entries {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(min(e.Time.Sub(entries[i-1].Time), maxReplayGap)):
+			}
+		}
+		if _, err := w.Write(e.Data); err != nil {
+			return false
+		}
+		if h.flusher != nil {
+			h.flusher.Flush()
+		}
+	}
+	return true
+}
+
 // fetchAndSendDelta reads the framebuffer synchronously and sends a delta-encoded frame.
 // Used by tests and benchmarks that don't need the async reader.
 func (h *StreamHandler) fetchAndSendDelta(w io.Writer, rawData []uint8) int {
@@ -277,19 +437,28 @@ func adaptRate(frameSize int, baseRate time.Duration) time.Duration {
 }
 
 func (h *StreamHandler) fetchAndSendDeltaAsync(w io.Writer, reader *AsyncFrameReader) int {
-	frame := reader.Latest()
+	frame, regions := reader.LatestRegion()
 	if frame == nil {
 		return 0 // no new frame available yet
 	}
+	whole := len(regions) == 1 && regions[0] == delta.Region{End: len(frame)}
+	if !whole && !h.deltaEncoder.HasPrevious() {
+		// A full frame must be sent, wait for a complete one
+		reader.RequestFull()
+		return 0
+	}
 
 	span := trace.BeginSpan("fetch_and_send")
 	defer trace.EndSpan(span, nil)
 
-	frameSize, err := h.deltaEncoder.EncodeWithSize(frame, w)
+	frameSize, err := h.deltaEncoder.EncodeRegionsWithSize(frame, regions, w)
 	if err != nil {
 		log.Println("Error in delta encoding", err)
 		return 0
 	}
+	if h.changes != nil {
+		h.changes.FrameEncoded(h.deltaEncoder.ChangeRatio())
+	}
 	debug.Log("Stream: sent frame (%d bytes)", frameSize)
 	if h.flusher != nil {
 		h.flusher.Flush()
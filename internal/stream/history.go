@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/history"
+)
+
+// NewHistoryHandler creates the handler of the history API:
+//   - GET /history lists the frames kept
+//   - GET /history/frame?t=... returns the screen at time t, with the
+//     options of /screenshot
+func NewHistoryHandler(b *history.Buffer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		infos := b.Infos()
+		list := struct {
+			From   time.Time      `json:"from"`
+			To     time.Time      `json:"to"`
+			Bytes  int            `json:"bytes"`
+			Frames []history.Info `json:"frames"`
+		}{Bytes: b.Size(), Frames: infos}
+		if len(infos) > 0 {
+			list.From, list.To = infos[0].Time, infos[len(infos)-1].Time
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			log.Printf("failed to encode JSON response: %v", err)
+		}
+	})
+	mux.HandleFunc("GET /history/frame", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		opts, err := ParseScreenshotOptions(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t := time.Now()
+		if s := query.Get("t"); s != "" {
+			if t, err = history.ParseTime(s, t); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		frame, at, err := b.FrameAt(t)
+		if errors.Is(err, history.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("failed to rebuild frame: %v", err)
+			http.Error(w, "failed to rebuild frame", http.StatusInternalServerError)
+			return
+		}
+
+		// The frame is rendered as a screenshot of the screen at that time
+		w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+		NewScreenshotHandler(bytes.NewReader(frame), 0).serve(w, r, opts, at)
+	})
+	return mux
+}
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/delta"
+	"github.com/owulveryck/goMarkableStream/internal/history"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// historyWithFrames records two frames of the screen size in a history.
+func historyWithFrames(t *testing.T) (*history.Buffer, [][]byte) {
+	t.Helper()
+	size := remarkable.Config.Width * remarkable.Config.Height * remarkable.Config.BytesPerPixel
+	b := history.NewBuffer(history.DefaultConfig(size))
+	enc := delta.NewEncoder(0.5)
+	frame := bytes.Repeat([]byte{0xff}, size)
+	var sent [][]byte
+	for i := range 2 {
+		clear(frame[i*4096 : (i+1)*4096])
+		var buf bytes.Buffer
+		if err := enc.Encode(frame, &buf); err != nil {
+			t.Fatal(err)
+		}
+		b.Add(buf.Bytes())
+		sent = append(sent, buf.Bytes())
+	}
+	return b, sent
+}
+
+func TestHistoryHandler(t *testing.T) {
+	b, _ := historyWithFrames(t)
+	h := NewHistoryHandler(b)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history", nil))
+	var list struct {
+		Frames []history.Info `json:"frames"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Frames) != 2 || !list.Frames[0].Keyframe {
+		t.Fatalf("/history = %s (%v)", rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history/frame?format=gray&t=0s", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/history/frame: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := png.Decode(rec.Body); err != nil {
+		t.Error(err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history/frame?t=1h", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("frame before the history: status %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history/frame?t=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid time: status %d", rec.Code)
+	}
+}
+
+func TestStreamReplay(t *testing.T) {
+	b, sent := historyWithFrames(t)
+	h := &StreamHandler{}
+	var out bytes.Buffer
+	if !h.replay(context.Background(), &out, b.Since(time.Now().Add(-time.Minute))) {
+		t.Fatal("replay interrupted")
+	}
+	if want := bytes.Join(sent, nil); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("replayed %d bytes, want the %d bytes sent", out.Len(), len(want))
+	}
+}
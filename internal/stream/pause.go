@@ -0,0 +1,27 @@
+package stream
+
+import "sync/atomic"
+
+// paused suspends the frame delivery of every stream while keeping the
+// connections open. It is toggled by server-side actions.
+var paused atomic.Bool
+
+// SetPaused suspends or resumes the frame delivery of all streams.
+func SetPaused(p bool) {
+	paused.Store(p)
+}
+
+// TogglePause flips the paused state and returns the new state.
+func TogglePause() bool {
+	for {
+		old := paused.Load()
+		if paused.CompareAndSwap(old, !old) {
+			return !old
+		}
+	}
+}
+
+// IsPaused reports whether frame delivery is suspended.
+func IsPaused() bool {
+	return paused.Load()
+}
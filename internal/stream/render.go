@@ -0,0 +1,346 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/owulveryck/goMarkableStream/internal/pdf"
+	"github.com/owulveryck/goMarkableStream/internal/pixconv"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// Screenshot formats
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatGray = "gray" // 8-bit gray PNG
+	FormatMono = "mono" // 1-bit PNG
+	FormatPDF  = "pdf"
+)
+
+// blankLevel is the level above which every channel of a pixel is
+// considered blank (white paper) when trimming the margins
+const blankLevel = 250
+
+// ScreenshotOptions are the query options of /screenshot.
+type ScreenshotOptions struct {
+	// Format is one of png, jpeg, gray, mono or pdf
+	Format string
+	// Quality of the JPEG images (1-100)
+	Quality int
+	// Rotate is the clockwise rotation in degrees (0, 90, 180 or 270)
+	Rotate int
+	// Crop is the part of the rotated screen to keep, empty for all
+	Crop image.Rectangle
+	// Trim removes the blank margins
+	Trim bool
+	// Scale is the size factor of the image, in (0, 1]
+	Scale float64
+}
+
+// DefaultScreenshotOptions returns a full-size PNG of the screen.
+func DefaultScreenshotOptions() ScreenshotOptions {
+	return ScreenshotOptions{Format: FormatPNG, Quality: 90, Scale: 1}
+}
+
+// ParseScreenshotOptions reads the options from the query of /screenshot:
+//   - format: png (default), jpeg, gray, mono or pdf
+//   - quality: JPEG quality, 90 by default
+//   - rotate: clockwise rotation in degrees
+//   - portrait, flip: the settings of the viewer, turning the image the
+//     same way (90° counterclockwise and 180°), added to rotate
+//   - crop: x,y,width,height of the rotated screen to keep
+//   - trim: remove the blank margins
+//   - scale: size factor in (0, 1]
+func ParseScreenshotOptions(q url.Values) (ScreenshotOptions, error) {
+	o := DefaultScreenshotOptions()
+	if f := q.Get("format"); f != "" {
+		switch f = strings.ToLower(f); f {
+		case FormatPNG, FormatJPEG, FormatGray, FormatMono, FormatPDF:
+			o.Format = f
+		case "jpg":
+			o.Format = FormatJPEG
+		default:
+			return o, fmt.Errorf("invalid format %q: must be png, jpeg, gray, mono or pdf", f)
+		}
+	}
+	if s := q.Get("quality"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > 100 {
+			return o, fmt.Errorf("invalid quality %q: must be between 1 and 100", s)
+		}
+		o.Quality = v
+	}
+	if s := q.Get("rotate"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v%90 != 0 {
+			return o, fmt.Errorf("invalid rotation %q: must be a multiple of 90", s)
+		}
+		o.Rotate = v
+	}
+	for name, angle := range map[string]int{"portrait": 270, "flip": 180} {
+		if s := q.Get(name); s != "" {
+			v, err := strconv.ParseBool(s)
+			if err != nil {
+				return o, fmt.Errorf("invalid %s %q", name, s)
+			}
+			if v {
+				o.Rotate += angle
+			}
+		}
+	}
+	o.Rotate = ((o.Rotate % 360) + 360) % 360
+	if s := q.Get("crop"); s != "" {
+		var x, y, w, h int
+		if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil || w <= 0 || h <= 0 || x < 0 || y < 0 {
+			return o, fmt.Errorf("invalid crop %q: must be x,y,width,height", s)
+		}
+		o.Crop = image.Rect(x, y, x+w, y+h)
+	}
+	if s := q.Get("trim"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return o, fmt.Errorf("invalid trim %q", s)
+		}
+		o.Trim = v
+	}
+	if s := q.Get("scale"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return o, fmt.Errorf("invalid scale %q: must be in (0, 1]", s)
+		}
+		o.Scale = v
+	}
+	return o, nil
+}
+
+// String returns a canonical form of the options, used in the ETag.
+func (o ScreenshotOptions) String() string {
+	return fmt.Sprintf("%s/q%d/r%d/c%v/t%v/s%g", o.Format, o.Quality, o.Rotate, o.Crop, o.Trim, o.Scale)
+}
+
+// PageSize returns the size in points of a PDF page showing an image of
+// the given bounds at the physical size of the screen.
+func (o ScreenshotOptions) PageSize(bounds image.Rectangle) (width, height float64) {
+	dpi := remarkable.ScreenDPI * o.Scale
+	return float64(bounds.Dx()) * pdf.PointsPerInch / dpi, float64(bounds.Dy()) * pdf.PointsPerInch / dpi
+}
+
+// Gray reports whether the format is rendered from gray pixels.
+func (o ScreenshotOptions) Gray() bool {
+	return o.Format == FormatGray || o.Format == FormatMono
+}
+
+// raster is an image being rendered, made of packed pixels of bpp bytes.
+type raster struct {
+	pix  []byte
+	w, h int
+	bpp  int
+}
+
+// errEmptyImage is returned when nothing is left of the screen
+var errEmptyImage = errors.New("the cropped or scaled image is empty")
+
+// newRaster converts a framebuffer of width x height pixels of srcBPP bytes
+// (BGRA, or little-endian gray16) to RGBA, or to 8-bit gray.
+func newRaster(frame []byte, width, height, srcBPP int, gray bool) raster {
+	n := width * height
+	frame = frame[:n*srcBPP]
+	switch {
+	case srcBPP == 2:
+		r := raster{pix: make([]byte, n), w: width, h: height, bpp: 1}
+		pixconv.Gray16ToGray8(r.pix, frame)
+		if !gray {
+			return r.toRGBA()
+		}
+		return r
+	case gray:
+		r := raster{pix: make([]byte, n), w: width, h: height, bpp: 1}
+		pixconv.BGRAToGray8(r.pix, frame)
+		return r
+	default:
+		r := raster{pix: make([]byte, n*4), w: width, h: height, bpp: 4}
+		pixconv.BGRAToRGBA(r.pix, frame)
+		return r
+	}
+}
+
+func (r raster) toRGBA() raster {
+	out := raster{pix: make([]byte, r.w*r.h*4), w: r.w, h: r.h, bpp: 4}
+	for i, v := range r.pix {
+		out.pix[i*4], out.pix[i*4+1], out.pix[i*4+2], out.pix[i*4+3] = v, v, v, 0xff
+	}
+	return out
+}
+
+// render applies the rotation, crop, trim and scale of the options.
+func (r raster) render(o ScreenshotOptions) (raster, error) {
+	r = r.rotate(o.Rotate)
+	if !o.Crop.Empty() {
+		rect := o.Crop.Intersect(image.Rect(0, 0, r.w, r.h))
+		if rect.Empty() {
+			return r, errEmptyImage
+		}
+		r = r.crop(rect)
+	}
+	if o.Trim {
+		// A blank page has no margins to remove: it is kept whole
+		if content := r.content(); !content.Empty() {
+			r = r.crop(content)
+		}
+	}
+	if o.Scale < 1 {
+		r = r.scale(o.Scale)
+	}
+	if r.w == 0 || r.h == 0 {
+		return r, errEmptyImage
+	}
+	return r, nil
+}
+
+// RenderFrame renders a framebuffer of width x height pixels of bpp bytes
+// (BGRA, or little-endian gray16) with the options. The format of the
+// options only selects gray or RGBA pixels.
+func RenderFrame(frame []byte, width, height, bpp int, opts ScreenshotOptions) (image.Image, error) {
+	out, err := newRaster(frame, width, height, bpp, opts.Gray()).render(opts)
+	if err != nil {
+		return nil, err
+	}
+	return out.image(), nil
+}
+
+// RenderGray applies the rotation, crop, trim and scale of the options to
+// a gray image of the screen.
+func RenderGray(img *image.Gray, opts ScreenshotOptions) (image.Image, error) {
+	b := img.Bounds()
+	r := raster{pix: make([]byte, b.Dx()*b.Dy()), w: b.Dx(), h: b.Dy(), bpp: 1}
+	for y := range r.h {
+		copy(r.pix[y*r.w:(y+1)*r.w], img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):])
+	}
+	out, err := r.render(opts)
+	if err != nil {
+		return nil, err
+	}
+	return out.image(), nil
+}
+
+// rotate turns the image clockwise by a multiple of 90 degrees.
+func (r raster) rotate(degrees int) raster {
+	if degrees == 0 {
+		return r
+	}
+	out := raster{pix: make([]byte, len(r.pix)), w: r.w, h: r.h, bpp: r.bpp}
+	if degrees != 180 {
+		out.w, out.h = r.h, r.w
+	}
+	for y := range r.h {
+		for x := range r.w {
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = r.h-1-y, x
+			case 180:
+				dx, dy = r.w-1-x, r.h-1-y
+			case 270:
+				dx, dy = y, r.w-1-x
+			}
+			src := (y*r.w + x) * r.bpp
+			copy(out.pix[(dy*out.w+dx)*r.bpp:], r.pix[src:src+r.bpp])
+		}
+	}
+	return out
+}
+
+// crop keeps the rectangle of the image.
+func (r raster) crop(rect image.Rectangle) raster {
+	out := raster{pix: make([]byte, rect.Dx()*rect.Dy()*r.bpp), w: rect.Dx(), h: rect.Dy(), bpp: r.bpp}
+	for y := range out.h {
+		src := ((rect.Min.Y+y)*r.w + rect.Min.X) * r.bpp
+		copy(out.pix[y*out.w*r.bpp:(y+1)*out.w*r.bpp], r.pix[src:])
+	}
+	return out
+}
+
+// content returns the bounds of the non-blank pixels, or an empty
+// rectangle if the page is blank.
+func (r raster) content() image.Rectangle {
+	bounds := image.Rectangle{Min: image.Pt(r.w, r.h)}
+	for y := range r.h {
+		row := r.pix[y*r.w*r.bpp : (y+1)*r.w*r.bpp]
+		for x := range r.w {
+			if !r.blank(row[x*r.bpp:]) {
+				bounds.Min.X, bounds.Max.X = min(bounds.Min.X, x), max(bounds.Max.X, x+1)
+				bounds.Min.Y, bounds.Max.Y = min(bounds.Min.Y, y), max(bounds.Max.Y, y+1)
+			}
+		}
+	}
+	if bounds.Empty() {
+		return image.Rectangle{}
+	}
+	return bounds
+}
+
+// blank reports whether a pixel is white paper. Alpha is ignored.
+func (r raster) blank(px []byte) bool {
+	channels := min(r.bpp, 3)
+	for c := range channels {
+		if px[c] < blankLevel {
+			return false
+		}
+	}
+	return true
+}
+
+// scale resizes the image by a factor in (0, 1): boxes of pixels are
+// averaged for integer reductions, the nearest pixel is taken otherwise.
+// Nothing is left of the image when the factor is below one pixel.
+func (r raster) scale(factor float64) raster {
+	inverse := 1 / factor
+	// The factor is checked before the conversions to int overflow
+	if inverse > float64(max(r.w, r.h)) {
+		return raster{bpp: r.bpp}
+	}
+	if n := math.Round(inverse); math.Abs(inverse-n) < 1e-6 {
+		out := raster{pix: make([]byte, (r.w/int(n))*(r.h/int(n))*r.bpp), bpp: r.bpp}
+		out.w, out.h = pixconv.Downscale(out.pix, r.pix, r.w, r.h, r.bpp, int(n))
+		return out
+	}
+	out := raster{w: max(int(float64(r.w)*factor), 1), h: max(int(float64(r.h)*factor), 1), bpp: r.bpp}
+	out.pix = make([]byte, out.w*out.h*r.bpp)
+	for y := range out.h {
+		sy := min(int(float64(y)*inverse), r.h-1)
+		for x := range out.w {
+			sx := min(int(float64(x)*inverse), r.w-1)
+			src := (sy*r.w + sx) * r.bpp
+			copy(out.pix[(y*out.w+x)*r.bpp:], r.pix[src:src+r.bpp])
+		}
+	}
+	return out
+}
+
+// mono returns the gray raster as a black and white image, encoded as
+// 1-bit by image/png.
+func (r raster) mono() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, r.w, r.h), color.Palette{color.Black, color.White})
+	for i, v := range r.pix {
+		if v >= 128 {
+			img.Pix[i] = 1
+		}
+	}
+	return img
+}
+
+// image returns the raster as an image.Gray or an image.RGBA.
+func (r raster) image() image.Image {
+	rect := image.Rect(0, 0, r.w, r.h)
+	if r.bpp == 1 {
+		return &image.Gray{Pix: r.pix, Stride: r.w, Rect: rect}
+	}
+	return &image.RGBA{Pix: r.pix, Stride: r.w * 4, Rect: rect}
+}
@@ -1,13 +1,20 @@
 package stream
 
 import (
+	"bytes"
+	"fmt"
 	"image"
+	"image/jpeg"
 	"image/png"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/owulveryck/goMarkableStream/internal/pdf"
 	"github.com/owulveryck/goMarkableStream/internal/remarkable"
 )
 
@@ -19,54 +26,150 @@ func NewScreenshotHandler(file io.ReaderAt, pointerAddr int64) *ScreenshotHandle
 	}
 }
 
-// ScreenshotHandler is an http.Handler that serves PNG screenshots of the framebuffer
+// ScreenshotHandler is an http.Handler that serves screenshots of the framebuffer
 type ScreenshotHandler struct {
 	file        io.ReaderAt
 	pointerAddr int64
 }
 
-// ServeHTTP implements http.Handler
+// ServeHTTP implements http.Handler. The query options are described in
+// ParseScreenshotOptions. The ETag is a hash of the screen and of the
+// options, so a client sending it back in If-None-Match gets a 304 as long
+// as the screen did not change.
 func (h *ScreenshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	imageDataPtr := rawFrameBuffer.Get().(*[]uint8)
-	imageData := *imageDataPtr
-	defer rawFrameBuffer.Put(imageDataPtr)
+	opts, err := ParseScreenshotOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.serve(w, r, opts, time.Now())
+}
 
-	_, err := h.file.ReadAt(imageData, h.pointerAddr)
+// serve reads the screen and sends it with the options, as shown at time
+// at.
+func (h *ScreenshotHandler) serve(w http.ResponseWriter, r *http.Request, opts ScreenshotOptions, at time.Time) {
+	frame, release, err := h.readFrame()
 	if err != nil {
 		log.Printf("failed to read framebuffer: %v", err)
 		http.Error(w, "failed to read framebuffer", http.StatusInternalServerError)
 		return
 	}
+	defer release()
 
-	width := remarkable.Config.Width
-	height := remarkable.Config.Height
+	cfg := remarkable.Config
+	etag := fmt.Sprintf("\"%016x\"", xxhash.Sum64String(opts.String())^xxhash.Sum64(frame))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	// Create RGBA image
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img, err := newRaster(frame, cfg.Width, cfg.Height, cfg.BytesPerPixel, opts.Gray()).render(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	contentType, ext, err := encodeScreenshot(&buf, img, opts)
+	if err != nil {
+		log.Printf("failed to encode screenshot: %v", err)
+		http.Error(w, "failed to encode screenshot", http.StatusInternalServerError)
+		return
+	}
 
-	// Convert framebuffer to RGBA
-	// All devices use BGRA format (4 bytes per pixel)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			srcIdx := (y*width + x) * 4
-			dstIdx := (y*width + x) * 4
+	// Generate filename with timestamp
+	filename := "remarkable_" + at.Format("20060102_150405") + ext
 
-			// BGRA to RGBA: swap B and R channels
-			img.Pix[dstIdx+0] = imageData[srcIdx+2] // R <- B
-			img.Pix[dstIdx+1] = imageData[srcIdx+1] // G <- G
-			img.Pix[dstIdx+2] = imageData[srcIdx+0] // B <- R
-			img.Pix[dstIdx+3] = 255                 // A (fully opaque)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("failed to send screenshot: %v", err)
+	}
+}
+
+// encodeScreenshot writes the image in the format of the options and
+// returns its content type and file extension.
+func encodeScreenshot(w io.Writer, img raster, opts ScreenshotOptions) (string, string, error) {
+	switch opts.Format {
+	case FormatJPEG:
+		return "image/jpeg", ".jpg", jpeg.Encode(w, img.image(), &jpeg.Options{Quality: opts.Quality})
+	case FormatMono:
+		return "image/png", ".png", png.Encode(w, img.mono())
+	case FormatPDF:
+		pw := pdf.NewWriter(w)
+		page := img.image()
+		width, height := opts.PageSize(page.Bounds())
+		if err := pw.AddPage(page, width, height); err != nil {
+			return "", "", err
 		}
+		return "application/pdf", ".pdf", pw.Close()
+	default:
+		return "image/png", ".png", png.Encode(w, img.image())
 	}
+}
 
-	// Generate filename with timestamp
-	filename := "remarkable_" + time.Now().Format("20060102_150405") + ".png"
+// etagMatch reports whether the If-None-Match header matches the ETag.
+func etagMatch(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
 
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
-	w.Header().Set("Cache-Control", "no-cache")
+// Snapshot reads the screen and renders it with the options. The hash
+// identifies the content of the screen, whatever the options.
+func (h *ScreenshotHandler) Snapshot(opts ScreenshotOptions) (image.Image, uint64, error) {
+	frame, release, err := h.readFrame()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	cfg := remarkable.Config
+	img, err := newRaster(frame, cfg.Width, cfg.Height, cfg.BytesPerPixel, opts.Gray()).render(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return img.image(), xxhash.Sum64(frame), nil
+}
+
+// readFrame reads the framebuffer into a buffer of the pool, returned to
+// the pool by release.
+func (h *ScreenshotHandler) readFrame() (frame []byte, release func(), err error) {
+	imageDataPtr := rawFrameBuffer.Get().(*[]uint8)
+	release = func() { rawFrameBuffer.Put(imageDataPtr) }
+	imageData := *imageDataPtr
+	if _, err := h.file.ReadAt(imageData, h.pointerAddr); err != nil {
+		release()
+		return nil, nil, err
+	}
+	cfg := remarkable.Config
+	return imageData[:cfg.Width*cfg.Height*cfg.BytesPerPixel], release, nil
+}
 
-	if err := png.Encode(w, img); err != nil {
-		log.Printf("failed to encode PNG: %v", err)
+// WritePNG captures the framebuffer and writes it to w as a PNG image.
+func (h *ScreenshotHandler) WritePNG(w io.Writer) error {
+	img, err := h.Capture()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// Capture reads the framebuffer and converts it to an RGBA image, from
+// BGRA or gray16 pixels.
+func (h *ScreenshotHandler) Capture() (*image.RGBA, error) {
+	img, _, err := h.Snapshot(DefaultScreenshotOptions())
+	if err != nil {
+		return nil, err
 	}
+	return img.(*image.RGBA), nil
 }
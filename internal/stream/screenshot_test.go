@@ -0,0 +1,291 @@
+package stream
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+func TestParseScreenshotOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    ScreenshotOptions
+		wantErr bool
+	}{
+		{"", DefaultScreenshotOptions(), false},
+		{"format=jpg&quality=50", ScreenshotOptions{Format: FormatJPEG, Quality: 50, Scale: 1}, false},
+		{"rotate=-90", ScreenshotOptions{Format: FormatPNG, Quality: 90, Rotate: 270, Scale: 1}, false},
+		{"portrait=true&flip=true", ScreenshotOptions{Format: FormatPNG, Quality: 90, Rotate: 90, Scale: 1}, false},
+		{"crop=10,20,30,40&trim=1&scale=0.5", ScreenshotOptions{Format: FormatPNG, Quality: 90, Crop: image.Rect(10, 20, 40, 60), Trim: true, Scale: 0.5}, false},
+		{"format=gif", ScreenshotOptions{}, true},
+		{"quality=0", ScreenshotOptions{}, true},
+		{"rotate=45", ScreenshotOptions{}, true},
+		{"crop=1,2,0,4", ScreenshotOptions{}, true},
+		{"scale=2", ScreenshotOptions{}, true},
+		{"flip=maybe", ScreenshotOptions{}, true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := ParseScreenshotOptions(q)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// grayRaster returns a w x h gray raster where each pixel is its index.
+func grayRaster(w, h int) raster {
+	r := raster{pix: make([]byte, w*h), w: w, h: h, bpp: 1}
+	for i := range r.pix {
+		r.pix[i] = byte(i)
+	}
+	return r
+}
+
+func TestRasterRotate(t *testing.T) {
+	// 0 1 2
+	// 3 4 5
+	r := grayRaster(3, 2)
+	tests := []struct {
+		degrees int
+		w, h    int
+		want    []byte
+	}{
+		{90, 2, 3, []byte{3, 0, 4, 1, 5, 2}},
+		{180, 3, 2, []byte{5, 4, 3, 2, 1, 0}},
+		{270, 2, 3, []byte{2, 5, 1, 4, 0, 3}},
+	}
+	for _, tt := range tests {
+		got := r.rotate(tt.degrees)
+		if got.w != tt.w || got.h != tt.h || !bytes.Equal(got.pix, tt.want) {
+			t.Errorf("rotate(%d) = %dx%d %v, want %dx%d %v", tt.degrees, got.w, got.h, got.pix, tt.w, tt.h, tt.want)
+		}
+	}
+}
+
+func TestRasterCropAndTrim(t *testing.T) {
+	r := grayRaster(4, 4)
+	got := r.crop(image.Rect(1, 1, 3, 3))
+	if want := []byte{5, 6, 9, 10}; !bytes.Equal(got.pix, want) {
+		t.Errorf("crop = %v, want %v", got.pix, want)
+	}
+
+	page := raster{pix: bytes.Repeat([]byte{255}, 10*8), w: 10, h: 8, bpp: 1}
+	if got := page.content(); !got.Empty() {
+		t.Errorf("content of a blank page = %v, want empty", got)
+	}
+	page.pix[2*10+3] = 0
+	page.pix[5*10+6] = 100
+	if got, want := page.content(), image.Rect(3, 2, 7, 6); got != want {
+		t.Errorf("content = %v, want %v", got, want)
+	}
+}
+
+func TestRasterScale(t *testing.T) {
+	r := raster{pix: bytes.Repeat([]byte{10, 20, 30, 255}, 8*6), w: 8, h: 6, bpp: 4}
+	half := r.scale(0.5)
+	if half.w != 4 || half.h != 3 || !bytes.Equal(half.pix[:4], []byte{10, 20, 30, 255}) {
+		t.Errorf("scale(0.5) = %dx%d %v", half.w, half.h, half.pix[:4])
+	}
+	odd := r.scale(0.75)
+	if odd.w != 6 || odd.h != 4 || len(odd.pix) != 6*4*4 {
+		t.Errorf("scale(0.75) = %dx%d", odd.w, odd.h)
+	}
+	// Factors below one pixel leave nothing, whatever their size
+	for _, factor := range []float64{0.1, 1e-9, 1e-300} {
+		opts := DefaultScreenshotOptions()
+		opts.Scale = factor
+		if _, err := r.render(opts); err != errEmptyImage {
+			t.Errorf("scale %g: err = %v, want %v", factor, err, errEmptyImage)
+		}
+	}
+}
+
+// screenshotFile is a framebuffer filled with white, with a black square.
+func screenshotFile() *bytes.Reader {
+	cfg := remarkable.Config
+	frame := bytes.Repeat([]byte{255}, cfg.Width*cfg.Height*cfg.BytesPerPixel)
+	for y := 100; y < 200; y++ {
+		row := y * cfg.Width * cfg.BytesPerPixel
+		clear(frame[row+300*cfg.BytesPerPixel : row+350*cfg.BytesPerPixel])
+	}
+	return bytes.NewReader(frame)
+}
+
+func TestScreenshotHandlerCaptureGray16(t *testing.T) {
+	saved := remarkable.Config
+	remarkable.Config = remarkable.FramebufferConfig{
+		Width:         4,
+		Height:        2,
+		BytesPerPixel: remarkable.BytesPerPixelGray16,
+		SizeBytes:     4 * 2 * remarkable.BytesPerPixelGray16,
+	}
+	ResetFrameBufferPool()
+	t.Cleanup(func() {
+		remarkable.Config = saved
+		ResetFrameBufferPool()
+	})
+
+	frame := bytes.Repeat([]byte{255}, 16)
+	clear(frame[2:4])
+	h := NewScreenshotHandler(bytes.NewReader(frame), 0)
+	img, err := h.Capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+		t.Fatalf("bounds = %v, want 4x2", img.Bounds())
+	}
+	white := img.RGBAAt(0, 0)
+	black := img.RGBAAt(1, 0)
+	if white.R <= black.R || black.A != 255 {
+		t.Errorf("pixels = %v and %v, want white then opaque black", white, black)
+	}
+
+	var buf bytes.Buffer
+	if err := h.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Errorf("decode PNG: %v", err)
+	}
+}
+
+func TestScreenshotHandlerFormats(t *testing.T) {
+	h := NewScreenshotHandler(screenshotFile(), 0)
+	tests := []struct {
+		query       string
+		contentType string
+		check       func(t *testing.T, body []byte)
+	}{
+		{"trim=1", "image/png", func(t *testing.T, body []byte) {
+			img, err := png.Decode(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != 50 || b.Dy() != 100 {
+				t.Errorf("trimmed size = %v, want 50x100", b)
+			}
+		}},
+		{"format=mono&trim=1&rotate=90", "image/png", func(t *testing.T, body []byte) {
+			img, err := png.Decode(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := img.(*image.Paletted); !ok {
+				t.Errorf("mono image is a %T", img)
+			}
+			if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+				t.Errorf("rotated size = %v, want 100x50", b)
+			}
+		}},
+		{"format=gray&crop=0,0,40,30&scale=0.5", "image/png", func(t *testing.T, body []byte) {
+			img, err := png.Decode(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := img.(*image.Gray); !ok {
+				t.Errorf("gray image is a %T", img)
+			}
+			if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 15 {
+				t.Errorf("size = %v, want 20x15", b)
+			}
+		}},
+		{"format=jpeg&trim=1", "image/jpeg", func(t *testing.T, body []byte) {
+			if _, err := jpeg.Decode(bytes.NewReader(body)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"format=pdf&trim=1", "application/pdf", func(t *testing.T, body []byte) {
+			if !bytes.HasPrefix(body, []byte("%PDF-")) {
+				t.Errorf("body does not start with a PDF header: %q", body[:min(len(body), 8)])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/screenshot?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got, want := rec.Header().Get("Content-Length"), len(rec.Body.Bytes()); got == "" || got != strconv.Itoa(want) {
+				t.Errorf("Content-Length = %q, want %d", got, want)
+			}
+			tt.check(t, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestScreenshotHandlerTrimBlankPage(t *testing.T) {
+	cfg := remarkable.Config
+	blank := bytes.Repeat([]byte{255}, cfg.Width*cfg.Height*cfg.BytesPerPixel)
+	h := NewScreenshotHandler(bytes.NewReader(blank), 0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/screenshot?format=gray&trim=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != cfg.Width || b.Dy() != cfg.Height {
+		t.Errorf("size = %v, want the whole %dx%d page", b, cfg.Width, cfg.Height)
+	}
+}
+
+func TestScreenshotHandlerETag(t *testing.T) {
+	h := NewScreenshotHandler(screenshotFile(), 0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/screenshot?format=gray", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	for _, header := range []string{etag, `"other", W/` + etag, "*"} {
+		req := httptest.NewRequest(http.MethodGet, "/screenshot?format=gray", nil)
+		req.Header.Set("If-None-Match", header)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: status = %d, body %d bytes", header, rec.Code, rec.Body.Len())
+		}
+	}
+
+	// The same screen with other options is another resource
+	req := httptest.NewRequest(http.MethodGet, "/screenshot?format=png", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("other options: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestScreenshotHandlerBadRequest(t *testing.T) {
+	h := NewScreenshotHandler(screenshotFile(), 0)
+	for _, query := range []string{"format=bmp", "crop=5000,5000,10,10", "scale=1e-300"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/screenshot?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
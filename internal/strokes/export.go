@@ -0,0 +1,135 @@
+package strokes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+const (
+	// minWidth and maxWidth are the widths of the SVG strokes, in screen
+	// pixels, at the lowest and the highest pressure
+	minWidth = 1.0
+	maxWidth = 5.0
+	// widthStep is the precision of the SVG stroke widths; a stroke is
+	// split where its width changes by this step
+	widthStep = 0.5
+	// mmPerInch converts the screen resolution
+	mmPerInch = 25.4
+)
+
+// WriteSVG writes the pen strokes of a session as an SVG image of the
+// size of the screen. The width of the lines follows the pressure. The
+// eraser strokes are left out.
+func WriteSVG(w io.Writer, s Session) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%smm" height="%smm" viewBox="0 0 %d %d">
+<title>%s</title>
+<rect width="100%%" height="100%%" fill="white"/>
+<g fill="none" stroke="black" stroke-linecap="round" stroke-linejoin="round">
+`, mm(float64(s.Width), s.DPI), mm(float64(s.Height), s.DPI), s.Width, s.Height, s.ID)
+	var buf []byte
+	for _, stroke := range s.Strokes {
+		if stroke.Tool == ToolEraser {
+			continue
+		}
+		// The stroke is drawn as paths of constant width
+		points := stroke.Points
+		for start := 0; start < len(points); {
+			width := strokeWidth(points[start].Pressure)
+			end := start + 1
+			for end < len(points) && strokeWidth(points[end].Pressure) == width {
+				end++
+			}
+			buf = append(buf[:0], `<path stroke-width="`...)
+			buf = strconv.AppendFloat(buf, width, 'f', -1, 64)
+			buf = append(buf, `" d="M`...)
+			buf = appendXY(buf, points[start])
+			if end-start == 1 && end == len(points) {
+				// A dot
+				buf = append(buf, "l0 0"...)
+			}
+			// The path joins the first point of the next one
+			for _, p := range points[start+1 : min(end+1, len(points))] {
+				buf = append(buf, 'L')
+				buf = appendXY(buf, p)
+			}
+			buf = append(buf, "\"/>\n"...)
+			bw.Write(buf)
+			start = end
+		}
+	}
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+// strokeWidth returns the width of the line drawn at a pressure.
+func strokeWidth(pressure float32) float64 {
+	w := minWidth + float64(pressure)*(maxWidth-minWidth)
+	return math.Round(w/widthStep) * widthStep
+}
+
+func appendXY(buf []byte, p Point) []byte {
+	buf = strconv.AppendFloat(buf, float64(p.X), 'f', 1, 32)
+	buf = append(buf, ' ')
+	return strconv.AppendFloat(buf, float64(p.Y), 'f', 1, 32)
+}
+
+// mm converts screen pixels to millimeters.
+func mm(px float64, dpi int) string {
+	return strconv.FormatFloat(px/float64(dpi)*mmPerInch, 'f', 2, 64)
+}
+
+// WriteInkML writes the strokes of a session as an InkML document
+// (https://www.w3.org/TR/InkML/). The X and Y channels are in millimeters
+// from the top-left corner of the screen, F is the pressure in [0, 1] and
+// T the time since the start of the session in milliseconds.
+func WriteInkML(w io.Writer, s Session) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>
+<ink xmlns="http://www.w3.org/2003/InkML">
+<definitions>
+<context xml:id="ctx0">
+<inkSource xml:id="digitizer">
+<traceFormat>
+<channel name="X" type="decimal" units="mm"/>
+<channel name="Y" type="decimal" units="mm"/>
+<channel name="F" type="decimal" min="0" max="1"/>
+<channel name="T" type="integer" units="ms"/>
+</traceFormat>
+</inkSource>
+<canvas xml:id="screen"><traceFormat href="#digitizer"/></canvas>
+<timestamp xml:id="start" time="%d"/>
+</context>
+<brush xml:id="%s"/>
+<brush xml:id="%s"/>
+</definitions>
+`, s.Started.UnixMilli(), ToolPen, ToolEraser)
+	scale := mmPerInch / float64(s.DPI)
+	var buf []byte
+	for _, stroke := range s.Strokes {
+		offset := int32(stroke.Start.Sub(s.Started).Milliseconds())
+		buf = append(buf[:0], `<trace contextRef="#ctx0" brushRef="#`...)
+		buf = append(buf, stroke.Tool...)
+		buf = append(buf, `">`...)
+		for i, p := range stroke.Points {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = strconv.AppendFloat(buf, float64(p.X)*scale, 'f', 3, 64)
+			buf = append(buf, ' ')
+			buf = strconv.AppendFloat(buf, float64(p.Y)*scale, 'f', 3, 64)
+			buf = append(buf, ' ')
+			buf = strconv.AppendFloat(buf, float64(p.Pressure), 'f', 3, 32)
+			buf = append(buf, ' ')
+			buf = strconv.AppendInt(buf, int64(offset+p.T), 10)
+		}
+		buf = append(buf, "</trace>\n"...)
+		bw.Write(buf)
+	}
+	bw.WriteString("</ink>\n")
+	return bw.Flush()
+}
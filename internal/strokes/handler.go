@@ -0,0 +1,72 @@
+package strokes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// NewHandler creates the handler of the strokes API:
+//   - GET /strokes lists the sessions.
+//   - POST /strokes/new ends the current session and starts a new one.
+//   - GET /strokes/{id} exports a session, "current" being the session
+//     being recorded. The format query parameter selects json (default),
+//     svg or inkml.
+func NewHandler(r *Recorder) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /strokes", r.handleList)
+	mux.HandleFunc("POST /strokes/new", r.handleNew)
+	mux.HandleFunc("GET /strokes/{id}", r.handleExport)
+	return mux
+}
+
+func (r *Recorder) handleList(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, r.Sessions())
+}
+
+func (r *Recorder) handleNew(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusCreated, r.NewSession())
+}
+
+func (r *Recorder) handleExport(w http.ResponseWriter, req *http.Request) {
+	var write func(io.Writer, Session) error
+	var contentType, ext string
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "json":
+		write = func(w io.Writer, s Session) error { return json.NewEncoder(w).Encode(s) }
+		contentType, ext = "application/json", "json"
+	case "svg":
+		write, contentType, ext = WriteSVG, "image/svg+xml", "svg"
+	case "inkml":
+		write, contentType, ext = WriteInkML, "application/inkml+xml", "inkml"
+	default:
+		http.Error(w, "invalid format \""+format+"\": must be json, svg or inkml", http.StatusBadRequest)
+		return
+	}
+	s, err := r.Session(req.PathValue("id"))
+	if errors.Is(err, ErrNoSession) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "inline; filename=\"strokes-"+s.ID+"."+ext+"\"")
+	if !s.Ended.IsZero() {
+		// An ended session does not change anymore
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if err := write(w, s); err != nil {
+		log.Printf("failed to export strokes: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode JSON response: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package strokes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+)
+
+// ErrNoSession is returned for an unknown session
+var ErrNoSession = errors.New("no such stroke session")
+
+// Config configures a Recorder.
+type Config struct {
+	// Mapping converts the digitizer coordinates to the screen
+	Mapping inject.DeviceMapping
+	// Width and Height are the size of the screen in pixels
+	Width, Height int
+	// DPI is the resolution of the screen, used to size the exports
+	DPI int
+	// MaxSessions is the number of sessions kept, including the current one
+	MaxSessions int
+	// MaxPoints is the number of points after which the current session is
+	// ended and a new one started
+	MaxPoints int
+}
+
+// DefaultConfig returns the configuration of the device model the binary
+// is built for.
+func DefaultConfig() Config {
+	return Config{
+		Mapping:     inject.DefaultMapping().Pen,
+		Width:       remarkable.Config.Width,
+		Height:      remarkable.Config.Height,
+		DPI:         remarkable.ScreenDPI,
+		MaxSessions: 8,
+		MaxPoints:   200000,
+	}
+}
+
+// Session is a set of strokes drawn between two calls to
+// Recorder.NewSession.
+type Session struct {
+	ID      string    `json:"id"`
+	Started time.Time `json:"started"`
+	// Ended is zero for the current session
+	Ended   time.Time `json:"ended,omitzero"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	DPI     int       `json:"dpi"`
+	Strokes []Stroke  `json:"strokes"`
+}
+
+// Info describes a session.
+type Info struct {
+	ID      string    `json:"id"`
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended,omitzero"`
+	Current bool      `json:"current"`
+	Strokes int       `json:"strokes"`
+	Points  int       `json:"points"`
+}
+
+// session is a session being recorded or kept
+type session struct {
+	Session
+	points int
+}
+
+func (s *session) info() Info {
+	return Info{
+		ID:      s.ID,
+		Started: s.Started,
+		Ended:   s.Ended,
+		Current: s.Ended.IsZero(),
+		Strokes: len(s.Strokes),
+		Points:  s.points,
+	}
+}
+
+// Recorder builds the strokes of the pen and stores them by session.
+type Recorder struct {
+	config  Config
+	builder *Builder
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sessions []*session // oldest first, the last one is the current session
+}
+
+// NewRecorder creates a recorder. The first session starts with the first
+// stroke.
+func NewRecorder(config Config) *Recorder {
+	return &Recorder{
+		config:  config,
+		builder: NewBuilder(config.Mapping, config.Width, config.Height),
+		now:     time.Now,
+	}
+}
+
+// Start subscribes to the pen events and records the strokes until ctx is
+// done.
+func (r *Recorder) Start(ctx context.Context, ps *pubsub.PubSub) {
+	penSource := events.Pen
+	// A lost pen up would join two strokes
+	eventC := ps.SubscribeWithOptions("strokes", pubsub.Options{
+		Filter:     pubsub.EventFilter{Source: &penSource},
+		BufferSize: 500,
+		Policy:     pubsub.Block,
+		Priority:   -1,
+	})
+	go func() {
+		defer ps.Unsubscribe(eventC)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-eventC:
+				if !ok {
+					return
+				}
+				r.HandleEvent(ev.InputEvent)
+			}
+		}
+	}()
+}
+
+// HandleEvent processes an event of the pen.
+func (r *Recorder) HandleEvent(ev events.InputEvent) {
+	stroke, ok := r.builder.HandleEvent(ev)
+	if !ok || len(stroke.Points) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.current()
+	if s == nil || s.points >= r.config.MaxPoints {
+		s = r.newSession(stroke.Start)
+	}
+	s.Strokes = append(s.Strokes, stroke)
+	s.points += len(stroke.Points)
+	debug.Log("Strokes: %d points added to session %s", len(stroke.Points), s.ID)
+}
+
+// NewSession ends the current session and starts a new one.
+func (r *Recorder) NewSession() Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.newSession(r.now()).info()
+}
+
+// newSession must be called with the lock held.
+func (r *Recorder) newSession(now time.Time) *session {
+	if s := r.current(); s != nil {
+		s.Ended = now
+	}
+	id := now.Format("20060102_150405.000")
+	s := &session{Session: Session{
+		ID:      id,
+		Started: now,
+		Width:   r.config.Width,
+		Height:  r.config.Height,
+		DPI:     r.config.DPI,
+	}}
+	r.sessions = append(r.sessions, s)
+	if n := len(r.sessions) - max(r.config.MaxSessions, 1); n > 0 {
+		clear(r.sessions[:n])
+		r.sessions = r.sessions[n:]
+	}
+	return s
+}
+
+// current must be called with the lock held.
+func (r *Recorder) current() *session {
+	if len(r.sessions) == 0 {
+		return nil
+	}
+	s := r.sessions[len(r.sessions)-1]
+	if !s.Ended.IsZero() {
+		return nil
+	}
+	return s
+}
+
+// Sessions lists the sessions, oldest first.
+func (r *Recorder) Sessions() []Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]Info, len(r.sessions))
+	for i, s := range r.sessions {
+		infos[i] = s.info()
+	}
+	return infos
+}
+
+// Session returns a copy of a session. The id "current" is the session
+// being recorded.
+func (r *Recorder) Session(id string) (Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.ID == id || (id == "current" && s.Ended.IsZero()) {
+			c := s.Session
+			// The strokes are never modified once added
+			c.Strokes = s.Strokes[:len(s.Strokes):len(s.Strokes)]
+			return c, nil
+		}
+	}
+	return Session{}, ErrNoSession
+}
@@ -0,0 +1,138 @@
+// Package strokes rebuilds the pen strokes from the events of the pen
+// digitizer and exports them as vector drawings.
+//
+// The strokes are kept in memory by sessions, in screen pixels, with the
+// pressure and the timing of each point. Unlike the pixels of the
+// framebuffer, they do not depend on the resolution of the screen.
+package strokes
+
+import (
+	"math"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+)
+
+// MaxPressure is the maximum pressure reported by the pen digitizers
+const MaxPressure = 4095
+
+// Tool is the end of the pen drawing the stroke.
+type Tool string
+
+const (
+	// ToolPen is the tip of the pen
+	ToolPen Tool = "pen"
+	// ToolEraser is the eraser end of the pen
+	ToolEraser Tool = "eraser"
+)
+
+// Point is a sample of a stroke.
+type Point struct {
+	// X and Y are the position in screen pixels
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	// Pressure is the pen pressure, in [0, 1]
+	Pressure float32 `json:"p"`
+	// T is the time since the start of the stroke, in milliseconds
+	T int32 `json:"t"`
+}
+
+// Stroke is the path of the pen between a pen down and a pen up.
+type Stroke struct {
+	Start  time.Time `json:"start"`
+	Tool   Tool      `json:"tool"`
+	Points []Point   `json:"points"`
+}
+
+// Builder segments the pen events into strokes.
+type Builder struct {
+	mapping       inject.DeviceMapping
+	width, height float64
+
+	axes     [2]int32
+	pressure int32
+	tool     Tool
+	stroke   *Stroke
+}
+
+// NewBuilder creates a builder converting the digitizer coordinates to a
+// screen of width x height pixels with the mapping of the pen.
+func NewBuilder(mapping inject.DeviceMapping, width, height int) *Builder {
+	return &Builder{
+		mapping: mapping,
+		width:   float64(width),
+		height:  float64(height),
+		tool:    ToolPen,
+	}
+}
+
+// HandleEvent processes an event of the pen. It returns the stroke
+// finished by the event, when the pen is lifted.
+func (b *Builder) HandleEvent(ev events.InputEvent) (Stroke, bool) {
+	switch ev.Type {
+	case events.EvAbs:
+		switch ev.Code {
+		case b.mapping.X.Code:
+			b.axes[0] = ev.Value
+		case b.mapping.Y.Code:
+			b.axes[1] = ev.Value
+		case inject.AbsPressure:
+			b.pressure = ev.Value
+		}
+	case events.EvKey:
+		// The tool is reported when the pen comes in range
+		if ev.Value == 1 && ev.Code == events.BtnToolRubber {
+			b.tool = ToolEraser
+		} else if ev.Value == 1 && ev.Code == events.BtnToolPen {
+			b.tool = ToolPen
+		}
+	case events.EvSyn:
+		if ev.Code == events.SynReport {
+			return b.sync(ev.Timestamp())
+		}
+	}
+	return Stroke{}, false
+}
+
+// sync adds the position reported since the last synchronization to the
+// stroke, or finishes the stroke if the pen was lifted.
+func (b *Builder) sync(t time.Time) (Stroke, bool) {
+	if b.pressure <= events.PressureThreshold {
+		return b.Flush()
+	}
+	if b.stroke == nil {
+		b.stroke = &Stroke{Start: t, Tool: b.tool}
+	}
+	p := Point{
+		X:        float32(b.mapping.X.Position(b.axes[0]) * b.width),
+		Y:        float32(b.mapping.Y.Position(b.axes[1]) * b.height),
+		Pressure: float32(math.Min(float64(b.pressure)/MaxPressure, 1)),
+		T:        int32(t.Sub(b.stroke.Start).Milliseconds()),
+	}
+	if n := len(b.stroke.Points); n > 0 {
+		// The pen did not move
+		last := b.stroke.Points[n-1]
+		if last.X == p.X && last.Y == p.Y && last.Pressure == p.Pressure {
+			return Stroke{}, false
+		}
+	}
+	b.stroke.Points = append(b.stroke.Points, p)
+	return Stroke{}, false
+}
+
+// Current returns the stroke being drawn, or nil if the pen is lifted. It
+// is only valid until the next event.
+func (b *Builder) Current() *Stroke {
+	return b.stroke
+}
+
+// Flush finishes the stroke being drawn, if any.
+func (b *Builder) Flush() (Stroke, bool) {
+	if b.stroke == nil {
+		return Stroke{}, false
+	}
+	s := *b.stroke
+	b.stroke = nil
+	return s, true
+}
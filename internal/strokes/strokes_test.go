@@ -0,0 +1,239 @@
+package strokes
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/goMarkableStream/internal/events"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+)
+
+// testMapping maps the digitizer range [0, 1000] to the screen
+var testMapping = inject.DeviceMapping{
+	X: inject.Axis{Code: inject.AbsX, Max: 1000},
+	Y: inject.Axis{Code: inject.AbsY, Max: 1000, Invert: true},
+}
+
+func testConfig() Config {
+	return Config{
+		Mapping:     testMapping,
+		Width:       200,
+		Height:      100,
+		DPI:         254,
+		MaxSessions: 2,
+		MaxPoints:   100,
+	}
+}
+
+// pen sends the events of a pen sample at ms milliseconds.
+type pen struct {
+	handle func(events.InputEvent)
+}
+
+func (p pen) event(typ, code uint16, value int32, ms int64) {
+	p.handle(events.InputEvent{
+		Time:  syscall.NsecToTimeval(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Add(time.Duration(ms) * time.Millisecond).UnixNano()),
+		Type:  typ,
+		Code:  code,
+		Value: value,
+	})
+}
+
+func (p pen) sample(x, y, pressure int32, ms int64) {
+	p.event(events.EvAbs, inject.AbsX, x, ms)
+	p.event(events.EvAbs, inject.AbsY, y, ms)
+	p.event(events.EvAbs, inject.AbsPressure, pressure, ms)
+	p.event(events.EvSyn, events.SynReport, 0, ms)
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(testMapping, 200, 100)
+	var got []Stroke
+	p := pen{handle: func(ev events.InputEvent) {
+		if s, ok := b.HandleEvent(ev); ok {
+			got = append(got, s)
+		}
+	}}
+	// Hovering is not drawing
+	p.sample(100, 100, 0, 0)
+	p.sample(500, 0, 4095, 10)
+	p.sample(500, 0, 4095, 20)
+	p.sample(1000, 500, 2048, 30)
+	p.sample(1000, 500, 0, 40)
+	// The eraser end comes in range
+	p.event(events.EvKey, events.BtnToolRubber, 1, 50)
+	p.sample(0, 1000, 1000, 60)
+	p.sample(0, 1000, 0, 70)
+
+	if len(got) != 2 {
+		t.Fatalf("%d strokes, want 2", len(got))
+	}
+	want := []Point{
+		{X: 100, Y: 100, Pressure: 1, T: 0},
+		{X: 200, Y: 50, Pressure: 2048.0 / 4095, T: 20},
+	}
+	if got[0].Tool != ToolPen || len(got[0].Points) != len(want) {
+		t.Fatalf("first stroke = %+v, want %v with the pen (repeated points are dropped)", got[0], want)
+	}
+	for i, p := range got[0].Points {
+		if p != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, p, want[i])
+		}
+	}
+	if got[1].Tool != ToolEraser || len(got[1].Points) != 1 || got[1].Points[0].Y != 0 {
+		t.Errorf("second stroke = %+v, want one eraser point", got[1])
+	}
+	if !got[1].Start.Equal(got[0].Start.Add(50 * time.Millisecond)) {
+		t.Errorf("second stroke started at %v, want 50ms after %v", got[1].Start, got[0].Start)
+	}
+}
+
+func TestRecorderSessions(t *testing.T) {
+	r := NewRecorder(testConfig())
+	p := pen{handle: r.HandleEvent}
+	stroke := func(points int, ms int64) {
+		for i := range points {
+			p.sample(int32(i*10), 0, 1000, ms+int64(i))
+		}
+		p.sample(0, 0, 0, ms+int64(points))
+	}
+	if _, err := r.Session("current"); err != ErrNoSession {
+		t.Errorf("current session before the first stroke: %v, want ErrNoSession", err)
+	}
+	stroke(60, 0)
+	stroke(60, 1000)
+	// The session is full
+	stroke(10, 2000)
+	sessions := r.Sessions()
+	if len(sessions) != 2 || sessions[0].Points != 120 || sessions[0].Current || !sessions[1].Current || sessions[1].Strokes != 1 {
+		t.Fatalf("sessions = %+v, want a full session and the current one", sessions)
+	}
+
+	info := r.NewSession()
+	stroke(5, 3000)
+	sessions = r.Sessions()
+	if len(sessions) != 2 || sessions[1].ID != info.ID || sessions[0].Ended.IsZero() {
+		t.Fatalf("sessions = %+v, want the oldest session dropped", sessions)
+	}
+	s, err := r.Session("current")
+	if err != nil || s.ID != info.ID || len(s.Strokes) != 1 || s.Width != 200 {
+		t.Errorf("current session = %+v, %v", s, err)
+	}
+	if _, err := r.Session("nope"); err != ErrNoSession {
+		t.Errorf("unknown session: %v, want ErrNoSession", err)
+	}
+}
+
+func testSession() Session {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return Session{
+		ID: "20240501_100000.000", Started: start, Width: 200, Height: 100, DPI: 254,
+		Strokes: []Stroke{
+			{Start: start, Tool: ToolPen, Points: []Point{
+				{X: 10, Y: 10, Pressure: 0.1}, {X: 20, Y: 10, Pressure: 0.1, T: 5}, {X: 30, Y: 20, Pressure: 0.9, T: 10},
+			}},
+			{Start: start.Add(time.Second), Tool: ToolPen, Points: []Point{{X: 50, Y: 50, Pressure: 0.5}}},
+			{Start: start.Add(2 * time.Second), Tool: ToolEraser, Points: []Point{{X: 5, Y: 5, Pressure: 0.5}}},
+		},
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	var b strings.Builder
+	if err := WriteSVG(&b, testSession()); err != nil {
+		t.Fatal(err)
+	}
+	var svg struct {
+		Width  string `xml:"width,attr"`
+		Height string `xml:"height,attr"`
+		Paths  []struct {
+			Width string `xml:"stroke-width,attr"`
+			D     string `xml:"d,attr"`
+		} `xml:"g>path"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &svg); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, b.String())
+	}
+	if svg.Width != "20.00mm" || svg.Height != "10.00mm" {
+		t.Errorf("size = %s x %s, want 20mm x 10mm", svg.Width, svg.Height)
+	}
+	// The first stroke changes width, the eraser is left out
+	want := []string{"M10.0 10.0L20.0 10.0L30.0 20.0", "M30.0 20.0l0 0", "M50.0 50.0l0 0"}
+	if len(svg.Paths) != len(want) {
+		t.Fatalf("%d paths, want %d:\n%s", len(svg.Paths), len(want), b.String())
+	}
+	for i, p := range svg.Paths {
+		if p.D != want[i] {
+			t.Errorf("path %d = %q, want %q", i, p.D, want[i])
+		}
+	}
+	if svg.Paths[0].Width != "1.5" || svg.Paths[1].Width != "4.5" {
+		t.Errorf("widths = %s, %s, want 1.5, 4.5", svg.Paths[0].Width, svg.Paths[1].Width)
+	}
+}
+
+func TestWriteInkML(t *testing.T) {
+	var b strings.Builder
+	if err := WriteInkML(&b, testSession()); err != nil {
+		t.Fatal(err)
+	}
+	var ink struct {
+		Traces []struct {
+			Brush  string `xml:"brushRef,attr"`
+			Points string `xml:",chardata"`
+		} `xml:"trace"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &ink); err != nil {
+		t.Fatalf("invalid InkML: %v\n%s", err, b.String())
+	}
+	if len(ink.Traces) != 3 || ink.Traces[2].Brush != "#eraser" {
+		t.Fatalf("traces = %+v, want 3 with the eraser last", ink.Traces)
+	}
+	if want := "1.000 1.000 0.100 0, 2.000 1.000 0.100 5, 3.000 2.000 0.900 10"; ink.Traces[0].Points != want {
+		t.Errorf("first trace = %q, want %q", ink.Traces[0].Points, want)
+	}
+	if want := "5.000 5.000 0.500 1000"; ink.Traces[1].Points != want {
+		t.Errorf("second trace = %q, want %q", ink.Traces[1].Points, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRecorder(testConfig())
+	h := NewHandler(r)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	if rec := do("GET", "/strokes/current"); rec.Code != http.StatusNotFound {
+		t.Errorf("no session: status %d, want 404", rec.Code)
+	}
+	rec := do("POST", "/strokes/new")
+	var info Info
+	if rec.Code != http.StatusCreated || json.NewDecoder(rec.Body).Decode(&info) != nil || !info.Current {
+		t.Fatalf("new session: status %d, %+v", rec.Code, info)
+	}
+	for format, contentType := range map[string]string{
+		"":      "application/json",
+		"svg":   "image/svg+xml",
+		"inkml": "application/inkml+xml",
+	} {
+		rec := do("GET", "/strokes/"+info.ID+"?format="+format)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != contentType {
+			t.Errorf("format %q: status %d, Content-Type %q", format, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+	if rec := do("GET", "/strokes/current?format=pdf"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid format: status %d, want 400", rec.Code)
+	}
+	var infos []Info
+	if rec := do("GET", "/strokes"); json.NewDecoder(rec.Body).Decode(&infos) != nil || len(infos) != 1 {
+		t.Errorf("sessions = %+v", infos)
+	}
+}
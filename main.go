@@ -18,10 +18,19 @@ import (
 
 	"github.com/kelseyhightower/envconfig"
 
+	"github.com/owulveryck/goMarkableStream/internal/actions"
 	dbg "github.com/owulveryck/goMarkableStream/internal/debug"
+	"github.com/owulveryck/goMarkableStream/internal/history"
+	"github.com/owulveryck/goMarkableStream/internal/inject"
+	"github.com/owulveryck/goMarkableStream/internal/journal"
 	"github.com/owulveryck/goMarkableStream/internal/jwtutil"
+	"github.com/owulveryck/goMarkableStream/internal/pagechange"
+	"github.com/owulveryck/goMarkableStream/internal/power"
 	"github.com/owulveryck/goMarkableStream/internal/pubsub"
+	"github.com/owulveryck/goMarkableStream/internal/recording"
 	"github.com/owulveryck/goMarkableStream/internal/remarkable"
+	"github.com/owulveryck/goMarkableStream/internal/stream"
+	"github.com/owulveryck/goMarkableStream/internal/strokes"
 	"github.com/owulveryck/goMarkableStream/internal/tlsutil"
 	"github.com/owulveryck/goMarkableStream/internal/trace"
 )
@@ -33,8 +42,52 @@ type configuration struct {
 	TLS            bool    `envconfig:"HTTPS" default:"true"`
 	DevMode        bool    `envconfig:"DEV_MODE" default:"false"`
 	DeltaThreshold float64 `envconfig:"DELTA_THRESHOLD" default:"0.30" description:"Change ratio threshold (0.0-1.0) above which full frame is sent"`
+	DeltaWorkers   int     `envconfig:"DELTA_WORKERS" default:"0" description:"Goroutines comparing the frames in parallel stripes (0 = one per core, 1 = sequential)"`
 	Debug          bool    `envconfig:"DEBUG" default:"false" description:"Enable debug logging"`
 
+	// Framebuffer configuration
+	FramebufferSource string        `envconfig:"FRAMEBUFFER_SOURCE" default:"process" description:"Where to read the framebuffer: process (named in PROCESS_NAMES), display (process mapping the display), rm2fb or auto"`
+	RM2FBPath         string        `envconfig:"RM2FB_PATH" default:"/dev/shm/swtfb.01" description:"Shared memory segment of the rm2fb display server"`
+	ProcessNames      []string      `envconfig:"PROCESS_NAMES" default:"xochitl" description:"Names of the processes holding the framebuffer, in order of preference (comma-separated)"`
+	ProcessWait       time.Duration `envconfig:"PROCESS_WAIT" default:"30s" description:"How long to wait at startup for the process holding the framebuffer"`
+	FramebufferCheck  string        `envconfig:"FRAMEBUFFER_CHECK" default:"warn" description:"Validation of the framebuffer address: off, warn (fall back to alternative addresses) or strict (refuse to start on implausible data)"`
+	ProcessVMReadv    bool          `envconfig:"PROCESS_VM_READV" default:"true" description:"Read the memory of the display process with process_vm_readv, falling back to /proc/<pid>/mem if denied"`
+	PartialReads      bool          `envconfig:"PARTIAL_READS" default:"true" description:"While drawing, read only the rows around the pen, and the whole framebuffer every second"`
+
+	// History configuration
+	HistoryMinutes int `envconfig:"HISTORY_MINUTES" default:"10" description:"Minutes of screen history kept for the viewers to rewind (0 = disabled)"`
+	HistoryMB      int `envconfig:"HISTORY_MB" default:"32" description:"Maximum memory used by the history in MB"`
+
+	// Journal configuration
+	JournalEnabled   bool   `envconfig:"JOURNAL_ENABLED" default:"false" description:"Write a timelapse of the pen activity to disk, exported with the export subcommand"`
+	JournalDir       string `envconfig:"JOURNAL_DIR" default:"/home/root/journal" description:"Directory for the journal segments"`
+	JournalSegmentMB int    `envconfig:"JOURNAL_SEGMENT_MB" default:"8" description:"Max journal segment size in MB before rotation"`
+	JournalMaxFiles  int    `envconfig:"JOURNAL_MAX_FILES" default:"24" description:"Maximum number of journal segments to keep"`
+
+	// Input recording configuration
+	EventRecord      string  `envconfig:"EVENT_RECORD" default:"" description:"Record all input events to this file"`
+	EventReplay      string  `envconfig:"EVENT_REPLAY" default:"" description:"Replay the input events recorded in this file instead of reading the input devices"`
+	EventReplaySpeed float64 `envconfig:"EVENT_REPLAY_SPEED" default:"1.0" description:"Replay speed factor (0 = no delay between events)"`
+	EventReplayLoop  bool    `envconfig:"EVENT_REPLAY_LOOP" default:"false" description:"Restart the replay when the end of the recording is reached"`
+
+	// Gesture bindings configuration
+	GestureBindings string `envconfig:"GESTURE_BINDINGS" default:"" description:"Path to a JSON file binding touch gestures to server-side actions"`
+
+	// Capture session configuration
+	CaptureDir    string `envconfig:"CAPTURE_DIR" default:"/home/root/captures" description:"Directory where the capture sessions save their PDF"`
+	PageDetection bool   `envconfig:"PAGE_DETECTION" default:"false" description:"Detect the page turns, sent as page-changed events on /events"`
+
+	// Stroke capture configuration
+	Strokes        bool `envconfig:"STROKES" default:"false" description:"Record the pen strokes as vectors, exported on /strokes"`
+	StrokeSessions int  `envconfig:"STROKE_SESSIONS" default:"8" description:"Number of stroke sessions kept in memory"`
+
+	// Keyboard configuration
+	KeystrokeFeed bool `envconfig:"KEYSTROKE_FEED" default:"false" description:"Stream the keys typed on the keyboard on /keys"`
+
+	// Remote input configuration
+	InputInjection bool    `envconfig:"INPUT_INJECTION" default:"false" description:"Allow admins to send taps, swipes and pen strokes to the tablet"`
+	InputRateLimit float64 `envconfig:"INPUT_RATE_LIMIT" default:"10" description:"Maximum number of injected gestures per second (0 = unlimited)"`
+
 	// TLS certificate configuration
 	TLSCertFile     string `envconfig:"TLS_CERT_FILE" default:"" description:"Path to custom TLS certificate file"`
 	TLSKeyFile      string `envconfig:"TLS_KEY_FILE" default:"" description:"Path to custom TLS key file"`
@@ -91,6 +144,19 @@ var (
 )
 
 func validateConfiguration(c *configuration) error {
+	switch remarkable.Source(c.FramebufferSource) {
+	case remarkable.SourceAuto, remarkable.SourceProcess, remarkable.SourceDisplay, remarkable.SourceRM2FB:
+	default:
+		return fmt.Errorf("invalid framebuffer source %q: must be auto, process, display or rm2fb", c.FramebufferSource)
+	}
+	switch remarkable.PointerCheck(c.FramebufferCheck) {
+	case remarkable.PointerCheckOff, remarkable.PointerCheckWarn, remarkable.PointerCheckStrict:
+	default:
+		return fmt.Errorf("invalid framebuffer check %q: must be off, warn or strict", c.FramebufferCheck)
+	}
+	if c.ProcessWait < 0 {
+		return fmt.Errorf("invalid process wait %v: must not be negative", c.ProcessWait)
+	}
 	return nil
 }
 
@@ -120,6 +186,11 @@ func main() {
 				log.Fatal(err)
 			}
 			return
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		}
 	}
 
@@ -194,6 +265,12 @@ func main() {
 		}
 	}
 
+	remarkable.FramebufferSource = remarkable.Source(c.FramebufferSource)
+	remarkable.RM2FBPath = c.RM2FBPath
+	remarkable.FramebufferCheck = remarkable.PointerCheck(c.FramebufferCheck)
+	remarkable.UseProcessVMReadv = c.ProcessVMReadv
+	remarkable.ProcessNames = c.ProcessNames
+	remarkable.ProcessWait = c.ProcessWait
 	file, pointerAddr, err = remarkable.GetFileAndPointer()
 	if err != nil {
 		log.Fatal(err)
@@ -220,14 +297,99 @@ func main() {
 	}
 
 	eventPublisher := pubsub.NewPubSub()
-	eventScanner := remarkable.NewEventScanner()
+	if c.EventRecord != "" {
+		recorder, err := recording.CreateRecorder(c.EventRecord)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorder.Start(ctx, eventPublisher)
+		log.Printf("Recording input events to %s", c.EventRecord)
+	}
+	var eventScanner remarkable.InputSource
+	if c.EventReplay != "" {
+		eventScanner, err = recording.OpenReplayScanner(c.EventReplay, c.EventReplaySpeed, c.EventReplayLoop)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Replaying input events from %s (speed %.1fx)", c.EventReplay, c.EventReplaySpeed)
+	} else {
+		eventScanner = remarkable.NewEventScanner()
+	}
 	eventScanner.StartAndPublish(ctx, eventPublisher)
 
+	powerMonitor := power.NewMonitor(power.DefaultConfig(), eventPublisher.Bus())
+	powerMonitor.Start(ctx, eventPublisher)
+
+	if c.JournalEnabled {
+		journalConfig := journal.DefaultConfig()
+		journalConfig.Dir = c.JournalDir
+		journalConfig.MaxSegmentBytes = c.JournalSegmentMB << 20
+		journalConfig.MaxFiles = c.JournalMaxFiles
+		journal.New(journalConfig, file, pointerAddr, journal.Geometry{
+			Width:         remarkable.Config.Width,
+			Height:        remarkable.Config.Height,
+			BytesPerPixel: remarkable.Config.BytesPerPixel,
+		}).Start(ctx, eventPublisher)
+		log.Printf("Writing the journal to %s", c.JournalDir)
+	}
+
+	var pageDetector *pagechange.Detector
+	if c.PageDetection {
+		pageDetector = pagechange.NewDetector(stream.NewScreenshotHandler(file, pointerAddr), pagechange.DefaultConfig(), eventPublisher.Bus())
+		pageDetector.SetPowerMonitor(powerMonitor)
+		pageDetector.Start(ctx, eventPublisher)
+	}
+
+	// The history is recorded whether a viewer is connected or not
+	var frameHistory *history.Buffer
+	if c.HistoryMinutes > 0 && c.HistoryMB > 0 {
+		historyConfig := history.DefaultConfig(remarkable.Config.SizeBytes)
+		historyConfig.MaxAge = time.Duration(c.HistoryMinutes) * time.Minute
+		historyConfig.MaxBytes = c.HistoryMB << 20
+		frameHistory = history.NewBuffer(historyConfig)
+		history.NewRecorder(frameHistory, file, pointerAddr).Start(ctx, eventPublisher)
+	}
+
+	var strokeRecorder *strokes.Recorder
+	if c.Strokes {
+		strokeConfig := strokes.DefaultConfig()
+		strokeConfig.MaxSessions = c.StrokeSessions
+		strokeRecorder = strokes.NewRecorder(strokeConfig)
+		strokeRecorder.Start(ctx, eventPublisher)
+	}
+
+	// Server-side gesture bindings work without any browser connected
+	viewers := actions.NewViewers()
+	if c.GestureBindings != "" {
+		bindings, err := actions.LoadBindings(c.GestureBindings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		engine := actions.NewEngine(bindings, actions.Environment{
+			Screenshot:  stream.NewScreenshotHandler(file, pointerAddr).WritePNG,
+			TogglePause: stream.TogglePause,
+			Viewers:     viewers,
+		})
+		engine.Start(ctx, eventPublisher)
+		log.Printf("Loaded %d gesture bindings from %s", len(bindings), c.GestureBindings)
+	}
+
+	var injector *inject.Injector
+	if c.InputInjection {
+		backend, err := inject.NewEvdevBackend(remarkable.PenInputDevice, remarkable.TouchInputDevice)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer backend.Close()
+		injector = inject.NewInjector(backend, inject.DefaultMapping())
+		log.Println("Remote input injection enabled")
+	}
+
 	// Channel to signal Tailscale listener restart
 	restartCh := make(chan bool, 1)
 
 	// Pass TailscaleManager and restart channel to setMuxer
-	mux := setMuxer(eventPublisher, listenerResult.TailscaleManager, restartCh, jwtMgr)
+	mux := setMuxer(eventPublisher, viewers, injector, powerMonitor, pageDetector, frameHistory, strokeRecorder, listenerResult.TailscaleManager, restartCh, jwtMgr)
 
 	var handler http.Handler
 	handler = AuthMiddleware(mux, jwtMgr)